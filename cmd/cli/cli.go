@@ -7,6 +7,7 @@ import (
 	"net/rpc"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -31,8 +32,16 @@ type RPCReply struct {
 }
 
 type JobSubmitArgs struct {
-	InputFiles []string
-	NReduce    int
+	InputFiles   []string
+	NReduce      int
+	App          string
+	Params       map[string]string
+	SplitMB      int
+	Partitioner  string
+	CacheFiles   []string
+	InputFormat  string
+	OutputFormat string
+	OutputDir    string
 }
 
 type JobSubmitReply struct {
@@ -40,6 +49,51 @@ type JobSubmitReply struct {
 	Status string
 }
 
+// JobDetailsReply dettagli di un job restituiti da Master.GetJob (sottoinsieme dei campi)
+type JobDetailsReply struct {
+	ID           string
+	Status       string
+	Phase        string
+	StartTime    time.Time
+	EndTime      *time.Time
+	Progress     float64
+	App          string
+	InputFormat  string
+	OutputFormat string
+	OutputDir    string
+	Partitioner  string
+	InputFiles   []string
+	MapTasks     JobTaskCounts
+	ReduceTasks  JobTaskCounts
+	MaxAttempts  int
+	Counters     JobCounters
+	Error        string
+}
+
+type JobTaskCounts struct {
+	Total      int
+	Completed  int
+	InProgress int
+	Failed     int
+}
+
+type JobCounters struct {
+	InputRecords         int64
+	MalformedRecords     int64
+	RecordsBeforeCombine int64
+	RecordsAfterCombine  int64
+	User                 map[string]int64
+}
+
+type JobControlArgs struct {
+	JobID string
+}
+
+type JobControlReply struct {
+	JobID  string
+	Status string
+}
+
 type IsLeaderArgs struct{}
 type IsLeaderReply struct {
 	IsLeader bool   `json:"is_leader"`
@@ -108,8 +162,15 @@ func (cli *CLICommands) createJobCommands() *cobra.Command {
 		Run:   cli.submitJob,
 	}
 	submitCmd.Flags().StringP("config", "c", "", "Configuration file")
-	submitCmd.Flags().StringP("output", "o", "", "Output directory")
+	submitCmd.Flags().StringP("output", "o", "", "Output directory or S3 prefix (s3://bucket/out/)")
 	submitCmd.Flags().IntP("reducers", "r", 10, "Number of reducers")
+	submitCmd.Flags().StringP("app", "a", "wordcount", "Application (wordcount, grep, invertedindex, sort, fieldcount, streaming)")
+	submitCmd.Flags().StringToStringP("param", "p", nil, "Application parameter (key=value), repeatable")
+	submitCmd.Flags().Int("split-mb", 0, "Input split size in MB (0 = master default)")
+	submitCmd.Flags().StringSlice("cache-file", nil, "Side file shipped to every worker (master path or s3://bucket/key), repeatable")
+	submitCmd.Flags().String("partitioner", "hash", "Intermediate key partitioner (hash, range = globally sorted output)")
+	submitCmd.Flags().String("input-format", "", "Input record format (lines, jsonl, csv); empty = detected from file extension")
+	submitCmd.Flags().String("output-format", "", "Reduce output format (text, tsv, jsonl, csv); empty = master default")
 	jobCmd.AddCommand(submitCmd)
 
 	// List jobs
@@ -129,6 +190,7 @@ func (cli *CLICommands) createJobCommands() *cobra.Command {
 		Args:  cobra.ExactArgs(1),
 		Run:   cli.getJob,
 	}
+	getCmd.Flags().StringP("format", "f", "table", "Output format (table, json)")
 	jobCmd.AddCommand(getCmd)
 
 	// Cancel job
@@ -140,6 +202,24 @@ func (cli *CLICommands) createJobCommands() *cobra.Command {
 	}
 	jobCmd.AddCommand(cancelCmd)
 
+	// Pause job
+	pauseCmd := &cobra.Command{
+		Use:   "pause [job-id]",
+		Short: "Pause a running job",
+		Args:  cobra.ExactArgs(1),
+		Run:   cli.pauseJob,
+	}
+	jobCmd.AddCommand(pauseCmd)
+
+	// Resume job
+	resumeCmd := &cobra.Command{
+		Use:   "resume [job-id]",
+		Short: "Resume a paused job",
+		Args:  cobra.ExactArgs(1),
+		Run:   cli.resumeJob,
+	}
+	jobCmd.AddCommand(resumeCmd)
+
 	return jobCmd
 }
 
@@ -351,39 +431,56 @@ func (cli *CLICommands) submitJob(cmd *cobra.Command, args []string) {
 	configFile, _ := cmd.Flags().GetString("config")
 	outputDir, _ := cmd.Flags().GetString("output")
 	reducers, _ := cmd.Flags().GetInt("reducers")
+	app, _ := cmd.Flags().GetString("app")
+	params, _ := cmd.Flags().GetStringToString("param")
+	splitMB, _ := cmd.Flags().GetInt("split-mb")
+	partitioner, _ := cmd.Flags().GetString("partitioner")
+	cacheFiles, _ := cmd.Flags().GetStringSlice("cache-file")
+	inputFormat, _ := cmd.Flags().GetString("input-format")
+	outputFormat, _ := cmd.Flags().GetString("output-format")
 
 	fmt.Println("MAPREDUCE CLIENT")
 	fmt.Println("==================")
 
-	// Verifica che il file esista
-	if _, err := os.Stat(jobFile); os.IsNotExist(err) {
-		fmt.Printf(" File non trovato: %s\n", jobFile)
-		return
-	}
+	// Un input su S3 (anche un pattern s3://bucket/in/*) viene letto direttamente dai worker
+	remote := strings.HasPrefix(jobFile, "s3://")
+	if remote {
+		fmt.Printf("File: %s\n", jobFile)
+	} else {
+		// Verifica che il file esista
+		if _, err := os.Stat(jobFile); os.IsNotExist(err) {
+			fmt.Printf(" File non trovato: %s\n", jobFile)
+			return
+		}
 
-	// Leggi e analizza il file
-	file, err := os.Open(jobFile)
-	if err != nil {
-		fmt.Printf(" Errore apertura file: %v\n", err)
-		return
-	}
-	defer file.Close()
+		// Leggi e analizza il file
+		file, err := os.Open(jobFile)
+		if err != nil {
+			fmt.Printf(" Errore apertura file: %v\n", err)
+			return
+		}
+		defer file.Close()
+
+		// Conta le parole
+		scanner := bufio.NewScanner(file)
+		wordCount := 0
+		lines := []string{}
+		for scanner.Scan() {
+			line := scanner.Text()
+			lines = append(lines, line)
+			words := strings.Fields(line)
+			wordCount += len(words)
+		}
 
-	// Conta le parole
-	scanner := bufio.NewScanner(file)
-	wordCount := 0
-	lines := []string{}
-	for scanner.Scan() {
-		line := scanner.Text()
-		lines = append(lines, line)
-		words := strings.Fields(line)
-		wordCount += len(words)
+		fmt.Printf("File: %s\n", jobFile)
+		fmt.Printf("Parole: %d\n", wordCount)
+		fmt.Printf("Righe: %d\n", len(lines))
 	}
-
-	fmt.Printf("File: %s\n", jobFile)
-	fmt.Printf("Parole: %d\n", wordCount)
-	fmt.Printf("Righe: %d\n", len(lines))
 	fmt.Printf("Reducer: %d\n", reducers)
+	fmt.Printf("Applicazione: %s\n", app)
+	for k, v := range params {
+		fmt.Printf("  %s=%s\n", k, v)
+	}
 
 	if configFile != "" {
 		fmt.Printf("⚙️  Config: %s\n", configFile)
@@ -445,10 +542,21 @@ func (cli *CLICommands) submitJob(cmd *cobra.Command, args []string) {
 
 	// Converti il percorso del file per il container
 	containerFile := "/root/data/" + filepath.Base(jobFile)
+	if remote {
+		containerFile = jobFile
+	}
 
 	jobArgs := JobSubmitArgs{
-		InputFiles: []string{containerFile},
-		NReduce:    reducers,
+		InputFiles:   []string{containerFile},
+		NReduce:      reducers,
+		App:          app,
+		Params:       params,
+		SplitMB:      splitMB,
+		Partitioner:  partitioner,
+		CacheFiles:   cacheFiles,
+		InputFormat:  inputFormat,
+		OutputFormat: outputFormat,
+		OutputDir:    outputDir,
 	}
 
 	var jobReply JobSubmitReply
@@ -507,69 +615,49 @@ func (cli *CLICommands) submitJob(cmd *cobra.Command, args []string) {
 			lastLeaderCheck = time.Now()
 		}
 
-		// Controlla se ci sono file di output
-		outputFiles := []string{}
-		for i := 0; i < reducers; i++ {
-			outputFiles = append(outputFiles, fmt.Sprintf("mr-out-%d", i))
-		}
-
-		allOutputsExist := true
-		for _, file := range outputFiles {
-			if _, err := os.Stat(file); os.IsNotExist(err) {
-				allOutputsExist = false
-				break
-			}
-		}
-
-		if allOutputsExist {
-			fmt.Println("✅ Job completato! File di output generati.")
-			break
+		// Lo stato del job lo decide il master: i file di output possono stare su un altro
+		// host o su S3, quindi non sono un indicatore affidabile del completamento
+		var job JobDetailsReply
+		if err := client.Call("Master.GetJob", &JobControlArgs{JobID: jobReply.JobID}, &job); err != nil {
+			fmt.Printf("Errore lettura stato del job: %v\n", err)
+			// Forza la verifica del leader al prossimo giro
+			lastLeaderCheck = time.Time{}
+		} else if isTerminalJobStatus(job.Status) {
+			printJobOutcome(&job)
+			return
 		}
 
 		time.Sleep(2 * time.Second)
 		fmt.Printf("Job in corso... (elapsed: %v)\n", time.Since(start).Round(time.Second))
 	}
 
-	// Controlla risultati finali
-	fmt.Println("\n Controllo risultati finali...")
-	outputFiles := []string{}
-	for i := 0; i < reducers; i++ {
-		outputFiles = append(outputFiles, fmt.Sprintf("mr-out-%d", i))
-	}
-
-	foundOutput := false
-	for _, file := range outputFiles {
-		if _, err := os.Stat(file); err == nil {
-			fmt.Printf("File output trovato: %s\n", file)
-			foundOutput = true
-
-			// Mostra contenuto
-			f, err := os.Open(file)
-			if err == nil {
-				fmt.Printf("Contenuto di %s:\n", file)
-				fmt.Println(strings.Repeat("-", 40))
-				scanner := bufio.NewScanner(f)
-				lineCount := 0
-				for scanner.Scan() && lineCount < 5 {
-					fmt.Println(scanner.Text())
-					lineCount++
-				}
-				if lineCount >= 5 {
-					fmt.Println("... (altre righe omesse)")
-				}
-				fmt.Println(strings.Repeat("-", 40))
-				f.Close()
-			}
-		}
-	}
+	fmt.Printf("Job %s non terminato entro %v: controlla lo stato con 'job get %s'\n", jobReply.JobID, timeout, jobReply.JobID)
+}
 
-	if !foundOutput {
-		fmt.Println("Nessun file di output trovato dopo il timeout")
-		fmt.Println("Il job potrebbe essere ancora in corso o aver fallito")
-	}
+// isTerminalJobStatus indica se lo stato riportato dal master è definitivo
+func isTerminalJobStatus(status string) bool {
+	return status == "completed" || status == "failed" || status == "canceled"
+}
 
-	fmt.Println("\nJOB MAPREDUCE COMPLETATO!")
-	fmt.Println("Il cluster ha processato il file con successo.")
+// printJobOutcome stampa l'esito di un job terminato
+func printJobOutcome(job *JobDetailsReply) {
+	switch job.Status {
+	case "completed":
+		fmt.Printf("✅ Job %s completato\n", job.ID)
+	case "canceled":
+		fmt.Printf("Job %s cancellato\n", job.ID)
+	default:
+		fmt.Printf("❌ Job %s fallito\n", job.ID)
+	}
+	if job.EndTime != nil {
+		fmt.Printf("%-14s %s\n", "Finished:", job.EndTime.Format("2006-01-02 15:04:05"))
+	}
+	if job.OutputDir != "" {
+		fmt.Printf("%-14s %s\n", "Output dir:", job.OutputDir)
+	}
+	if job.Error != "" {
+		fmt.Printf("%-14s %s\n", "Error:", job.Error)
+	}
 }
 
 func (cli *CLICommands) listJobs(cmd *cobra.Command, args []string) {
@@ -621,28 +709,91 @@ func (cli *CLICommands) listJobs(cmd *cobra.Command, args []string) {
 }
 
 func (cli *CLICommands) getJob(cmd *cobra.Command, args []string) {
-	jobID := args[0]
+	format, _ := cmd.Flags().GetString("format")
+
+	client, _, err := cli.connectToLeader()
+	if err != nil {
+		fmt.Printf("Errore connessione al leader: %v\n", err)
+		os.Exit(1)
+	}
+	defer client.Close()
 
-	// Simulazione dettagli job
-	job := map[string]interface{}{
-		"id":              jobID,
-		"status":          "running",
-		"phase":           "map",
-		"started":         time.Now().Add(-5 * time.Minute),
-		"progress":        75.5,
-		"map_tasks":       10,
-		"reduce_tasks":    5,
-		"completed_tasks": 7,
-		"failed_tasks":    0,
+	var job JobDetailsReply
+	if err := client.Call("Master.GetJob", &JobControlArgs{JobID: args[0]}, &job); err != nil {
+		fmt.Printf("Errore: %v\n", err)
+		os.Exit(1)
 	}
 
-	json.NewEncoder(os.Stdout).Encode(job)
+	if format == "json" {
+		json.NewEncoder(os.Stdout).Encode(job)
+		return
+	}
+
+	fmt.Printf("%-14s %s\n", "ID:", job.ID)
+	fmt.Printf("%-14s %s (%s)\n", "Status:", job.Status, job.Phase)
+	fmt.Printf("%-14s %s\n", "App:", job.App)
+	fmt.Printf("%-14s %s\n", "Input format:", job.InputFormat)
+	fmt.Printf("%-14s %s\n", "Output format:", job.OutputFormat)
+	if job.OutputDir != "" {
+		fmt.Printf("%-14s %s\n", "Output dir:", job.OutputDir)
+	}
+	fmt.Printf("%-14s %s\n", "Partitioner:", job.Partitioner)
+	fmt.Printf("%-14s %s\n", "Started:", job.StartTime.Format("2006-01-02 15:04:05"))
+	if job.EndTime != nil {
+		fmt.Printf("%-14s %s\n", "Finished:", job.EndTime.Format("2006-01-02 15:04:05"))
+	}
+	fmt.Printf("%-14s %.1f%%\n", "Progress:", job.Progress)
+	fmt.Printf("%-14s %d/%d completed, %d failed\n", "Map tasks:", job.MapTasks.Completed, job.MapTasks.Total, job.MapTasks.Failed)
+	fmt.Printf("%-14s %d/%d completed, %d failed\n", "Reduce tasks:", job.ReduceTasks.Completed, job.ReduceTasks.Total, job.ReduceTasks.Failed)
+	fmt.Printf("%-14s %d records, %d malformed\n", "Input:", job.Counters.InputRecords, job.Counters.MalformedRecords)
+	fmt.Printf("%-14s %d before combine, %d after combine\n", "Records:", job.Counters.RecordsBeforeCombine, job.Counters.RecordsAfterCombine)
+	if job.Error != "" {
+		fmt.Printf("%-14s %s\n", "Error:", job.Error)
+	}
+
+	if len(job.Counters.User) > 0 {
+		names := make([]string, 0, len(job.Counters.User))
+		for name := range job.Counters.User {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Println("\nUser counters:")
+		for _, name := range names {
+			fmt.Printf("  %-30s %d\n", name, job.Counters.User[name])
+		}
+	}
 }
 
 func (cli *CLICommands) cancelJob(cmd *cobra.Command, args []string) {
-	jobID := args[0]
-	fmt.Printf("Cancelling job: %s\n", jobID)
-	fmt.Println("Job cancelled successfully!")
+	fmt.Printf("Cancelling job: %s\n", args[0])
+	cli.controlJob("Master.CancelJob", args[0], "cancelled")
+}
+
+func (cli *CLICommands) pauseJob(cmd *cobra.Command, args []string) {
+	fmt.Printf("Pausing job: %s\n", args[0])
+	cli.controlJob("Master.PauseJob", args[0], "paused")
+}
+
+func (cli *CLICommands) resumeJob(cmd *cobra.Command, args []string) {
+	fmt.Printf("Resuming job: %s\n", args[0])
+	cli.controlJob("Master.ResumeJob", args[0], "resumed")
+}
+
+// controlJob invia al leader un comando di controllo sul job
+func (cli *CLICommands) controlJob(method, jobID, action string) {
+	client, _, err := cli.connectToLeader()
+	if err != nil {
+		fmt.Printf("Errore connessione al leader: %v\n", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	var reply JobControlReply
+	if err := client.Call(method, &JobControlArgs{JobID: jobID}, &reply); err != nil {
+		fmt.Printf("Errore: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Job %s %s successfully! (status: %s)\n", reply.JobID, action, reply.Status)
 }
 
 func (cli *CLICommands) showStatus(cmd *cobra.Command, args []string) {
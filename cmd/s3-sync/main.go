@@ -1,26 +1,93 @@
 package main
 
 import (
+	"crypto/md5"
+	"encoding/hex"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// Metriche della sincronizzazione, esposte su -metrics-addr
+var (
+	syncFiles = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mapreduce_s3_sync_files_total",
+			Help: "Files handled by S3 directory sync (uploaded, skipped, deleted, failed)",
+		},
+		[]string{"result"},
+	)
+
+	syncBytes = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mapreduce_s3_sync_bytes_total",
+			Help: "Bytes uploaded by S3 directory sync and bytes skipped because unchanged",
+		},
+		[]string{"result"},
+	)
+)
+
+// recordSync aggiorna le metriche con il risultato di una sincronizzazione
+func recordSync(stats syncStats) {
+	syncFiles.WithLabelValues("uploaded").Add(float64(stats.uploaded))
+	syncFiles.WithLabelValues("skipped").Add(float64(stats.skipped))
+	syncFiles.WithLabelValues("deleted").Add(float64(stats.deleted))
+	syncFiles.WithLabelValues("failed").Add(float64(stats.failed))
+	syncBytes.WithLabelValues("uploaded").Add(float64(stats.bytesUploaded))
+	syncBytes.WithLabelValues("skipped").Add(float64(stats.bytesSkipped))
+}
+
 type S3SyncConfig struct {
 	Bucket     string
 	Region     string
 	LocalPath  string
 	Interval   time.Duration
 	BackupMode bool
+
+	// Server compatibile S3: endpoint, URL path-style, credenziali statiche e HTTP senza TLS
+	Endpoint        string
+	ForcePathStyle  bool
+	AccessKeyID     string
+	SecretAccessKey string
+	DisableSSL      bool
+
+	// Upload in parallelo, rimozione dei file eliminati in locale e indirizzo delle metriche
+	Workers     int
+	Delete      bool
+	MetricsAddr string
+}
+
+// awsConfig restituisce la configurazione della sessione AWS
+func (c S3SyncConfig) awsConfig() *aws.Config {
+	config := &aws.Config{
+		Region:           aws.String(c.Region),
+		S3ForcePathStyle: aws.Bool(c.ForcePathStyle),
+		DisableSSL:       aws.Bool(c.DisableSSL),
+	}
+	if c.Endpoint != "" {
+		config.Endpoint = aws.String(c.Endpoint)
+	}
+	if c.AccessKeyID != "" {
+		config.Credentials = credentials.NewStaticCredentials(c.AccessKeyID, c.SecretAccessKey, os.Getenv("S3_SESSION_TOKEN"))
+	}
+	return config
 }
 
 func main() {
@@ -31,11 +98,22 @@ func main() {
 	flag.StringVar(&config.LocalPath, "path", "/tmp/mapreduce", "Local path to sync")
 	flag.DurationVar(&config.Interval, "interval", 60*time.Second, "Sync interval")
 	flag.BoolVar(&config.BackupMode, "backup", false, "Enable backup mode")
+	flag.StringVar(&config.Endpoint, "endpoint", os.Getenv("S3_ENDPOINT"), "S3-compatible endpoint URL (empty = AWS)")
+	flag.BoolVar(&config.ForcePathStyle, "path-style", os.Getenv("S3_FORCE_PATH_STYLE") == "true", "Use path-style addressing (endpoint/bucket/key)")
+	flag.StringVar(&config.AccessKeyID, "access-key", os.Getenv("S3_ACCESS_KEY_ID"), "Static access key ID (empty = default AWS credential chain)")
+	flag.StringVar(&config.SecretAccessKey, "secret-key", os.Getenv("S3_SECRET_ACCESS_KEY"), "Static secret access key")
+	flag.BoolVar(&config.DisableSSL, "disable-ssl", os.Getenv("S3_DISABLE_SSL") == "true", "Use plain HTTP instead of HTTPS")
+	flag.IntVar(&config.Workers, "workers", envInt("S3_SYNC_WORKERS", 4), "Maximum parallel uploads")
+	flag.BoolVar(&config.Delete, "delete", os.Getenv("S3_SYNC_DELETE") == "true", "Delete remote files removed locally")
+	flag.StringVar(&config.MetricsAddr, "metrics-addr", "", "Address serving Prometheus metrics on /metrics (empty = disabled)")
 	flag.Parse()
 
 	if config.Bucket == "" {
 		log.Fatal("S3 bucket not specified")
 	}
+	if config.AccessKeyID != "" && config.SecretAccessKey == "" {
+		log.Fatal("S3 secret key not specified for the static access key")
+	}
 
 	if config.Region == "" {
 		config.Region = "us-east-1"
@@ -47,11 +125,13 @@ func main() {
 	fmt.Printf("Local Path: %s\n", config.LocalPath)
 	fmt.Printf("Interval: %v\n", config.Interval)
 	fmt.Printf("Backup Mode: %v\n", config.BackupMode)
+	fmt.Printf("Workers: %d, Delete: %v\n", config.Workers, config.Delete)
+	if config.Endpoint != "" {
+		fmt.Printf("Endpoint: %s (path-style: %v, TLS: %v)\n", config.Endpoint, config.ForcePathStyle, !config.DisableSSL)
+	}
 
 	// Crea sessione AWS
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(config.Region),
-	})
+	sess, err := session.NewSession(config.awsConfig())
 	if err != nil {
 		log.Fatalf("Failed to create AWS session: %v", err)
 	}
@@ -60,6 +140,15 @@ func main() {
 	uploader := s3manager.NewUploader(sess)
 	downloader := s3manager.NewDownloader(sess)
 
+	if config.MetricsAddr != "" {
+		http.Handle("/metrics", promhttp.Handler())
+		go func() {
+			if err := http.ListenAndServe(config.MetricsAddr, nil); err != nil {
+				log.Printf("Metrics server failed: %v", err)
+			}
+		}()
+	}
+
 	syncService := &S3SyncService{
 		config:     config,
 		s3Client:   s3Client,
@@ -145,16 +234,86 @@ func (s *S3SyncService) syncDirectory(localSubDir, s3Prefix string) error {
 	return s.syncDirectoryWithPrefix(localSubDir, s3Prefix)
 }
 
+// syncStats riepiloga una sincronizzazione
+type syncStats struct {
+	uploaded, skipped, deleted, failed int
+	bytesUploaded, bytesSkipped        int64
+}
+
+// remoteObject è un oggetto già presente sotto il prefisso sincronizzato
+type remoteObject struct {
+	size int64
+	etag string
+}
+
+// md5Metadata è il metadato (x-amz-meta-md5) con l'MD5 del file caricato: l'ETag degli
+// upload multipart non è l'MD5 del contenuto
+const md5Metadata = "Md5"
+
+// syncDirectoryWithPrefix carica solo i file nuovi o modificati (dimensione e MD5 confrontati
+// con ETag o metadato), con al più config.Workers upload in parallelo; con config.Delete
+// rimuove gli oggetti dei file eliminati in locale, solo se la directory è stata letta per intero
 func (s *S3SyncService) syncDirectoryWithPrefix(localSubDir, s3Prefix string) error {
 	localPath := filepath.Join(s.config.LocalPath, localSubDir)
-	
+
 	// Verifica se la directory locale esiste
 	if _, err := os.Stat(localPath); os.IsNotExist(err) {
 		fmt.Printf("Directory %s does not exist, skipping\n", localPath)
 		return nil
 	}
 
-	return filepath.Walk(localPath, func(path string, info os.FileInfo, err error) error {
+	// Le chiavi sono relative a config.LocalPath: il prefisso elencato copre solo questa sottodirectory
+	listPrefix := s3Prefix
+	if localSubDir != "" {
+		listPrefix += filepath.ToSlash(localSubDir) + "/"
+	}
+	remote, err := s.listRemoteObjects(listPrefix)
+	if err != nil {
+		return err
+	}
+
+	type item struct {
+		path, key string
+		size      int64
+	}
+	items := make(chan item)
+	var (
+		mu       sync.Mutex
+		stats    syncStats
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	workers := s.config.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for it := range items {
+				uploaded, err := s.syncFile(it.path, it.key, it.size, remote[it.key])
+				mu.Lock()
+				switch {
+				case err != nil:
+					stats.failed++
+					if firstErr == nil {
+						firstErr = err
+					}
+				case uploaded:
+					stats.uploaded++
+					stats.bytesUploaded += it.size
+				default:
+					stats.skipped++
+					stats.bytesSkipped += it.size
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	local := make(map[string]bool)
+	walkErr := filepath.Walk(localPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -171,27 +330,122 @@ func (s *S3SyncService) syncDirectoryWithPrefix(localSubDir, s3Prefix string) er
 
 		// Crea la chiave S3
 		s3Key := s3Prefix + strings.ReplaceAll(relPath, "\\", "/")
+		local[s3Key] = true
+		items <- item{path: path, key: s3Key, size: info.Size()}
+		return nil
+	})
+	close(items)
+	wg.Wait()
+
+	if walkErr != nil {
+		firstErr = walkErr
+	} else if s.config.Delete && listPrefix != "" {
+		for key := range remote {
+			if local[key] {
+				continue
+			}
+			if _, err := s.s3Client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String(s.config.Bucket), Key: aws.String(key)}); err != nil {
+				stats.failed++
+				if firstErr == nil {
+					firstErr = fmt.Errorf("failed to delete %s: %v", key, err)
+				}
+				continue
+			}
+			stats.deleted++
+			fmt.Printf("Deleted: s3://%s/%s\n", s.config.Bucket, key)
+		}
+	}
 
-		// Upload del file
-		file, err := os.Open(path)
+	recordSync(stats)
+	fmt.Printf("Synced %s: %d uploaded (%d bytes), %d unchanged (%d bytes), %d deleted, %d failed\n",
+		localPath, stats.uploaded, stats.bytesUploaded, stats.skipped, stats.bytesSkipped, stats.deleted, stats.failed)
+	return firstErr
+}
+
+// syncFile carica il file se l'oggetto remoto manca o è diverso; restituisce se ha caricato
+func (s *S3SyncService) syncFile(path, key string, size int64, remote *remoteObject) (bool, error) {
+	sum, err := fileMD5(path)
+	if err != nil {
+		return false, err
+	}
+	if remote != nil && remote.size == size {
+		same, err := s.remoteMatches(key, remote, sum)
 		if err != nil {
-			return err
+			return false, err
 		}
-		defer file.Close()
+		if same {
+			return false, nil
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
 
-		_, err = s.uploader.Upload(&s3manager.UploadInput{
-			Bucket: aws.String(s.config.Bucket),
-			Key:    aws.String(s3Key),
-			Body:   file,
-		})
+	_, err = s.uploader.Upload(&s3manager.UploadInput{
+		Bucket:   aws.String(s.config.Bucket),
+		Key:      aws.String(key),
+		Body:     file,
+		Metadata: map[string]*string{md5Metadata: aws.String(sum)},
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to upload %s: %v", key, err)
+	}
 
-		if err != nil {
-			return fmt.Errorf("failed to upload %s: %v", s3Key, err)
+	fmt.Printf("Uploaded: %s -> s3://%s/%s\n", path, s.config.Bucket, key)
+	return true, nil
+}
+
+// remoteMatches confronta l'MD5 locale con l'ETag o, per gli oggetti multipart, con il metadato
+func (s *S3SyncService) remoteMatches(key string, remote *remoteObject, sum string) (bool, error) {
+	etag := strings.Trim(remote.etag, "\"")
+	if !strings.Contains(etag, "-") {
+		return etag == sum, nil
+	}
+	head, err := s.s3Client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(s.config.Bucket), Key: aws.String(key)})
+	if err != nil {
+		return false, fmt.Errorf("failed to read metadata of %s: %v", key, err)
+	}
+	for name, value := range head.Metadata {
+		if strings.EqualFold(name, md5Metadata) {
+			return aws.StringValue(value) == sum, nil
 		}
+	}
+	return false, nil
+}
 
-		fmt.Printf("Uploaded: %s -> s3://%s/%s\n", path, s.config.Bucket, s3Key)
-		return nil
+// listRemoteObjects restituisce dimensione ed ETag degli oggetti sotto il prefisso
+func (s *S3SyncService) listRemoteObjects(prefix string) (map[string]*remoteObject, error) {
+	objects := make(map[string]*remoteObject)
+	err := s.s3Client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(s.config.Bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			objects[aws.StringValue(obj.Key)] = &remoteObject{size: aws.Int64Value(obj.Size), etag: aws.StringValue(obj.ETag)}
+		}
+		return true
 	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list s3://%s/%s: %v", s.config.Bucket, prefix, err)
+	}
+	return objects, nil
+}
+
+// fileMD5 restituisce l'MD5 esadecimale del contenuto del file
+func fileMD5(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
 func (s *S3SyncService) DownloadFromS3(s3Key, localPath string) error {
@@ -218,3 +472,11 @@ func (s *S3SyncService) DownloadFromS3(s3Key, localPath string) error {
 	fmt.Printf("Downloaded: s3://%s/%s -> %s\n", s.config.Bucket, s3Key, localPath)
 	return nil
 }
+
+// envInt legge un intero da una variabile d'ambiente
+func envInt(name string, def int) int {
+	if n, err := strconv.Atoi(os.Getenv(name)); err == nil {
+		return n
+	}
+	return def
+}
@@ -18,7 +18,7 @@ function Show-Help {
     Write-Host ""
     Write-Host "File copiati:"
     Write-Host "  - mr-out-0 a mr-out-9 (file di output dei reducer)"
-    Write-Host "  - final-output.txt (file finale unificato)"
+    Write-Host "  - final-output-main-job.txt (file finale unificato)"
     Write-Host ""
     Write-Host "Requisiti:"
     Write-Host "  - Docker deve essere in esecuzione"
@@ -84,8 +84,8 @@ function Copy-OutputFiles {
     $skippedFiles = 0
     
     for ($i = 0; $i -le 9; $i++) {
-        $sourceFile = "/tmp/mapreduce/mr-out-$i"
-        $destFile = "data/output/mr-out-$i"
+        $sourceFile = "/tmp/mapreduce/mr-out-main-job-$i"
+        $destFile = "data/output/mr-out-main-job-$i"
         
         # Verifica se il file esiste nel container
         try {
@@ -94,10 +94,10 @@ function Copy-OutputFiles {
                 # Copia il file dal container alla cartella locale
                 docker cp "$activeWorker`:$sourceFile" $destFile
                 if ($LASTEXITCODE -eq 0) {
-                    Write-ColorOutput "File copiato: mr-out-$i" "Green"
+                    Write-ColorOutput "File copiato: mr-out-main-job-$i" "Green"
                     $copiedFiles++
                 } else {
-                    Write-ColorOutput "Errore copia file: mr-out-$i" "Red"
+                    Write-ColorOutput "Errore copia file: mr-out-main-job-$i" "Red"
                 }
             } else {
                 $skippedFiles++
@@ -109,15 +109,15 @@ function Copy-OutputFiles {
     }
     
     # Copia anche il file finale unificato
-    $unifiedSourceFile = "/tmp/mapreduce/final-output.txt"
-    $unifiedDestFile = "data/output/final-output.txt"
+    $unifiedSourceFile = "/tmp/mapreduce/final-output-main-job.txt"
+    $unifiedDestFile = "data/output/final-output-main-job.txt"
     
     try {
         docker exec $activeWorker test -f $unifiedSourceFile | Out-Null
         if ($LASTEXITCODE -eq 0) {
             docker cp "$activeWorker`:$unifiedSourceFile" $unifiedDestFile
             if ($LASTEXITCODE -eq 0) {
-                Write-ColorOutput "File finale unificato copiato: final-output.txt" "Green"
+                Write-ColorOutput "File finale unificato copiato: final-output-main-job.txt" "Green"
                 $copiedFiles++
             } else {
                 Write-ColorOutput "Errore copia file finale unificato" "Red"
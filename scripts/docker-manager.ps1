@@ -462,20 +462,20 @@ function Copy-OutputFiles {
     
     # Copia file mr-out-* direttamente dal volume Docker (solo 3 file per correlazione 1:1:1)
     for ($i = 0; $i -le 2; $i++) {
-        $sourceFile = "/data/mr-out-$i"
-        $destFile = "data/output/mr-out-$i"
+        $sourceFile = "/data/mr-out-main-job-$i"
+        $destFile = "data/output/mr-out-main-job-$i"
         
         try {
             # Usa un container temporaneo per accedere al volume
             docker run --rm -v mapreduce-project_intermediate-data:/data alpine test -f $sourceFile 2>$null
             if ($LASTEXITCODE -eq 0) {
                 $outputPath = (Resolve-Path "data/output").Path
-                docker run --rm -v mapreduce-project_intermediate-data:/data -v "${outputPath}:/output" alpine cp $sourceFile /output/mr-out-$i
+                docker run --rm -v mapreduce-project_intermediate-data:/data -v "${outputPath}:/output" alpine cp $sourceFile /output/mr-out-main-job-$i
                 if ($LASTEXITCODE -eq 0) {
-                    Write-ColorOutput "File copiato: mr-out-$i" "Green"
+                    Write-ColorOutput "File copiato: mr-out-main-job-$i" "Green"
                     $copiedFiles++
                 } else {
-                    Write-ColorOutput "Errore copia file: mr-out-$i" "Red"
+                    Write-ColorOutput "Errore copia file: mr-out-main-job-$i" "Red"
                 }
             } else {
                 $skippedFiles++
@@ -489,7 +489,7 @@ function Copy-OutputFiles {
     # Crea file finale unificato combinando tutti i mr-out-* locali
     Write-Host "Creazione file finale unificato..."
     $outputPath = (Resolve-Path "data/output").Path
-    $unifiedDestFile = "data/output/final-output.txt"
+    $unifiedDestFile = "data/output/final-output-main-job.txt"
     
     try {
         # Crea file finale unificato combinando tutti i mr-out-* locali
@@ -499,9 +499,9 @@ function Copy-OutputFiles {
         $finalContent += ""
         
         for ($i = 0; $i -le 2; $i++) {
-            $mrOutFile = "data/output/mr-out-$i"
+            $mrOutFile = "data/output/mr-out-main-job-$i"
             if (Test-Path $mrOutFile) {
-                $finalContent += "=== FILE mr-out-$i ==="
+                $finalContent += "=== FILE mr-out-main-job-$i ==="
                 $content = Get-Content $mrOutFile -Raw
                 if ($content) {
                     $finalContent += $content.Trim()
@@ -516,7 +516,7 @@ function Copy-OutputFiles {
         $finalContent | Out-File -FilePath $unifiedDestFile -Encoding UTF8
         
         if (Test-Path $unifiedDestFile) {
-            Write-ColorOutput "File finale unificato creato: final-output.txt" "Green"
+            Write-ColorOutput "File finale unificato creato: final-output-main-job.txt" "Green"
             $copiedFiles++
         } else {
             Write-ColorOutput "Errore creazione file finale unificato" "Red"
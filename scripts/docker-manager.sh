@@ -214,20 +214,20 @@ copy_output() {
     
     # Usa il numero di reducer corretto (3) invece di hardcoded 9
     for i in {0..2}; do
-        if docker exec "$WORKER_CONTAINER" test -f "/tmp/mapreduce/mr-out-$i" 2>/dev/null; then
-            if docker cp "$WORKER_CONTAINER:/tmp/mapreduce/mr-out-$i" "data/output/mr-out-$i"; then
-                print_color $GREEN "File copiato: mr-out-$i"
+        if docker exec "$WORKER_CONTAINER" test -f "/tmp/mapreduce/mr-out-main-job-$i" 2>/dev/null; then
+            if docker cp "$WORKER_CONTAINER:/tmp/mapreduce/mr-out-main-job-$i" "data/output/mr-out-main-job-$i"; then
+                print_color $GREEN "File copiato: mr-out-main-job-$i"
                 ((COPIED_FILES++))
             else
-                print_color $RED "Errore copia file: mr-out-$i"
+                print_color $RED "Errore copia file: mr-out-main-job-$i"
             fi
         fi
     done
     
     # Copia file finale unificato
-    if docker exec "$WORKER_CONTAINER" test -f "/tmp/mapreduce/final-output.txt" 2>/dev/null; then
-        if docker cp "$WORKER_CONTAINER:/tmp/mapreduce/final-output.txt" "data/output/final-output.txt"; then
-            print_color $GREEN "File finale unificato copiato: final-output.txt"
+    if docker exec "$WORKER_CONTAINER" test -f "/tmp/mapreduce/final-output-main-job.txt" 2>/dev/null; then
+        if docker cp "$WORKER_CONTAINER:/tmp/mapreduce/final-output-main-job.txt" "data/output/final-output-main-job.txt"; then
+            print_color $GREEN "File finale unificato copiato: final-output-main-job.txt"
             ((COPIED_FILES++))
         fi
     fi
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// DefaultAppName è l'applicazione usata dai job che non ne specificano una
+const DefaultAppName = "wordcount"
+
+// MapFunc e ReduceFunc sono le funzioni utente eseguite dai worker
+type MapFunc func(filename string, contents string) []KeyValue
+type ReduceFunc func(key string, values []string) string
+
+// CombineFunc aggrega localmente i valori di una chiave prima della scrittura degli
+// intermedi. Il risultato viene riletto dal reduce, quindi deve essere associativo.
+type CombineFunc func(key string, values []string) string
+
+// StreamReducer riceve in ordine le chiavi di un reduce task e scrive in autonomia le
+// righe di output, invece di restituire un valore per chiave (es. un processo esterno
+// per task). Close attende la fine e restituisce il numero di righe scritte; Abort
+// interrompe il reducer quando il task viene abbandonato.
+type StreamReducer interface {
+	Reduce(key string, values []string) error
+	Close() (records int64, err error)
+	Abort()
+}
+
+// StreamReduceFunc avvia uno StreamReducer che scrive l'output del task in out, nel
+// formato di output del job
+type StreamReduceFunc func(out OutputWriter) (StreamReducer, error)
+
+// AppContext è passato ai costruttori delle funzioni di un'applicazione: contiene i
+// parametri del job, i contatori utente del task e i file accessori del job scaricati
+// in cache. Counters e CacheFiles sono nil quando le funzioni vengono costruite fuori
+// da un task (validazione e campionamento sul master).
+type AppContext struct {
+	Params     map[string]string
+	Counters   *UserCounters
+	CacheFiles map[string]string // nome del file accessorio -> percorso locale
+
+	failure *appFailure
+}
+
+// Fail segnala un errore di una funzione dell'applicazione: al termine il task viene
+// riportato al master come fallito. Fuori da un task l'errore viene solo registrato nel log.
+func (ctx AppContext) Fail(err error) {
+	if ctx.failure == nil {
+		LogWarn("Errore dell'applicazione fuori da un task: %v", err)
+		return
+	}
+	ctx.failure.mu.Lock()
+	if ctx.failure.err == nil {
+		ctx.failure.err = err
+	}
+	ctx.failure.mu.Unlock()
+}
+
+// appFailure conserva il primo errore segnalato con AppContext.Fail durante un task
+type appFailure struct {
+	mu  sync.Mutex
+	err error
+}
+
+func (f *appFailure) Err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
+
+// CacheFile restituisce il percorso locale del file accessorio del job con il nome indicato
+func (ctx AppContext) CacheFile(name string) (string, error) {
+	path, ok := ctx.CacheFiles[name]
+	if !ok {
+		return "", fmt.Errorf("file accessorio %q non pubblicato con il job", name)
+	}
+	return path, nil
+}
+
+// App descrive un'applicazione MapReduce registrata. NewMap e NewReduce costruiscono
+// le funzioni a partire dal contesto del task e restituiscono errore se i parametri non
+// sono validi. NewCombine è opzionale: nil indica che l'applicazione non ha un combiner.
+// NewStreamReduce sostituisce NewReduce per le applicazioni che producono l'output del
+// reduce in autonomia (streaming). CacheParams elenca i parametri il cui valore deve essere
+// il nome di uno dei file accessori del job. NoSampling indica che la map non può essere
+// eseguita sul master, per cui l'applicazione non supporta i partitioner campionati.
+//
+// La MapFunc di NewMap viene chiamata una volta per record con il valore del record;
+// con SplitMap riceve invece l'intero split (decompresso) in un'unica chiamata. Le
+// applicazioni che usano i campi dei record (CSV, JSONL) forniscono NewRecordMap al
+// posto di NewMap.
+type App struct {
+	Name            string
+	Description     string
+	NewMap          func(ctx AppContext) (MapFunc, error)
+	NewRecordMap    func(ctx AppContext) (RecordMapFunc, error)
+	SplitMap        bool
+	NewReduce       func(ctx AppContext) (ReduceFunc, error)
+	NewCombine      func(ctx AppContext) (CombineFunc, error)
+	NewStreamReduce func(ctx AppContext) (StreamReduceFunc, error)
+	CacheParams     []string
+	NoSampling      bool
+}
+
+// validateCacheParams verifica che i parametri dell'applicazione che indicano un file
+// accessorio nominino uno dei file pubblicati con il job
+func (app *App) validateCacheParams(params map[string]string, files []CacheFile) error {
+	for _, param := range app.CacheParams {
+		name := params[param]
+		if name == "" {
+			continue
+		}
+		found := false
+		for _, file := range files {
+			if file.Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("parametro %s: file accessorio %q non pubblicato con il job", param, name)
+		}
+	}
+	return nil
+}
+
+// taskFuncs sono le funzioni dell'applicazione usate da un task; con StreamReduce il
+// reduce usa lo StreamReducer al posto di Reduce. Map è impostata solo per le applicazioni
+// con SplitMap, le altre leggono l'input un record alla volta con RecordMap.
+type taskFuncs struct {
+	Map          MapFunc
+	RecordMap    RecordMapFunc
+	Reduce       ReduceFunc
+	Combine      CombineFunc
+	StreamReduce StreamReduceFunc
+}
+
+// appRegistry contiene le applicazioni disponibili, indicizzate per nome
+var appRegistry = make(map[string]*App)
+
+// RegisterApp registra un'applicazione; un nome già presente viene sostituito
+func RegisterApp(app *App) {
+	appRegistry[app.Name] = app
+}
+
+// LookupApp restituisce l'applicazione registrata con il nome indicato.
+// Un nome vuoto indica l'applicazione di default.
+func LookupApp(name string) (*App, error) {
+	if name == "" {
+		name = DefaultAppName
+	}
+	app, ok := appRegistry[name]
+	if !ok {
+		return nil, fmt.Errorf("applicazione %q non registrata (disponibili: %s)", name, strings.Join(AppNames(), ", "))
+	}
+	return app, nil
+}
+
+// AppNames restituisce i nomi delle applicazioni registrate in ordine alfabetico
+func AppNames() []string {
+	names := make([]string, 0, len(appRegistry))
+	for name := range appRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// BuildAppFuncs risolve l'applicazione e costruisce la coppia map/reduce con i parametri del job
+func BuildAppFuncs(name string, params map[string]string) (MapFunc, ReduceFunc, error) {
+	return buildAppFuncs(name, AppContext{Params: params})
+}
+
+// buildAppFuncs costruisce la coppia map/reduce con il contesto di un task. Per le
+// applicazioni con NewRecordMap i parametri della map vengono validati e mapf resta nil.
+func buildAppFuncs(name string, ctx AppContext) (MapFunc, ReduceFunc, error) {
+	app, err := LookupApp(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	var mapf MapFunc
+	if app.NewMap != nil {
+		if mapf, err = app.NewMap(ctx); err != nil {
+			return nil, nil, fmt.Errorf("parametri map non validi per %s: %v", app.Name, err)
+		}
+	} else if _, err := buildAppRecordMap(app, ctx); err != nil {
+		return nil, nil, err
+	}
+	reducef, err := buildAppReduce(app, ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return mapf, reducef, nil
+}
+
+// buildAppRecordMap costruisce la map per record dell'applicazione; una MapFunc viene
+// adattata chiamandola con il valore di ogni record
+func buildAppRecordMap(app *App, ctx AppContext) (RecordMapFunc, error) {
+	if app.NewRecordMap != nil {
+		mapr, err := app.NewRecordMap(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("parametri map non validi per %s: %v", app.Name, err)
+		}
+		return mapr, nil
+	}
+	mapf, err := app.NewMap(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("parametri map non validi per %s: %v", app.Name, err)
+	}
+	return recordMapFunc(mapf), nil
+}
+
+// buildAppReduce costruisce il reduce per chiave dell'applicazione. Per il reduce in
+// streaming i parametri vengono validati e la funzione per chiave resta nil.
+func buildAppReduce(app *App, ctx AppContext) (ReduceFunc, error) {
+	if app.NewReduce == nil {
+		_, err := buildAppStreamReduce(app, ctx)
+		return nil, err
+	}
+	reducef, err := app.NewReduce(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("parametri reduce non validi per %s: %v", app.Name, err)
+	}
+	return reducef, nil
+}
+
+// buildAppStreamReduce costruisce il reduce in streaming dell'applicazione, nil se non lo prevede
+func buildAppStreamReduce(app *App, ctx AppContext) (StreamReduceFunc, error) {
+	if app.NewStreamReduce == nil {
+		return nil, nil
+	}
+	streamf, err := app.NewStreamReduce(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("parametri reduce non validi per %s: %v", app.Name, err)
+	}
+	return streamf, nil
+}
+
+// BuildAppCombiner restituisce il combiner dell'applicazione, o nil se non ne ha uno
+func BuildAppCombiner(name string, params map[string]string) (CombineFunc, error) {
+	return buildAppCombiner(name, AppContext{Params: params})
+}
+
+// buildAppCombiner costruisce il combiner con il contesto di un task
+func buildAppCombiner(name string, ctx AppContext) (CombineFunc, error) {
+	app, err := LookupApp(name)
+	if err != nil {
+		return nil, err
+	}
+	if app.NewCombine == nil {
+		return nil, nil
+	}
+	combinef, err := app.NewCombine(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("parametri combine non validi per %s: %v", app.Name, err)
+	}
+	return combinef, nil
+}
+
+// sumCombiner somma i conteggi parziali: è il combiner delle applicazioni che contano
+func sumCombiner(AppContext) (CombineFunc, error) {
+	return CombineFunc(Reduce), nil
+}
+
+func init() {
+	RegisterApp(&App{
+		Name:        "wordcount",
+		Description: "Conta le occorrenze di ogni parola; il parametro stopwords indica un file accessorio con le parole da escludere",
+		NewMap:      newWordCountMap,
+		NewReduce:   func(AppContext) (ReduceFunc, error) { return Reduce, nil },
+		NewCombine:  sumCombiner,
+		CacheParams: []string{"stopwords"},
+	})
+	RegisterApp(&App{
+		Name:        "grep",
+		Description: "Conta le righe che corrispondono all'espressione regolare nel parametro pattern",
+		NewMap:      newGrepMap,
+		NewReduce:   func(AppContext) (ReduceFunc, error) { return Reduce, nil },
+		NewCombine:  sumCombiner,
+	})
+	RegisterApp(&App{
+		Name:        "invertedindex",
+		Description: "Per ogni parola elenca i file in cui compare",
+		NewMap:      func(AppContext) (MapFunc, error) { return invertedIndexMap, nil },
+		NewReduce:   func(AppContext) (ReduceFunc, error) { return invertedIndexReduce, nil },
+	})
+	RegisterApp(&App{
+		Name:        "sort",
+		Description: "Ordina le righe dell'input (ordinamento per partizione di reduce)",
+		NewMap:      func(AppContext) (MapFunc, error) { return sortMap, nil },
+		NewReduce:   func(AppContext) (ReduceFunc, error) { return Reduce, nil },
+		NewCombine:  sumCombiner,
+	})
+	RegisterApp(&App{
+		Name:         "fieldcount",
+		Description:  "Conta i record per valore del campo indicato dal parametro field (input CSV o JSONL)",
+		NewRecordMap: newFieldCountMap,
+		NewReduce:    func(AppContext) (ReduceFunc, error) { return Reduce, nil },
+		NewCombine:   sumCombiner,
+	})
+}
+
+// newWordCountMap restituisce la map di wordcount. Con stopwords=<nome> le parole elencate
+// nel file accessorio del job (separate da spazi o a capo) vengono scartate e conteggiate;
+// in un task, se il file non è in cache, la map non viene costruita e il task fallisce.
+func newWordCountMap(ctx AppContext) (MapFunc, error) {
+	name := ctx.Params["stopwords"]
+	if name == "" || ctx.Counters == nil {
+		// Fuori da un task (validazione sul master) i file accessori non sono disponibili
+		return Map, nil
+	}
+	path, err := ctx.CacheFile(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("errore lettura stopwords %s: %v", name, err)
+	}
+	stopwords := make(map[string]bool)
+	for _, w := range strings.Fields(string(data)) {
+		stopwords[w] = true
+	}
+	return func(filename string, contents string) []KeyValue {
+		kva := Map(filename, contents)
+		kept := kva[:0]
+		for _, kv := range kva {
+			if !stopwords[kv.Key] {
+				kept = append(kept, kv)
+			}
+		}
+		ctx.Counters.Inc("wordcount_stopwords_skipped", int64(len(kva)-len(kept)))
+		return kept
+	}, nil
+}
+
+// newGrepMap emette ogni riga che corrisponde al pattern; con ignore_case=true il confronto ignora maiuscole/minuscole.
+// Conta le righe esaminate e quelle scartate nei contatori utente del task.
+func newGrepMap(ctx AppContext) (MapFunc, error) {
+	pattern := ctx.Params["pattern"]
+	if pattern == "" {
+		return nil, fmt.Errorf("parametro pattern mancante")
+	}
+	if ignore, _ := strconv.ParseBool(ctx.Params["ignore_case"]); ignore {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("pattern non valido: %v", err)
+	}
+	return func(filename string, contents string) []KeyValue {
+		kva := []KeyValue{}
+		// Il '\n' finale non introduce una riga vuota in più
+		lines := strings.Split(strings.TrimSuffix(contents, "\n"), "\n")
+		for _, line := range lines {
+			if re.MatchString(line) {
+				kva = append(kva, KeyValue{Key: line, Value: MapValueCount})
+			}
+		}
+		ctx.Counters.Inc("grep_lines_scanned", int64(len(lines)))
+		ctx.Counters.Inc("grep_lines_skipped", int64(len(lines)-len(kva)))
+		return kva
+	}, nil
+}
+
+// newFieldCountMap emette il valore del campo indicato per ogni record; i record senza
+// il campo vengono contati in fieldcount_missing_field
+func newFieldCountMap(ctx AppContext) (RecordMapFunc, error) {
+	field := ctx.Params["field"]
+	if field == "" {
+		return nil, fmt.Errorf("parametro field mancante")
+	}
+	return func(rec Record) []KeyValue {
+		value, ok := rec.Fields[field]
+		if !ok {
+			ctx.Counters.Inc("fieldcount_missing_field", 1)
+			return nil
+		}
+		return []KeyValue{{Key: value, Value: MapValueCount}}
+	}, nil
+}
+
+// invertedIndexMap emette una coppia parola -> file per ogni parola distinta del file
+func invertedIndexMap(filename string, contents string) []KeyValue {
+	words := strings.FieldsFunc(contents, func(r rune) bool { return !unicode.IsLetter(r) })
+	seen := make(map[string]bool, len(words))
+	kva := []KeyValue{}
+	for _, w := range words {
+		if !seen[w] {
+			seen[w] = true
+			kva = append(kva, KeyValue{Key: w, Value: filename})
+		}
+	}
+	return kva
+}
+
+// invertedIndexReduce restituisce il numero di file e la lista ordinata dei file
+func invertedIndexReduce(key string, values []string) string {
+	files := make(map[string]bool, len(values))
+	for _, v := range values {
+		files[v] = true
+	}
+	list := make([]string, 0, len(files))
+	for f := range files {
+		list = append(list, f)
+	}
+	sort.Strings(list)
+	return fmt.Sprintf("%d %s", len(list), strings.Join(list, ","))
+}
+
+// sortMap usa ogni riga non vuota come chiave; il reduce ne conta i duplicati
+func sortMap(filename string, contents string) []KeyValue {
+	kva := []KeyValue{}
+	for _, line := range strings.Split(contents, "\n") {
+		if line = strings.TrimRight(line, "\r"); line != "" {
+			kva = append(kva, KeyValue{Key: line, Value: MapValueCount})
+		}
+	}
+	return kva
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	crand "crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Ogni assegnazione di un task è un tentativo con ID univoco. Il worker scrive i propri
+// file con il suffisso del tentativo e il master promuove ai nomi definitivi solo i file
+// del primo tentativo che segnala il completamento; quelli degli altri vengono scartati.
+
+// attemptMarker separa il nome definitivo di un file dall'ID del tentativo
+const attemptMarker = ".attempt-"
+
+// newAttemptID genera l'ID di un tentativo: tipo e numero del task, numero del tentativo
+// e un suffisso casuale, così da restare univoco anche dopo un cambio di leader
+func newAttemptID(taskType TaskType, taskID, attempt int) string {
+	var b [4]byte
+	suffix := ""
+	if _, err := crand.Read(b[:]); err == nil {
+		suffix = hex.EncodeToString(b[:])
+	} else {
+		suffix = fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return fmt.Sprintf("%s%d-%d-%s", strings.ToLower(taskType.String()[:1]), taskID, attempt, suffix)
+}
+
+// attemptFileName restituisce il nome del file scritto dal tentativo (vuoto = nome definitivo)
+func attemptFileName(name, attemptID string) string {
+	if attemptID == "" {
+		return name
+	}
+	return name + attemptMarker + attemptID
+}
+
+// taskOutputFiles restituisce i nomi definitivi dei file prodotti da un task:
+// gli intermedi di tutte le partizioni per un map, il file di output per un reduce
+// (nella directory di output del job, vuota = directory locale)
+func taskOutputFiles(jobID string, taskType TaskType, taskID, nReduce int, outputDir string) []string {
+	if taskType == ReduceTask {
+		return []string{reduceOutputFileName(outputDir, jobID, taskID)}
+	}
+	files := make([]string, 0, nReduce)
+	for r := 0; r < nReduce; r++ {
+		files = append(files, getIntermediateFileName(jobID, taskID, r))
+	}
+	return files
+}
+
+// promoteAttemptFiles rinomina i file del tentativo nei nomi definitivi. Ogni rename è
+// atomico sul filesystem locale e sostituisce eventuali file rimasti da tentativi precedenti;
+// su S3 è una copia seguita dalla rimozione dell'originale.
+func promoteAttemptFiles(files []string, attemptID string) error {
+	for _, name := range files {
+		if err := storageFor(name).Rename(attemptFileName(name, attemptID), name); err != nil {
+			return fmt.Errorf("promozione tentativo %s di %s fallita: %v", attemptID, name, err)
+		}
+	}
+	return nil
+}
+
+// removeAttemptFiles rimuove i file scritti da un tentativo scartato o non completato
+func removeAttemptFiles(files []string, attemptID string) {
+	if attemptID == "" {
+		return
+	}
+	for _, name := range files {
+		path := attemptFileName(name, attemptID)
+		if err := storageFor(path).Remove(path); err != nil && !os.IsNotExist(err) {
+			LogWarn("Errore rimozione file del tentativo %s: %v", path, err)
+		}
+	}
+}
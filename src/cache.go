@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"net/rpc"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache distribuita dei file accessori di un job (liste di stop-word, tabelle per i join
+// lato map, ...). Il leader valida i file alla sottomissione e li pubblica con il job; ogni
+// worker li scarica una sola volta per job in TMP_PATH/cache/<job>, verificandone il
+// checksum, e le funzioni dell'applicazione li trovano per nome in AppContext.CacheFiles.
+// I file locali vengono serviti dal master tramite RPC, quelli s3://bucket/key scaricati
+// direttamente da S3.
+
+// S3URIPrefix identifica le sorgenti su S3
+const S3URIPrefix = "s3://"
+
+// publishCacheFiles valida i file accessori di un job e ne calcola il checksum.
+// Il nome di ogni file è il nome base della sorgente e deve essere univoco nel job.
+func publishCacheFiles(sources []string) ([]CacheFile, error) {
+	var files []CacheFile
+	names := make(map[string]bool, len(sources))
+	for _, source := range sources {
+		source = strings.TrimSpace(source)
+		if source == "" {
+			continue
+		}
+		file := CacheFile{Source: source}
+		if strings.HasPrefix(source, S3URIPrefix) {
+			_, key, err := parseS3URI(source)
+			if err != nil {
+				return nil, err
+			}
+			file.Name = path.Base(key)
+		} else {
+			info, err := os.Stat(source)
+			if err != nil {
+				return nil, fmt.Errorf("file di cache %s non accessibile: %v", source, err)
+			}
+			if info.IsDir() {
+				return nil, fmt.Errorf("file di cache %s è una directory", source)
+			}
+			if info.Size() > CacheFileMaxSize {
+				return nil, fmt.Errorf("file di cache %s troppo grande: %d byte (massimo %d)", source, info.Size(), CacheFileMaxSize)
+			}
+			size, crc, lines, err := checksumFile(source)
+			if err != nil {
+				return nil, fmt.Errorf("errore checksum %s: %v", source, err)
+			}
+			file.Name = filepath.Base(source)
+			file.Checksum = &FileChecksum{Records: lines, Size: size, CRC32: crc}
+		}
+		if names[file.Name] {
+			return nil, fmt.Errorf("file di cache con nome duplicato: %s", file.Name)
+		}
+		names[file.Name] = true
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// parseS3URI separa bucket e chiave di una sorgente s3://bucket/key
+func parseS3URI(uri string) (bucket, key string, err error) {
+	rest := strings.TrimPrefix(uri, S3URIPrefix)
+	bucket, key, found := strings.Cut(rest, "/")
+	if !found || bucket == "" || key == "" || strings.HasSuffix(key, "/") {
+		return "", "", fmt.Errorf("URI S3 non valido: %s (atteso s3://bucket/key)", uri)
+	}
+	return bucket, key, nil
+}
+
+// cacheFile restituisce il file accessorio del job con il nome indicato
+func (j *Job) cacheFile(name string) (CacheFile, bool) {
+	for _, f := range j.CacheFiles {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return CacheFile{}, false
+}
+
+// GetCacheFile è il metodo RPC con cui un worker scarica un file accessorio locale del job
+func (m *Master) GetCacheFile(args *CacheFileArgs, reply *CacheFileReply) error {
+	m.mu.RLock()
+	job := m.jobs[args.JobID]
+	var file CacheFile
+	found := false
+	if job != nil {
+		file, found = job.cacheFile(args.Name)
+	}
+	m.mu.RUnlock()
+
+	if !found {
+		return fmt.Errorf("file di cache %s non pubblicato dal job %s", args.Name, args.JobID)
+	}
+	if strings.HasPrefix(file.Source, S3URIPrefix) {
+		return fmt.Errorf("file di cache %s su S3: va scaricato da %s", file.Name, file.Source)
+	}
+	data, err := os.ReadFile(file.Source)
+	if err != nil {
+		return fmt.Errorf("errore lettura file di cache %s: %v", file.Source, err)
+	}
+	reply.Data = data
+	return nil
+}
+
+// jobCache è la cache dei file accessori di un job su questo worker
+type jobCache struct {
+	mu       sync.Mutex
+	files    map[string]string // nome -> percorso locale, nil finché non scaricati
+	inUse    int
+	lastUsed time.Time
+}
+
+var jobCaches = struct {
+	sync.Mutex
+	jobs map[string]*jobCache
+}{jobs: make(map[string]*jobCache)}
+
+// jobCacheDir restituisce la directory della cache del job
+func jobCacheDir(jobID string) string {
+	if jobID == "" {
+		jobID = DefaultJobID
+	}
+	return filepath.Join(filepath.Dir(getIntermediateFileName(jobID, 0, 0)), CacheDirName, jobID)
+}
+
+// prepareJobCache scarica, se non già presenti, i file accessori del job del task e ne
+// restituisce i percorsi locali per nome. I task dello stesso job attendono il primo
+// download; release va chiamata a fine task.
+func prepareJobCache(masterAddr string, task *Task) (files map[string]string, release func(), err error) {
+	if len(task.CacheFiles) == 0 {
+		return nil, func() {}, nil
+	}
+
+	jobCaches.Lock()
+	jc := jobCaches.jobs[task.JobID]
+	if jc == nil {
+		jc = &jobCache{}
+		jobCaches.jobs[task.JobID] = jc
+	}
+	jc.inUse++
+	jobCaches.Unlock()
+
+	release = func() {
+		jobCaches.Lock()
+		jc.inUse--
+		jc.lastUsed = time.Now()
+		jobCaches.Unlock()
+	}
+
+	jc.mu.Lock()
+	defer jc.mu.Unlock()
+	if jc.files == nil {
+		files, err := fetchJobCache(masterAddr, task.JobID, task.CacheFiles)
+		if err != nil {
+			release()
+			return nil, nil, err
+		}
+		jc.files = files
+		evictIdleJobCaches(task.JobID)
+	}
+	return jc.files, release, nil
+}
+
+// fetchJobCache scarica i file accessori del job nella directory di cache. I file già
+// presenti con il checksum atteso (worker riavviato) non vengono riscaricati.
+func fetchJobCache(masterAddr, jobID string, cacheFiles []CacheFile) (map[string]string, error) {
+	dir := jobCacheDir(jobID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("errore creazione directory di cache %s: %v", dir, err)
+	}
+
+	files := make(map[string]string, len(cacheFiles))
+	for _, file := range cacheFiles {
+		dest := filepath.Join(dir, file.Name)
+		if file.Checksum != nil && verifyFileChecksum(dest, *file.Checksum) == nil {
+			files[file.Name] = dest
+			continue
+		}
+		tmp := dest + ".download"
+		if err := downloadCacheFile(masterAddr, jobID, file, tmp); err != nil {
+			os.Remove(tmp)
+			return nil, fmt.Errorf("errore download file di cache %s: %v", file.Source, err)
+		}
+		if file.Checksum != nil {
+			if err := verifyFileChecksum(tmp, *file.Checksum); err != nil {
+				os.Remove(tmp)
+				return nil, fmt.Errorf("file di cache %s corrotto: %v", file.Name, err)
+			}
+		}
+		if err := os.Rename(tmp, dest); err != nil {
+			os.Remove(tmp)
+			return nil, err
+		}
+		files[file.Name] = dest
+	}
+	LogInfo("Cache: %d file accessori del job %s pronti in %s", len(files), jobID, dir)
+	return files, nil
+}
+
+// downloadCacheFile scarica un file accessorio da S3 o, se locale, dal master
+func downloadCacheFile(masterAddr, jobID string, file CacheFile, dest string) error {
+	if strings.HasPrefix(file.Source, S3URIPrefix) {
+		bucket, key, err := parseS3URI(file.Source)
+		if err != nil {
+			return err
+		}
+		config := GetS3ConfigFromEnv()
+		config.Bucket = bucket
+		config.Enabled = true
+		client, err := NewS3Client(config)
+		if err != nil {
+			return err
+		}
+		return client.DownloadFile(key, dest)
+	}
+
+	client, err := rpc.DialHTTP("tcp", masterAddr)
+	if err != nil {
+		return fmt.Errorf("connessione al master %s: %v", masterAddr, err)
+	}
+	defer client.Close()
+	var reply CacheFileReply
+	if err := client.Call("Master.GetCacheFile", &CacheFileArgs{JobID: jobID, Name: file.Name}, &reply); err != nil {
+		return err
+	}
+	return os.WriteFile(dest, reply.Data, 0644)
+}
+
+// evictIdleJobCaches rimuove le cache dei job diversi da keep non usate da CacheIdleTimeout
+func evictIdleJobCaches(keep string) {
+	jobCaches.Lock()
+	var idle []string
+	for jobID, jc := range jobCaches.jobs {
+		if jobID != keep && jc.inUse == 0 && time.Since(jc.lastUsed) > CacheIdleTimeout {
+			idle = append(idle, jobID)
+		}
+	}
+	jobCaches.Unlock()
+	for _, jobID := range idle {
+		removeJobCache(jobID)
+	}
+}
+
+// removeJobCache rimuove la cache dei file accessori di un job, se nessun task la sta usando
+func removeJobCache(jobID string) {
+	if !validShuffleName(jobID) {
+		return
+	}
+	jobCaches.Lock()
+	if jc := jobCaches.jobs[jobID]; jc != nil {
+		if jc.inUse > 0 {
+			jobCaches.Unlock()
+			return
+		}
+		delete(jobCaches.jobs, jobID)
+	}
+	jobCaches.Unlock()
+
+	dir := jobCacheDir(jobID)
+	if _, err := os.Stat(dir); err != nil {
+		return
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		LogWarn("Errore rimozione cache del job %s: %v", jobID, err)
+		return
+	}
+	LogInfo("Cache: rimossi i file accessori del job terminato %s", jobID)
+}
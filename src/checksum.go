@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Checksum end-to-end dei file prodotti dai task: il worker calcola dimensione, CRC32 e
+// numero di record di ogni file scritto e li invia con TaskCompleted; il master li
+// registra nel FSM e li usa per validare i file al commit, nel monitor di validazione e
+// nella ripresa dello stato, mentre i reduce verificano le partizioni prima del merge.
+
+// FileChecksum descrive un file prodotto da un task: la partizione di reduce per gli
+// intermedi di un map, l'ID del reduce per il suo output
+type FileChecksum struct {
+	Partition int    `json:"partition"`
+	Records   int64  `json:"records"`
+	Size      int64  `json:"size"`
+	CRC32     uint32 `json:"crc32"`
+}
+
+// taskResult è il risultato dell'esecuzione di un task da segnalare al master
+type taskResult struct {
+	Counters TaskCounters
+	Files    []FileChecksum
+}
+
+// checksumFile calcola dimensione, CRC32 e numero di righe dell'intero file
+func checksumFile(path string) (size int64, crc uint32, lines int64, err error) {
+	f, err := openStorageFile(path)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer f.Close()
+
+	h := crc32.NewIEEE()
+	buf := make([]byte, 64<<10)
+	r := bufio.NewReader(f)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			h.Write(buf[:n])
+			size += int64(n)
+			lines += int64(bytes.Count(buf[:n], []byte{'\n'}))
+		}
+		if err == io.EOF {
+			return size, h.Sum32(), lines, nil
+		}
+		if err != nil {
+			return 0, 0, 0, err
+		}
+	}
+}
+
+// newFileChecksum calcola il checksum di un file prodotto da un task con records record
+func newFileChecksum(path string, partition int, records int64) (FileChecksum, error) {
+	size, crc, _, err := checksumFile(path)
+	if err != nil {
+		return FileChecksum{}, fmt.Errorf("errore checksum %s: %v", path, err)
+	}
+	return FileChecksum{Partition: partition, Records: records, Size: size, CRC32: crc}, nil
+}
+
+// verifyFileChecksum verifica che dimensione e CRC32 del file corrispondano a quelli registrati
+func verifyFileChecksum(path string, expected FileChecksum) error {
+	size, crc, _, err := checksumFile(path)
+	if err != nil {
+		return err
+	}
+	if size != expected.Size {
+		return fmt.Errorf("%s: %d byte, attesi %d", path, size, expected.Size)
+	}
+	if crc != expected.CRC32 {
+		return fmt.Errorf("%s: CRC32 %08x, atteso %08x", path, crc, expected.CRC32)
+	}
+	return nil
+}
+
+// findFileChecksum restituisce il checksum registrato per la partizione indicata
+func findFileChecksum(files []FileChecksum, partition int) (FileChecksum, bool) {
+	for _, f := range files {
+		if f.Partition == partition {
+			return f, true
+		}
+	}
+	return FileChecksum{}, false
+}
@@ -0,0 +1,486 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Formato dei file intermedi (output dei map, spill e run del reduce).
+//
+// Un file è composto da un header di kvHeaderSize byte seguito dal payload:
+//
+//	magic "MRKV" | versione | codec | riservati (2) | record (8) | lunghezza payload (8) |
+//	CRC32 del payload (4) | CRC32 dei 28 byte precedenti (4)
+//
+// Il payload è la sequenza dei record, ciascuno come lunghezza (uvarint) e byte di chiave
+// e valore, eventualmente compressa dal codec. L'header viene scritto alla chiusura del
+// file, quando record e checksum sono noti: la validazione controlla header e checksum
+// senza decodificare i record. I file senza magic sono letti come JSON, una coppia per riga
+// (formato dei worker precedenti e codec "json").
+
+const (
+	kvMagic         = "MRKV"
+	kvFormatVersion = 1
+	kvHeaderSize    = 32
+
+	// CodecJSON scrive una coppia JSON per riga, senza header
+	CodecJSON = "json"
+	// CodecBinary scrive record binari con lunghezza, senza compressione
+	CodecBinary = "binary"
+	// CodecGzip scrive record binari compressi con gzip
+	CodecGzip = "gzip"
+)
+
+// IntermediateCodec comprime il payload dei file intermedi. L'ID viene registrato
+// nell'header e identifica il codec in lettura.
+type IntermediateCodec interface {
+	ID() byte
+	Name() string
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.Reader, error)
+}
+
+var intermediateCodecs = struct {
+	sync.RWMutex
+	byName map[string]IntermediateCodec
+	byID   map[byte]IntermediateCodec
+}{byName: make(map[string]IntermediateCodec), byID: make(map[byte]IntermediateCodec)}
+
+// RegisterIntermediateCodec registra un codec per i file intermedi
+func RegisterIntermediateCodec(codec IntermediateCodec) {
+	intermediateCodecs.Lock()
+	defer intermediateCodecs.Unlock()
+	if _, exists := intermediateCodecs.byID[codec.ID()]; exists {
+		panic(fmt.Sprintf("codec intermedio con ID %d già registrato", codec.ID()))
+	}
+	intermediateCodecs.byName[codec.Name()] = codec
+	intermediateCodecs.byID[codec.ID()] = codec
+}
+
+// IntermediateCodecNames restituisce i nomi dei codec disponibili, incluso CodecJSON
+func IntermediateCodecNames() []string {
+	intermediateCodecs.RLock()
+	defer intermediateCodecs.RUnlock()
+	names := []string{CodecJSON}
+	for name := range intermediateCodecs.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupIntermediateCodec restituisce il codec con il nome indicato
+func lookupIntermediateCodec(name string) (IntermediateCodec, error) {
+	intermediateCodecs.RLock()
+	codec, ok := intermediateCodecs.byName[name]
+	intermediateCodecs.RUnlock()
+	if ok {
+		return codec, nil
+	}
+	return nil, fmt.Errorf("codec intermedio %q sconosciuto (disponibili: %s)", name, strings.Join(IntermediateCodecNames(), ", "))
+}
+
+// nopWriteCloser adatta un io.Writer senza Close
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// binaryCodec non comprime il payload
+type binaryCodec struct{}
+
+func (binaryCodec) ID() byte                                      { return 1 }
+func (binaryCodec) Name() string                                  { return CodecBinary }
+func (binaryCodec) NewWriter(w io.Writer) (io.WriteCloser, error) { return nopWriteCloser{w}, nil }
+func (binaryCodec) NewReader(r io.Reader) (io.Reader, error)      { return r, nil }
+
+// gzipCodec comprime il payload con gzip alla velocità massima
+type gzipCodec struct{}
+
+func (gzipCodec) ID() byte     { return 2 }
+func (gzipCodec) Name() string { return CodecGzip }
+func (gzipCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriterLevel(w, gzip.BestSpeed)
+}
+func (gzipCodec) NewReader(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }
+
+func init() {
+	RegisterIntermediateCodec(binaryCodec{})
+	RegisterIntermediateCodec(gzipCodec{})
+}
+
+// kvFileHeader è l'header di un file intermedio
+type kvFileHeader struct {
+	Codec      byte
+	Records    uint64
+	PayloadLen uint64
+	PayloadCRC uint32
+}
+
+func (h kvFileHeader) marshal() []byte {
+	buf := make([]byte, kvHeaderSize)
+	copy(buf, kvMagic)
+	buf[4] = kvFormatVersion
+	buf[5] = h.Codec
+	binary.BigEndian.PutUint64(buf[8:], h.Records)
+	binary.BigEndian.PutUint64(buf[16:], h.PayloadLen)
+	binary.BigEndian.PutUint32(buf[24:], h.PayloadCRC)
+	binary.BigEndian.PutUint32(buf[28:], crc32.ChecksumIEEE(buf[:28]))
+	return buf
+}
+
+func unmarshalKVFileHeader(buf []byte) (kvFileHeader, error) {
+	if crc32.ChecksumIEEE(buf[:28]) != binary.BigEndian.Uint32(buf[28:]) {
+		return kvFileHeader{}, fmt.Errorf("checksum dell'header non valido")
+	}
+	if buf[4] != kvFormatVersion {
+		return kvFileHeader{}, fmt.Errorf("versione del formato %d non supportata", buf[4])
+	}
+	return kvFileHeader{
+		Codec:      buf[5],
+		Records:    binary.BigEndian.Uint64(buf[8:]),
+		PayloadLen: binary.BigEndian.Uint64(buf[16:]),
+		PayloadCRC: binary.BigEndian.Uint32(buf[24:]),
+	}, nil
+}
+
+// kvWriter scrive le coppie di un file intermedio
+type kvWriter interface {
+	Write(kv KeyValue) error
+	Close() error
+}
+
+// kvReader legge le coppie di un file intermedio; Read restituisce io.EOF a fine file
+type kvReader interface {
+	Read() (KeyValue, error)
+	BytesRead() int64
+	Close() error
+}
+
+// intermediateCodecName restituisce il codec configurato per i file intermedi
+func intermediateCodecName() string {
+	return GetConfig().GetIntermediateCodec()
+}
+
+// createKVFile crea un file intermedio con il codec indicato
+func createKVFile(path, codecName string) (kvWriter, error) {
+	if codecName == CodecJSON {
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		w := bufio.NewWriter(f)
+		return &jsonKVWriter{file: f, buf: w, enc: json.NewEncoder(w)}, nil
+	}
+	codec, err := lookupIntermediateCodec(codecName)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	// Header provvisorio, riscritto alla chiusura
+	if _, err := f.Write(make([]byte, kvHeaderSize)); err != nil {
+		f.Close()
+		return nil, err
+	}
+	w := &binaryKVWriter{file: f, codec: codec, fileBuf: bufio.NewWriter(f), crc: crc32.NewIEEE()}
+	w.payload = &countingWriter{w: io.MultiWriter(w.fileBuf, w.crc)}
+	if w.compressed, err = codec.NewWriter(w.payload); err != nil {
+		f.Close()
+		return nil, err
+	}
+	w.records = bufio.NewWriter(w.compressed)
+	return w, nil
+}
+
+// checksum è il CRC32 calcolato sui byte del payload
+type checksum interface {
+	io.Writer
+	Sum32() uint32
+}
+
+// countingWriter conta i byte scritti
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// binaryKVWriter scrive record binari con lunghezza e l'header alla chiusura
+type binaryKVWriter struct {
+	file       *os.File
+	codec      IntermediateCodec
+	fileBuf    *bufio.Writer
+	crc        checksum
+	payload    *countingWriter
+	compressed io.WriteCloser
+	records    *bufio.Writer
+	count      uint64
+	lenBuf     [binary.MaxVarintLen64]byte
+}
+
+func (w *binaryKVWriter) writeField(s string) error {
+	n := binary.PutUvarint(w.lenBuf[:], uint64(len(s)))
+	if _, err := w.records.Write(w.lenBuf[:n]); err != nil {
+		return err
+	}
+	_, err := w.records.WriteString(s)
+	return err
+}
+
+func (w *binaryKVWriter) Write(kv KeyValue) error {
+	if err := w.writeField(kv.Key); err != nil {
+		return err
+	}
+	if err := w.writeField(kv.Value); err != nil {
+		return err
+	}
+	w.count++
+	return nil
+}
+
+func (w *binaryKVWriter) Close() error {
+	err := w.records.Flush()
+	if cerr := w.compressed.Close(); err == nil {
+		err = cerr
+	}
+	if ferr := w.fileBuf.Flush(); err == nil {
+		err = ferr
+	}
+	if err == nil {
+		header := kvFileHeader{Codec: w.codec.ID(), Records: w.count, PayloadLen: uint64(w.payload.n), PayloadCRC: w.crc.Sum32()}
+		_, err = w.file.WriteAt(header.marshal(), 0)
+	}
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// jsonKVWriter scrive una coppia JSON per riga
+type jsonKVWriter struct {
+	file *os.File
+	buf  *bufio.Writer
+	enc  *json.Encoder
+}
+
+func (w *jsonKVWriter) Write(kv KeyValue) error { return w.enc.Encode(kv) }
+
+func (w *jsonKVWriter) Close() error {
+	err := w.buf.Flush()
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// countingReader conta i byte letti
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// openKVFile apre un file intermedio riconoscendo il formato dall'header
+func openKVFile(path string) (kvReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(f)
+	magic, _ := br.Peek(len(kvMagic))
+	if !bytes.Equal(magic, []byte(kvMagic)) {
+		return &jsonKVReader{file: f, dec: json.NewDecoder(br)}, nil
+	}
+
+	buf := make([]byte, kvHeaderSize)
+	if _, err := io.ReadFull(br, buf); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("header di %s incompleto: %v", path, err)
+	}
+	header, err := unmarshalKVFileHeader(buf)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	codec, err := codecByID(header.Codec)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	r := &binaryKVReader{path: path, file: f, header: header, crc: crc32.NewIEEE()}
+	r.payload = &countingReader{r: io.TeeReader(io.LimitReader(br, int64(header.PayloadLen)), r.crc)}
+	decompressed, err := codec.NewReader(r.payload)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	r.records = bufio.NewReader(decompressed)
+	return r, nil
+}
+
+// codecByID restituisce il codec registrato con l'ID indicato
+func codecByID(id byte) (IntermediateCodec, error) {
+	intermediateCodecs.RLock()
+	defer intermediateCodecs.RUnlock()
+	if codec, ok := intermediateCodecs.byID[id]; ok {
+		return codec, nil
+	}
+	return nil, fmt.Errorf("codec intermedio con ID %d sconosciuto", id)
+}
+
+// binaryKVReader legge record binari verificando numero di record e checksum a fine file
+type binaryKVReader struct {
+	path    string
+	file    *os.File
+	header  kvFileHeader
+	crc     checksum
+	payload *countingReader
+	records *bufio.Reader
+	count   uint64
+}
+
+func (r *binaryKVReader) readField() (string, error) {
+	n, err := binary.ReadUvarint(r.records)
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r.records, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+func (r *binaryKVReader) Read() (KeyValue, error) {
+	key, err := r.readField()
+	if err == io.EOF {
+		return KeyValue{}, r.verify()
+	}
+	if err != nil {
+		return KeyValue{}, fmt.Errorf("lettura %s: %v", r.path, err)
+	}
+	value, err := r.readField()
+	if err != nil {
+		return KeyValue{}, fmt.Errorf("lettura %s: record troncato: %v", r.path, err)
+	}
+	r.count++
+	return KeyValue{Key: key, Value: value}, nil
+}
+
+// verify controlla a fine payload record letti, lunghezza e checksum
+func (r *binaryKVReader) verify() error {
+	if r.count != r.header.Records {
+		return fmt.Errorf("%s: letti %d record, attesi %d", r.path, r.count, r.header.Records)
+	}
+	if uint64(r.payload.n) != r.header.PayloadLen || r.crc.Sum32() != r.header.PayloadCRC {
+		return fmt.Errorf("%s: checksum del payload non valido", r.path)
+	}
+	return io.EOF
+}
+
+func (r *binaryKVReader) BytesRead() int64 { return kvHeaderSize + r.payload.n }
+func (r *binaryKVReader) Close() error     { return r.file.Close() }
+
+// jsonKVReader legge una coppia JSON per riga
+type jsonKVReader struct {
+	file *os.File
+	dec  *json.Decoder
+}
+
+func (r *jsonKVReader) Read() (KeyValue, error) {
+	var kv KeyValue
+	err := r.dec.Decode(&kv)
+	return kv, err
+}
+
+func (r *jsonKVReader) BytesRead() int64 { return r.dec.InputOffset() }
+func (r *jsonKVReader) Close() error     { return r.file.Close() }
+
+// validateKVFile verifica un file intermedio e ne restituisce il numero di record. Per i
+// file con header controlla dimensione e checksum del payload senza decodificare i record;
+// i file JSON vengono decodificati per intero.
+func validateKVFile(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	magic, _ := br.Peek(len(kvMagic))
+	if !bytes.Equal(magic, []byte(kvMagic)) {
+		dec := json.NewDecoder(br)
+		var records int64
+		for dec.More() {
+			var kv KeyValue
+			if err := dec.Decode(&kv); err != nil {
+				return records, fmt.Errorf("decodifica JSON: %v", err)
+			}
+			records++
+		}
+		return records, nil
+	}
+
+	buf := make([]byte, kvHeaderSize)
+	if _, err := io.ReadFull(br, buf); err != nil {
+		return 0, fmt.Errorf("header incompleto: %v", err)
+	}
+	header, err := unmarshalKVFileHeader(buf)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := codecByID(header.Codec); err != nil {
+		return 0, err
+	}
+	crc := crc32.NewIEEE()
+	n, err := io.Copy(crc, br)
+	if err != nil {
+		return 0, err
+	}
+	if uint64(n) != header.PayloadLen {
+		return 0, fmt.Errorf("payload di %d byte, attesi %d", n, header.PayloadLen)
+	}
+	if crc.Sum32() != header.PayloadCRC {
+		return 0, fmt.Errorf("checksum del payload non valido")
+	}
+	return int64(header.Records), nil
+}
+
+// writeKeyValuesToFile scrive una slice di KeyValue in un file intermedio con il codec configurato
+func writeKeyValuesToFile(filename string, kvs []KeyValue) error {
+	w, err := createKVFile(filename, intermediateCodecName())
+	if err != nil {
+		return fmt.Errorf("errore creazione file %s: %v", filename, err)
+	}
+	for _, kv := range kvs {
+		if err := w.Write(kv); err != nil {
+			w.Close()
+			return fmt.Errorf("errore scrittura file %s: %v", filename, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("errore scrittura file %s: %v", filename, err)
+	}
+	return nil
+}
@@ -10,12 +10,45 @@ const (
 	defaultTempPath     = "temp-local"
 	defaultOutputPath   = "output"
 	defaultRaftDataPath = "raft-data"
+	defaultSplitSizeMB  = 64
+	defaultMaxAttempts  = 4
+	defaultWorkerSlots  = 1
 )
 
 // Config contiene tutta la configurazione del sistema
 type Config struct {
 	Dashboard DashboardConfig `mapstructure:"dashboard"`
 	Paths     PathConfig      `mapstructure:"paths"`
+	Jobs      JobConfig       `mapstructure:"jobs"`
+	Worker    WorkerConfig    `mapstructure:"worker"`
+	Shuffle   ShuffleConfig   `mapstructure:"shuffle"`
+}
+
+// JobConfig configurazione dei job
+type JobConfig struct {
+	SplitSizeMB     int  `mapstructure:"split_size_mb"`     // 0 = uno split per file
+	MaxTaskAttempts int  `mapstructure:"max_task_attempts"` // fallimenti di un task prima di far fallire il job
+	Speculative     bool `mapstructure:"speculative"`       // backup dei task lenti verso la fine di una fase
+	// Codec dei file intermedi: json, binary o gzip
+	IntermediateCodec string `mapstructure:"intermediate_codec"`
+	// Formato di output dei job che non ne indicano uno; OutputBanner aggiunge
+	// intestazione e riepilogo all'output unificato in formato text
+	OutputFormat string `mapstructure:"output_format"`
+	OutputBanner bool   `mapstructure:"output_banner"`
+	// Directory o prefisso s3:// dell'output dei job che non ne indicano una (vuoto = output locale)
+	OutputDir string `mapstructure:"output_dir"`
+}
+
+// WorkerConfig configurazione dei worker
+type WorkerConfig struct {
+	Slots int `mapstructure:"slots"` // task eseguiti in parallelo da un processo worker
+}
+
+// ShuffleConfig configurazione dello shuffle tra worker
+type ShuffleConfig struct {
+	Enabled bool   `mapstructure:"enabled"` // false = intermedi letti dal filesystem condiviso
+	Port    int    `mapstructure:"port"`    // 0 = porta scelta dal sistema
+	Host    string `mapstructure:"host"`    // host annunciato ai reduce (vuoto = hostname)
 }
 
 // PathConfig configurazione dei percorsi
@@ -43,6 +76,23 @@ func LoadConfig(configPath string) (*Config, error) {
 			Output:   getEnvString("OUTPUT_PATH", defaultOutputPath),
 			RaftData: getEnvString("RAFT_DATA_PATH", defaultRaftDataPath),
 		},
+		Jobs: JobConfig{
+			SplitSizeMB:       getEnvInt("SPLIT_SIZE_MB", defaultSplitSizeMB),
+			MaxTaskAttempts:   getEnvInt("MAX_TASK_ATTEMPTS", defaultMaxAttempts),
+			Speculative:       getEnvBool("SPECULATIVE_EXECUTION", false),
+			IntermediateCodec: getEnvString("INTERMEDIATE_CODEC", CodecBinary),
+			OutputFormat:      getEnvString("OUTPUT_FORMAT", OutputFormatText),
+			OutputBanner:      getEnvBool("OUTPUT_BANNER", false),
+			OutputDir:         getEnvString("MAPREDUCE_OUTPUT_DIR", ""),
+		},
+		Worker: WorkerConfig{
+			Slots: getEnvInt("WORKER_SLOTS", defaultWorkerSlots),
+		},
+		Shuffle: ShuffleConfig{
+			Enabled: getEnvBool("SHUFFLE_ENABLED", false),
+			Port:    getEnvInt("SHUFFLE_PORT", 0),
+			Host:    getEnvString("SHUFFLE_HOST", ""),
+		},
 	}
 
 	// Validazione configurazione
@@ -87,6 +137,68 @@ func (c *Config) GetRaftDataDir() string {
 	return c.Paths.RaftData
 }
 
+// GetSplitSize restituisce la dimensione degli split di input in byte (0 = uno split per file)
+func (c *Config) GetSplitSize() int64 {
+	if c == nil {
+		return int64(defaultSplitSizeMB) << 20
+	}
+	return int64(c.Jobs.SplitSizeMB) << 20
+}
+
+// IsSpeculativeEnabled indica se l'esecuzione speculativa dei task lenti è abilitata
+// (disabilitata di default, si attiva con SPECULATIVE_EXECUTION=true)
+func (c *Config) IsSpeculativeEnabled() bool {
+	if c == nil {
+		return false
+	}
+	return c.Jobs.Speculative
+}
+
+// GetMaxTaskAttempts restituisce il numero massimo di fallimenti ammessi per un task
+func (c *Config) GetMaxTaskAttempts() int {
+	if c == nil {
+		return defaultMaxAttempts
+	}
+	return c.Jobs.MaxTaskAttempts
+}
+
+// GetIntermediateCodec restituisce il codec dei file intermedi
+func (c *Config) GetIntermediateCodec() string {
+	if c == nil || c.Jobs.IntermediateCodec == "" {
+		return CodecBinary
+	}
+	return c.Jobs.IntermediateCodec
+}
+
+// GetOutputFormat restituisce il formato di output dei job che non ne indicano uno
+func (c *Config) GetOutputFormat() string {
+	if c == nil || c.Jobs.OutputFormat == "" {
+		return OutputFormatText
+	}
+	return c.Jobs.OutputFormat
+}
+
+// GetJobOutputDir restituisce la directory di output dei job che non ne indicano una
+func (c *Config) GetJobOutputDir() string {
+	if c == nil {
+		return ""
+	}
+	return c.Jobs.OutputDir
+}
+
+// IsOutputBannerEnabled indica se l'output unificato in formato text ha intestazione e riepilogo
+func (c *Config) IsOutputBannerEnabled() bool {
+	return c != nil && c.Jobs.OutputBanner
+}
+
+// GetWorkerSlots restituisce il numero di slot di esecuzione di un processo worker
+func (c *Config) GetWorkerSlots() int {
+	if c == nil || c.Worker.Slots <= 0 {
+		return defaultWorkerSlots
+	}
+	return c.Worker.Slots
+}
+
 // Helper functions per gestione variabili d'ambiente
 func getEnvString(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -122,5 +234,34 @@ func validateConfig(config *Config) error {
 		return fmt.Errorf("percorso dati Raft non può essere vuoto")
 	}
 
+	if config.Jobs.SplitSizeMB < 0 {
+		return fmt.Errorf("dimensione split non valida: %d MB", config.Jobs.SplitSizeMB)
+	}
+
+	if config.Jobs.MaxTaskAttempts <= 0 {
+		return fmt.Errorf("numero massimo di tentativi non valido: %d", config.Jobs.MaxTaskAttempts)
+	}
+
+	if codec := config.Jobs.IntermediateCodec; codec != CodecJSON {
+		if _, err := lookupIntermediateCodec(codec); err != nil {
+			return err
+		}
+	}
+
+	if _, err := LookupOutputFormat(config.Jobs.OutputFormat); err != nil {
+		return err
+	}
+	if err := validateOutputDir(config.Jobs.OutputDir); err != nil {
+		return err
+	}
+
+	if config.Shuffle.Port < 0 || config.Shuffle.Port > 65535 {
+		return fmt.Errorf("porta shuffle non valida: %d", config.Shuffle.Port)
+	}
+
+	if config.Worker.Slots <= 0 {
+		return fmt.Errorf("numero di slot del worker non valido: %d", config.Worker.Slots)
+	}
+
 	return nil
 }
@@ -14,9 +14,42 @@ const (
 	TaskMonitorInterval = 2 * time.Second
 	TaskRetryDelay      = 2 * time.Second
 
+	// Speculative execution: backup dei task lenti verso la fine di una fase
+	SpeculativePhaseThreshold = 0.75            // frazione di task completati oltre cui si specula
+	SpeculativeSlowdownFactor = 2.0             // durata rispetto alla mediana oltre cui un task è lento
+	SpeculativeMinRuntime     = 3 * time.Second // durata minima prima di lanciare un backup
+
+	// Reduce configuration
+	ReduceMemoryBudget = int64(64 << 20) // byte in memoria prima dello spill su disco
+	ReduceMergeFanIn   = 64              // run fusi contemporaneamente nel merge k-way
+
 	// Worker configuration
 	WorkerRetryDelay        = 5 * time.Second
 	WorkerHeartbeatInterval = 10 * time.Second
+	WorkerProgressInterval  = 3 * time.Second // invio dell'avanzamento del task in corso
+	MapProgressRecords      = 10000           // record di input tra due aggiornamenti dell'avanzamento del map
+
+	// Shuffle: i reduce scaricano le partizioni intermedie dai worker che hanno eseguito i map
+	ShufflePath             = "/shuffle"
+	ShuffleFetchTimeout     = 2 * time.Minute // timeout del download di una partizione
+	ShuffleFetchRetries     = 3               // tentativi prima di considerare perso l'output di un map
+	ShuffleRetryDelay       = time.Second
+	ShuffleFetchParallelism = 4 // download contemporanei per reduce task
+
+	// Applicazione streaming: durata massima di default di un processo mapper o reducer
+	StreamingTimeout = 10 * time.Minute
+
+	// Cache distribuita dei file accessori dei job
+	CacheDirName     = "cache"
+	CacheFileMaxSize = int64(64 << 20)  // dimensione massima di un file accessorio locale
+	CacheIdleTimeout = 30 * time.Minute // inutilizzo oltre cui la cache di un job viene rimossa
+
+	// Range partitioner: campionamento dell'input alla sottomissione del job
+	PartitionSampleChunks    = 64       // porzioni di input lette per job
+	PartitionSampleChunkSize = 64 << 10 // byte letti per porzione
+
+	// Sincronizzazione delle directory su S3
+	DefaultS3SyncWorkers = 4 // upload in parallelo
 
 	// Master configuration
 	MainLoopTimeout        = 5 * time.Minute
@@ -25,6 +58,7 @@ const (
 	ClusterManagementDelay = 2 * time.Second
 	ClusterMonitorInterval = 10 * time.Second
 	FileValidationInterval = 10 * time.Second
+	MaxRetainedJobs        = 50 // job terminati conservati nello stato replicato e negli snapshot
 
 	// Minimum arguments
 	MinMasterArgs = 4
@@ -48,6 +82,16 @@ const (
 	DonePhase
 )
 
+// Job status (stato amministrativo del job, indipendente dalla fase)
+type JobStatus int
+
+const (
+	JobActive JobStatus = iota
+	JobPaused
+	JobCanceled
+	JobFailed
+)
+
 // Task states
 type TaskState int
 
@@ -93,6 +137,21 @@ func (jp JobPhase) String() string {
 	}
 }
 
+func (js JobStatus) String() string {
+	switch js {
+	case JobActive:
+		return "active"
+	case JobPaused:
+		return "paused"
+	case JobCanceled:
+		return "canceled"
+	case JobFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
 func (ts TaskState) String() string {
 	switch ts {
 	case Idle:
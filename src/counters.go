@@ -0,0 +1,43 @@
+package main
+
+import "sync"
+
+// UserCounters raccoglie i contatori di dominio incrementati dalle funzioni map e reduce
+// di un task (righe malformate, record scartati, ...). I valori viaggiano con
+// TaskCompletedArgs e il master li somma nel job solo per il tentativo promosso.
+// Un *UserCounters nil è valido: gli incrementi vengono ignorati.
+type UserCounters struct {
+	mu     sync.Mutex
+	values map[string]int64
+}
+
+func newUserCounters() *UserCounters {
+	return &UserCounters{values: make(map[string]int64)}
+}
+
+// Inc somma delta al contatore name
+func (c *UserCounters) Inc(name string, delta int64) {
+	if c == nil || name == "" {
+		return
+	}
+	c.mu.Lock()
+	c.values[name] += delta
+	c.mu.Unlock()
+}
+
+// Snapshot restituisce una copia dei contatori, nil se non ne è stato incrementato nessuno
+func (c *UserCounters) Snapshot() map[string]int64 {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.values) == 0 {
+		return nil
+	}
+	snapshot := make(map[string]int64, len(c.values))
+	for name, value := range c.values {
+		snapshot[name] = value
+	}
+	return snapshot
+}
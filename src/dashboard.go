@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/rpc"
@@ -132,24 +133,71 @@ func (c *DashboardDataCache) Set(data *DashboardData) {
 
 // JobInfo informazioni su un job
 type JobInfo struct {
-	ID          string        `json:"id"`
-	Status      string        `json:"status"`
-	Phase       string        `json:"phase"`
-	StartTime   time.Time     `json:"start_time"`
-	EndTime     *time.Time    `json:"end_time,omitempty"`
-	Duration    time.Duration `json:"duration"`
-	MapTasks    int           `json:"map_tasks"`
-	ReduceTasks int           `json:"reduce_tasks"`
-	Progress    float64       `json:"progress"`
+	ID           string         `json:"id"`
+	Status       string         `json:"status"`
+	Phase        string         `json:"phase"`
+	StartTime    time.Time      `json:"start_time"`
+	EndTime      *time.Time     `json:"end_time,omitempty"`
+	Duration     time.Duration  `json:"duration"`
+	MapTasks     int            `json:"map_tasks"`
+	ReduceTasks  int            `json:"reduce_tasks"`
+	Progress     float64        `json:"progress"`
+	Counters     TaskCounters   `json:"counters"`
+	Error        string         `json:"error,omitempty"`         // causa del fallimento del job
+	RunningTasks []TaskProgress `json:"running_tasks,omitempty"` // avanzamento dei task in esecuzione
+}
+
+// JobDetails dettagli di un job per il dashboard
+type JobDetails struct {
+	ID           string            `json:"id"`
+	Status       string            `json:"status"`
+	Phase        string            `json:"phase"`
+	StartTime    time.Time         `json:"start_time"`
+	EndTime      *time.Time        `json:"end_time,omitempty"`
+	Progress     float64           `json:"progress"`
+	App          string            `json:"app"`
+	AppParams    map[string]string `json:"app_params,omitempty"`
+	InputFormat  string            `json:"input_format"`
+	OutputFormat string            `json:"output_format"`
+	OutputDir    string            `json:"output_dir,omitempty"`
+	Partitioner  string            `json:"partitioner"`
+	CacheFiles   []CacheFile       `json:"cache_files,omitempty"`
+	InputFiles   []string          `json:"input_files"`
+	MapTasks     TaskStateCounts   `json:"map_tasks"`
+	ReduceTasks  TaskStateCounts   `json:"reduce_tasks"`
+	MaxAttempts  int               `json:"max_attempts"`
+	Counters     TaskCounters      `json:"counters"`
+	Error        string            `json:"error,omitempty"`
+	ErrorLog     []string          `json:"error_log"` // errore del job e fallimenti dei task, in ordine di tempo
+	RunningTasks []TaskProgress    `json:"running_tasks,omitempty"`
+	Failures     []JobTaskFailure  `json:"failures"`
+}
+
+// TaskStateCounts conteggio dei task di un tipo per stato
+type TaskStateCounts struct {
+	Total      int `json:"total"`
+	Completed  int `json:"completed"`
+	InProgress int `json:"in_progress"`
+	Failed     int `json:"failed"` // task con almeno un tentativo fallito
+}
+
+// JobTaskFailure tentativo fallito di un task del job
+type JobTaskFailure struct {
+	TaskType string `json:"task_type"`
+	TaskID   int    `json:"task_id"`
+	TaskFailure
 }
 
 // WorkerInfoDashboard informazioni su un worker per il dashboard
 type WorkerInfoDashboard struct {
-	ID          string    `json:"id"`
-	Status      string    `json:"status"`
-	LastSeen    time.Time `json:"last_seen"`
-	TasksDone   int       `json:"tasks_done"`
-	CurrentTask string    `json:"current_task,omitempty"`
+	ID           string         `json:"id"`
+	Status       string         `json:"status"`
+	LastSeen     time.Time      `json:"last_seen"`
+	TasksDone    int            `json:"tasks_done"`
+	CurrentTask  string         `json:"current_task,omitempty"`
+	Slots        int            `json:"slots"`              // slot di esecuzione del worker
+	RunningTasks int            `json:"running_tasks"`      // task in esecuzione negli slot
+	Progress     []TaskProgress `json:"progress,omitempty"` // avanzamento dei task in esecuzione
 }
 
 // MasterInfo informazioni su un master
@@ -355,6 +403,29 @@ func (d *Dashboard) getRaftLeader(c *gin.Context) {
 	})
 }
 
+// errNoLeader indica che nessun master ha risposto come leader
+var errNoLeader = errors.New("nessun master leader disponibile")
+
+// callLeaderRPC esegue una chiamata RPC sul master leader
+func callLeaderRPC(method string, args interface{}, reply interface{}) error {
+	for _, rpcAddr := range getMasterRpcAddresses() {
+		client, err := rpc.DialHTTP("tcp", rpcAddr)
+		if err != nil {
+			continue
+		}
+		var infoArgs GetMasterInfoArgs
+		var info MasterInfoReply
+		if err := client.Call("Master.GetMasterInfo", &infoArgs, &info); err != nil || !info.IsLeader {
+			client.Close()
+			continue
+		}
+		err = client.Call(method, args, reply)
+		client.Close()
+		return rpcError(err)
+	}
+	return errNoLeader
+}
+
 // getIndex restituisce la pagina principale
 func (d *Dashboard) getIndex(c *gin.Context) {
 	data := d.getDashboardData()
@@ -775,43 +846,76 @@ func (d *Dashboard) GetWorker() *WorkerInfo {
 func (d *Dashboard) getJobDetails(c *gin.Context) {
 	jobID := c.Param("id")
 
-	// Per ora restituisce un messaggio di non implementato
-	c.JSON(http.StatusNotImplemented, gin.H{
-		"error":  "Job details not yet implemented",
-		"job_id": jobID,
+	if d.master == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"success": false,
+			"message": "Master not available",
+			"job_id":  jobID,
+		})
+		return
+	}
+	details, ok := d.master.GetJobDetails(jobID)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("job %q non trovato", jobID),
+			"job_id":  jobID,
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    details,
 	})
 }
 
 // pauseJob mette in pausa un job
 func (d *Dashboard) pauseJob(c *gin.Context) {
-	jobID := c.Param("id")
-
-	// Per ora restituisce un messaggio di non implementato
-	c.JSON(http.StatusNotImplemented, gin.H{
-		"error":  "Job pause not yet implemented",
-		"job_id": jobID,
-	})
+	d.controlJob(c, "Master.PauseJob", "paused")
 }
 
 // resumeJob riprende un job in pausa
 func (d *Dashboard) resumeJob(c *gin.Context) {
-	jobID := c.Param("id")
-
-	// Per ora restituisce un messaggio di non implementato
-	c.JSON(http.StatusNotImplemented, gin.H{
-		"error":  "Job resume not yet implemented",
-		"job_id": jobID,
-	})
+	d.controlJob(c, "Master.ResumeJob", "resumed")
 }
 
 // cancelJob cancella un job
 func (d *Dashboard) cancelJob(c *gin.Context) {
+	d.controlJob(c, "Master.CancelJob", "canceled")
+}
+
+// controlJob inoltra al master leader un comando di controllo sul job indicato
+func (d *Dashboard) controlJob(c *gin.Context, method, action string) {
 	jobID := c.Param("id")
 
-	// Per ora restituisce un messaggio di non implementato
-	c.JSON(http.StatusNotImplemented, gin.H{
-		"error":  "Job cancel not yet implemented",
-		"job_id": jobID,
+	args := JobControlArgs{JobID: jobID}
+	var reply JobControlReply
+	if err := callLeaderRPC(method, &args, &reply); err != nil {
+		status := http.StatusConflict
+		switch {
+		case errors.Is(err, errNoLeader):
+			status = http.StatusServiceUnavailable
+		case errors.Is(err, errJobNotFound):
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{
+			"success": false,
+			"error":   err.Error(),
+			"job_id":  jobID,
+		})
+		return
+	}
+
+	d.broadcastCustomUpdate("job_"+action, map[string]interface{}{
+		"job_id": reply.JobID,
+		"status": reply.Status,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": fmt.Sprintf("Job %s %s", reply.JobID, action),
+		"job_id":  reply.JobID,
+		"status":  reply.Status,
 	})
 }
 
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// Effetti sugli output: Apply deve restare deterministico e locale, quindi le operazioni
+// sullo storage degli output (che può essere s3://) decise dai comandi replicati vengono
+// solo accodate. Le esegue una goroutine del master, fuori da m.mu e solo sul leader; i
+// follower le scartano, perché gli output sono condivisi e li gestisce il leader.
+// Dopo la pubblicazione di un job il leader replica il comando publish-job: un nuovo
+// leader pubblica i job completati che ne sono privi, mentre la riesecuzione del log dopo
+// un riavvio salta quelli che lo hanno.
+
+// outputEffectKind indica l'operazione da eseguire sugli output di un job
+type outputEffectKind int
+
+const (
+	// outputPublish copia gli output di un job completato, crea il file unificato ed
+	// esegue il backup su S3
+	outputPublish outputEffectKind = iota
+	// outputCleanup rimuove gli output residui di un job attivato o interrotto
+	outputCleanup
+)
+
+// outputEffect è un'operazione sugli output accodata da Apply, con una copia del job al
+// momento del comando
+type outputEffect struct {
+	kind outputEffectKind
+	job  Job
+}
+
+// queueOutputEffect accoda un'operazione sugli output del job e sveglia la goroutine che
+// le esegue. Chiamato da Apply con m.mu acquisito.
+func (m *Master) queueOutputEffect(kind outputEffectKind, job *Job) {
+	snapshot := *job
+	snapshot.ReduceTasks = append([]TaskInfo(nil), job.ReduceTasks...)
+	m.outputEffects = append(m.outputEffects, outputEffect{kind: kind, job: snapshot})
+	select {
+	case m.outputEffectsReady <- struct{}{}:
+	default:
+	}
+}
+
+// runOutputEffects esegue in ordine le operazioni accodate da Apply finché il master è attivo
+func (m *Master) runOutputEffects() {
+	for range m.outputEffectsReady {
+		m.mu.Lock()
+		effects := m.outputEffects
+		m.outputEffects = nil
+		m.mu.Unlock()
+		if m.raft == nil || m.raft.State() != raft.Leader {
+			continue
+		}
+		// I comandi publish-job ancora da applicare devono essere visibili prima di
+		// decidere quali job pubblicare; senza leadership i job restano a chi la ottiene
+		if err := m.raft.Barrier(5 * time.Second).Error(); err != nil {
+			LogWarn("[Master] Operazioni sugli output rinviate: %v", err)
+			continue
+		}
+		for i := range effects {
+			m.runOutputEffect(&effects[i])
+		}
+	}
+}
+
+// runOutputEffect esegue un'operazione sugli output senza m.mu
+func (m *Master) runOutputEffect(effect *outputEffect) {
+	job := &effect.job
+	switch effect.kind {
+	case outputPublish:
+		m.mu.RLock()
+		current := m.jobs[job.ID]
+		published := current == nil || current.Published
+		m.mu.RUnlock()
+		if published {
+			LogDebug("[Master] Job %s già pubblicato, salto la pubblicazione", job.ID)
+			return
+		}
+		// Copia i file di output dal volume Docker alla cartella locale
+		m.copyOutputFilesToLocal(job)
+		// Backup su S3 se abilitato
+		m.backupToS3()
+		m.markJobPublished(job.ID)
+	case outputCleanup:
+		// Un comando rieseguito dal log dopo un riavvio non deve rimuovere gli output di un
+		// job che nel frattempo ha prodotto output o è stato completato; un job non più in
+		// stato è terminato da tempo (vedi pruneFinishedJobs)
+		m.mu.RLock()
+		current := m.jobs[job.ID]
+		progressed := current == nil || current.Phase == DonePhase ||
+			(!current.IsDone() && current.ReduceTasksDone > 0)
+		m.mu.RUnlock()
+		if progressed {
+			LogDebug("[Master] Job %s già avanzato, salto la pulizia degli output", job.ID)
+			return
+		}
+		m.cleanupOutputFiles(job)
+	}
+}
+
+// markJobPublished replica il marcatore di pubblicazione del job. Chiamato senza m.mu,
+// perché attende l'applicazione del comando.
+func (m *Master) markJobPublished(jobID string) {
+	if m.raft == nil {
+		return
+	}
+	cmdBytes, err := json.Marshal(LogCommand{Operation: "publish-job", JobID: jobID})
+	if err != nil {
+		LogError("[Master] Errore marshaling publish-job: %v", err)
+		return
+	}
+	if err := m.raft.Apply(cmdBytes, 5*time.Second).Error(); err != nil {
+		// Il job resta da pubblicare: lo riprende il prossimo leader
+		LogWarn("[Master] Errore applicando publish-job per il job %s: %v", jobID, err)
+	}
+}
+
+// publishPendingJobs accoda la pubblicazione dei job completati privi del marcatore: il
+// leader precedente potrebbe non aver eseguito le operazioni accodate. Chiamato dal nuovo leader.
+func (m *Master) publishPendingJobs() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, job := range m.orderedJobs() {
+		if job.Phase == DonePhase && !job.Published {
+			LogInfo("[Master] Job %s completato ma non pubblicato, accodo la pubblicazione", job.ID)
+			m.queueOutputEffect(outputPublish, job)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// Merge esterno per il reduce: i map task scrivono run ordinati per chiave, il reduce
+// li fonde in streaming. I file non ordinati (worker precedenti) vengono ordinati a
+// blocchi entro il budget di memoria e riversati su file di spill.
+
+// kvRecordOverhead stima l'occupazione in memoria di una KeyValue oltre ai byte delle stringhe
+const kvRecordOverhead = 64
+
+// reduceMemoryBudget restituisce il budget di memoria del reduce in byte
+// (REDUCE_MEMORY_MB sovrascrive il default)
+func reduceMemoryBudget() int64 {
+	if v := os.Getenv("REDUCE_MEMORY_MB"); v != "" {
+		if mb, err := strconv.Atoi(v); err == nil && mb > 0 {
+			return int64(mb) << 20
+		}
+	}
+	return ReduceMemoryBudget
+}
+
+// kvRun legge in streaming un file di coppie ordinate per chiave
+type kvRun struct {
+	path   string
+	reader kvReader
+	cur    KeyValue
+	ok     bool
+}
+
+// openKVRun apre un run e ne legge la prima coppia
+func openKVRun(path string) (*kvRun, error) {
+	reader, err := openKVFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &kvRun{path: path, reader: reader}
+	if err := r.advance(); err != nil {
+		reader.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// advance legge la coppia successiva; a fine file ok diventa false
+func (r *kvRun) advance() error {
+	kv, err := r.reader.Read()
+	if err != nil {
+		r.ok = false
+		if err == io.EOF {
+			return nil
+		}
+		return fmt.Errorf("lettura run %s: %v", r.path, err)
+	}
+	r.cur = kv
+	r.ok = true
+	return nil
+}
+
+func (r *kvRun) Close() {
+	r.reader.Close()
+}
+
+// kvRunHeap ordina i run per chiave corrente; a parità di chiave vince il run con indice minore
+type kvRunHeap struct {
+	runs  []*kvRun
+	order map[*kvRun]int
+}
+
+func (h *kvRunHeap) Len() int { return len(h.runs) }
+func (h *kvRunHeap) Less(i, j int) bool {
+	if h.runs[i].cur.Key != h.runs[j].cur.Key {
+		return h.runs[i].cur.Key < h.runs[j].cur.Key
+	}
+	return h.order[h.runs[i]] < h.order[h.runs[j]]
+}
+func (h *kvRunHeap) Swap(i, j int)      { h.runs[i], h.runs[j] = h.runs[j], h.runs[i] }
+func (h *kvRunHeap) Push(x interface{}) { h.runs = append(h.runs, x.(*kvRun)) }
+func (h *kvRunHeap) Pop() interface{} {
+	last := h.runs[len(h.runs)-1]
+	h.runs = h.runs[:len(h.runs)-1]
+	return last
+}
+
+// kvMerger esegue il merge k-way di più run ordinati
+type kvMerger struct {
+	all []*kvRun
+	h   *kvRunHeap
+}
+
+// newKVMerger apre i run indicati; i file vuoti vengono ignorati
+func newKVMerger(paths []string) (*kvMerger, error) {
+	m := &kvMerger{h: &kvRunHeap{order: make(map[*kvRun]int)}}
+	for i, path := range paths {
+		r, err := openKVRun(path)
+		if err != nil {
+			m.Close()
+			return nil, err
+		}
+		m.all = append(m.all, r)
+		if r.ok {
+			m.h.order[r] = i
+			m.h.runs = append(m.h.runs, r)
+		}
+	}
+	heap.Init(m.h)
+	return m, nil
+}
+
+// Next restituisce la chiave successiva con tutti i suoi valori; ok è false a fine merge
+func (m *kvMerger) Next() (key string, values []string, ok bool, err error) {
+	if m.h.Len() == 0 {
+		return "", nil, false, nil
+	}
+	key = m.h.runs[0].cur.Key
+	for m.h.Len() > 0 && m.h.runs[0].cur.Key == key {
+		r := m.h.runs[0]
+		values = append(values, r.cur.Value)
+		if err := r.advance(); err != nil {
+			return "", nil, false, err
+		}
+		if r.ok {
+			heap.Fix(m.h, 0)
+		} else {
+			heap.Pop(m.h)
+		}
+	}
+	return key, values, true, nil
+}
+
+// BytesRead restituisce i byte dei run consumati finora dal merge
+func (m *kvMerger) BytesRead() int64 {
+	var n int64
+	for _, r := range m.all {
+		n += r.reader.BytesRead()
+	}
+	return n
+}
+
+// Close chiude tutti i run aperti
+func (m *kvMerger) Close() {
+	for _, r := range m.all {
+		r.Close()
+	}
+}
+
+// isSortedKVFile verifica in streaming se un file di coppie è ordinato per chiave
+func isSortedKVFile(path string) (bool, error) {
+	r, err := openKVRun(path)
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+	prev := r.cur.Key
+	for r.ok {
+		if r.cur.Key < prev {
+			return false, nil
+		}
+		prev = r.cur.Key
+		if err := r.advance(); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// spillSorter scrive file di spill ordinati con nomi progressivi
+type spillSorter struct {
+	prefix string
+	budget int64
+	spills []string
+}
+
+// nextSpillPath restituisce il nome del prossimo file di spill e lo registra per la pulizia
+func (s *spillSorter) nextSpillPath() string {
+	path := fmt.Sprintf("%s%d", s.prefix, len(s.spills))
+	s.spills = append(s.spills, path)
+	return path
+}
+
+// writeSorted ordina il blocco in memoria e lo scrive in un nuovo file di spill
+func (s *spillSorter) writeSorted(kvs []KeyValue) (string, error) {
+	sort.SliceStable(kvs, func(i, j int) bool { return kvs[i].Key < kvs[j].Key })
+	path := s.nextSpillPath()
+	w, err := createKVFile(path, intermediateCodecName())
+	if err != nil {
+		return "", err
+	}
+	for _, kv := range kvs {
+		if err := w.Write(kv); err != nil {
+			w.Close()
+			return "", err
+		}
+	}
+	return path, w.Close()
+}
+
+// sortFile divide un file non ordinato in run ordinati che rispettano il budget di memoria
+func (s *spillSorter) sortFile(path string) ([]string, error) {
+	r, err := openKVRun(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var runs []string
+	var chunk []KeyValue
+	var size int64
+	for r.ok {
+		chunk = append(chunk, r.cur)
+		size += int64(len(r.cur.Key)+len(r.cur.Value)) + kvRecordOverhead
+		if size >= s.budget {
+			run, err := s.writeSorted(chunk)
+			if err != nil {
+				return nil, err
+			}
+			runs = append(runs, run)
+			chunk, size = nil, 0
+		}
+		if err := r.advance(); err != nil {
+			return nil, err
+		}
+	}
+	if len(chunk) > 0 {
+		run, err := s.writeSorted(chunk)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// mergeToSpill fonde più run in un unico file di spill ordinato
+func (s *spillSorter) mergeToSpill(paths []string) (string, error) {
+	m, err := newKVMerger(paths)
+	if err != nil {
+		return "", err
+	}
+	defer m.Close()
+
+	path := s.nextSpillPath()
+	w, err := createKVFile(path, intermediateCodecName())
+	if err != nil {
+		return "", err
+	}
+	for {
+		key, values, ok, err := m.Next()
+		if err != nil {
+			w.Close()
+			return "", err
+		}
+		if !ok {
+			break
+		}
+		for _, v := range values {
+			if err := w.Write(KeyValue{Key: key, Value: v}); err != nil {
+				w.Close()
+				return "", err
+			}
+		}
+	}
+	return path, w.Close()
+}
+
+// prepareSortedRuns restituisce i run ordinati da fondere per il reduce: i file già
+// ordinati sono usati direttamente, gli altri vengono ordinati su file di spill.
+// Se i run superano ReduceMergeFanIn vengono fusi a gruppi per limitare i file aperti.
+// Il chiamante deve rimuovere i file di spill restituiti.
+func prepareSortedRuns(inputs []string, budget int64, spillPrefix string) (runs []string, spills []string, err error) {
+	s := &spillSorter{prefix: spillPrefix, budget: budget}
+	for _, path := range inputs {
+		sorted, err := isSortedKVFile(path)
+		if err != nil {
+			return nil, s.spills, err
+		}
+		if sorted {
+			runs = append(runs, path)
+			continue
+		}
+		LogWarn("File intermedio %s non ordinato, ordinamento esterno su spill", path)
+		sortedRuns, err := s.sortFile(path)
+		if err != nil {
+			return nil, s.spills, err
+		}
+		runs = append(runs, sortedRuns...)
+	}
+
+	for len(runs) > ReduceMergeFanIn {
+		var merged []string
+		for start := 0; start < len(runs); start += ReduceMergeFanIn {
+			end := start + ReduceMergeFanIn
+			if end > len(runs) {
+				end = len(runs)
+			}
+			if end-start == 1 {
+				merged = append(merged, runs[start])
+				continue
+			}
+			path, err := s.mergeToSpill(runs[start:end])
+			if err != nil {
+				return nil, s.spills, err
+			}
+			merged = append(merged, path)
+		}
+		runs = merged
+	}
+	return runs, s.spills, nil
+}
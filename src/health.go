@@ -342,11 +342,15 @@ func CheckS3Connection() (bool, string, map[string]string) {
 		}
 	}
 
-	// In un'implementazione reale, faresti una chiamata di test a S3
-	return true, "", map[string]string{
+	details := map[string]string{
 		"bucket": bucket,
 		"region": region,
 	}
+	if endpoint := os.Getenv("S3_ENDPOINT"); endpoint != "" {
+		details["endpoint"] = endpoint
+	}
+	// In un'implementazione reale, faresti una chiamata di test a S3
+	return true, "", details
 }
 
 // CheckRaftCluster verifica lo stato del cluster Raft
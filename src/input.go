@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Formati di input: il map task legge il proprio split con l'InputFormat del job e passa
+// alla funzione di map un record alla volta, con file e offset del record. I file .gz e
+// .bz2 vengono decompressi in lettura; non essendo divisibili restano uno split per file
+// e l'offset dei loro record è relativo al contenuto decompresso.
+
+const (
+	// InputFormatLines produce un record per riga (default)
+	InputFormatLines = "lines"
+	// InputFormatJSONL produce un record per oggetto JSON, uno per riga
+	InputFormatJSONL = "jsonl"
+	// InputFormatCSV produce un record per riga CSV; la prima riga del file è l'intestazione
+	InputFormatCSV = "csv"
+)
+
+// Record è un record di input passato alla funzione di map
+type Record struct {
+	File   string
+	Offset int64             // offset del record nel file (nel contenuto decompresso per .gz/.bz2)
+	Value  string            // riga di testo, oggetto JSON o campi CSV uniti da virgola
+	Fields map[string]string // campi per nome: colonne CSV o campi di primo livello JSON
+}
+
+// RecordMapFunc è la funzione di map che riceve un record alla volta
+type RecordMapFunc func(rec Record) []KeyValue
+
+// recordMapFunc adatta una MapFunc ai record: viene chiamata con il valore di ogni record
+func recordMapFunc(mapf MapFunc) RecordMapFunc {
+	return func(rec Record) []KeyValue {
+		return mapf(rec.File, rec.Value)
+	}
+}
+
+// MalformedRecordError indica un record che il formato non riesce a interpretare:
+// il map task lo scarta e lo conta in TaskCounters.MalformedRecords
+type MalformedRecordError struct {
+	File   string
+	Offset int64
+	Err    error
+}
+
+func (e *MalformedRecordError) Error() string {
+	return fmt.Sprintf("record malformato in %s all'offset %d: %v", e.File, e.Offset, e.Err)
+}
+
+func (e *MalformedRecordError) Unwrap() error { return e.Err }
+
+// RecordReader legge in sequenza i record di uno split; Next restituisce io.EOF a fine split
+type RecordReader interface {
+	Next() (Record, error)
+	Close() error
+}
+
+// InputFormat apre i record di uno split di input
+type InputFormat interface {
+	Name() string
+	Open(split InputSplit) (RecordReader, error)
+}
+
+var inputFormats = struct {
+	sync.RWMutex
+	byName map[string]InputFormat
+}{byName: make(map[string]InputFormat)}
+
+// RegisterInputFormat registra un formato di input; un nome già presente viene sostituito
+func RegisterInputFormat(format InputFormat) {
+	inputFormats.Lock()
+	defer inputFormats.Unlock()
+	inputFormats.byName[format.Name()] = format
+}
+
+// InputFormatNames restituisce i nomi dei formati registrati in ordine alfabetico
+func InputFormatNames() []string {
+	inputFormats.RLock()
+	defer inputFormats.RUnlock()
+	names := make([]string, 0, len(inputFormats.byName))
+	for name := range inputFormats.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupInputFormat restituisce il formato con il nome indicato; vuoto = InputFormatLines
+func LookupInputFormat(name string) (InputFormat, error) {
+	if name == "" {
+		name = InputFormatLines
+	}
+	inputFormats.RLock()
+	format, ok := inputFormats.byName[name]
+	inputFormats.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("formato di input %q sconosciuto (disponibili: %s)", name, strings.Join(InputFormatNames(), ", "))
+	}
+	return format, nil
+}
+
+func init() {
+	RegisterInputFormat(linesFormat{})
+	RegisterInputFormat(jsonlFormat{})
+	RegisterInputFormat(csvFormat{})
+}
+
+// inputExtensions associa le estensioni dei file di input al formato che le legge
+var inputExtensions = map[string]string{
+	".txt":    InputFormatLines,
+	".jsonl":  InputFormatJSONL,
+	".ndjson": InputFormatJSONL,
+	".csv":    InputFormatCSV,
+}
+
+// compressionExtension restituisce l'estensione di compressione del file, vuota se non compresso
+func compressionExtension(file string) string {
+	lower := strings.ToLower(file)
+	for _, ext := range []string{".gz", ".bz2"} {
+		if strings.HasSuffix(lower, ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// isInputFileName indica se il file ha un'estensione di input riconosciuta, anche compressa
+func isInputFileName(name string) bool {
+	lower := strings.TrimSuffix(strings.ToLower(name), compressionExtension(name))
+	for ext := range inputExtensions {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// detectInputFormat sceglie il formato dall'estensione dei file quando è la stessa per
+// tutti; negli altri casi usa InputFormatLines
+func detectInputFormat(files []string) string {
+	detected := ""
+	for _, file := range files {
+		lower := strings.TrimSuffix(strings.ToLower(file), compressionExtension(file))
+		format := InputFormatLines
+		for ext, name := range inputExtensions {
+			if strings.HasSuffix(lower, ext) {
+				format = name
+			}
+		}
+		if detected != "" && detected != format {
+			return InputFormatLines
+		}
+		detected = format
+	}
+	if detected == "" {
+		return InputFormatLines
+	}
+	return detected
+}
+
+// openSplitStream apre il contenuto di uno split: i file compressi vengono decompressi per
+// intero, gli altri letti nell'intervallo dello split. base è l'offset del primo byte letto.
+func openSplitStream(split InputSplit) (r io.Reader, base int64, closer func() error, err error) {
+	compression := compressionExtension(split.File)
+	offset, length := split.Offset, split.Length
+	if compression != "" {
+		offset, length = 0, 0
+	}
+	f, err := storageFor(split.File).OpenRange(split.File, offset, length)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	switch compression {
+	case ".gz":
+		gz, err := gzip.NewReader(bufio.NewReader(f))
+		if err != nil {
+			f.Close()
+			return nil, 0, nil, fmt.Errorf("gzip %s: %v", split.File, err)
+		}
+		return gz, 0, func() error { gz.Close(); return f.Close() }, nil
+	case ".bz2":
+		return bzip2.NewReader(bufio.NewReader(f)), 0, f.Close, nil
+	}
+	return f, split.Offset, f.Close, nil
+}
+
+// splitInputSize restituisce la dimensione in byte dello split (almeno 1), usata per
+// l'avanzamento del map; per i file compressi è la dimensione compressa
+func splitInputSize(split InputSplit) int64 {
+	size := split.Length
+	if size == 0 {
+		if n, err := storageFor(split.File).Stat(split.File); err == nil {
+			size = n
+		}
+	}
+	if size < 1 {
+		size = 1
+	}
+	return size
+}
+
+// wholeSplitFormat restituisce il contenuto dello split come un unico record: è il
+// formato delle applicazioni con App.SplitMap. Con limit > 0 legge al più limit byte,
+// fermandosi all'ultima riga completa.
+type wholeSplitFormat struct {
+	limit int64
+}
+
+func (wholeSplitFormat) Name() string { return "split" }
+
+func (f wholeSplitFormat) Open(split InputSplit) (RecordReader, error) {
+	r, base, closer, err := openSplitStream(split)
+	if err != nil {
+		return nil, err
+	}
+	defer closer()
+	if f.limit > 0 {
+		r = io.LimitReader(r, f.limit)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if f.limit > 0 && int64(len(data)) == f.limit {
+		data = data[:bytes.LastIndexByte(data, '\n')+1]
+	}
+	return &wholeSplitReader{rec: Record{File: split.File, Offset: base, Value: string(data)}}, nil
+}
+
+type wholeSplitReader struct {
+	rec  Record
+	done bool
+}
+
+func (r *wholeSplitReader) Next() (Record, error) {
+	if r.done {
+		return Record{}, io.EOF
+	}
+	r.done = true
+	return r.rec, nil
+}
+
+func (r *wholeSplitReader) Close() error { return nil }
+
+// lineReader legge le righe di uno split tenendo traccia dell'offset di ciascuna
+type lineReader struct {
+	file   string
+	r      *bufio.Reader
+	offset int64
+	closer func() error
+}
+
+func openLineReader(split InputSplit) (*lineReader, error) {
+	r, base, closer, err := openSplitStream(split)
+	if err != nil {
+		return nil, err
+	}
+	return &lineReader{file: split.File, r: bufio.NewReaderSize(r, 64<<10), offset: base, closer: closer}, nil
+}
+
+// next restituisce la riga successiva senza terminatore e il suo offset
+func (l *lineReader) next() (string, int64, error) {
+	line, err := l.r.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", 0, err
+	}
+	offset := l.offset
+	l.offset += int64(len(line))
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), offset, nil
+}
+
+func (l *lineReader) Close() error { return l.closer() }
+
+// linesFormat produce un record per riga, incluse le righe vuote
+type linesFormat struct{}
+
+func (linesFormat) Name() string { return InputFormatLines }
+
+func (linesFormat) Open(split InputSplit) (RecordReader, error) {
+	lr, err := openLineReader(split)
+	if err != nil {
+		return nil, err
+	}
+	return linesRecordReader{lr}, nil
+}
+
+type linesRecordReader struct{ *lineReader }
+
+func (r linesRecordReader) Next() (Record, error) {
+	line, offset, err := r.next()
+	if err != nil {
+		return Record{}, err
+	}
+	return Record{File: r.file, Offset: offset, Value: line}, nil
+}
+
+// jsonlFormat produce un record per riga non vuota; ogni riga deve essere un valore JSON
+type jsonlFormat struct{}
+
+func (jsonlFormat) Name() string { return InputFormatJSONL }
+
+func (jsonlFormat) Open(split InputSplit) (RecordReader, error) {
+	lr, err := openLineReader(split)
+	if err != nil {
+		return nil, err
+	}
+	return jsonlRecordReader{lr}, nil
+}
+
+type jsonlRecordReader struct{ *lineReader }
+
+func (r jsonlRecordReader) Next() (Record, error) {
+	for {
+		line, offset, err := r.next()
+		if err != nil {
+			return Record{}, err
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		rec := Record{File: r.file, Offset: offset, Value: line}
+		var value interface{}
+		if err := json.Unmarshal([]byte(line), &value); err != nil {
+			return rec, &MalformedRecordError{File: r.file, Offset: offset, Err: err}
+		}
+		if obj, ok := value.(map[string]interface{}); ok {
+			rec.Fields = make(map[string]string, len(obj))
+			for name, v := range obj {
+				rec.Fields[name] = jsonFieldString(v)
+			}
+		}
+		return rec, nil
+	}
+}
+
+// jsonFieldString converte un campo JSON in stringa: le stringhe restano tali, null
+// diventa vuoto e gli altri valori vengono riserializzati
+func jsonFieldString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+// csvFormat produce un record per riga CSV con i campi indicizzati per intestazione.
+// Gli split successivi al primo leggono l'intestazione dall'inizio del file; gli split
+// sono allineati alle righe, quindi i campi tra virgolette non possono contenere a capo.
+type csvFormat struct{}
+
+func (csvFormat) Name() string { return InputFormatCSV }
+
+func (csvFormat) Open(split InputSplit) (RecordReader, error) {
+	r, base, closer, err := openSplitStream(split)
+	if err != nil {
+		return nil, err
+	}
+	reader := &csvRecordReader{file: split.File, base: base, closer: closer, r: csv.NewReader(r)}
+	reader.r.FieldsPerRecord = -1
+
+	if base == 0 {
+		reader.header, err = reader.r.Read()
+	} else {
+		reader.header, err = readCSVHeader(split.File)
+	}
+	if err == io.EOF {
+		return reader, nil
+	}
+	if err != nil {
+		closer()
+		return nil, fmt.Errorf("intestazione CSV di %s: %v", split.File, err)
+	}
+	return reader, nil
+}
+
+// readCSVHeader legge l'intestazione dalla prima riga del file
+func readCSVHeader(file string) ([]string, error) {
+	f, err := openStorageFile(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return csv.NewReader(bufio.NewReader(f)).Read()
+}
+
+type csvRecordReader struct {
+	file   string
+	base   int64
+	header []string
+	r      *csv.Reader
+	closer func() error
+}
+
+func (c *csvRecordReader) Next() (Record, error) {
+	offset := c.base + c.r.InputOffset()
+	fields, err := c.r.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return Record{File: c.file, Offset: offset}, &MalformedRecordError{File: c.file, Offset: offset, Err: err}
+		}
+		return Record{}, err
+	}
+	rec := Record{File: c.file, Offset: offset, Value: strings.Join(fields, ",")}
+	if len(fields) != len(c.header) {
+		return rec, &MalformedRecordError{File: c.file, Offset: offset,
+			Err: fmt.Errorf("%d campi, attesi %d dall'intestazione", len(fields), len(c.header))}
+	}
+	rec.Fields = make(map[string]string, len(fields))
+	for i, name := range c.header {
+		rec.Fields[name] = fields[i]
+	}
+	return rec, nil
+}
+
+func (c *csvRecordReader) Close() error { return c.closer() }
@@ -0,0 +1,313 @@
+package main
+
+import (
+	crand "crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultJobID identifica il job creato all'avvio del master dai file passati da riga di comando
+const DefaultJobID = "main-job"
+
+// errJobNotFound indica che il job richiesto non è registrato nel master
+var errJobNotFound = errors.New("job non trovato")
+
+// Job rappresenta un job MapReduce nella coda dell'FSM del master.
+// Ogni job ha la propria fase, le proprie tabelle dei task e i propri contatori.
+type Job struct {
+	ID              string            `json:"id"`
+	Phase           JobPhase          `json:"phase"`
+	Status          JobStatus         `json:"status"`
+	InputFiles      []string          `json:"input_files"`
+	Splits          []InputSplit      `json:"splits"` // uno split per map task
+	NReduce         int               `json:"n_reduce"`
+	App             string            `json:"app,omitempty"`
+	AppParams       map[string]string `json:"app_params,omitempty"`
+	MaxAttempts     int               `json:"max_attempts,omitempty"`  // 0 = defaultMaxAttempts
+	InputFormat     string            `json:"input_format,omitempty"`  // vuoto = InputFormatLines
+	OutputFormat    string            `json:"output_format,omitempty"` // vuoto = OutputFormatText
+	OutputDir       string            `json:"output_dir,omitempty"`    // directory o prefisso s3:// (vuoto = output locale)
+	Partitioner     string            `json:"partitioner,omitempty"`   // vuoto = PartitionerHash
+	PartitionBounds []string          `json:"partition_bounds,omitempty"`
+	CacheFiles      []CacheFile       `json:"cache_files,omitempty"` // file accessori scaricati dai worker
+	Error           string            `json:"error,omitempty"`       // causa del fallimento del job
+	MapTasks        []TaskInfo        `json:"map_tasks"`
+	ReduceTasks     []TaskInfo        `json:"reduce_tasks"`
+	MapTasksDone    int               `json:"map_tasks_done"`
+	ReduceTasksDone int               `json:"reduce_tasks_done"`
+	Counters        TaskCounters      `json:"counters"` // somma dei contatori dei task completati
+	SubmittedAt     time.Time         `json:"submitted_at"`
+	FinishedAt      time.Time         `json:"finished_at,omitempty"`
+	Started         bool              `json:"started,omitempty"`   // già attivato: gli output residui sono stati rimossi
+	Published       bool              `json:"published,omitempty"` // output completati pubblicati dal leader (vedi effects.go)
+}
+
+// newJob crea un job in MapPhase con tutti i task Idle a partire dalla specifica
+func newJob(spec *JobSpec) *Job {
+	splits := spec.Splits
+	if len(splits) == 0 {
+		splits = wholeFileSplits(spec.InputFiles)
+	}
+	return &Job{
+		ID:          spec.JobID,
+		Phase:       MapPhase,
+		InputFiles:  append([]string(nil), spec.InputFiles...),
+		NReduce:     spec.NReduce,
+		App:         spec.App,
+		AppParams:   spec.AppParams,
+		MaxAttempts: spec.MaxAttempts,
+		Splits:      splits,
+		InputFormat: spec.InputFormat,
+
+		OutputFormat:    spec.OutputFormat,
+		OutputDir:       spec.OutputDir,
+		Partitioner:     spec.Partitioner,
+		PartitionBounds: spec.PartitionBounds,
+		CacheFiles:      spec.CacheFiles,
+		MapTasks:        make([]TaskInfo, len(splits)),
+		ReduceTasks:     make([]TaskInfo, spec.NReduce),
+		SubmittedAt:     spec.SubmittedAt,
+	}
+}
+
+// newJobID genera un ID univoco per un nuovo job. Viene chiamato solo dal leader
+// e l'ID viene poi replicato tramite Raft, quindi resta stabile tra i failover.
+func newJobID() string {
+	var b [4]byte
+	if _, err := crand.Read(b[:]); err != nil {
+		return fmt.Sprintf("job-%d", time.Now().UnixNano())
+	}
+	return fmt.Sprintf("job-%d-%s", time.Now().Unix(), hex.EncodeToString(b[:]))
+}
+
+// newMapTask costruisce il map task che elabora lo split taskID
+func (j *Job) newMapTask(taskID int) *Task {
+	split := j.Splits[taskID]
+	return &Task{
+		Type:    MapTask,
+		JobID:   j.ID,
+		TaskID:  taskID,
+		Input:   split.File,
+		Offset:  split.Offset,
+		Length:  split.Length,
+		NReduce: j.NReduce,
+
+		InputFormat: j.InputFormat,
+		CacheFiles:  j.CacheFiles,
+
+		Partitioner:     j.Partitioner,
+		PartitionBounds: j.PartitionBounds,
+	}
+}
+
+// newReduceTask costruisce il task da assegnare per il reduce taskID, con la posizione
+// degli output dei map da cui scaricare le partizioni
+func (j *Job) newReduceTask(taskID int, checkpoint string) *Task {
+	return &Task{
+		Type:       ReduceTask,
+		JobID:      j.ID,
+		TaskID:     taskID,
+		NMap:       len(j.MapTasks),
+		Checkpoint: checkpoint,
+		MapOutputs: j.mapOutputs(taskID),
+		CacheFiles: j.CacheFiles,
+
+		OutputFormat: j.OutputFormat,
+		OutputDir:    j.OutputDir,
+	}
+}
+
+// resetCompletedTask riporta Idle un task Completed il cui output è andato perso o non è
+// più valido, sottraendo dal job i contatori del tentativo promosso. Il chiamante aggiorna
+// il numero di task completati della fase.
+func (j *Job) resetCompletedTask(info *TaskInfo) {
+	if info.Counters != nil {
+		j.Counters.Sub(*info.Counters)
+	}
+	info.State = Idle
+	info.Location = ""
+	info.Committed = ""
+	info.Counters = nil
+	info.Files = nil
+}
+
+// TaskFailure registra un tentativo fallito di un task, come segnalato dal worker
+type TaskFailure struct {
+	Attempt   int       `json:"attempt"`
+	AttemptID string    `json:"attempt_id,omitempty"`
+	WorkerID  string    `json:"worker_id"`
+	Error     string    `json:"error"`
+	Time      time.Time `json:"time"`
+}
+
+// IsDone indica se il job è in uno stato terminale: completato, cancellato o fallito
+func (j *Job) IsDone() bool {
+	return j.Phase == DonePhase || j.Status == JobCanceled || j.Status == JobFailed
+}
+
+// IsPaused indica se il job è stato messo in pausa
+func (j *Job) IsPaused() bool {
+	return j.Status == JobPaused && !j.IsDone()
+}
+
+// IsCanceled indica se il job è stato cancellato prima del completamento
+func (j *Job) IsCanceled() bool {
+	return j.Status == JobCanceled
+}
+
+// IsFailed indica se il job è fallito per aver esaurito i tentativi di un task
+func (j *Job) IsFailed() bool {
+	return j.Status == JobFailed
+}
+
+// maxAttempts restituisce il numero di fallimenti ammessi per ogni task del job
+func (j *Job) maxAttempts() int {
+	if j.MaxAttempts > 0 {
+		return j.MaxAttempts
+	}
+	return defaultMaxAttempts
+}
+
+// inputFormatName restituisce il formato di input del job, InputFormatLines se non indicato
+func (j *Job) inputFormatName() string {
+	if j.InputFormat == "" {
+		return InputFormatLines
+	}
+	return j.InputFormat
+}
+
+// outputFormat restituisce il formato di output del job, OutputFormatText se non indicato
+// o non più registrato
+func (j *Job) outputFormat() *OutputFormat {
+	if f, err := LookupOutputFormat(j.OutputFormat); err == nil {
+		return f
+	}
+	f, _ := LookupOutputFormat(OutputFormatText)
+	return f
+}
+
+// outputFileName restituisce il file di output definitivo del reduce taskID
+func (j *Job) outputFileName(taskID int) string {
+	return reduceOutputFileName(j.OutputDir, j.ID, taskID)
+}
+
+// checkpointFileName restituisce il checkpoint del reduce taskID
+func (j *Job) checkpointFileName(taskID int) string {
+	return reduceCheckpointFileName(j.OutputDir, j.ID, taskID)
+}
+
+// unifiedOutputName restituisce il nome del file che concatena gli output dei reduce del job
+func (j *Job) unifiedOutputName() string {
+	return "final-output-" + j.ID + j.outputFormat().Extension
+}
+
+// partitionerName restituisce il partitioner del job, PartitionerHash se non indicato
+func (j *Job) partitionerName() string {
+	if j.Partitioner == "" {
+		return PartitionerHash
+	}
+	return j.Partitioner
+}
+
+// Progress restituisce la percentuale di avanzamento della fase corrente
+func (j *Job) Progress() float64 {
+	switch j.Phase {
+	case MapPhase:
+		if len(j.MapTasks) > 0 {
+			return float64(j.MapTasksDone) / float64(len(j.MapTasks)) * 100
+		}
+	case ReducePhase:
+		if len(j.ReduceTasks) > 0 {
+			return float64(j.ReduceTasksDone) / float64(len(j.ReduceTasks)) * 100
+		}
+	case DonePhase:
+		return 100.0
+	}
+	return 0
+}
+
+// activeJob restituisce il primo job non completato e non in pausa in ordine FIFO (nil se
+// non ce ne sono): un job in pausa cede il posto ai successivi e, quando viene ripreso,
+// torna attivo prima di loro. Deve essere chiamato con m.mu acquisito.
+func (m *Master) activeJob() *Job {
+	for _, id := range m.jobQueue {
+		if job := m.jobs[id]; job != nil && !job.IsDone() && !job.IsPaused() {
+			return job
+		}
+	}
+	return nil
+}
+
+// getJob restituisce il job con l'ID indicato; un ID vuoto indica il job attivo
+// (compatibilità con comandi e worker che non conoscono il JobID).
+// Deve essere chiamato con m.mu acquisito.
+func (m *Master) getJob(jobID string) *Job {
+	if jobID == "" {
+		return m.activeJob()
+	}
+	return m.jobs[jobID]
+}
+
+// enqueueJob aggiunge un job in coda. Restituisce false se l'ID è già presente.
+// Deve essere chiamato con m.mu acquisito.
+func (m *Master) enqueueJob(job *Job) bool {
+	if m.jobs == nil {
+		m.jobs = make(map[string]*Job)
+	}
+	if _, exists := m.jobs[job.ID]; exists {
+		return false
+	}
+	m.jobs[job.ID] = job
+	m.jobQueue = append(m.jobQueue, job.ID)
+	return true
+}
+
+// settled indica se il job è terminato e non ha più operazioni in sospeso sugli output:
+// un job completato lo è solo dopo la pubblicazione
+func (j *Job) settled() bool {
+	return j.IsDone() && (j.Phase != DonePhase || j.Published)
+}
+
+// pruneFinishedJobs rimuove dallo stato i job terminati più vecchi oltre MaxRetainedJobs,
+// così che la coda e gli snapshot non crescano con il numero di job eseguiti. Dipende solo
+// dallo stato replicato: viene chiamato da Apply con m.mu acquisito.
+func (m *Master) pruneFinishedJobs() {
+	finished := 0
+	for _, id := range m.jobQueue {
+		if job := m.jobs[id]; job != nil && job.settled() {
+			finished++
+		}
+	}
+	if finished <= MaxRetainedJobs {
+		return
+	}
+	remove := finished - MaxRetainedJobs
+	queue := make([]string, 0, len(m.jobQueue)-remove)
+	for _, id := range m.jobQueue {
+		if job := m.jobs[id]; remove > 0 && job != nil && job.settled() {
+			delete(m.jobs, id)
+			for _, cleaned := range m.shuffleCleaned {
+				delete(cleaned, id)
+			}
+			remove--
+			LogInfo("[Master] Job %s rimosso dallo stato (conservati gli ultimi %d job terminati)", id, MaxRetainedJobs)
+			continue
+		}
+		queue = append(queue, id)
+	}
+	m.jobQueue = queue
+}
+
+// orderedJobs restituisce i job nell'ordine di sottomissione.
+// Deve essere chiamato con m.mu acquisito.
+func (m *Master) orderedJobs() []*Job {
+	jobs := make([]*Job, 0, len(m.jobQueue))
+	for _, id := range m.jobQueue {
+		if job := m.jobs[id]; job != nil {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
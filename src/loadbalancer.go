@@ -2,7 +2,6 @@ package main
 
 import (
 	"bufio"
-	"encoding/json"
 	"fmt"
 	"math/rand"
 	"net/http"
@@ -775,21 +774,22 @@ func (aft *AdvancedFaultTolerance) handleMapperFailure(workerID string) {
 	// Verifica se il mapper aveva task in corso
 	tasks := aft.getWorkerTasksByType(workerID, MapTask)
 
-	for _, mapID := range tasks {
+	for _, task := range tasks {
+		mapID := task.TaskID
 		// Verifica se il map task era completato
-		if aft.isMapTaskCompleted(mapID) {
+		if aft.isMapTaskCompleted(task.JobID, mapID) {
 			// Task completato: verifica se gli output intermedi sono stati scritti
-			if aft.verifyMapperOutputWritten(mapID) {
-				LogInfo("[FaultTolerance] Mapper %s task %d completato, dati arrivati al reducer", workerID, mapID)
+			if aft.verifyMapperOutputWritten(task.JobID, mapID) {
+				LogInfo("[FaultTolerance] Mapper %s task %d (job %s) completato, dati arrivati al reducer", workerID, mapID, task.JobID)
 				// Non serve riavviare il task
 			} else {
-				LogWarn("[FaultTolerance] Mapper %s task %d completato ma dati non arrivati, riavvio task", workerID, mapID)
-				aft.restartTask(mapID, "map")
+				LogWarn("[FaultTolerance] Mapper %s task %d (job %s) completato ma dati non arrivati, riavvio task", workerID, mapID, task.JobID)
+				aft.restartTask(task.JobID, mapID, "map")
 			}
 		} else {
 			// Task non completato: riavvia
-			LogWarn("[FaultTolerance] Mapper %s task %d non completato, riavvio task", workerID, mapID)
-			aft.restartTask(mapID, "map")
+			LogWarn("[FaultTolerance] Mapper %s task %d (job %s) non completato, riavvio task", workerID, mapID, task.JobID)
+			aft.restartTask(task.JobID, mapID, "map")
 		}
 	}
 }
@@ -817,23 +817,24 @@ func (aft *AdvancedFaultTolerance) handleReducerFailure(workerID string) {
 	// Verifica se il reducer aveva task in corso
 	tasks := aft.getWorkerTasksByType(workerID, ReduceTask)
 
-	for _, taskID := range tasks {
+	for _, task := range tasks {
+		taskID := task.TaskID
 		// Verifica se il reducer aveva ricevuto dati
-		if aft.hasReducerReceivedData(taskID) {
+		if aft.hasReducerReceivedData(task.JobID, taskID) {
 			// Reducer aveva ricevuto dati: verifica se aveva iniziato processing
-			if aft.hasReducerStartedProcessing(taskID) {
+			if aft.hasReducerStartedProcessing(task.JobID, taskID) {
 				// Reducer stava processando: nuovo reducer riparte dallo stato precedente
 				LogWarn("[FaultTolerance] Reducer %s task %d stava processando, nuovo reducer riparte dallo stato precedente", workerID, taskID)
-				aft.resumeReducerFromCheckpoint(taskID)
+				aft.resumeReducerFromCheckpoint(task.JobID, taskID)
 			} else {
 				// Reducer aveva ricevuto dati ma non aveva iniziato: nuovo reducer riceve gli stessi dati
 				LogInfo("[FaultTolerance] Reducer %s task %d aveva ricevuto dati ma non iniziato, nuovo reducer riceve gli stessi dati", workerID, taskID)
-				aft.assignSameDataToNewReducer(taskID)
+				aft.assignSameDataToNewReducer(task.JobID, taskID)
 			}
 		} else {
 			// Reducer non aveva ricevuto dati: nuovo reducer riceve gli stessi dati
 			LogInfo("[FaultTolerance] Reducer %s task %d non aveva ricevuto dati, nuovo reducer riceve gli stessi dati", workerID, taskID)
-			aft.assignSameDataToNewReducer(taskID)
+			aft.assignSameDataToNewReducer(task.JobID, taskID)
 		}
 	}
 }
@@ -855,7 +856,7 @@ func (aft *AdvancedFaultTolerance) isReducer(workerID string) bool {
 }
 
 // getWorkerTasks restituisce i task assegnati a un worker
-func (aft *AdvancedFaultTolerance) getWorkerTasksByType(workerID string, taskType TaskType) []int {
+func (aft *AdvancedFaultTolerance) getWorkerTasksByType(workerID string, taskType TaskType) []WorkerTask {
 	// Interroga il master leader per i task correnti del worker e filtra per tipo
 	rpcAddrs := getMasterRpcAddresses()
 	for _, addr := range rpcAddrs {
@@ -864,13 +865,13 @@ func (aft *AdvancedFaultTolerance) getWorkerTasksByType(workerID string, taskTyp
 			args := GetWorkerTasksArgs{WorkerID: workerID}
 			if err := client.Call("Master.GetWorkerTasks", &args, &reply); err == nil {
 				client.Close()
-				ids := make([]int, 0, len(reply.Tasks))
+				tasks := make([]WorkerTask, 0, len(reply.Tasks))
 				for _, t := range reply.Tasks {
 					if t.Type == taskType {
-						ids = append(ids, t.TaskID)
+						tasks = append(tasks, t)
 					}
 				}
-				return ids
+				return tasks
 			}
 			client.Close()
 		}
@@ -882,45 +883,30 @@ func (aft *AdvancedFaultTolerance) getWorkerTasksByType(workerID string, taskTyp
 // (rimosse funzioni deprecated non utilizzate)
 
 // isMapTaskCompleted verifica se un map task ha prodotto i file intermedi
-func (aft *AdvancedFaultTolerance) isMapTaskCompleted(mapID int) bool {
+func (aft *AdvancedFaultTolerance) isMapTaskCompleted(jobID string, mapID int) bool {
 	basePath := os.Getenv("TMP_PATH")
 	if basePath == "" {
 		basePath = "."
 	}
-	pattern := filepath.Join(basePath, fmt.Sprintf("mr-intermediate-%d-*", mapID))
+	pattern := filepath.Join(basePath, fmt.Sprintf("mr-intermediate-%s%d-*", jobFilePrefix(jobID), mapID))
 	matches, _ := filepath.Glob(pattern)
 	return len(matches) > 0
 }
 
 // verifyMapperOutputWritten verifica che gli intermedi del mapID siano presenti (e opzionalmente validi)
-func (aft *AdvancedFaultTolerance) verifyMapperOutputWritten(mapID int) bool {
+func (aft *AdvancedFaultTolerance) verifyMapperOutputWritten(jobID string, mapID int) bool {
 	basePath := os.Getenv("TMP_PATH")
 	if basePath == "" {
 		basePath = "."
 	}
-	pattern := filepath.Join(basePath, fmt.Sprintf("mr-intermediate-%d-*", mapID))
+	pattern := filepath.Join(basePath, fmt.Sprintf("mr-intermediate-%s%d-*", jobFilePrefix(jobID), mapID))
 	matches, _ := filepath.Glob(pattern)
 	if len(matches) == 0 {
 		return false
 	}
-	// Validazione JSON minima
+	// Validazione di header e checksum (le partizioni vuote sono valide)
 	for _, file := range matches {
-		f, err := os.Open(file)
-		if err != nil {
-			return false
-		}
-		dec := json.NewDecoder(f)
-		var kv KeyValue
-		hasData := false
-		for dec.More() {
-			if err := dec.Decode(&kv); err != nil {
-				f.Close()
-				return false
-			}
-			hasData = true
-		}
-		f.Close()
-		if !hasData {
+		if _, err := validateKVFile(file); err != nil {
 			return false
 		}
 	}
@@ -928,43 +914,31 @@ func (aft *AdvancedFaultTolerance) verifyMapperOutputWritten(mapID int) bool {
 }
 
 // hasReducerReceivedData verifica se un reducer ha ricevuto dati
-func (aft *AdvancedFaultTolerance) hasReducerReceivedData(taskID int) bool {
+func (aft *AdvancedFaultTolerance) hasReducerReceivedData(jobID string, taskID int) bool {
 	basePath := os.Getenv("TMP_PATH")
 	if basePath == "" {
 		basePath = "."
 	}
-	pattern := filepath.Join(basePath, fmt.Sprintf("mr-intermediate-*-%d", taskID))
+	pattern := filepath.Join(basePath, fmt.Sprintf("mr-intermediate-%s*-%d", jobFilePrefix(jobID), taskID))
 	matches, _ := filepath.Glob(pattern)
 	if len(matches) == 0 {
 		return false
 	}
-	// Validazione base JSON (come sopra)
+	// Validazione di header e checksum: serve almeno un record
+	var records int64
 	for _, file := range matches {
-		f, err := os.Open(file)
+		n, err := validateKVFile(file)
 		if err != nil {
 			return false
 		}
-		dec := json.NewDecoder(f)
-		var kv KeyValue
-		hasData := false
-		for dec.More() {
-			if err := dec.Decode(&kv); err != nil {
-				f.Close()
-				return false
-			}
-			hasData = true
-		}
-		f.Close()
-		if !hasData {
-			return false
-		}
+		records += n
 	}
-	return true
+	return records > 0
 }
 
 // hasReducerStartedProcessing verifica se un reducer ha iniziato l'elaborazione
-func (aft *AdvancedFaultTolerance) hasReducerStartedProcessing(taskID int) bool {
-	out := getOutputFileName(taskID)
+func (aft *AdvancedFaultTolerance) hasReducerStartedProcessing(jobID string, taskID int) bool {
+	out := getOutputFileName(jobID, taskID)
 	if _, err := os.Stat(out + ".partial"); err == nil {
 		return true
 	}
@@ -975,14 +949,14 @@ func (aft *AdvancedFaultTolerance) hasReducerStartedProcessing(taskID int) bool
 }
 
 // restartTask riavvia un task
-func (aft *AdvancedFaultTolerance) restartTask(taskID int, taskType string) {
-	LogInfo("[FaultTolerance] Riavvio task %d di tipo %s", taskID, taskType)
+func (aft *AdvancedFaultTolerance) restartTask(jobID string, taskID int, taskType string) {
+	LogInfo("[FaultTolerance] Riavvio task %d di tipo %s (job %s)", taskID, taskType, jobID)
 	// Chiama l'endpoint pubblico: inoltra al leader se necessario
 	rpcAddrs := getMasterRpcAddresses()
 	for _, addr := range rpcAddrs {
 		if client, err := rpc.DialHTTP("tcp", addr); err == nil {
 			var reply Reply
-			args := ResetTaskArgs{TaskID: taskID, Type: MapTask, Reason: "fault tolerance restart"}
+			args := ResetTaskArgs{JobID: jobID, TaskID: taskID, Type: MapTask, Reason: "fault tolerance restart"}
 			if taskType == "reduce" {
 				args.Type = ReduceTask
 			}
@@ -994,14 +968,14 @@ func (aft *AdvancedFaultTolerance) restartTask(taskID int, taskType string) {
 }
 
 // assignSameDataToNewReducer assegna gli stessi dati a un nuovo reducer
-func (aft *AdvancedFaultTolerance) assignSameDataToNewReducer(taskID int) {
+func (aft *AdvancedFaultTolerance) assignSameDataToNewReducer(jobID string, taskID int) {
 	LogInfo("[FaultTolerance] Assegnazione stessi dati a nuovo reducer per task %d", taskID)
 	// Notifica al master (endpoint pubblico) di riassegnare il task
 	rpcAddrs := getMasterRpcAddresses()
 	for _, addr := range rpcAddrs {
 		if client, err := rpc.DialHTTP("tcp", addr); err == nil {
 			var reply Reply
-			args := ResetTaskArgs{TaskID: taskID, Type: ReduceTask, Reason: "assign same data to new reducer"}
+			args := ResetTaskArgs{JobID: jobID, TaskID: taskID, Type: ReduceTask, Reason: "assign same data to new reducer"}
 			_ = client.Call("Master.PublicResetTask", &args, &reply)
 			client.Close()
 			break
@@ -1010,7 +984,7 @@ func (aft *AdvancedFaultTolerance) assignSameDataToNewReducer(taskID int) {
 }
 
 // resumeReducerFromCheckpoint fa ripartire un reducer dal checkpoint precedente
-func (aft *AdvancedFaultTolerance) resumeReducerFromCheckpoint(taskID int) {
+func (aft *AdvancedFaultTolerance) resumeReducerFromCheckpoint(jobID string, taskID int) {
 	LogInfo("[FaultTolerance] Ripresa reducer dal checkpoint per task %d", taskID)
 	// Notifica al master (endpoint pubblico) di riassegnare il reduce; il nuovo worker riprenderà dal checkpoint
 	rpcAddrs := getMasterRpcAddresses()
@@ -1018,8 +992,8 @@ func (aft *AdvancedFaultTolerance) resumeReducerFromCheckpoint(taskID int) {
 		if client, err := rpc.DialHTTP("tcp", addr); err == nil {
 			var reply Reply
 			// Passa il percorso del checkpoint per aiutare il master a ripristinare lo stato
-			checkpointPath := getOutputFileName(taskID) + ".checkpoint.json"
-			args := ResetTaskArgs{TaskID: taskID, Type: ReduceTask, Reason: "resume reducer from checkpoint; checkpoint=" + checkpointPath}
+			checkpointPath := getOutputFileName(jobID, taskID) + ".checkpoint.json"
+			args := ResetTaskArgs{JobID: jobID, TaskID: taskID, Type: ReduceTask, Reason: "resume reducer from checkpoint; checkpoint=" + checkpointPath}
 			_ = client.Call("Master.PublicResetTask", &args, &reply)
 			client.Close()
 			break
@@ -1037,40 +1011,20 @@ func (aft *AdvancedFaultTolerance) checkDataIntegrity() {
 		basePath = "."
 	}
 
-	// 1) Controlla intermedi: mr-intermediate-<map>-<reduce>
+	// 1) Controlla intermedi: mr-intermediate-[<job>-]<map>-<reduce>
 	interPattern := filepath.Join(basePath, "mr-intermediate-*-*")
 	interFiles, _ := filepath.Glob(interPattern)
 	for _, file := range interFiles {
-		f, err := os.Open(file)
-		if err != nil {
+		if _, err := validateKVFile(file); err != nil {
 			// Reset conservativo dei possibili map task coinvolti
-			if mapID, ok := extractMapIDFromIntermediate(file); ok {
-				LogWarn("[FaultTolerance] Intermedio illeggibile %s, reset MapTask %d", file, mapID)
-				aft.restartTask(mapID, "map")
-			}
-			continue
-		}
-		dec := json.NewDecoder(f)
-		var kv KeyValue
-		hasData := false
-		valid := true
-		for dec.More() {
-			if err := dec.Decode(&kv); err != nil {
-				valid = false
-				break
-			}
-			hasData = true
-		}
-		f.Close()
-		if !valid || !hasData {
-			if mapID, ok := extractMapIDFromIntermediate(file); ok {
-				LogWarn("[FaultTolerance] Intermedio corrotto/vuoto %s, reset MapTask %d", file, mapID)
-				aft.restartTask(mapID, "map")
+			if jobID, mapID, ok := extractMapIDFromIntermediate(file); ok {
+				LogWarn("[FaultTolerance] Intermedio corrotto %s (%v), reset MapTask %d", file, err, mapID)
+				aft.restartTask(jobID, mapID, "map")
 			}
 		}
 	}
 
-	// 2) Controlla output reduce mr-out-<id>
+	// 2) Controlla output reduce mr-out-[<job>-]<id>
 	outPattern := filepath.Join(basePath, "mr-out-*")
 	outFiles, _ := filepath.Glob(outPattern)
 	for _, file := range outFiles {
@@ -1080,9 +1034,9 @@ func (aft *AdvancedFaultTolerance) checkDataIntegrity() {
 		}
 		f, err := os.Open(file)
 		if err != nil {
-			if reduceID, ok := extractReduceIDFromOutput(file); ok {
+			if jobID, reduceID, ok := extractReduceIDFromOutput(file); ok {
 				LogWarn("[FaultTolerance] Output illeggibile %s, reset ReduceTask %d", file, reduceID)
-				aft.restartTask(reduceID, "reduce")
+				aft.restartTask(jobID, reduceID, "reduce")
 			}
 			continue
 		}
@@ -1097,9 +1051,9 @@ func (aft *AdvancedFaultTolerance) checkDataIntegrity() {
 		}
 		f.Close()
 		if !hasData {
-			if reduceID, ok := extractReduceIDFromOutput(file); ok {
+			if jobID, reduceID, ok := extractReduceIDFromOutput(file); ok {
 				LogWarn("[FaultTolerance] Output vuoto %s, reset ReduceTask %d", file, reduceID)
-				aft.restartTask(reduceID, "reduce")
+				aft.restartTask(jobID, reduceID, "reduce")
 			}
 		}
 	}
@@ -1112,30 +1066,30 @@ func (aft *AdvancedFaultTolerance) checkDataIntegrity() {
 // (no-op)
 
 // Helpers per estrarre ID da nomi file, resilienti senza regex pesanti
-func extractMapIDFromIntermediate(path string) (int, bool) {
-	base := filepath.Base(path) // mr-intermediate-<map>-<reduce>
+func extractMapIDFromIntermediate(path string) (string, int, bool) {
+	base := filepath.Base(path) // mr-intermediate-[<job>-]<map>-<reduce>
 	parts := strings.Split(base, "-")
 	if len(parts) < 4 {
-		return 0, false
+		return "", 0, false
 	}
-	// parts[2] = mapID
-	if id, err := strconv.Atoi(parts[2]); err == nil {
-		return id, true
+	// penultima parte = mapID, quelle tra "intermediate" e mapID = jobID (vuoto per i nomi legacy)
+	if id, err := strconv.Atoi(parts[len(parts)-2]); err == nil {
+		return strings.Join(parts[2:len(parts)-2], "-"), id, true
 	}
-	return 0, false
+	return "", 0, false
 }
 
-func extractReduceIDFromOutput(path string) (int, bool) {
-	base := filepath.Base(path) // mr-out-<id>
+func extractReduceIDFromOutput(path string) (string, int, bool) {
+	base := filepath.Base(path) // mr-out-[<job>-]<id>
 	parts := strings.Split(base, "-")
 	if len(parts) < 3 {
-		return 0, false
+		return "", 0, false
 	}
-	// parts[2] may include extension, but our files have no extension
-	if id, err := strconv.Atoi(parts[2]); err == nil {
-		return id, true
+	// ultima parte = reduceID, quelle tra "out" e reduceID = jobID (vuoto per i nomi legacy)
+	if id, err := strconv.Atoi(parts[len(parts)-1]); err == nil {
+		return strings.Join(parts[2:len(parts)-1], "-"), id, true
 	}
-	return 0, false
+	return "", 0, false
 }
 
 // ============================================================================
@@ -87,28 +87,21 @@ func runMaster() {
 	envGlob := os.Getenv("MAPREDUCE_INPUT_GLOB")
 	files := []string{}
 
-	// Check if S3 is enabled and input is from S3
-	if os.Getenv("S3_SYNC_ENABLED") == "true" && strings.HasPrefix(envGlob, "s3://") {
-		LogInfo("S3 input detected, downloading files from S3...")
-		
-		// Initialize S3 manager
-		s3Config := GetS3ConfigFromEnv()
-		if s3Manager, err := NewS3StorageManager(s3Config); err == nil {
-			// Download input files from S3
-			localInputPath := "/tmp/mapreduce/input"
-			if err := s3Manager.DownloadInputData(localInputPath); err != nil {
-				LogError("Failed to download input data from S3: %v", err)
-			} else {
-				// Get list of downloaded files
-				if inputFiles, err := s3Manager.GetInputFilesList(); err == nil {
-					for _, fileName := range inputFiles {
-						files = append(files, filepath.Join(localInputPath, fileName))
-					}
-					LogInfo("Downloaded %d input files from S3", len(files))
+	// Input from S3: the objects are read in place by the map tasks, nothing is downloaded
+	if strings.HasPrefix(envGlob, "s3://") {
+		pattern, prefixOnly := envGlob, !hasGlobMeta(envGlob)
+		if prefixOnly {
+			pattern = strings.TrimSuffix(envGlob, "/") + "/*"
+		}
+		if matches, err := storageFor(pattern).Glob(pattern); err == nil {
+			for _, match := range matches {
+				if !prefixOnly || isInputFileName(match) {
+					files = append(files, match)
 				}
 			}
+			LogInfo("Found %d input files on S3 for %s", len(files), envGlob)
 		} else {
-			LogError("Failed to initialize S3 manager: %v", err)
+			LogError("Failed to list S3 input %s: %v", envGlob, err)
 		}
 	} else {
 		// 1) If env glob is provided, use it (local filesystem)
@@ -126,12 +119,12 @@ func runMaster() {
 		}
 	}
 
-	// 3) If argument is a directory, take all .txt files inside
+	// 3) If argument is a directory, take all input files inside (.txt, .jsonl, .csv, also .gz/.bz2)
 	if len(files) == 0 {
 		if fi, err := os.Stat(rawArg); err == nil && fi.IsDir() {
 			entries, _ := os.ReadDir(rawArg)
 			for _, e := range entries {
-				if !e.IsDir() && strings.HasSuffix(strings.ToLower(e.Name()), ".txt") {
+				if !e.IsDir() && isInputFileName(e.Name()) {
 					files = append(files, filepath.Join(rawArg, e.Name()))
 				}
 			}
@@ -217,6 +210,9 @@ func runMaster() {
 		select {
 		case <-timeout:
 			LogWarn("[Master %d] Timeout raggiunto, esco", me)
+			// Lascia ai worker in attesa il tempo di ricevere ExitTask
+			m.Shutdown()
+			time.Sleep(WorkerRetryDelay)
 			return
 		case <-ticker.C:
 			if m.Done() {
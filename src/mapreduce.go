@@ -2,14 +2,18 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"hash/fnv"
 	"io"
+	"math"
 	"net/rpc"
 	"os"
+	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 	"unicode"
 )
@@ -33,8 +37,120 @@ func Map(filename string, contents string) []KeyValue {
 	return kva
 }
 
+// Reduce somma i conteggi della chiave. I valori sono "1" emessi da Map oppure
+// somme parziali prodotte dal combiner; un valore non numerico conta come 1.
 func Reduce(key string, values []string) string {
-	return strconv.Itoa(len(values))
+	total := 0
+	for _, v := range values {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			n = 1
+		}
+		total += n
+	}
+	return strconv.Itoa(total)
+}
+
+// taskRun è lo stato di un task in esecuzione in uno slot del worker: il goroutine di
+// heartbeat lo usa per segnalare l'abbandono chiesto dal master (pausa o cancellazione)
+// e per inviare l'avanzamento del task
+type taskRun struct {
+	abandoned bool
+	progress  TaskProgress
+}
+
+// runningTasks contiene i task in esecuzione negli slot del worker
+var runningTasks = struct {
+	sync.Mutex
+	tasks map[*Task]*taskRun
+}{tasks: make(map[*Task]*taskRun)}
+
+// abandonRunningTasks marca come abbandonati i task in esecuzione dei job indicati
+func abandonRunningTasks(jobIDs []string) {
+	runningTasks.Lock()
+	defer runningTasks.Unlock()
+	for _, jobID := range jobIDs {
+		for task, run := range runningTasks.tasks {
+			if task.JobID == jobID && !run.abandoned {
+				run.abandoned = true
+				LogWarn("Il master ha chiesto di abbandonare il task %v %d del job %s", task.Type, task.TaskID, jobID)
+			}
+		}
+	}
+}
+
+// isTaskAbandoned indica se il task in esecuzione deve essere abbandonato
+func isTaskAbandoned(task *Task) bool {
+	runningTasks.Lock()
+	defer runningTasks.Unlock()
+	run := runningTasks.tasks[task]
+	return run != nil && run.abandoned
+}
+
+// trackRunningTask registra il task come in esecuzione e ne invia periodicamente
+// l'avanzamento al master con l'RPC ReportProgress; la funzione restituita lo deregistra
+func trackRunningTask(masterAddr, workerID string, task *Task) func() {
+	if task.Type != MapTask && task.Type != ReduceTask {
+		return func() {}
+	}
+	runningTasks.Lock()
+	runningTasks.tasks[task] = &taskRun{progress: TaskProgress{
+		JobID:     task.JobID,
+		TaskID:    task.TaskID,
+		Type:      task.Type,
+		Attempt:   task.Attempt,
+		AttemptID: task.AttemptID,
+	}}
+	runningTasks.Unlock()
+
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(WorkerProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				runningTasks.Lock()
+				run := runningTasks.tasks[task]
+				var progress TaskProgress
+				if run != nil {
+					progress = run.progress
+				}
+				runningTasks.Unlock()
+				if run != nil {
+					reportTaskProgress(masterAddr, workerID, &progress)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		runningTasks.Lock()
+		delete(runningTasks.tasks, task)
+		runningTasks.Unlock()
+	}
+}
+
+// updateTaskProgress aggiorna l'avanzamento del task in esecuzione
+func updateTaskProgress(task *Task, bytes, records int64, percent float64) {
+	runningTasks.Lock()
+	defer runningTasks.Unlock()
+	if run := runningTasks.tasks[task]; run != nil {
+		run.progress.Bytes, run.progress.Records, run.progress.Percent = bytes, records, percent
+	}
+}
+
+// runningTaskProgress restituisce l'avanzamento di tutti i task in esecuzione
+func runningTaskProgress() []TaskProgress {
+	runningTasks.Lock()
+	defer runningTasks.Unlock()
+	progress := make([]TaskProgress, 0, len(runningTasks.tasks))
+	for _, run := range runningTasks.tasks {
+		progress = append(progress, run.progress)
+	}
+	return progress
 }
 
 // Worker runs the worker process for MapReduce
@@ -50,7 +166,8 @@ func Worker(mapf func(string, string) []KeyValue, reducef func(string, []string)
 			workerID = fmt.Sprintf("worker-%d", os.Getpid())
 		}
 	}
-	LogInfo("Worker ID: %s", workerID)
+	slots := GetConfig().GetWorkerSlots()
+	LogInfo("Worker ID: %s, slot: %d", workerID, slots)
 
 	// Ottiene gli indirizzi dei master dalla configurazione
 	rpcAddrs := getMasterRpcAddresses()
@@ -66,54 +183,136 @@ func Worker(mapf func(string, string) []KeyValue, reducef func(string, []string)
 
 	LogInfo("Worker connesso a %d master: %v", len(rpcAddrs), rpcAddrs)
 
+	// Avvia il server shuffle che serve ai reduce gli intermedi prodotti da questo worker
+	if shuffleConfig := GetConfig().Shuffle; shuffleConfig.Enabled {
+		addr, err := startShuffleServer(shuffleConfig)
+		if err != nil {
+			LogError("Shuffle tra worker non disponibile, uso il filesystem condiviso: %v", err)
+		} else {
+			workerShuffleAddr = addr
+			LogInfo("Server shuffle in ascolto, annunciato come %s", addr)
+		}
+	}
+
 	// Avvia il heartbeat in background
 	go func() {
 		heartbeatTicker := time.NewTicker(WorkerHeartbeatInterval)
 		defer heartbeatTicker.Stop()
 
 		for range heartbeatTicker.C {
-			sendHeartbeat(workerID, rpcAddrs)
+			sendHeartbeat(workerID, slots, rpcAddrs)
 		}
 	}()
 
-	// Loop principale del worker
+	// Ogni slot richiede ed esegue task in modo indipendente
+	var wg sync.WaitGroup
+	for slot := 0; slot < slots; slot++ {
+		wg.Add(1)
+		go func(slot int) {
+			defer wg.Done()
+			runWorkerSlot(slot, workerID, slots, rpcAddrs, mapf, reducef)
+		}(slot)
+	}
+	wg.Wait()
+
+	LogInfo("Worker terminato")
+}
+
+// runWorkerSlot è il loop di uno slot del worker: richiede un task al master, lo esegue
+// e ne segnala l'esito, finché il master non invia un task di uscita
+func runWorkerSlot(slot int, workerID string, slots int, rpcAddrs []string, mapf func(string, string) []KeyValue, reducef func(string, []string) string) {
 	for {
 		// Cerca un master disponibile
-		masterAddr := findAvailableMaster(rpcAddrs, workerID)
+		masterAddr := findAvailableMaster(rpcAddrs, workerID, slots)
 		if masterAddr == "" {
-			LogWarn("Nessun master disponibile, riprovo tra 5 secondi...")
+			LogWarn("Slot %d: nessun master disponibile, riprovo tra 5 secondi...", slot)
 			time.Sleep(WorkerRetryDelay)
 			continue
 		}
 
-		LogInfo("Worker connesso al master: %s", masterAddr)
+		LogInfo("Slot %d connesso al master: %s", slot, masterAddr)
 
 		// Richiede un task dal master
-		task := requestTaskFromMaster(masterAddr, workerID)
+		task := requestTaskFromMaster(masterAddr, workerID, slots)
 		if task == nil {
-			LogDebug("Nessun task disponibile, riprovo tra 2 secondi...")
+			LogDebug("Slot %d: nessun task disponibile, riprovo tra 2 secondi...", slot)
+			time.Sleep(TaskRetryDelay)
+			continue
+		}
+
+		// Scarica una volta per job i file accessori e sceglie le funzioni map/reduce/combine
+		// dell'applicazione del job
+		cacheFiles, releaseCache, err := prepareJobCache(masterAddr, task)
+		if err != nil {
+			LogError("Task %d del job %s: file accessori non disponibili: %v", task.TaskID, task.JobID, err)
+			reportTaskFailure(masterAddr, task, workerID, err)
+			time.Sleep(TaskRetryDelay)
+			continue
+		}
+		counters, failure := newUserCounters(), &appFailure{}
+		ctx := AppContext{Counters: counters, CacheFiles: cacheFiles, failure: failure}
+		funcs, err := resolveTaskFuncs(task, ctx, mapf, reducef)
+		if err != nil {
+			releaseCache()
+			LogError("Task %d del job %s non eseguibile: %v", task.TaskID, task.JobID, err)
+			reportTaskFailure(masterAddr, task, workerID, err)
 			time.Sleep(TaskRetryDelay)
 			continue
 		}
 
 		// Esegue il task
-		executeTask(task, mapf, reducef)
+		untrack := trackRunningTask(masterAddr, workerID, task)
+		result, err := executeTask(task, funcs)
+		if err == nil {
+			// Errori segnalati dalle funzioni dell'applicazione (es. processo di streaming fallito)
+			err = failure.Err()
+		}
+		releaseCache()
+		result.Counters.User = counters.Snapshot()
+		abandoned := isTaskAbandoned(task)
+		untrack()
+
+		// Un task abbandonato (job in pausa o cancellato) non va segnalato come completato
+		if abandoned {
+			LogWarn("Task %d del job %s abbandonato, non segnalo il completamento", task.TaskID, task.JobID)
+			removeAttemptFiles(taskOutputFiles(task.JobID, task.Type, task.TaskID, task.NReduce, task.OutputDir), task.AttemptID)
+			continue
+		}
+
+		// Output di map non più raggiungibili: il master riesegue i map e rimette in coda il reduce
+		var lostErr *mapOutputLostError
+		if errors.As(err, &lostErr) {
+			LogWarn("Task %v %d del job %s: %v", task.Type, task.TaskID, task.JobID, err)
+			removeAttemptFiles(taskOutputFiles(task.JobID, task.Type, task.TaskID, task.NReduce, task.OutputDir), task.AttemptID)
+			reportMapOutputLost(masterAddr, task, workerID, lostErr)
+			continue
+		}
+
+		// Un task fallito viene segnalato subito, senza attendere il timeout del master
+		if err != nil {
+			LogError("Task %v %d del job %s fallito (tentativo %d): %v", task.Type, task.TaskID, task.JobID, task.Attempt, err)
+			removeAttemptFiles(taskOutputFiles(task.JobID, task.Type, task.TaskID, task.NReduce, task.OutputDir), task.AttemptID)
+			reportTaskFailure(masterAddr, task, workerID, err)
+			continue
+		}
 
-		// Segnala il completamento del task
-		reportTaskCompletion(masterAddr, task, workerID)
+		// Segnala il completamento del task; gli intermedi serviti da questo worker e rifiutati
+		// dal master (tentativo superato da un altro) non servono più
+		if err := reportTaskCompletion(masterAddr, task, workerID, result); err != nil &&
+			task.Type == MapTask && workerShuffleAddr != "" && task.AttemptID != "" {
+			removeAttemptFiles(taskOutputFiles(task.JobID, task.Type, task.TaskID, task.NReduce, task.OutputDir), task.AttemptID)
+		}
 
 		// Se il task è di uscita, termina
 		if task.Type == ExitTask {
-			LogInfo("Worker ricevuto task di uscita, termino...")
-			break
+			LogInfo("Slot %d ricevuto task di uscita, termino...", slot)
+			return
 		}
 	}
-
-	LogInfo("Worker terminato")
 }
 
 // findAvailableMaster cerca il master leader tra quelli configurati
-func findAvailableMaster(rpcAddrs []string, workerID string) string {
+func findAvailableMaster(rpcAddrs []string, workerID string, slots int) string {
 	for _, addr := range rpcAddrs {
 		// Prova a connettersi al master
 		client, err := rpc.DialHTTP("tcp", addr)
@@ -142,7 +341,7 @@ func findAvailableMaster(rpcAddrs []string, workerID string) string {
 		}
 
 		var reply Task
-		err = client.Call("Master.AssignTask", RequestTaskArgs{WorkerID: workerID}, &reply)
+		err = client.Call("Master.AssignTask", RequestTaskArgs{WorkerID: workerID, Slots: slots}, &reply)
 		client.Close()
 
 		if err == nil {
@@ -155,7 +354,7 @@ func findAvailableMaster(rpcAddrs []string, workerID string) string {
 }
 
 // requestTaskFromMaster richiede un task dal master specificato
-func requestTaskFromMaster(masterAddr string, workerID string) *Task {
+func requestTaskFromMaster(masterAddr string, workerID string, slots int) *Task {
 	client, err := rpc.DialHTTP("tcp", masterAddr)
 	if err != nil {
 		LogError("Errore connessione master %s: %v", masterAddr, err)
@@ -164,7 +363,7 @@ func requestTaskFromMaster(masterAddr string, workerID string) *Task {
 	defer client.Close()
 
 	var task Task
-	err = client.Call("Master.AssignTask", RequestTaskArgs{WorkerID: workerID}, &task)
+	err = client.Call("Master.AssignTask", RequestTaskArgs{WorkerID: workerID, Slots: slots}, &task)
 	if err != nil {
 		LogError("Errore richiesta task da %s: %v", masterAddr, err)
 		return nil
@@ -173,72 +372,234 @@ func requestTaskFromMaster(masterAddr string, workerID string) *Task {
 	return &task
 }
 
+// resolveTaskFuncs restituisce le funzioni map/reduce e l'eventuale combiner dell'applicazione
+// indicata dal task, costruite con i parametri del job e il contesto del task (contatori utente
+// e file accessori); i task senza applicazione (master precedenti) usano le funzioni passate al worker
+func resolveTaskFuncs(task *Task, ctx AppContext, mapf func(string, string) []KeyValue, reducef func(string, []string) string) (taskFuncs, error) {
+	if task.App == "" || (task.Type != MapTask && task.Type != ReduceTask) {
+		return taskFuncs{RecordMap: recordMapFunc(mapf), Reduce: reducef}, nil
+	}
+	ctx.Params = task.AppParams
+	app, err := LookupApp(task.App)
+	if err != nil {
+		return taskFuncs{}, err
+	}
+	var funcs taskFuncs
+	if app.SplitMap {
+		if funcs.Map, err = app.NewMap(ctx); err != nil {
+			return taskFuncs{}, fmt.Errorf("parametri map non validi per %s: %v", app.Name, err)
+		}
+	} else if funcs.RecordMap, err = buildAppRecordMap(app, ctx); err != nil {
+		return taskFuncs{}, err
+	}
+	if funcs.Reduce, err = buildAppReduce(app, ctx); err != nil {
+		return taskFuncs{}, err
+	}
+	if funcs.Combine, err = buildAppCombiner(task.App, ctx); err != nil {
+		return taskFuncs{}, err
+	}
+	if funcs.StreamReduce, err = buildAppStreamReduce(app, ctx); err != nil {
+		return taskFuncs{}, err
+	}
+	return funcs, nil
+}
+
 // executeTask esegue il task assegnato
-func executeTask(task *Task, mapf func(string, string) []KeyValue, reducef func(string, []string) string) {
-	LogInfo("Eseguendo task: Type=%d, TaskID=%d", task.Type, task.TaskID)
+func executeTask(task *Task, funcs taskFuncs) (taskResult, error) {
+	var result taskResult
+	var err error
+	LogInfo("Eseguendo task: Job=%s, App=%s, Type=%d, TaskID=%d", task.JobID, task.App, task.Type, task.TaskID)
 
 	switch task.Type {
 	case MapTask:
-		executeMapTask(task, mapf)
+		if funcs.RecordMap != nil {
+			result, err = executeRecordMapTask(task, funcs.RecordMap, funcs.Combine)
+		} else {
+			result, err = executeMapTask(task, funcs.Map, funcs.Combine)
+		}
 	case ReduceTask:
-		executeReduceTask(task, reducef)
+		if funcs.StreamReduce != nil {
+			result, err = executeStreamReduceTask(task, funcs.StreamReduce)
+		} else {
+			result, err = executeReduceTask(task, funcs.Reduce)
+		}
 	case NoTask:
 		LogDebug("Nessun task da eseguire")
 	case ExitTask:
 		LogInfo("Task di uscita ricevuto")
 	}
+	return result, err
 }
 
-// executeMapTask esegue un task di mappatura
-func executeMapTask(task *Task, mapf func(string, string) []KeyValue) {
-	LogInfo("Eseguendo MapTask %d su file: %s", task.TaskID, task.Input)
+// executeMapTask esegue un task di mappatura passando alla funzione di map l'intero split
+func executeMapTask(task *Task, mapf func(string, string) []KeyValue, combinef CombineFunc) (taskResult, error) {
+	return runMapTask(task, wholeSplitFormat{}, recordMapFunc(mapf), combinef)
+}
 
-	// Legge il file di input
-	file, err := os.Open(task.Input)
+// executeRecordMapTask esegue un task di mappatura leggendo lo split con il formato di
+// input del job e chiamando la funzione di map per ogni record
+func executeRecordMapTask(task *Task, mapr RecordMapFunc, combinef CombineFunc) (taskResult, error) {
+	format, err := LookupInputFormat(task.InputFormat)
 	if err != nil {
-		LogError("Errore apertura file %s: %v", task.Input, err)
-		return
+		return taskResult{}, err
 	}
-	defer file.Close()
+	return runMapTask(task, format, mapr, combinef)
+}
+
+// runMapTask legge i record dello split, applica la map e scrive i file intermedi
+func runMapTask(task *Task, format InputFormat, mapr RecordMapFunc, combinef CombineFunc) (taskResult, error) {
+	var result taskResult
+	counters := &result.Counters
+	split := InputSplit{File: task.Input, Offset: task.Offset, Length: task.Length}
+	LogInfo("Eseguendo MapTask %d su file: %s (formato %s)", task.TaskID, task.Input, format.Name())
 
-	content, err := io.ReadAll(file)
+	// Apre lo split di input assegnato al task
+	reader, err := format.Open(split)
 	if err != nil {
-		LogError("Errore lettura file %s: %v", task.Input, err)
-		return
+		return result, fmt.Errorf("errore lettura split %s: %v", split, err)
 	}
+	defer reader.Close()
 
-	// Applica la funzione di mappatura
-	kva := mapf(task.Input, string(content))
+	partitioner, err := newTaskPartitioner(task)
+	if err != nil {
+		return result, err
+	}
+
+	// Applica la funzione di mappatura a ogni record; i record malformati vengono scartati
+	size := splitInputSize(split)
+	var kva []KeyValue
+	var processed int64
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		var malformed *MalformedRecordError
+		if errors.As(err, &malformed) {
+			counters.MalformedRecords++
+			LogDebug("MapTask %d: %v", task.TaskID, err)
+			continue
+		}
+		if err != nil {
+			return result, fmt.Errorf("errore lettura split %s: %v", split, err)
+		}
+		counters.InputRecords++
+		kva = append(kva, mapr(rec)...)
+		processed = rec.Offset - split.Offset + int64(len(rec.Value))
+		if counters.InputRecords%MapProgressRecords == 0 {
+			updateTaskProgress(task, processed, int64(len(kva)), 20+40*math.Min(1, float64(processed)/float64(size)))
+		}
+	}
+	if counters.MalformedRecords > 0 {
+		LogWarn("MapTask %d: scartati %d record malformati di %s", task.TaskID, counters.MalformedRecords, split)
+	}
+	updateTaskProgress(task, processed, int64(len(kva)), 60)
 
-	// Raggruppa i risultati per chiave di riduzione
-	intermediate := make(map[int][]KeyValue)
+	// Raggruppa i risultati per chiave di riduzione; ogni partizione ha il suo file, anche
+	// vuoto, così il reduce distingue una partizione vuota da un output perso
+	intermediate := make([][]KeyValue, task.NReduce)
 	for _, kv := range kva {
-		reduceTaskID := ihash(kv.Key) % task.NReduce
+		reduceTaskID := partitioner.Partition(kv.Key, task.NReduce)
 		intermediate[reduceTaskID] = append(intermediate[reduceTaskID], kv)
 	}
 
-	// Scrive i file intermedi
+	if isTaskAbandoned(task) {
+		LogWarn("MapTask %d abbandonato, non scrivo i file intermedi", task.TaskID)
+		return result, nil
+	}
+
+	// Scrive i file intermedi, applicando il combiner per partizione se presente
+	counters.RecordsBeforeCombine = int64(len(kva))
+	written := 0
 	for reduceTaskID, kvs := range intermediate {
-		filename := getIntermediateFileName(task.TaskID, reduceTaskID)
-		writeKeyValuesToFile(filename, kvs)
+		// Ogni file intermedio è un run ordinato per chiave, pronto per il merge del reduce
+		if combinef != nil {
+			kvs = combineKeyValues(kvs, combinef)
+		} else {
+			sort.SliceStable(kvs, func(i, j int) bool { return kvs[i].Key < kvs[j].Key })
+		}
+		counters.RecordsAfterCombine += int64(len(kvs))
+		// I file del tentativo vengono promossi dal master al commit del task
+		filename := attemptFileName(getIntermediateFileName(task.JobID, task.TaskID, reduceTaskID), task.AttemptID)
+		if err := writeKeyValuesToFile(filename, kvs); err != nil {
+			return result, err
+		}
+		checksum, err := newFileChecksum(filename, reduceTaskID, int64(len(kvs)))
+		if err != nil {
+			return result, err
+		}
+		result.Files = append(result.Files, checksum)
+		written++
+		updateTaskProgress(task, processed, int64(len(kva)), 60+40*float64(written)/float64(len(intermediate)))
 	}
 
-	LogInfo("MapTask %d completato, scritti %d file intermedi", task.TaskID, len(intermediate))
+	LogInfo("MapTask %d completato, scritti %d file intermedi (record di input: %d; coppie: %d prima del combiner, %d dopo)",
+		task.TaskID, len(intermediate), counters.InputRecords, counters.RecordsBeforeCombine, counters.RecordsAfterCombine)
+	return result, nil
+}
+
+// combineKeyValues raggruppa le coppie per chiave e applica il combiner, restituendo
+// una coppia per chiave in ordine di chiave
+func combineKeyValues(kvs []KeyValue, combinef CombineFunc) []KeyValue {
+	grouped := make(map[string][]string)
+	for _, kv := range kvs {
+		grouped[kv.Key] = append(grouped[kv.Key], kv.Value)
+	}
+	keys := make([]string, 0, len(grouped))
+	for k := range grouped {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	combined := make([]KeyValue, 0, len(keys))
+	for _, k := range keys {
+		combined = append(combined, KeyValue{Key: k, Value: combinef(k, grouped[k])})
+	}
+	return combined
 }
 
 // executeReduceTask esegue un task di riduzione
-func executeReduceTask(task *Task, reducef func(string, []string) string) {
+func executeReduceTask(task *Task, reducef func(string, []string) string) (taskResult, error) {
+	return runReduceTask(task, reducef, nil)
+}
+
+// executeStreamReduceTask esegue un task di riduzione passando le chiavi a uno StreamReducer
+func executeStreamReduceTask(task *Task, streamf StreamReduceFunc) (taskResult, error) {
+	return runReduceTask(task, nil, streamf)
+}
+
+// runReduceTask fonde le partizioni del reduce e applica reducef a ogni chiave, oppure,
+// se streamf non è nil, le passa allo StreamReducer che scrive l'output
+func runReduceTask(task *Task, reducef ReduceFunc, streamf StreamReduceFunc) (taskResult, error) {
+	var result taskResult
 	LogInfo("Eseguendo ReduceTask %d", task.TaskID)
+	format, err := LookupOutputFormat(task.OutputFormat)
+	if err != nil {
+		return result, err
+	}
 
-	// 1) Carica eventuale checkpoint
-	baseOut := getOutputFileName(task.TaskID)
+	// 1) Carica eventuale checkpoint (sempre sul disco locale, anche con output remoto)
+	baseOut := reduceOutputFileName(task.OutputDir, task.JobID, task.TaskID)
 	partialOut := baseOut + ".partial"
-	checkpointFile := baseOut + ".checkpoint.json"
+	if task.AttemptID != "" {
+		// Output scritto nel file del tentativo, promosso dal master al commit del task
+		partialOut = attemptFileName(baseOut, task.AttemptID)
+	}
+	outStorage := storageFor(baseOut)
+	checkpointFile := reduceCheckpointFileName(task.OutputDir, task.JobID, task.TaskID)
 	if task.Checkpoint != "" {
 		checkpointFile = task.Checkpoint
 		LogInfo("ReduceTask %d: ripresa da checkpoint fornito: %s", task.TaskID, checkpointFile)
 	}
 	ck := loadReduceCheckpoint(checkpointFile) // {LastKey string, Processed int}
+	if streamf != nil {
+		// L'output di uno StreamReducer non è allineato alle chiavi: si riparte sempre da zero
+		ck = reduceCheckpoint{}
+	} else if isStorageURI(baseOut) && ck.LastKey != "" {
+		// Un output remoto diventa visibile solo a fine scrittura: non c'è un parziale da riprendere
+		LogInfo("ReduceTask %d: output remoto %s, ignoro il checkpoint", task.TaskID, baseOut)
+		ck = reduceCheckpoint{}
+	}
 
 	// Log dettagliato del checkpoint
 	if ck.LastKey != "" {
@@ -248,52 +609,105 @@ func executeReduceTask(task *Task, reducef func(string, []string) string) {
 		LogInfo("ReduceTask %d: NESSUN CHECKPOINT - inizio da zero", task.TaskID)
 	}
 
-	// 2) Aggrega input
-	keyValues := make(map[string][]string)
-	for mapTaskID := 0; mapTaskID < task.NMap; mapTaskID++ {
-		filename := getIntermediateFileName(mapTaskID, task.TaskID)
-		file, err := os.Open(filename)
-		if err != nil {
-			continue
+	// 2) Raccoglie le partizioni dei map, scaricando quelle servite da altri worker, e
+	//    prepara i run ordinati (merge esterno, memoria limitata)
+	inputs, fetched, err := gatherReduceInputs(task)
+	defer func() {
+		for _, file := range fetched {
+			_ = os.Remove(file)
 		}
-		dec := json.NewDecoder(file)
-		for {
-			var kv KeyValue
-			if err := dec.Decode(&kv); err != nil {
-				break
-			}
-			keyValues[kv.Key] = append(keyValues[kv.Key], kv.Value)
+	}()
+	if err != nil {
+		return result, err
+	}
+	spillPrefix := filepath.Join(filepath.Dir(getIntermediateFileName(task.JobID, 0, task.TaskID)),
+		fmt.Sprintf("mr-spill-%s%d-", jobFilePrefix(task.JobID), task.TaskID))
+	runs, spills, err := prepareSortedRuns(inputs, reduceMemoryBudget(), spillPrefix)
+	defer func() {
+		for _, spill := range spills {
+			_ = os.Remove(spill)
 		}
-		file.Close()
+	}()
+	if err != nil {
+		return result, fmt.Errorf("errore preparazione run ordinati: %v", err)
 	}
-
-	// Ordina le chiavi per avere ordine deterministico e poter riprendere dal checkpoint
-	keys := make([]string, 0, len(keyValues))
-	for k := range keyValues {
-		keys = append(keys, k)
+	merger, err := newKVMerger(runs)
+	if err != nil {
+		return result, fmt.Errorf("errore apertura run: %v", err)
 	}
-	sort.Strings(keys)
+	defer merger.Close()
+	var totalBytes int64
+	for _, run := range runs {
+		if info, err := os.Stat(run); err == nil {
+			totalBytes += info.Size()
+		}
+	}
+	LogInfo("ReduceTask %d: merge di %d run (%d file intermedi, %d spill)", task.TaskID, len(runs), len(inputs), len(spills))
 
-	// 3) Scrive su partial e aggiorna checkpoint ogni 100 chiavi
-	out, err := os.Create(partialOut)
+	// 3) Scrive su partial e aggiorna checkpoint ogni 100 chiavi; le chiavi arrivano già ordinate
+	out, err := outStorage.Create(partialOut)
 	if err != nil {
-		LogError("Errore creazione partial %s: %v", partialOut, err)
-		return
+		return result, fmt.Errorf("errore creazione partial %s: %v", partialOut, err)
+	}
+	writer := format.NewWriter(out)
+	var stream StreamReducer
+	if streamf != nil {
+		if stream, err = streamf(writer); err != nil {
+			out.Close()
+			return result, fmt.Errorf("errore avvio reducer: %v", err)
+		}
+	}
+	abort := func() {
+		if stream != nil {
+			stream.Abort()
+		}
+		out.Close()
 	}
 
 	processed := 0
 	skipped := 0
-	for _, key := range keys {
+	for {
+		if isTaskAbandoned(task) {
+			LogWarn("ReduceTask %d abbandonato dopo %d chiavi", task.TaskID, processed)
+			abort()
+			return result, nil
+		}
+		key, values, ok, err := merger.Next()
+		if err != nil {
+			abort()
+			return result, fmt.Errorf("errore durante il merge: %v", err)
+		}
+		if !ok {
+			break
+		}
+		if stream != nil {
+			if err := stream.Reduce(key, values); err != nil {
+				abort()
+				return result, fmt.Errorf("errore reducer: %v", err)
+			}
+			processed++
+			if processed%100 == 0 {
+				reportReduceProgress(task, merger, totalBytes, processed)
+			}
+			continue
+		}
 		// riprendi dal checkpoint se presente
 		if ck.LastKey != "" && key <= ck.LastKey {
 			skipped++
 			continue
 		}
-		values := keyValues[key]
-		res := reducef(key, values)
-		fmt.Fprintf(out, "%s %s\n", key, res)
+		if err := writer.Write(key, reducef(key, values)); err != nil {
+			abort()
+			return result, fmt.Errorf("errore scrittura output %s: %v", partialOut, err)
+		}
 		processed++
 		if processed%100 == 0 {
+			reportReduceProgress(task, merger, totalBytes, processed+skipped)
+			// Il checkpoint non deve precedere i record ancora nel buffer
+			if err := writer.Flush(); err != nil {
+				abort()
+				return result, fmt.Errorf("errore scrittura output %s: %v", partialOut, err)
+			}
 			saveReduceCheckpoint(checkpointFile, key, processed)
 			LogInfo("ReduceTask %d: checkpoint salvato - chiave '%s', processate %d chiavi",
 				task.TaskID, key, processed)
@@ -304,23 +718,54 @@ func executeReduceTask(task *Task, reducef func(string, []string) string) {
 		LogInfo("ReduceTask %d: saltate %d chiavi già processate (checkpoint), processate %d nuove chiavi",
 			task.TaskID, skipped, processed)
 	}
+	reportReduceProgress(task, merger, totalBytes, processed+skipped)
+	records := int64(processed)
+	if stream != nil {
+		if records, err = stream.Close(); err != nil {
+			out.Close()
+			return result, err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		out.Close()
+		return result, fmt.Errorf("errore scrittura output %s: %v", partialOut, err)
+	}
 	// checkpoint finale
 	saveReduceCheckpoint(checkpointFile, "", processed)
 
 	// Chiudi il file prima del rename (necessario su Windows)
 	if err := out.Close(); err != nil {
-		LogError("Errore chiusura partial %s: %v", partialOut, err)
+		return result, fmt.Errorf("errore chiusura partial %s: %v", partialOut, err)
 	}
 
-	// 4) Rinomina in definitivo
-	if err := os.Rename(partialOut, baseOut); err != nil {
-		LogError("Rename %s -> %s fallito: %v", partialOut, baseOut, err)
-		return
+	// Checksum dell'output, verificato dal master al commit e dal monitor di validazione
+	checksum, err := newFileChecksum(partialOut, task.TaskID, records)
+	if err != nil {
+		return result, err
+	}
+	result.Files = []FileChecksum{checksum}
+
+	// 4) Rinomina in definitivo (solo senza tentativo: altrimenti la promozione spetta al master)
+	if task.AttemptID == "" {
+		if err := outStorage.Rename(partialOut, baseOut); err != nil {
+			return result, fmt.Errorf("rename %s -> %s fallito: %v", partialOut, baseOut, err)
+		}
 	}
 	// pulizia checkpoint
 	_ = os.Remove(checkpointFile)
 
-	LogInfo("ReduceTask %d completato, scritti %d record", task.TaskID, processed)
+	LogInfo("ReduceTask %d completato, scritti %d record", task.TaskID, records)
+	return result, nil
+}
+
+// reportReduceProgress aggiorna l'avanzamento del reduce in base ai byte letti dai run
+func reportReduceProgress(task *Task, merger *kvMerger, totalBytes int64, keys int) {
+	read := merger.BytesRead()
+	percent := 100.0
+	if totalBytes > 0 && read < totalBytes {
+		percent = float64(read) / float64(totalBytes) * 100
+	}
+	updateTaskProgress(task, read, int64(keys), percent)
 }
 
 // Strutture e funzioni di supporto per checkpoint reduce
@@ -357,41 +802,80 @@ func saveReduceCheckpoint(path, lastKey string, processed int) {
 }
 
 // reportTaskCompletion segnala il completamento del task al master
-func reportTaskCompletion(masterAddr string, task *Task, workerID string) {
+func reportTaskCompletion(masterAddr string, task *Task, workerID string, result taskResult) error {
 	client, err := rpc.DialHTTP("tcp", masterAddr)
 	if err != nil {
 		LogError("Errore connessione master %s per report: %v", masterAddr, err)
-		return
+		return err
 	}
 	defer client.Close()
 
 	args := TaskCompletedArgs{
-		TaskID:   task.TaskID,
-		Type:     task.Type,
-		WorkerID: workerID,
+		JobID:     task.JobID,
+		TaskID:    task.TaskID,
+		Type:      task.Type,
+		WorkerID:  workerID,
+		AttemptID: task.AttemptID,
+		Counters:  result.Counters,
+		Files:     result.Files,
+	}
+	if task.Type == MapTask {
+		args.ShuffleAddr = workerShuffleAddr
 	}
 
 	var reply Reply
 	err = client.Call("Master.TaskCompleted", args, &reply)
 	if err != nil {
 		LogError("Errore report completamento task %d: %v", task.TaskID, err)
-	} else {
-		LogInfo("Task %d segnalato come completato", task.TaskID)
+		return err
 	}
+	LogInfo("Task %d segnalato come completato", task.TaskID)
+	return nil
 }
 
-// writeKeyValuesToFile scrive una slice di KeyValue in un file
-func writeKeyValuesToFile(filename string, kvs []KeyValue) {
-	file, err := os.Create(filename)
+// reportTaskProgress invia al master l'avanzamento del task in esecuzione
+func reportTaskProgress(masterAddr, workerID string, progress *TaskProgress) {
+	client, err := rpc.DialHTTP("tcp", masterAddr)
 	if err != nil {
-		LogError("Errore creazione file %s: %v", filename, err)
+		LogDebug("Errore connessione master %s per avanzamento: %v", masterAddr, err)
 		return
 	}
-	defer file.Close()
+	defer client.Close()
 
-	encoder := json.NewEncoder(file)
-	for _, kv := range kvs {
-		encoder.Encode(kv)
+	args := ReportProgressArgs{WorkerID: workerID, Progress: *progress}
+	var reply Reply
+	if err := client.Call("Master.ReportProgress", args, &reply); err != nil {
+		LogDebug("Errore invio avanzamento task %d: %v", progress.TaskID, err)
+	}
+}
+
+// reportTaskFailure segnala al master il fallimento del task con l'errore riscontrato
+func reportTaskFailure(masterAddr string, task *Task, workerID string, taskErr error) {
+	if task.Type != MapTask && task.Type != ReduceTask {
+		return
+	}
+	client, err := rpc.DialHTTP("tcp", masterAddr)
+	if err != nil {
+		LogError("Errore connessione master %s per report fallimento: %v", masterAddr, err)
+		return
+	}
+	defer client.Close()
+
+	args := TaskFailedArgs{
+		JobID:     task.JobID,
+		TaskID:    task.TaskID,
+		Type:      task.Type,
+		WorkerID:  workerID,
+		Attempt:   task.Attempt,
+		AttemptID: task.AttemptID,
+		Error:     taskErr.Error(),
+	}
+
+	var reply Reply
+	if err := client.Call("Master.TaskFailed", args, &reply); err != nil {
+		LogError("Errore report fallimento task %d: %v", task.TaskID, err)
+	} else {
+		LogInfo("Task %d segnalato come fallito", task.TaskID)
 	}
 }
 
@@ -417,7 +901,7 @@ func ihash(key string) int {
 }
 
 // sendHeartbeat invia un heartbeat al master leader
-func sendHeartbeat(workerID string, rpcAddrs []string) {
+func sendHeartbeat(workerID string, slots int, rpcAddrs []string) {
 	for _, addr := range rpcAddrs {
 		client, err := rpc.DialHTTP("tcp", addr)
 		if err != nil {
@@ -430,13 +914,20 @@ func sendHeartbeat(workerID string, rpcAddrs []string) {
 		err = client.Call("Master.GetMasterInfo", &args, &reply)
 		if err == nil && reply.IsLeader {
 			// Invia heartbeat al leader
-			heartbeatArgs := WorkerHeartbeatArgs{WorkerID: workerID}
+			heartbeatArgs := WorkerHeartbeatArgs{WorkerID: workerID, Slots: slots, ShuffleAddr: workerShuffleAddr, Progress: runningTaskProgress()}
 			var heartbeatReply WorkerHeartbeatReply
 			err = client.Call("Master.WorkerHeartbeat", &heartbeatArgs, &heartbeatReply)
 			client.Close()
 
 			if err == nil && heartbeatReply.Success {
 				LogDebug("Worker %s: Heartbeat inviato con successo", workerID)
+				if len(heartbeatReply.AbandonJobs) > 0 {
+					abandonRunningTasks(heartbeatReply.AbandonJobs)
+				}
+				for _, jobID := range heartbeatReply.CleanupJobs {
+					removeJobShuffleFiles(jobID)
+					removeJobCache(jobID)
+				}
 				return
 			}
 		} else {
@@ -13,6 +13,7 @@ import (
 	"net/rpc"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -30,33 +31,82 @@ import (
 type TaskInfo struct {
 	State     TaskState
 	StartTime time.Time
+	Attempts  int            // assegnazioni effettuate dal leader
+	Failures  []TaskFailure  `json:",omitempty"` // tentativi falliti segnalati dai worker
+	Committed string         `json:",omitempty"` // ID del tentativo i cui file sono stati promossi
+	Duration  time.Duration  `json:",omitempty"` // durata del tentativo promosso
+	Location  string         `json:",omitempty"` // map: worker che serve gli intermedi (vuoto = filesystem condiviso)
+	Counters  *TaskCounters  `json:",omitempty"` // contatori del tentativo promosso
+	Files     []FileChecksum `json:",omitempty"` // checksum dei file del tentativo promosso
+	// Ultimo avanzamento segnalato da un worker (solo leader)
+	LastProgress time.Time `json:",omitempty"`
+	// Tentativo primario e backup speculativo assegnati (solo leader): i fallimenti
+	// segnalati da altri tentativi sono obsoleti
+	AttemptID string `json:",omitempty"`
+	BackupID  string `json:",omitempty"`
 }
 type LogCommand struct {
 	Operation string `json:"operation"`
+	JobID     string `json:"job_id,omitempty"` // vuoto = job attivo
 	TaskID    int    `json:"task_id"`
 	// Nuovi campi per gestione dinamica del cluster
 	MasterID    int    `json:"master_id,omitempty"`
 	RaftAddress string `json:"raft_address,omitempty"`
 	RpcAddress  string `json:"rpc_address,omitempty"`
 	ClusterInfo string `json:"cluster_info,omitempty"`
+	// Specifica completa del job per il comando submit-job
+	Job *JobSpec `json:"job,omitempty"`
+	// Contatori del task per complete-map/complete-reduce
+	Counters *TaskCounters `json:"counters,omitempty"`
+	// Tentativo fallito per fail-map/fail-reduce
+	Failure *TaskFailure `json:"failure,omitempty"`
+	// Tentativo promosso e sua durata per complete-map/complete-reduce
+	AttemptID string        `json:"attempt_id,omitempty"`
+	Duration  time.Duration `json:"duration,omitempty"`
+	// Worker che serve gli intermedi per complete-map, output persi per lost-map
+	Location string      `json:"location,omitempty"`
+	Lost     []MapOutput `json:"lost,omitempty"`
+	// Checksum dei file prodotti per complete-map/complete-reduce
+	Files []FileChecksum `json:"files,omitempty"`
 }
 
-// TaskKey identifica un task con ID e tipo
+// JobSpec descrive un job sottomesso, replicato tramite Raft su tutti i nodi
+type JobSpec struct {
+	JobID       string            `json:"job_id"`
+	InputFiles  []string          `json:"input_files"`
+	Splits      []InputSplit      `json:"splits,omitempty"` // calcolati dal leader; vuoto = uno per file
+	NReduce     int               `json:"n_reduce"`
+	App         string            `json:"app,omitempty"`
+	AppParams   map[string]string `json:"app_params,omitempty"`
+	MaxAttempts int               `json:"max_attempts,omitempty"`
+	SubmittedAt time.Time         `json:"submitted_at"`
+	// Formati di input dei record e di output dei reduce (vuoti = InputFormatLines, OutputFormatText)
+	InputFormat  string `json:"input_format,omitempty"`
+	OutputFormat string `json:"output_format,omitempty"`
+	// Directory o prefisso s3:// in cui scrivere l'output (vuoto = output locale)
+	OutputDir string `json:"output_dir,omitempty"`
+	// Partitioner delle chiavi intermedie (vuoto = PartitionerHash) e confini
+	// calcolati dal leader per i partitioner campionati
+	Partitioner     string   `json:"partitioner,omitempty"`
+	PartitionBounds []string `json:"partition_bounds,omitempty"`
+	// File accessori pubblicati con il job
+	CacheFiles []CacheFile `json:"cache_files,omitempty"`
+}
+
+// TaskKey identifica un task con job, ID e tipo
 type TaskKey struct {
-	ID   int
-	Type TaskType
+	JobID string
+	ID    int
+	Type  TaskType
 }
 type Master struct {
-	mu              sync.RWMutex
-	raft            *raft.Raft
-	isDone          bool
-	phase           JobPhase
-	inputFiles      []string
-	nReduce         int
-	mapTasks        []TaskInfo
-	reduceTasks     []TaskInfo
-	mapTasksDone    int
-	reduceTasksDone int
+	mu   sync.RWMutex
+	raft *raft.Raft
+	// Coda FIFO dei job: ogni job ha fase, task e contatori propri
+	jobs     map[string]*Job // Job ID -> Job
+	jobQueue []string        // Job ID in ordine di sottomissione
+	isDone   bool            // true quando tutti i job in coda sono completati
+	stopping bool            // true quando il master è in arresto: i worker ricevono ExitTask
 	// Nuovi campi per gestione dinamica del cluster
 	clusterMembers map[string]string // Raft address -> RPC address
 	myID           int
@@ -68,8 +118,21 @@ type Master struct {
 	workerHeartbeat map[string]time.Time   // Worker ID -> Last heartbeat time
 	// Mappa worker->task correnti (solo InProgress)
 	workerToTasks map[string]map[TaskKey]bool // workerID -> set di task con tipo
+	// Ultimo avanzamento segnalato da ogni worker per il task in esecuzione
+	workerProgress map[string]map[TaskKey]*TaskProgress // workerID -> progresso dei task in esecuzione
+	// Operazioni sugli output accodate da Apply ed eseguite dal leader (vedi effects.go)
+	outputEffects      []outputEffect
+	outputEffectsReady chan struct{}
 	// Checkpoint dei reducer da usare alla prossima riassegnazione
-	reducerCheckpoint map[int]string // reduceTaskID -> checkpoint path
+	reducerCheckpoint map[TaskKey]string // reduce task -> checkpoint path
+	// Metriche Prometheus del master
+	metrics *MetricCollector
+	// Serializza il commit dei tentativi: il primo TaskCompleted valido vince
+	commitMu sync.Mutex
+	// Task candidati al backup speculativo (solo leader): ID del backup, vuoto se non ancora lanciato
+	speculative map[TaskKey]string
+	// Job terminati già segnalati ai server shuffle per la pulizia (solo leader)
+	shuffleCleaned map[string]map[string]bool
 }
 
 func (m *Master) Apply(logEntry *raft.Log) interface{} {
@@ -81,45 +144,59 @@ func (m *Master) Apply(logEntry *raft.Log) interface{} {
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	defer m.pruneFinishedJobs()
 
 	// Log del comando ricevuto per debugging
-	LogDebug("[Master] Apply comando: %s, TaskID: %d, Term: %d, Index: %d",
-		cmd.Operation, cmd.TaskID, logEntry.Term, logEntry.Index)
-
-	// Ignora comandi se il master non è ancora inizializzato
-	if m.inputFiles == nil || len(m.inputFiles) == 0 {
-		LogDebug("[Master] Ignoro comando %s durante inizializzazione (inputFiles=nil)", cmd.Operation)
-		return nil
-	}
-
-	// Ignora comandi se non ci sono task configurati
-	if len(m.mapTasks) == 0 && len(m.reduceTasks) == 0 {
-		LogDebug("[Master] Ignoro comando %s durante inizializzazione (nessun task)", cmd.Operation)
-		return nil
-	}
-
-	// Se il job è già completato, ignora tutti i comandi
-	if m.isDone {
-		LogDebug("[Master] Ignoro comando %s - job già completato", cmd.Operation)
-		return nil
-	}
+	LogDebug("[Master] Apply comando: %s, JobID: %s, TaskID: %d, Term: %d, Index: %d",
+		cmd.Operation, cmd.JobID, cmd.TaskID, logEntry.Term, logEntry.Index)
 
 	switch cmd.Operation {
+	case "submit-job":
+		if cmd.Job == nil {
+			log.Printf("[Master] Comando submit-job senza specifica del job\n")
+			return nil
+		}
+		m.applySubmitJob(cmd.Job)
 	case "complete-map":
-		if cmd.TaskID >= 0 && cmd.TaskID < len(m.mapTasks) {
-			if m.mapTasks[cmd.TaskID].State != Completed {
-				m.mapTasks[cmd.TaskID].State = Completed
-				m.mapTasksDone++
-				LogInfo("[Master] MapTask %d completato, progresso: %d/%d",
-					cmd.TaskID, m.mapTasksDone, len(m.mapTasks))
-				if m.mapTasksDone == len(m.mapTasks) {
-					m.phase = ReducePhase
-					LogInfo("[Master] Transizione a ReducePhase")
+		job := m.jobForCommitCommand(cmd)
+		if job == nil {
+			return nil
+		}
+		if cmd.TaskID >= 0 && cmd.TaskID < len(job.MapTasks) {
+			if job.MapTasks[cmd.TaskID].State != Completed {
+				job.MapTasks[cmd.TaskID].State = Completed
+				job.MapTasks[cmd.TaskID].Committed = cmd.AttemptID
+				job.MapTasks[cmd.TaskID].Duration = cmd.Duration
+				job.MapTasks[cmd.TaskID].Location = cmd.Location
+				job.MapTasks[cmd.TaskID].Files = cmd.Files
+				job.MapTasksDone++
+				if cmd.Counters != nil {
+					counters := *cmd.Counters
+					job.MapTasks[cmd.TaskID].Counters = &counters
+					job.Counters.Add(*cmd.Counters)
+				}
+				LogInfo("[Master] Job %s: MapTask %d completato, progresso: %d/%d",
+					job.ID, cmd.TaskID, job.MapTasksDone, len(job.MapTasks))
+				if job.MapTasksDone == len(job.MapTasks) {
+					job.Phase = ReducePhase
+					LogInfo("[Master] Job %s: transizione a ReducePhase", job.ID)
 				}
 			}
 		} else {
-			log.Printf("[Master] TaskID %d fuori range per MapTask (max: %d)\n", cmd.TaskID, len(m.mapTasks)-1)
+			log.Printf("[Master] TaskID %d fuori range per MapTask (max: %d)\n", cmd.TaskID, len(job.MapTasks)-1)
+		}
+	case "lost-map":
+		job := m.jobForTaskCommand(cmd)
+		if job == nil {
+			return nil
 		}
+		m.applyLostMapOutputs(job, cmd)
+	case "lost-reduce":
+		job := m.jobForTaskCommand(cmd)
+		if job == nil {
+			return nil
+		}
+		m.applyLostReduceOutput(job, cmd)
 	case "add-master":
 		// Gestisce l'aggiunta di un nuovo master al cluster
 		if cmd.RaftAddress != "" && cmd.RpcAddress != "" {
@@ -143,69 +220,228 @@ func (m *Master) Apply(logEntry *raft.Log) interface{} {
 			LogInfo("[Master] Master rimosso dal cluster: %s", cmd.RaftAddress)
 		}
 	case "complete-reduce":
-		if cmd.TaskID >= 0 && cmd.TaskID < len(m.reduceTasks) {
-			if m.reduceTasks[cmd.TaskID].State != Completed {
-				m.reduceTasks[cmd.TaskID].State = Completed
-				m.reduceTasksDone++
-				LogInfo("[Master] ReduceTask %d completato, progresso: %d/%d",
-					cmd.TaskID, m.reduceTasksDone, len(m.reduceTasks))
-				if m.reduceTasksDone == len(m.reduceTasks) {
-					m.phase = DonePhase
-					m.isDone = true
-					LogInfo("[Master] Job completato - transizione a DonePhase")
-					// Copia i file di output dal volume Docker alla cartella locale
-					m.copyOutputFilesToLocal()
-					// Backup su S3 se abilitato
-					m.backupToS3()
+		job := m.jobForCommitCommand(cmd)
+		if job == nil {
+			return nil
+		}
+		if cmd.TaskID >= 0 && cmd.TaskID < len(job.ReduceTasks) {
+			if job.ReduceTasks[cmd.TaskID].State != Completed {
+				job.ReduceTasks[cmd.TaskID].State = Completed
+				job.ReduceTasks[cmd.TaskID].Committed = cmd.AttemptID
+				job.ReduceTasks[cmd.TaskID].Duration = cmd.Duration
+				job.ReduceTasks[cmd.TaskID].Files = cmd.Files
+				job.ReduceTasksDone++
+				if cmd.Counters != nil {
+					counters := *cmd.Counters
+					job.ReduceTasks[cmd.TaskID].Counters = &counters
+					job.Counters.Add(*cmd.Counters)
+				}
+				LogInfo("[Master] Job %s: ReduceTask %d completato, progresso: %d/%d",
+					job.ID, cmd.TaskID, job.ReduceTasksDone, len(job.ReduceTasks))
+				if job.ReduceTasksDone == len(job.ReduceTasks) {
+					m.finishJob(job)
 				}
 			}
 		} else {
-			log.Printf("[Master] TaskID %d fuori range per ReduceTask (max: %d)\n", cmd.TaskID, len(m.reduceTasks)-1)
+			log.Printf("[Master] TaskID %d fuori range per ReduceTask (max: %d)\n", cmd.TaskID, len(job.ReduceTasks)-1)
 		}
 	case "reset-task":
 		// Nuovo comando per reset di task in caso di fallimento worker
+		job := m.jobForTaskCommand(cmd)
+		if job == nil {
+			return nil
+		}
 		if cmd.TaskID >= 0 {
-			if m.phase == MapPhase && cmd.TaskID < len(m.mapTasks) {
-				if m.mapTasks[cmd.TaskID].State == InProgress {
-					m.mapTasks[cmd.TaskID].State = Idle
-					LogInfo("[Master] MapTask %d resettato a Idle per riassegnazione", cmd.TaskID)
+			if job.Phase == MapPhase && cmd.TaskID < len(job.MapTasks) {
+				if job.MapTasks[cmd.TaskID].State == InProgress {
+					job.MapTasks[cmd.TaskID].State = Idle
+					LogInfo("[Master] Job %s: MapTask %d resettato a Idle per riassegnazione", job.ID, cmd.TaskID)
 				}
-			} else if m.phase == ReducePhase && cmd.TaskID < len(m.reduceTasks) {
-				if m.reduceTasks[cmd.TaskID].State == InProgress {
-					m.reduceTasks[cmd.TaskID].State = Idle
-					LogInfo("[Master] ReduceTask %d resettato a Idle per riassegnazione", cmd.TaskID)
+			} else if job.Phase == ReducePhase && cmd.TaskID < len(job.ReduceTasks) {
+				if job.ReduceTasks[cmd.TaskID].State == InProgress {
+					job.ReduceTasks[cmd.TaskID].State = Idle
+					LogInfo("[Master] Job %s: ReduceTask %d resettato a Idle per riassegnazione", job.ID, cmd.TaskID)
 				}
 			}
 		}
+	case "fail-map", "fail-reduce":
+		job := m.jobForTaskCommand(cmd)
+		if job == nil || cmd.Failure == nil {
+			return nil
+		}
+		tasks, taskType := job.MapTasks, MapTask
+		if cmd.Operation == "fail-reduce" {
+			tasks, taskType = job.ReduceTasks, ReduceTask
+		}
+		if cmd.TaskID < 0 || cmd.TaskID >= len(tasks) {
+			log.Printf("[Master] TaskID %d fuori range per %v (max: %d)\n", cmd.TaskID, taskType, len(tasks)-1)
+			return nil
+		}
+		m.applyTaskFailure(job, taskType, &tasks[cmd.TaskID], cmd.TaskID, *cmd.Failure)
+	case "publish-job":
+		// Output del job pubblicati dal leader: né la riesecuzione del log né un nuovo
+		// leader devono ripetere la pubblicazione
+		if job := m.jobs[cmd.JobID]; job != nil && job.Phase == DonePhase {
+			job.Published = true
+		}
+	case "pause-job":
+		m.applyPauseJob(cmd.JobID)
+	case "resume-job":
+		m.applyResumeJob(cmd.JobID)
+	case "cancel-job":
+		m.applyCancelJob(cmd.JobID)
 	default:
 		log.Printf("[Master] Comando sconosciuto: %s\n", cmd.Operation)
 	}
 	return nil
 }
 
+// jobForTaskCommand risolve il job a cui si riferisce un comando sui task,
+// ignorando i comandi per job inesistenti o già completati.
+func (m *Master) jobForTaskCommand(cmd LogCommand) *Job {
+	job := m.getJob(cmd.JobID)
+	if job == nil {
+		LogDebug("[Master] Ignoro comando %s: job %q non trovato", cmd.Operation, cmd.JobID)
+		return nil
+	}
+	if job.IsDone() {
+		LogDebug("[Master] Ignoro comando %s - job %s già completato", cmd.Operation, job.ID)
+		return nil
+	}
+	return job
+}
+
+// jobForCommitCommand risolve il job di un comando complete-map/complete-reduce: oltre ai
+// job terminati ignora quelli in pausa, i cui task sono tornati Idle con la pausa.
+func (m *Master) jobForCommitCommand(cmd LogCommand) *Job {
+	job := m.jobForTaskCommand(cmd)
+	if job != nil && job.IsPaused() {
+		LogDebug("[Master] Ignoro comando %s - job %s in pausa", cmd.Operation, job.ID)
+		return nil
+	}
+	return job
+}
+
+// applyLostReduceOutput riporta Idle un reduce Completed il cui output non è più valido,
+// sottraendo i suoi contatori dal job. Il comando si riferisce al tentativo promosso:
+// se nel frattempo il reduce è stato rieseguito viene ignorato. Chiamato da Apply con m.mu acquisito.
+func (m *Master) applyLostReduceOutput(job *Job, cmd LogCommand) {
+	if cmd.TaskID < 0 || cmd.TaskID >= len(job.ReduceTasks) {
+		log.Printf("[Master] TaskID %d fuori range per ReduceTask (max: %d)\n", cmd.TaskID, len(job.ReduceTasks)-1)
+		return
+	}
+	info := &job.ReduceTasks[cmd.TaskID]
+	if info.State != Completed || info.Committed != cmd.AttemptID {
+		return
+	}
+	job.resetCompletedTask(info)
+	job.ReduceTasksDone--
+	LogWarn("[Master] Job %s: output di ReduceTask %d non valido, riesecuzione", job.ID, cmd.TaskID)
+}
+
+// invalidateCompletedTask replica tramite Raft la riesecuzione di un task Completed il cui
+// output non è più valido: lost-map per un map, lost-reduce per un reduce. Il task torna Idle
+// quando il comando viene applicato, su tutti i nodi e con i contatori sottratti dal job.
+// Il comando non viene atteso perché Apply richiede m.mu. Chiamato dal leader con m.mu acquisito.
+func (m *Master) invalidateCompletedTask(job *Job, taskType TaskType, taskID int) {
+	var cmd LogCommand
+	if taskType == MapTask {
+		info := job.MapTasks[taskID]
+		cmd = LogCommand{Operation: "lost-map", JobID: job.ID, TaskID: -1,
+			Lost: []MapOutput{{TaskID: taskID, Addr: info.Location, AttemptID: info.Committed}}}
+	} else {
+		cmd = LogCommand{Operation: "lost-reduce", JobID: job.ID, TaskID: taskID, AttemptID: job.ReduceTasks[taskID].Committed}
+	}
+	cmdBytes, err := json.Marshal(cmd)
+	if err != nil {
+		log.Printf("[Master] Error marshaling command: %v", err)
+		return
+	}
+	m.raft.Apply(cmdBytes, 500*time.Millisecond)
+}
+
+// finishJob chiude un job completato e attiva il successivo in coda.
+// Chiamato da Apply con m.mu già acquisito.
+func (m *Master) finishJob(job *Job) {
+	job.Phase = DonePhase
+	job.FinishedAt = time.Now()
+	LogInfo("[Master] Job %s completato - transizione a DonePhase", job.ID)
+	// Copia locale, file unificato e backup su S3 vengono eseguiti dal leader fuori da Apply
+	m.queueOutputEffect(outputPublish, job)
+	// Gli intermedi non servono più una volta prodotto l'output
+	m.cleanupJobIntermediateFiles(job)
+	m.forgetJobTasks(job)
+
+	m.advanceQueue()
+}
+
+// advanceQueue attiva il prossimo job in coda dopo la chiusura di quello corrente.
+// Chiamato con m.mu già acquisito.
+func (m *Master) advanceQueue() {
+	if next := m.activeJob(); next != nil {
+		m.activateJob(next)
+		return
+	}
+	for _, job := range m.orderedJobs() {
+		if !job.IsDone() {
+			LogInfo("[Master] Nessun job eseguibile: i job in coda sono in pausa")
+			return
+		}
+	}
+	m.isDone = true
+	LogInfo("[Master] Tutti i job in coda sono completati")
+}
+
+// activateJob prepara l'esecuzione del job in testa alla coda. Alla prima attivazione
+// rimuove gli output lasciati da un'esecuzione precedente dello stesso job, che altrimenti
+// verrebbero scambiati per task già completati; un job ripreso dopo una pausa conserva
+// invece i propri output.
+// Chiamato con m.mu già acquisito.
+func (m *Master) activateJob(job *Job) {
+	LogInfo("[Master] Job %s attivo: %d map tasks, %d reduce tasks", job.ID, len(job.MapTasks), len(job.ReduceTasks))
+	m.isDone = false
+	if job.Started {
+		return
+	}
+	job.Started = true
+	m.queueOutputEffect(outputCleanup, job)
+}
+
+// forgetJobTasks rimuove speculazioni e checkpoint dei reducer di un job i cui task non
+// sono più in esecuzione. Chiamato con m.mu già acquisito.
+func (m *Master) forgetJobTasks(job *Job) {
+	for key := range m.speculative {
+		if key.JobID == job.ID {
+			delete(m.speculative, key)
+		}
+	}
+	for key := range m.reducerCheckpoint {
+		if key.JobID == job.ID {
+			delete(m.reducerCheckpoint, key)
+		}
+	}
+}
+
+// snapshotState è la rappresentazione serializzata dell'FSM del master
+type snapshotState struct {
+	Jobs []*Job
+	// Campi del formato precedente (job singolo), letti solo da Restore
+	JobID           string     `json:",omitempty"`
+	IsDone          bool       `json:",omitempty"`
+	Phase           JobPhase   `json:",omitempty"`
+	InputFiles      []string   `json:",omitempty"`
+	NReduce         int        `json:",omitempty"`
+	MapTasks        []TaskInfo `json:",omitempty"`
+	ReduceTasks     []TaskInfo `json:",omitempty"`
+	MapTasksDone    int        `json:",omitempty"`
+	ReduceTasksDone int        `json:",omitempty"`
+}
+
 // Snapshot structures the FSM state into a durable snapshot.
 func (m *Master) Snapshot() (raft.FSMSnapshot, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	state := struct {
-		IsDone          bool
-		Phase           JobPhase
-		InputFiles      []string
-		NReduce         int
-		MapTasks        []TaskInfo
-		ReduceTasks     []TaskInfo
-		MapTasksDone    int
-		ReduceTasksDone int
-	}{
-		IsDone:          m.isDone,
-		Phase:           m.phase,
-		InputFiles:      append([]string(nil), m.inputFiles...),
-		NReduce:         m.nReduce,
-		MapTasks:        append([]TaskInfo(nil), m.mapTasks...),
-		ReduceTasks:     append([]TaskInfo(nil), m.reduceTasks...),
-		MapTasksDone:    m.mapTasksDone,
-		ReduceTasksDone: m.reduceTasksDone,
-	}
+	state := snapshotState{Jobs: m.orderedJobs()}
 	var buf bytes.Buffer
 	if err := json.NewEncoder(&buf).Encode(state); err != nil {
 		return nil, err
@@ -229,57 +465,76 @@ func (s *memorySnapshot) Release() {}
 // Restore rehydrates the FSM state from a snapshot stream.
 func (m *Master) Restore(rc io.ReadCloser) error {
 	defer rc.Close()
-	var state struct {
-		IsDone          bool
-		Phase           JobPhase
-		InputFiles      []string
-		NReduce         int
-		MapTasks        []TaskInfo
-		ReduceTasks     []TaskInfo
-		MapTasksDone    int
-		ReduceTasksDone int
-	}
+	var state snapshotState
 	dec := json.NewDecoder(rc)
 	if err := dec.Decode(&state); err != nil {
 		return err
 	}
+
+	// Snapshot nel formato a job singolo: converte nel job di default
+	if len(state.Jobs) == 0 && len(state.InputFiles) > 0 {
+		jobID := state.JobID
+		if jobID == "" {
+			jobID = DefaultJobID
+		}
+		state.Jobs = []*Job{{
+			ID:              jobID,
+			Phase:           state.Phase,
+			InputFiles:      state.InputFiles,
+			NReduce:         state.NReduce,
+			MapTasks:        state.MapTasks,
+			ReduceTasks:     state.ReduceTasks,
+			MapTasksDone:    state.MapTasksDone,
+			ReduceTasksDone: state.ReduceTasksDone,
+		}}
+		if state.IsDone {
+			state.Jobs[0].Phase = DonePhase
+		}
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	LogInfo("[Master] Restore chiamato: isDone=%v, phase=%v", state.IsDone, state.Phase)
-	m.isDone = state.IsDone
-	m.phase = state.Phase
-	m.inputFiles = state.InputFiles
-	m.nReduce = state.NReduce
-	m.mapTasks = state.MapTasks
-	m.reduceTasks = state.ReduceTasks
-	m.mapTasksDone = state.MapTasksDone
-	m.reduceTasksDone = state.ReduceTasksDone
+	m.jobs = make(map[string]*Job, len(state.Jobs))
+	m.jobQueue = nil
+	for _, job := range state.Jobs {
+		// Snapshot precedenti agli split: un map task per file
+		if len(job.Splits) == 0 {
+			job.Splits = wholeFileSplits(job.InputFiles)
+		}
+		m.enqueueJob(job)
+	}
+	m.isDone = m.activeJob() == nil
+	LogInfo("[Master] Restore chiamato: %d job, isDone=%v", len(m.jobQueue), m.isDone)
 	return nil
 }
 
 // isMapTaskCompleted verifica se un MapTask è completato controllando l'esistenza dei file intermedi
-func (m *Master) isMapTaskCompleted(taskID int) bool {
-	if taskID < 0 || taskID >= len(m.mapTasks) {
+func (m *Master) isMapTaskCompleted(job *Job, taskID int) bool {
+	if taskID < 0 || taskID >= len(job.MapTasks) {
 		return false
 	}
+	if job.MapTasks[taskID].Location != "" {
+		// Intermedi serviti dal worker: fa fede lo stato registrato
+		return job.MapTasks[taskID].State == Completed
+	}
 
 	// Verifica che tutti i file intermedi per questo MapTask esistano
-	for i := 0; i < m.nReduce; i++ {
-		fileName := getIntermediateFileName(taskID, i)
+	for i := 0; i < job.NReduce; i++ {
+		fileName := getIntermediateFileName(job.ID, taskID, i)
 		if _, err := os.Stat(fileName); os.IsNotExist(err) {
 			LogDebug("[Master] MapTask %d incompleto: file %s mancante", taskID, fileName)
 			return false
 		}
 	}
 
-	LogInfo("[Master] MapTask %d completato: tutti i file intermedi presenti", taskID)
+	LogInfo("[Master] Job %s: MapTask %d completato: tutti i file intermedi presenti", job.ID, taskID)
 	return true
 }
 
 // areAllMapTasksCompleted verifica se tutti i MapTask sono completati
-func (m *Master) areAllMapTasksCompleted() bool {
-	for i := 0; i < len(m.mapTasks); i++ {
-		if !m.isMapTaskCompleted(i) {
+func (m *Master) areAllMapTasksCompleted(job *Job) bool {
+	for i := 0; i < len(job.MapTasks); i++ {
+		if !m.isMapTaskCompleted(job, i) {
 			return false
 		}
 	}
@@ -287,53 +542,64 @@ func (m *Master) areAllMapTasksCompleted() bool {
 }
 
 // validateMapTaskOutput verifica la validità dei file intermedi di un MapTask
-func (m *Master) validateMapTaskOutput(taskID int) bool {
-	if taskID < 0 || taskID >= len(m.mapTasks) {
+func (m *Master) validateMapTaskOutput(job *Job, taskID int) bool {
+	if taskID < 0 || taskID >= len(job.MapTasks) {
+		return false
+	}
+	if job.MapTasks[taskID].Location != "" {
+		// Intermedi serviti dal worker: la perdita viene segnalata dai reduce
+		return true
+	}
+	return m.validateMapAttemptOutput(job, taskID, "", job.MapTasks[taskID].Files)
+}
+
+// validateMapAttemptOutput verifica i file intermedi scritti da un tentativo (vuoto = nomi definitivi)
+// e, se presenti, i checksum e i record registrati dal worker
+func (m *Master) validateMapAttemptOutput(job *Job, taskID int, attemptID string, files []FileChecksum) bool {
+	if taskID < 0 || taskID >= len(job.MapTasks) {
 		return false
 	}
 
-	// Verifica che tutti i file intermedi esistano e siano leggibili
-	for i := 0; i < m.nReduce; i++ {
-		fileName := getIntermediateFileName(taskID, i)
-		file, err := os.Open(fileName)
+	// Verifica che tutti i file intermedi esistano e che header e checksum siano integri;
+	// una partizione vuota è valida, il map scrive un file per ogni reduce
+	for i := 0; i < job.NReduce; i++ {
+		fileName := attemptFileName(getIntermediateFileName(job.ID, taskID, i), attemptID)
+		records, err := validateKVFile(fileName)
 		if err != nil {
-			LogError("[Master] MapTask %d invalido: errore apertura file %s: %v", taskID, fileName, err)
+			LogError("[Master] MapTask %d invalido: file intermedio %s: %v", taskID, fileName, err)
 			return false
 		}
-
-		// Verifica che il file contenga dati JSON validi
-		decoder := json.NewDecoder(file)
-		var kv KeyValue
-		hasData := false
-		for decoder.More() {
-			if err := decoder.Decode(&kv); err != nil {
-				LogError("[Master] MapTask %d invalido: errore decodifica JSON in %s: %v", taskID, fileName, err)
-				file.Close()
-				return false
-			}
-			hasData = true
+		if len(files) == 0 {
+			continue
 		}
-		file.Close()
-
-		if !hasData {
-			LogWarn("[Master] MapTask %d invalido: file %s vuoto", taskID, fileName)
+		expected, ok := findFileChecksum(files, i)
+		if !ok {
+			LogError("[Master] MapTask %d invalido: checksum della partizione %d mancante", taskID, i)
+			return false
+		}
+		if records != expected.Records {
+			LogError("[Master] MapTask %d invalido: %s contiene %d record, attesi %d", taskID, fileName, records, expected.Records)
+			return false
+		}
+		if err := verifyFileChecksum(fileName, expected); err != nil {
+			LogError("[Master] MapTask %d invalido: %v", taskID, err)
 			return false
 		}
 	}
 
-	LogInfo("[Master] MapTask %d valido: tutti i file intermedi sono validi", taskID)
+	LogInfo("[Master] Job %s: MapTask %d valido: tutti i file intermedi sono validi", job.ID, taskID)
 	return true
 }
 
 // cleanupInvalidMapTask rimuove i file intermedi di un MapTask invalido
-func (m *Master) cleanupInvalidMapTask(taskID int) {
-	if taskID < 0 || taskID >= len(m.mapTasks) {
+func (m *Master) cleanupInvalidMapTask(job *Job, taskID int) {
+	if taskID < 0 || taskID >= len(job.MapTasks) {
 		return
 	}
 
-	LogInfo("[Master] Pulizia MapTask %d invalido", taskID)
-	for i := 0; i < m.nReduce; i++ {
-		fileName := getIntermediateFileName(taskID, i)
+	LogInfo("[Master] Pulizia MapTask %d invalido del job %s", taskID, job.ID)
+	for i := 0; i < job.NReduce; i++ {
+		fileName := getIntermediateFileName(job.ID, taskID, i)
 		if err := os.Remove(fileName); err != nil && !os.IsNotExist(err) {
 			LogError("[Master] Errore rimozione file %s: %v", fileName, err)
 		}
@@ -341,29 +607,39 @@ func (m *Master) cleanupInvalidMapTask(taskID int) {
 }
 
 // isReduceTaskCompleted verifica se un ReduceTask è completato controllando l'esistenza del file di output
-func (m *Master) isReduceTaskCompleted(taskID int) bool {
-	if taskID < 0 || taskID >= len(m.reduceTasks) {
+func (m *Master) isReduceTaskCompleted(job *Job, taskID int) bool {
+	if taskID < 0 || taskID >= len(job.ReduceTasks) {
 		return false
 	}
 
-	fileName := getOutputFileName(taskID)
-	if _, err := os.Stat(fileName); os.IsNotExist(err) {
+	fileName := job.outputFileName(taskID)
+	if _, err := storageFor(fileName).Stat(fileName); os.IsNotExist(err) {
 		LogDebug("[Master] ReduceTask %d incompleto: file %s mancante", taskID, fileName)
 		return false
 	}
 
-	LogInfo("[Master] ReduceTask %d completato: file output presente", taskID)
+	LogInfo("[Master] Job %s: ReduceTask %d completato: file output presente", job.ID, taskID)
 	return true
 }
 
 // validateReduceTaskOutput verifica la validità del file di output di un ReduceTask
-func (m *Master) validateReduceTaskOutput(taskID int) bool {
-	if taskID < 0 || taskID >= len(m.reduceTasks) {
+func (m *Master) validateReduceTaskOutput(job *Job, taskID int) bool {
+	if taskID < 0 || taskID >= len(job.ReduceTasks) {
 		return false
 	}
+	return m.validateReduceAttemptOutput(job, taskID, "", job.ReduceTasks[taskID].Files)
+}
 
-	fileName := getOutputFileName(taskID)
-	file, err := os.Open(fileName)
+// validateReduceAttemptOutput verifica il file di output scritto da un tentativo (vuoto = nome definitivo)
+// e, se presenti, il checksum e i record registrati dal worker
+func (m *Master) validateReduceAttemptOutput(job *Job, taskID int, attemptID string, files []FileChecksum) bool {
+	if taskID < 0 || taskID >= len(job.ReduceTasks) {
+		return false
+	}
+	expected, hasChecksum := findFileChecksum(files, taskID)
+
+	fileName := attemptFileName(job.outputFileName(taskID), attemptID)
+	file, err := openStorageFile(fileName)
 	if err != nil {
 		LogError("[Master] ReduceTask %d invalido: errore apertura file %s: %v", taskID, fileName, err)
 		return false
@@ -387,24 +663,35 @@ func (m *Master) validateReduceTaskOutput(taskID int) bool {
 		return false
 	}
 
-	if !hasData {
+	if hasChecksum {
+		// Con il checksum anche un output vuoto è valido, se il reduce non ha scritto record;
+		// le righe corrispondono ai record solo nei formati con un record per riga
+		if !job.outputFormat().MultiLine && int64(lineCount) != expected.Records {
+			LogError("[Master] ReduceTask %d invalido: %s contiene %d righe, attese %d", taskID, fileName, lineCount, expected.Records)
+			return false
+		}
+		if err := verifyFileChecksum(fileName, expected); err != nil {
+			LogError("[Master] ReduceTask %d invalido: %v", taskID, err)
+			return false
+		}
+	} else if !hasData {
 		LogWarn("[Master] ReduceTask %d invalido: file %s vuoto", taskID, fileName)
 		return false
 	}
 
-	LogInfo("[Master] ReduceTask %d valido: file %s contiene %d righe", taskID, fileName, lineCount)
+	LogInfo("[Master] Job %s: ReduceTask %d valido: file %s contiene %d righe", job.ID, taskID, fileName, lineCount)
 	return true
 }
 
 // cleanupInvalidReduceTask rimuove il file di output di un ReduceTask invalido
-func (m *Master) cleanupInvalidReduceTask(taskID int) {
-	if taskID < 0 || taskID >= len(m.reduceTasks) {
+func (m *Master) cleanupInvalidReduceTask(job *Job, taskID int) {
+	if taskID < 0 || taskID >= len(job.ReduceTasks) {
 		return
 	}
 
-	LogInfo("[Master] Pulizia ReduceTask %d invalido", taskID)
-	fileName := getOutputFileName(taskID)
-	if err := os.Remove(fileName); err != nil && !os.IsNotExist(err) {
+	LogInfo("[Master] Pulizia ReduceTask %d invalido del job %s", taskID, job.ID)
+	fileName := job.outputFileName(taskID)
+	if err := storageFor(fileName).Remove(fileName); err != nil && !os.IsNotExist(err) {
 		LogError("[Master] Errore rimozione file %s: %v", fileName, err)
 	}
 }
@@ -418,102 +705,125 @@ func (m *Master) AssignTask(args *RequestTaskArgs, reply *Task) error {
 	}
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	if m.isDone {
-		LogInfo("[Master] Job completato, restituisco ExitTask")
+	if m.stopping {
+		LogInfo("[Master] Master in arresto, restituisco ExitTask")
 		reply.Type = ExitTask
 		return nil
 	}
+	job := m.activeJob()
+	if job == nil {
+		// Coda vuota: i worker restano in attesa dei job sottomessi in seguito
+		*reply = Task{Type: NoTask}
+		LogDebug("[Master] Nessun job attivo, restituisco NoTask")
+		return nil
+	}
+	if workerID := strings.TrimSpace(args.WorkerID); workerID != "" {
+		m.advertiseWorkerSlots(workerID, args.Slots)
+		if !m.workerHasFreeSlot(workerID, args.Slots) {
+			// Tutti gli slot del worker sono occupati da task in esecuzione
+			*reply = Task{Type: NoTask}
+			LogDebug("[Master] Worker %s ha tutti gli slot occupati, restituisco NoTask", workerID)
+			return nil
+		}
+	}
 	var taskToDo *Task
-	LogDebug("[Master] Fase corrente: %v, mapTasks: %d, reduceTasks: %d", m.phase, len(m.mapTasks), len(m.reduceTasks))
-	if m.phase == MapPhase {
-		for id, info := range m.mapTasks {
+	backup := false // taskToDo è un backup speculativo di un tentativo in corso
+	speculate := GetConfig().IsSpeculativeEnabled()
+	LogDebug("[Master] Job %s fase corrente: %v, mapTasks: %d, reduceTasks: %d", job.ID, job.Phase, len(job.MapTasks), len(job.ReduceTasks))
+	if job.Phase == MapPhase {
+		for id, info := range job.MapTasks {
 			LogDebug("[Master] MapTask %d: stato=%v", id, info.State)
 			if info.State == Idle {
 				// Verifica se il MapTask è già stato completato (file intermedi esistenti)
-				if m.isMapTaskCompleted(id) {
+				if m.isMapTaskCompleted(job, id) {
 					LogInfo("[Master] MapTask %d già completato (file intermedi esistenti), marco come Completed", id)
-					m.mapTasks[id].State = Completed
-					m.mapTasksDone++
-					if m.mapTasksDone == len(m.mapTasks) {
-						m.phase = ReducePhase
+					job.MapTasks[id].State = Completed
+					job.MapTasksDone++
+					if job.MapTasksDone == len(job.MapTasks) {
+						job.Phase = ReducePhase
 						LogInfo("[Master] Tutti i MapTask completati, transizione a ReducePhase")
 					}
 					continue
 				}
-				taskToDo = &Task{Type: MapTask, TaskID: id, Input: m.inputFiles[id], NReduce: m.nReduce}
-				m.mapTasks[id].State = InProgress
-				m.mapTasks[id].StartTime = time.Now()
-				LogInfo("[Master] Assegnato MapTask %d: %s", id, m.inputFiles[id])
+				taskToDo = job.newMapTask(id)
+				job.MapTasks[id].State = InProgress
+				job.MapTasks[id].StartTime = time.Now()
+				LogInfo("[Master] Job %s: assegnato MapTask %d: %s", job.ID, id, job.Splits[id])
 				break
 			} else if info.State == InProgress {
 				// Verifica se il task è effettivamente completato (file intermedi esistenti)
-				if m.isMapTaskCompleted(id) {
+				if m.isMapTaskCompleted(job, id) {
 					LogInfo("[Master] MapTask %d in InProgress ma file intermedi presenti, marco come Completed", id)
-					m.mapTasks[id].State = Completed
-					m.mapTasksDone++
-					if m.mapTasksDone == len(m.mapTasks) {
-						m.phase = ReducePhase
+					job.MapTasks[id].State = Completed
+					job.MapTasksDone++
+					if job.MapTasksDone == len(job.MapTasks) {
+						job.Phase = ReducePhase
 						LogInfo("[Master] Tutti i MapTask completati, transizione a ReducePhase")
 					}
 					continue
 				}
+				if speculate {
+					// Con l'esecuzione speculativa un task in corso riceve solo il backup deciso dal monitor
+					if !m.takeBackupSlot(TaskKey{JobID: job.ID, ID: id, Type: MapTask}, args.WorkerID) {
+						continue
+					}
+					taskToDo = job.newMapTask(id)
+					backup = true
+					LogInfo("[Master] Job %s: backup speculativo di MapTask %d: %s", job.ID, id, job.Splits[id])
+					break
+				}
 				// Il task è in InProgress ma non è completato, potrebbe essere bloccato
 				// Riassegna il task
-				taskToDo = &Task{Type: MapTask, TaskID: id, Input: m.inputFiles[id], NReduce: m.nReduce}
-				m.mapTasks[id].State = InProgress
-				m.mapTasks[id].StartTime = time.Now()
-				LogInfo("[Master] Riassegnato MapTask %d in InProgress: %s", id, m.inputFiles[id])
+				taskToDo = job.newMapTask(id)
+				job.MapTasks[id].State = InProgress
+				job.MapTasks[id].StartTime = time.Now()
+				LogInfo("[Master] Job %s: riassegnato MapTask %d in InProgress: %s", job.ID, id, job.Splits[id])
 				break
 			} else if info.State == Completed {
 				// Verifica se i file intermedi sono ancora validi
-				if !m.validateMapTaskOutput(id) {
+				if !m.validateMapTaskOutput(job, id) {
+					// Il task torna Idle, e viene riassegnato, quando il reset è applicato
 					LogWarn("[Master] MapTask %d marcato come Completed ma file intermedi invalidi, resetto a Idle", id)
-					m.mapTasks[id].State = Idle
-					m.mapTasksDone--
-					m.cleanupInvalidMapTask(id)
-					taskToDo = &Task{Type: MapTask, TaskID: id, Input: m.inputFiles[id], NReduce: m.nReduce}
-					m.mapTasks[id].State = InProgress
-					m.mapTasks[id].StartTime = time.Now()
-					LogInfo("[Master] Riassegnato MapTask %d: %s", id, m.inputFiles[id])
-					break
+					m.cleanupInvalidMapTask(job, id)
+					m.invalidateCompletedTask(job, MapTask, id)
 				}
 			}
 		}
 
 		// Verifica esplicita se tutti i MapTask sono completati
-		if taskToDo == nil && m.phase == MapPhase {
+		if taskToDo == nil && job.Phase == MapPhase {
 			// Conta i MapTask effettivamente completati
 			actualMapDone := 0
-			for _, task := range m.mapTasks {
+			for _, task := range job.MapTasks {
 				if task.State == Completed {
 					actualMapDone++
 				}
 			}
-			if actualMapDone == len(m.mapTasks) {
-				m.mapTasksDone = actualMapDone
-				m.phase = ReducePhase
-				LogInfo("[Master] Tutti i MapTask completati (%d/%d), transizione a ReducePhase", actualMapDone, len(m.mapTasks))
+			if actualMapDone == len(job.MapTasks) {
+				job.MapTasksDone = actualMapDone
+				job.Phase = ReducePhase
+				LogInfo("[Master] Tutti i MapTask completati (%d/%d), transizione a ReducePhase", actualMapDone, len(job.MapTasks))
 			}
 		}
-	} else if m.phase == ReducePhase {
-		for id, info := range m.reduceTasks {
+	} else if job.Phase == ReducePhase {
+		for id, info := range job.ReduceTasks {
 			LogDebug("[Master] ReduceTask %d: stato=%v", id, info.State)
 			if info.State == Idle {
 				// Verifica se tutti i file intermedi necessari esistono
-				if !m.areAllMapTasksCompleted() {
+				if !m.areAllMapTasksCompleted(job) {
 					LogDebug("[Master] ReduceTask %d non può essere assegnato: MapTask non completati", id)
 					continue
 				}
 
 				// Verifica se il ReduceTask è già stato completato (file di output esistente)
-				if m.isReduceTaskCompleted(id) {
+				if m.isReduceTaskCompleted(job, id) {
 					LogInfo("[Master] ReduceTask %d già completato (file output esistente), marco come Completed", id)
-					m.reduceTasks[id].State = Completed
-					m.reduceTasksDone++
-					if m.reduceTasksDone == len(m.reduceTasks) {
-						m.phase = DonePhase
-						m.isDone = true
+					job.ReduceTasks[id].State = Completed
+					job.ReduceTasksDone++
+					if job.ReduceTasksDone == len(job.ReduceTasks) {
 						LogInfo("[Master] Tutti i ReduceTask completati, transizione a DonePhase")
+						m.finishJob(job)
+						break
 					}
 					continue
 				}
@@ -521,41 +831,64 @@ func (m *Master) AssignTask(args *RequestTaskArgs, reply *Task) error {
 				// Riprendi da eventuale checkpoint precedente
 				checkpoint := ""
 				if m.reducerCheckpoint != nil {
-					if cp, ok := m.reducerCheckpoint[id]; ok {
+					if cp, ok := m.reducerCheckpoint[TaskKey{JobID: job.ID, ID: id, Type: ReduceTask}]; ok {
 						checkpoint = cp
 						LogInfo("[Master] ReduceTask %d: assegno con checkpoint %s", id, cp)
 					}
 				}
-				taskToDo = &Task{Type: ReduceTask, TaskID: id, NMap: len(m.mapTasks), Checkpoint: checkpoint}
-				m.reduceTasks[id].State = InProgress
-				m.reduceTasks[id].StartTime = time.Now()
-				LogInfo("[Master] Assegnato ReduceTask %d", id)
+				taskToDo = job.newReduceTask(id, checkpoint)
+				job.ReduceTasks[id].State = InProgress
+				job.ReduceTasks[id].StartTime = time.Now()
+				LogInfo("[Master] Job %s: assegnato ReduceTask %d", job.ID, id)
+				break
+			} else if info.State == InProgress && speculate {
+				if !m.takeBackupSlot(TaskKey{JobID: job.ID, ID: id, Type: ReduceTask}, args.WorkerID) {
+					continue
+				}
+				taskToDo = job.newReduceTask(id, "")
+				backup = true
+				LogInfo("[Master] Job %s: backup speculativo di ReduceTask %d", job.ID, id)
 				break
 			} else if info.State == Completed {
 				// Verifica se il file di output è ancora valido
-				if !m.validateReduceTaskOutput(id) {
+				if !m.validateReduceTaskOutput(job, id) {
+					// Il task torna Idle, e viene riassegnato, quando il reset è applicato
 					LogWarn("[Master] ReduceTask %d marcato come Completed ma file output invalido, resetto a Idle", id)
-					m.reduceTasks[id].State = Idle
-					m.reduceTasksDone--
-					m.cleanupInvalidReduceTask(id)
-					// Riprendi da eventuale checkpoint precedente
-					checkpoint := ""
-					if m.reducerCheckpoint != nil {
-						if cp, ok := m.reducerCheckpoint[id]; ok {
-							checkpoint = cp
-							LogInfo("[Master] ReduceTask %d: riassegno con checkpoint %s", id, cp)
-						}
-					}
-					taskToDo = &Task{Type: ReduceTask, TaskID: id, NMap: len(m.mapTasks), Checkpoint: checkpoint}
-					m.reduceTasks[id].State = InProgress
-					m.reduceTasks[id].StartTime = time.Now()
-					LogInfo("[Master] Riassegnato ReduceTask %d", id)
-					break
+					m.cleanupInvalidReduceTask(job, id)
+					m.invalidateCompletedTask(job, ReduceTask, id)
 				}
 			}
 		}
 	}
 	if taskToDo != nil {
+		// Il worker usa l'applicazione del job per scegliere le funzioni map/reduce
+		taskToDo.App = job.App
+		taskToDo.AppParams = job.AppParams
+		taskToDo.OutputFormat = job.OutputFormat
+		taskToDo.OutputDir = job.OutputDir
+		// Numera il tentativo: il worker lo riporta in caso di fallimento
+		tasks := job.MapTasks
+		if taskToDo.Type == ReduceTask {
+			tasks = job.ReduceTasks
+		}
+		tasks[taskToDo.TaskID].Attempts++
+		taskToDo.Attempt = tasks[taskToDo.TaskID].Attempts
+		taskToDo.AttemptID = newAttemptID(taskToDo.Type, taskToDo.TaskID, taskToDo.Attempt)
+		if !backup {
+			tasks[taskToDo.TaskID].AttemptID = taskToDo.AttemptID
+			tasks[taskToDo.TaskID].BackupID = ""
+		} else {
+			key := TaskKey{JobID: job.ID, ID: taskToDo.TaskID, Type: taskToDo.Type}
+			tasks[taskToDo.TaskID].BackupID = taskToDo.AttemptID
+			m.speculative[key] = taskToDo.AttemptID
+			if taskToDo.Type == ReduceTask {
+				// Il backup usa un checkpoint proprio per non riprendere da quello del tentativo in corso
+				taskToDo.Checkpoint = attemptFileName(job.checkpointFileName(taskToDo.TaskID), taskToDo.AttemptID)
+			}
+			if m.metrics != nil {
+				m.metrics.RecordSpeculativeLaunch(strings.ToLower(taskToDo.Type.String()))
+			}
+		}
 		*reply = *taskToDo
 		LogInfo("[Master] Restituisco task: %v", *taskToDo)
 
@@ -573,8 +906,9 @@ func (m *Master) AssignTask(args *RequestTaskArgs, reply *Task) error {
 					Status:    "active",
 					LastSeen:  time.Now(),
 					TasksDone: 0,
+					Slots:     args.Slots,
 				}
-				LogInfo("[Master] Nuovo worker registrato: %s", workerID)
+				LogInfo("[Master] Nuovo worker registrato: %s (%d slot)", workerID, m.workerSlotLimit(workerID, args.Slots))
 			}
 			m.workerLastSeen[workerID] = time.Now()
 			m.workers[workerID].LastSeen = time.Now()
@@ -584,7 +918,7 @@ func (m *Master) AssignTask(args *RequestTaskArgs, reply *Task) error {
 			if m.workerToTasks[workerID] == nil {
 				m.workerToTasks[workerID] = make(map[TaskKey]bool)
 			}
-			m.workerToTasks[workerID][TaskKey{ID: taskToDo.TaskID, Type: taskToDo.Type}] = true
+			m.workerToTasks[workerID][TaskKey{JobID: taskToDo.JobID, ID: taskToDo.TaskID, Type: taskToDo.Type}] = true
 		}
 	} else {
 		*reply = Task{Type: NoTask}
@@ -597,35 +931,84 @@ func (m *Master) TaskCompleted(args *TaskCompletedArgs, reply *Reply) error {
 		return nil
 	}
 
-	LogInfo("[Master] TaskCompleted ricevuto: Type=%v, TaskID=%d", args.Type, args.TaskID)
+	LogInfo("[Master] TaskCompleted ricevuto: Job=%s, Type=%v, TaskID=%d, Attempt=%s", args.JobID, args.Type, args.TaskID, args.AttemptID)
 
-	// Validazione specifica per MapTask
-	if args.Type == MapTask {
-		if args.TaskID < 0 || args.TaskID >= len(m.mapTasks) {
-			log.Printf("[Master] TaskID %d fuori range per MapTask\n", args.TaskID)
-			return fmt.Errorf("TaskID %d fuori range", args.TaskID)
-		}
+	// Un solo commit alla volta: il primo tentativo valido viene promosso, i successivi scartati
+	m.commitMu.Lock()
+	defer m.commitMu.Unlock()
 
-		// Verifica che i file intermedi siano stati creati correttamente
-		if !m.validateMapTaskOutput(args.TaskID) {
-			log.Printf("[Master] MapTask %d completato ma file intermedi invalidi, rifiuto completamento\n", args.TaskID)
-			return fmt.Errorf("MapTask %d file intermedi invalidi", args.TaskID)
-		}
+	m.mu.RLock()
+	job := m.getJob(args.JobID)
+	if job == nil {
+		m.mu.RUnlock()
+		return fmt.Errorf("%w: %s", errJobNotFound, args.JobID)
+	}
+	jobID := job.ID
 
-		LogInfo("[Master] MapTask %d completato e validato correttamente", args.TaskID)
+	var tasks []TaskInfo
+	var valid bool
+	if args.Type == MapTask {
+		tasks = job.MapTasks
 	} else if args.Type == ReduceTask {
-		if args.TaskID < 0 || args.TaskID >= len(m.reduceTasks) {
-			log.Printf("[Master] TaskID %d fuori range per ReduceTask\n", args.TaskID)
-			return fmt.Errorf("TaskID %d fuori range", args.TaskID)
-		}
-
+		tasks = job.ReduceTasks
+	}
+	if args.TaskID < 0 || args.TaskID >= len(tasks) {
+		m.mu.RUnlock()
+		log.Printf("[Master] TaskID %d fuori range per %v\n", args.TaskID, args.Type)
+		return fmt.Errorf("TaskID %d fuori range", args.TaskID)
+	}
+	files := taskOutputFiles(jobID, args.Type, args.TaskID, job.NReduce, job.OutputDir)
+	taskKey := TaskKey{JobID: jobID, ID: args.TaskID, Type: args.Type}
+	if args.AttemptID != "" && tasks[args.TaskID].State == Completed {
+		// Straggler: un altro tentativo ha già completato il task
+		committed := tasks[args.TaskID].Committed
+		m.mu.RUnlock()
+		removeAttemptFiles(files, args.AttemptID)
+		m.mu.Lock()
+		m.untrackWorkerTask(args.WorkerID, taskKey)
+		m.mu.Unlock()
+		LogWarn("[Master] %vTask %d già completato dal tentativo %q, scarto il tentativo %s", args.Type, args.TaskID, committed, args.AttemptID)
+		return fmt.Errorf("%vTask %d già completato da un altro tentativo", args.Type, args.TaskID)
+	}
+	if job.IsPaused() {
+		// I task del job sono tornati Idle con la pausa e verranno rieseguiti alla ripresa
+		m.mu.RUnlock()
+		removeAttemptFiles(files, args.AttemptID)
+		m.mu.Lock()
+		m.untrackWorkerTask(args.WorkerID, taskKey)
+		m.mu.Unlock()
+		LogWarn("[Master] Job %s in pausa, scarto il tentativo %s di %vTask %d", jobID, args.AttemptID, args.Type, args.TaskID)
+		return fmt.Errorf("job %s in pausa", jobID)
+	}
+	var duration time.Duration
+	if start := tasks[args.TaskID].StartTime; !start.IsZero() {
+		duration = time.Since(start)
+	}
+	shuffled := args.Type == MapTask && args.ShuffleAddr != ""
+	if shuffled {
+		// Intermedi sul disco del worker, che li serve ai reduce: il master non può leggerli
+		valid = true
+	} else if args.Type == MapTask {
+		// Verifica che i file intermedi siano stati creati correttamente
+		valid = m.validateMapAttemptOutput(job, args.TaskID, args.AttemptID, args.Files)
+	} else {
 		// Verifica che il file di output sia stato creato correttamente
-		if !m.validateReduceTaskOutput(args.TaskID) {
-			log.Printf("[Master] ReduceTask %d completato ma file output invalido, rifiuto completamento\n", args.TaskID)
-			return fmt.Errorf("ReduceTask %d file output invalido", args.TaskID)
-		}
+		valid = m.validateReduceAttemptOutput(job, args.TaskID, args.AttemptID, args.Files)
+	}
+	m.mu.RUnlock()
+	if !valid {
+		removeAttemptFiles(files, args.AttemptID)
+		log.Printf("[Master] %vTask %d completato ma output invalido, rifiuto completamento\n", args.Type, args.TaskID)
+		return fmt.Errorf("%vTask %d output invalido", args.Type, args.TaskID)
+	}
+	LogInfo("[Master] %vTask %d completato e validato correttamente", args.Type, args.TaskID)
 
-		LogInfo("[Master] ReduceTask %d completato e validato correttamente", args.TaskID)
+	// Promuove i file del tentativo ai nomi definitivi prima di registrare il completamento
+	if args.AttemptID != "" && !shuffled {
+		if err := promoteAttemptFiles(files, args.AttemptID); err != nil {
+			removeAttemptFiles(files, args.AttemptID)
+			return err
+		}
 	}
 
 	op := "complete-reduce"
@@ -633,7 +1016,10 @@ func (m *Master) TaskCompleted(args *TaskCompletedArgs, reply *Reply) error {
 		op = "complete-map"
 	}
 
-	cmd := LogCommand{Operation: op, TaskID: args.TaskID}
+	cmd := LogCommand{Operation: op, JobID: jobID, TaskID: args.TaskID, AttemptID: args.AttemptID, Duration: duration, Counters: &args.Counters, Files: args.Files}
+	if shuffled {
+		cmd.Location = args.ShuffleAddr
+	}
 	cmdBytes, err := json.Marshal(cmd)
 	if err != nil {
 		log.Printf("[Master] Error marshaling command: %v", err)
@@ -646,19 +1032,20 @@ func (m *Master) TaskCompleted(args *TaskCompletedArgs, reply *Reply) error {
 		return err
 	}
 
-	LogInfo("[Master] TaskCompleted applicato con successo: %s TaskID=%d", op, args.TaskID)
+	LogInfo("[Master] TaskCompleted applicato con successo: %s Job=%s TaskID=%d", op, jobID, args.TaskID)
+	if args.Type == MapTask && m.metrics != nil {
+		m.metrics.RecordCombine(args.Counters.RecordsBeforeCombine, args.Counters.RecordsAfterCombine)
+	}
 
 	// Aggiorna contatori e deregistra il task dal worker
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.resolveSpeculation(taskKey, args.AttemptID)
 	if args.WorkerID != "" {
 		if worker, exists := m.workers[args.WorkerID]; exists {
 			worker.TasksDone++
 			worker.LastSeen = time.Now()
-			if m.workerToTasks[args.WorkerID] != nil {
-				delete(m.workerToTasks[args.WorkerID], TaskKey{ID: args.TaskID, Type: args.Type})
-				if len(m.workerToTasks[args.WorkerID]) == 0 {
-					delete(m.workerToTasks, args.WorkerID)
-				}
-			}
+			m.untrackWorkerTask(args.WorkerID, taskKey)
 			LogInfo("[Master] Worker %s ha completato il task, totale task completati: %d", args.WorkerID, worker.TasksDone)
 		} else {
 			LogWarn("[Master] Worker %s non trovato nella mappa dei worker", args.WorkerID)
@@ -670,6 +1057,84 @@ func (m *Master) TaskCompleted(args *TaskCompletedArgs, reply *Reply) error {
 	return nil
 }
 
+// untrackWorkerTask rimuove un task dai task in carico al worker. Chiamato con m.mu acquisito.
+func (m *Master) untrackWorkerTask(workerID string, key TaskKey) {
+	m.clearWorkerProgress(workerID, key)
+	if tasks := m.workerToTasks[workerID]; tasks != nil {
+		delete(tasks, key)
+		if len(tasks) == 0 {
+			delete(m.workerToTasks, workerID)
+		}
+	}
+}
+
+// TaskFailed è il metodo RPC con cui un worker segnala che un task è fallito. Il fallimento
+// viene registrato nello storico del task tramite Raft e il task torna subito assegnabile,
+// senza attendere TaskTimeout; i fallimenti del backup speculativo e dei tentativi
+// obsoleti restano sul leader (vedi absorbTaskFailure).
+func (m *Master) TaskFailed(args *TaskFailedArgs, reply *Reply) error {
+	if m.raft.State() != raft.Leader {
+		return fmt.Errorf("non sono il leader")
+	}
+
+	LogWarn("[Master] TaskFailed ricevuto: Job=%s, Type=%v, TaskID=%d, Attempt=%d, Worker=%s: %s",
+		args.JobID, args.Type, args.TaskID, args.Attempt, args.WorkerID, args.Error)
+
+	m.mu.Lock()
+	job := m.getJob(args.JobID)
+	if job == nil {
+		m.mu.Unlock()
+		return fmt.Errorf("%w: %s", errJobNotFound, args.JobID)
+	}
+	jobID := job.ID
+	op, tasks := "fail-map", job.MapTasks
+	if args.Type == ReduceTask {
+		op, tasks = "fail-reduce", job.ReduceTasks
+	} else if args.Type != MapTask {
+		m.mu.Unlock()
+		return fmt.Errorf("tipo di task non valido: %v", args.Type)
+	}
+	if args.TaskID < 0 || args.TaskID >= len(tasks) {
+		m.mu.Unlock()
+		return fmt.Errorf("TaskID %d fuori range", args.TaskID)
+	}
+	taskKey := TaskKey{JobID: jobID, ID: args.TaskID, Type: args.Type}
+	if m.absorbTaskFailure(taskKey, &tasks[args.TaskID], args.AttemptID, args.WorkerID) {
+		m.mu.Unlock()
+		return nil
+	}
+	m.mu.Unlock()
+
+	cmd := LogCommand{
+		Operation: op,
+		JobID:     jobID,
+		TaskID:    args.TaskID,
+		Failure: &TaskFailure{
+			Attempt:   args.Attempt,
+			AttemptID: args.AttemptID,
+			WorkerID:  args.WorkerID,
+			Error:     args.Error,
+			Time:      time.Now(),
+		},
+	}
+	cmdBytes, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+	if err := m.raft.Apply(cmdBytes, 2*time.Second).Error(); err != nil {
+		return fmt.Errorf("errore applicando %s: %v", op, err)
+	}
+	if m.metrics != nil {
+		m.metrics.RecordTaskFailure(strings.ToLower(args.Type.String()))
+	}
+
+	// Il task non è più in carico al worker
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.untrackWorkerTask(args.WorkerID, taskKey)
+	return nil
+}
+
 // ResetTask è un metodo RPC che forza il reset di un task specifico, permettendone
 // la riassegnazione immediata. Il reset viene serializzato tramite Raft per consistenza.
 func (m *Master) ResetTask(args *ResetTaskArgs, reply *Reply) error {
@@ -679,8 +1144,16 @@ func (m *Master) ResetTask(args *ResetTaskArgs, reply *Reply) error {
 	if args.TaskID < 0 {
 		return fmt.Errorf("task id invalido")
 	}
+	// Risolve il job (vuoto = job attivo) per registrare l'ID esplicito nel log
+	m.mu.RLock()
+	job := m.getJob(args.JobID)
+	m.mu.RUnlock()
+	if job == nil {
+		return fmt.Errorf("%w: %s", errJobNotFound, args.JobID)
+	}
+	jobID := job.ID
 	// Applica il reset tramite Raft per consistenza
-	cmd := LogCommand{Operation: "reset-task", TaskID: args.TaskID}
+	cmd := LogCommand{Operation: "reset-task", JobID: jobID, TaskID: args.TaskID}
 	cmdBytes, err := json.Marshal(cmd)
 	if err != nil {
 		return err
@@ -688,11 +1161,14 @@ func (m *Master) ResetTask(args *ResetTaskArgs, reply *Reply) error {
 	if err := m.raft.Apply(cmdBytes, 2*time.Second).Error(); err != nil {
 		return err
 	}
-	LogWarn("[Master] ResetTask RPC: %v task=%d reason=%s", args.Type, args.TaskID, args.Reason)
+	LogWarn("[Master] ResetTask RPC: job=%s %v task=%d reason=%s", jobID, args.Type, args.TaskID, args.Reason)
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	// Best-effort: rimuovi il task dalla mappa worker->tasks (potrebbe essere stato riassegnato)
+	taskKey := TaskKey{JobID: jobID, ID: args.TaskID, Type: args.Type}
 	for w := range m.workerToTasks {
-		if m.workerToTasks[w][TaskKey{ID: args.TaskID, Type: args.Type}] {
-			delete(m.workerToTasks[w], TaskKey{ID: args.TaskID, Type: args.Type})
+		if m.workerToTasks[w][taskKey] {
+			delete(m.workerToTasks[w], taskKey)
 			if len(m.workerToTasks[w]) == 0 {
 				delete(m.workerToTasks, w)
 			}
@@ -701,13 +1177,13 @@ func (m *Master) ResetTask(args *ResetTaskArgs, reply *Reply) error {
 	// Se è un ReduceTask e la reason contiene checkpoint=..., memorizza il percorso
 	if args.Type == ReduceTask {
 		if m.reducerCheckpoint == nil {
-			m.reducerCheckpoint = make(map[int]string)
+			m.reducerCheckpoint = make(map[TaskKey]string)
 		}
 		const key = "checkpoint="
 		if idx := strings.Index(args.Reason, key); idx >= 0 {
 			cp := strings.TrimSpace(args.Reason[idx+len(key):])
 			if cp != "" {
-				m.reducerCheckpoint[args.TaskID] = cp
+				m.reducerCheckpoint[taskKey] = cp
 				LogInfo("[Master] Registrato checkpoint per ReduceTask %d: %s", args.TaskID, cp)
 			}
 		}
@@ -754,6 +1230,14 @@ func (m *Master) Done() bool {
 	return m.isDone
 }
 
+// Shutdown segnala l'arresto del master: da questo momento AssignTask risponde ExitTask
+// e i worker terminano. Finché il master è attivo una coda vuota restituisce NoTask.
+func (m *Master) Shutdown() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stopping = true
+}
+
 // RecoveryState verifica e ripristina lo stato dopo l'elezione del leader
 func (m *Master) RecoveryState() {
 	m.mu.Lock()
@@ -764,90 +1248,94 @@ func (m *Master) RecoveryState() {
 	}
 
 	LogInfo("[Master] RecoveryState: verifico stato dopo elezione leader")
-	LogInfo("[Master] Stato corrente: isDone=%v, phase=%v, mapTasksDone=%d/%d, reduceTasksDone=%d/%d",
-		m.isDone, m.phase, m.mapTasksDone, len(m.mapTasks), m.reduceTasksDone, len(m.reduceTasks))
+	job := m.activeJob()
+	if job == nil {
+		LogInfo("[Master] RecoveryState: nessun job attivo, isDone=%v", m.isDone)
+		return
+	}
+	LogInfo("[Master] Stato corrente job %s: phase=%v, mapTasksDone=%d/%d, reduceTasksDone=%d/%d",
+		job.ID, job.Phase, job.MapTasksDone, len(job.MapTasks), job.ReduceTasksDone, len(job.ReduceTasks))
 
 	// Verifica consistenza dello stato e recovery completo
-	if m.phase == MapPhase {
+	if job.Phase == MapPhase {
 		// Conta i MapTask effettivamente completati verificando i file
 		actualMapDone := 0
-		for i, task := range m.mapTasks {
+		for i, task := range job.MapTasks {
 			if task.State == Completed {
 				// Verifica che i file intermedi siano ancora validi
-				if m.isMapTaskCompleted(i) && m.validateMapTaskOutput(i) {
+				if m.isMapTaskCompleted(job, i) && m.validateMapTaskOutput(job, i) {
 					actualMapDone++
 				} else {
 					// File corrotti o mancanti, reset del task
 					LogWarn("[Master] RecoveryState: MapTask %d file corrotti, resetto a Idle", i)
-					m.mapTasks[i].State = Idle
-					m.cleanupInvalidMapTask(i)
+					job.MapTasks[i].State = Idle
+					m.cleanupInvalidMapTask(job, i)
 				}
 			} else if task.State == InProgress {
 				// Verifica se il task è effettivamente completato
-				if m.isMapTaskCompleted(i) && m.validateMapTaskOutput(i) {
+				if m.isMapTaskCompleted(job, i) && m.validateMapTaskOutput(job, i) {
 					LogInfo("[Master] RecoveryState: MapTask %d completato ma marcato InProgress, correggo", i)
-					m.mapTasks[i].State = Completed
+					job.MapTasks[i].State = Completed
 					actualMapDone++
 				} else {
 					// Task bloccato, reset
 					LogWarn("[Master] RecoveryState: MapTask %d bloccato, resetto a Idle", i)
-					m.mapTasks[i].State = Idle
+					job.MapTasks[i].State = Idle
 				}
 			}
 		}
 
-		if actualMapDone != m.mapTasksDone {
-			LogInfo("[Master] Correzione mapTasksDone: %d -> %d", m.mapTasksDone, actualMapDone)
-			m.mapTasksDone = actualMapDone
+		if actualMapDone != job.MapTasksDone {
+			LogInfo("[Master] Correzione mapTasksDone: %d -> %d", job.MapTasksDone, actualMapDone)
+			job.MapTasksDone = actualMapDone
 		}
 
 		// Se tutti i MapTask sono completati, passa a ReducePhase
-		if m.mapTasksDone == len(m.mapTasks) && m.phase == MapPhase {
-			m.phase = ReducePhase
+		if job.MapTasksDone == len(job.MapTasks) && job.Phase == MapPhase {
+			job.Phase = ReducePhase
 			LogInfo("[Master] RecoveryState: transizione a ReducePhase")
 		}
-	} else if m.phase == ReducePhase {
+	} else if job.Phase == ReducePhase {
 		// Conta i ReduceTask effettivamente completati verificando i file
 		actualReduceDone := 0
-		for i, task := range m.reduceTasks {
+		for i, task := range job.ReduceTasks {
 			if task.State == Completed {
 				// Verifica che il file di output sia ancora valido
-				if m.isReduceTaskCompleted(i) && m.validateReduceTaskOutput(i) {
+				if m.isReduceTaskCompleted(job, i) && m.validateReduceTaskOutput(job, i) {
 					actualReduceDone++
 				} else {
 					// File corrotti o mancanti, reset del task
 					LogWarn("[Master] RecoveryState: ReduceTask %d file corrotti, resetto a Idle", i)
-					m.reduceTasks[i].State = Idle
-					m.cleanupInvalidReduceTask(i)
+					job.ReduceTasks[i].State = Idle
+					m.cleanupInvalidReduceTask(job, i)
 				}
 			} else if task.State == InProgress {
 				// Verifica se il task è effettivamente completato
-				if m.isReduceTaskCompleted(i) && m.validateReduceTaskOutput(i) {
+				if m.isReduceTaskCompleted(job, i) && m.validateReduceTaskOutput(job, i) {
 					LogInfo("[Master] RecoveryState: ReduceTask %d completato ma marcato InProgress, correggo", i)
-					m.reduceTasks[i].State = Completed
+					job.ReduceTasks[i].State = Completed
 					actualReduceDone++
 				} else {
 					// Task bloccato, reset
 					LogWarn("[Master] RecoveryState: ReduceTask %d bloccato, resetto a Idle", i)
-					m.reduceTasks[i].State = Idle
+					job.ReduceTasks[i].State = Idle
 				}
 			}
 		}
 
-		if actualReduceDone != m.reduceTasksDone {
-			LogInfo("[Master] Correzione reduceTasksDone: %d -> %d", m.reduceTasksDone, actualReduceDone)
-			m.reduceTasksDone = actualReduceDone
+		if actualReduceDone != job.ReduceTasksDone {
+			LogInfo("[Master] Correzione reduceTasksDone: %d -> %d", job.ReduceTasksDone, actualReduceDone)
+			job.ReduceTasksDone = actualReduceDone
 		}
 
 		// Se tutti i ReduceTask sono completati, passa a DonePhase
-		if m.reduceTasksDone == len(m.reduceTasks) && m.phase == ReducePhase {
-			m.phase = DonePhase
-			m.isDone = true
+		if job.ReduceTasksDone == len(job.ReduceTasks) && job.Phase == ReducePhase {
 			LogInfo("[Master] RecoveryState: transizione a DonePhase")
+			m.finishJob(job)
 		}
 	}
 
-	LogInfo("[Master] RecoveryState completato: isDone=%v, phase=%v", m.isDone, m.phase)
+	LogInfo("[Master] RecoveryState completato: job=%s, phase=%v, isDone=%v", job.ID, job.Phase, m.isDone)
 }
 func MakeMaster(files []string, nReduce int, me int, raftAddrs []string, rpcAddrs []string) (*Master, error) {
 	// Inizializza il generatore di numeri casuali con seed realmente indipendente per nodo
@@ -859,9 +1347,7 @@ func MakeMaster(files []string, nReduce int, me int, raftAddrs []string, rpcAddr
 	}
 
 	m := &Master{
-		inputFiles: files, nReduce: nReduce,
-		mapTasks: make([]TaskInfo, len(files)), reduceTasks: make([]TaskInfo, nReduce),
-		phase:  MapPhase,
+		jobs:   make(map[string]*Job),
 		isDone: false, // Forza isDone=false esplicitamente
 		// Inizializza i nuovi campi per gestione dinamica del cluster
 		clusterMembers: make(map[string]string),
@@ -872,7 +1358,11 @@ func MakeMaster(files []string, nReduce int, me int, raftAddrs []string, rpcAddr
 		workers:         make(map[string]*WorkerInfo),
 		workerLastSeen:  make(map[string]time.Time),
 		workerHeartbeat: make(map[string]time.Time),
+		workerProgress:  make(map[string]map[TaskKey]*TaskProgress),
 		workerToTasks:   make(map[string]map[TaskKey]bool),
+		metrics:         NewMetricCollector(),
+
+		outputEffectsReady: make(chan struct{}, 1),
 	}
 
 	// Popola la mappa dei membri del cluster
@@ -881,7 +1371,7 @@ func MakeMaster(files []string, nReduce int, me int, raftAddrs []string, rpcAddr
 			m.clusterMembers[raftAddr] = rpcAddrs[i]
 		}
 	}
-	LogInfo("[Master %d] Inizializzazione: isDone=%v, phase=%v", me, m.isDone, m.phase)
+	LogInfo("[Master %d] Inizializzazione: isDone=%v", me, m.isDone)
 	config := raft.DefaultConfig()
 	config.LocalID = raft.ServerID(raftAddrs[me])
 	config.Logger = hclog.New(&hclog.LoggerOptions{Name: fmt.Sprintf("Raft-%s", raftAddrs[me]), Level: hclog.Info, Output: os.Stderr})
@@ -913,24 +1403,24 @@ func MakeMaster(files []string, nReduce int, me int, raftAddrs []string, rpcAddr
 	os.MkdirAll(raftDir, 0700)
 	LogInfo("[Master %d] Directory Raft preparata: %s", me, raftDir)
 
-	// Reset esplicito dello stato PRIMA della creazione di Raft
+	// Reset esplicito dello stato PRIMA della creazione di Raft: il job iniziale
+	// (stesso ID su tutti i nodi) parte con tutti i task Idle
 	m.mu.Lock()
 	m.isDone = false
-	m.phase = MapPhase
-	m.mapTasksDone = 0
-	m.reduceTasksDone = 0
-	// Reset tutti i task a Idle
-	for i := range m.mapTasks {
-		m.mapTasks[i] = TaskInfo{State: Idle}
-	}
-	for i := range m.reduceTasks {
-		m.reduceTasks[i] = TaskInfo{State: Idle}
+	initialSplits, err := computeInputSplits(files, GetConfig().GetSplitSize())
+	if err != nil {
+		LogWarn("[Master %d] Impossibile calcolare gli split di input (%v), uso un map task per file", me, err)
+		initialSplits = nil
 	}
+	initialJob := newJob(&JobSpec{JobID: DefaultJobID, InputFiles: files, Splits: initialSplits, NReduce: nReduce, App: DefaultAppName,
+		MaxAttempts: GetConfig().GetMaxTaskAttempts(), SubmittedAt: time.Now(), InputFormat: detectInputFormat(files),
+		OutputFormat: GetConfig().GetOutputFormat(), OutputDir: GetConfig().GetJobOutputDir()})
+	m.enqueueJob(initialJob)
 	m.mu.Unlock()
-	LogInfo("[Master %d] Reset stato PRIMA di Raft: isDone=%v, phase=%v", me, m.isDone, m.phase)
+	LogInfo("[Master %d] Reset stato PRIMA di Raft: isDone=%v, job=%s, phase=%v", me, m.isDone, initialJob.ID, initialJob.Phase)
 
 	// Pulisci i file precedenti all'avvio
-	m.cleanupPreviousJobFiles()
+	m.cleanupJobFiles(initialJob)
 	logStore, err := raftboltdb.New(raftboltdb.Options{Path: filepath.Join(raftDir, "log.db")})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create log store: %s", err)
@@ -948,7 +1438,7 @@ func MakeMaster(files []string, nReduce int, me int, raftAddrs []string, rpcAddr
 		return nil, fmt.Errorf("raft: %s", err)
 	}
 	m.raft = ra
-	LogInfo("[Master %d] Dopo creazione Raft: isDone=%v, phase=%v", me, m.isDone, m.phase)
+	LogInfo("[Master %d] Dopo creazione Raft: isDone=%v", me, m.Done())
 
 	// Verifica che i file Raft siano stati creati correttamente
 	logPath := filepath.Join(raftDir, "log.db")
@@ -983,17 +1473,23 @@ func MakeMaster(files []string, nReduce int, me int, raftAddrs []string, rpcAddr
 				if currentState == raft.Leader {
 					LogInfo("[Master %d] Diventato leader, eseguo recovery dello stato", me)
 					m.RecoveryState()
+					m.publishPendingJobs()
 				}
 			}
 		}
 	}()
 
-	LogInfo("[Master %d] Stato finale dopo inizializzazione: isDone=%v, phase=%v, mapTasks=%d, reduceTasks=%d",
-		me, m.isDone, m.phase, len(m.mapTasks), len(m.reduceTasks))
+	m.mu.RLock()
+	LogInfo("[Master %d] Stato finale dopo inizializzazione: isDone=%v, job in coda=%d",
+		me, m.isDone, len(m.jobQueue))
+	m.mu.RUnlock()
 
 	// Avvia il monitor per la gestione dinamica del cluster
 	go m.startClusterManagementMonitor()
 
+	// Esegue sul leader le operazioni sugli output decise dai comandi applicati
+	go m.runOutputEffects()
+
 	// Implementa un sistema di elezione più equo
 	// Solo un master alla volta può fare il bootstrap, con delay casuale non correlato
 	go func() {
@@ -1064,30 +1560,33 @@ func MakeMaster(files []string, nReduce int, me int, raftAddrs []string, rpcAddr
 			}
 			now := time.Now()
 			m.mu.Lock()
-			if m.phase == MapPhase {
-				for i, info := range m.mapTasks {
-					if info.State == InProgress && now.Sub(info.StartTime) > TaskTimeout {
-						// Reset task e logga il comando per recovery
-						m.mapTasks[i] = TaskInfo{State: Idle}
-						LogWarn("[Master] MapTask %d timeout, resettato a Idle", i)
+			job := m.activeJob()
+			if job != nil && job.Phase == MapPhase {
+				for i, info := range job.MapTasks {
+					if info.State == InProgress && now.Sub(info.lastActivity()) > TaskTimeout {
+						// Reset task e logga il comando per recovery (storico dei tentativi preservato)
+						job.MapTasks[i].State = Idle
+						delete(m.speculative, TaskKey{JobID: job.ID, ID: i, Type: MapTask})
+						LogWarn("[Master] Job %s: MapTask %d senza progressi da %v, resettato a Idle", job.ID, i, now.Sub(info.lastActivity()).Round(time.Second))
 
 						// Applica il reset tramite Raft per consistency
-						cmd := LogCommand{Operation: "reset-task", TaskID: i}
+						cmd := LogCommand{Operation: "reset-task", JobID: job.ID, TaskID: i}
 						cmdBytes, err := json.Marshal(cmd)
 						if err == nil {
 							m.raft.Apply(cmdBytes, 500*time.Millisecond)
 						}
 					}
 				}
-			} else if m.phase == ReducePhase {
-				for i, info := range m.reduceTasks {
-					if info.State == InProgress && now.Sub(info.StartTime) > TaskTimeout {
-						// Reset task e logga il comando per recovery
-						m.reduceTasks[i] = TaskInfo{State: Idle}
-						LogWarn("[Master] ReduceTask %d timeout, resettato a Idle", i)
+			} else if job != nil && job.Phase == ReducePhase {
+				for i, info := range job.ReduceTasks {
+					if info.State == InProgress && now.Sub(info.lastActivity()) > TaskTimeout {
+						// Reset task e logga il comando per recovery (storico dei tentativi preservato)
+						job.ReduceTasks[i].State = Idle
+						delete(m.speculative, TaskKey{JobID: job.ID, ID: i, Type: ReduceTask})
+						LogWarn("[Master] Job %s: ReduceTask %d senza progressi da %v, resettato a Idle", job.ID, i, now.Sub(info.lastActivity()).Round(time.Second))
 
 						// Applica il reset tramite Raft per consistency
-						cmd := LogCommand{Operation: "reset-task", TaskID: i}
+						cmd := LogCommand{Operation: "reset-task", JobID: job.ID, TaskID: i}
 						cmdBytes, err := json.Marshal(cmd)
 						if err == nil {
 							m.raft.Apply(cmdBytes, 500*time.Millisecond)
@@ -1095,6 +1594,10 @@ func MakeMaster(files []string, nReduce int, me int, raftAddrs []string, rpcAddr
 					}
 				}
 			}
+			// Verso la fine della fase lancia backup dei task molto più lenti della mediana
+			if GetConfig().IsSpeculativeEnabled() {
+				m.markSpeculativeTasks(job, now)
+			}
 			m.mu.Unlock()
 		}
 	}()
@@ -1109,27 +1612,36 @@ func MakeMaster(files []string, nReduce int, me int, raftAddrs []string, rpcAddr
 			}
 
 			m.mu.Lock()
-			if m.phase == MapPhase {
-				for i, info := range m.mapTasks {
+			job := m.activeJob()
+			if job != nil && job.Phase == MapPhase {
+				for i, info := range job.MapTasks {
 					if info.State == Completed {
 						// Verifica periodicamente che i file intermedi siano ancora validi
-						if !m.validateMapTaskOutput(i) {
-							LogWarn("[Master] MapTask %d file intermedi corrotti, resetto a Idle", i)
-							m.mapTasks[i].State = Idle
-							m.mapTasksDone--
-							m.cleanupInvalidMapTask(i)
+						if !m.validateMapTaskOutput(job, i) {
+							LogWarn("[Master] Job %s: MapTask %d file intermedi corrotti, resetto a Idle", job.ID, i)
+							m.cleanupInvalidMapTask(job, i)
+							m.invalidateCompletedTask(job, MapTask, i)
 						}
 					}
 				}
-			} else if m.phase == ReducePhase {
-				for i, info := range m.reduceTasks {
+			} else if job != nil && job.Phase == ReducePhase {
+				// Un intermedio che non corrisponde più al checksum registrato richiede di
+				// rieseguire il map prima che i reduce lo leggano: lost-map riporta il map
+				// Idle e il job in MapPhase su tutti i nodi
+				for i, info := range job.MapTasks {
+					if info.State == Completed && !m.validateMapTaskOutput(job, i) {
+						LogWarn("[Master] Job %s: MapTask %d file intermedi corrotti, riesecuzione e ritorno a MapPhase", job.ID, i)
+						m.cleanupInvalidMapTask(job, i)
+						m.invalidateCompletedTask(job, MapTask, i)
+					}
+				}
+				for i, info := range job.ReduceTasks {
 					if info.State == Completed {
 						// Verifica periodicamente che i file di output siano ancora validi
-						if !m.validateReduceTaskOutput(i) {
-							LogWarn("[Master] ReduceTask %d file output corrotti, resetto a Idle", i)
-							m.reduceTasks[i].State = Idle
-							m.reduceTasksDone--
-							m.cleanupInvalidReduceTask(i)
+						if !m.validateReduceTaskOutput(job, i) {
+							LogWarn("[Master] Job %s: ReduceTask %d file output corrotti, resetto a Idle", job.ID, i)
+							m.cleanupInvalidReduceTask(job, i)
+							m.invalidateCompletedTask(job, ReduceTask, i)
 						}
 					}
 				}
@@ -1167,41 +1679,43 @@ func MakeMaster(files []string, nReduce int, me int, raftAddrs []string, rpcAddr
 				delete(m.workers, workerID)
 				delete(m.workerLastSeen, workerID)
 				delete(m.workerHeartbeat, workerID)
+				delete(m.workerProgress, workerID)
 
 				// Reset tutti i task InProgress (potrebbero essere assegnati al worker morto)
-				if m.phase == MapPhase {
-					for i, info := range m.mapTasks {
+				job := m.activeJob()
+				if job != nil && job.Phase == MapPhase {
+					for i, info := range job.MapTasks {
 						if info.State == InProgress && now.Sub(info.StartTime) > workerTimeout {
-							LogWarn("[Master] Reset MapTask %d per worker morto %s", i, workerID)
-							m.mapTasks[i].State = Idle
+							LogWarn("[Master] Job %s: reset MapTask %d per worker morto %s", job.ID, i, workerID)
+							job.MapTasks[i].State = Idle
 
 							// Applica il reset tramite Raft per consistency
-							cmd := LogCommand{Operation: "reset-task", TaskID: i}
+							cmd := LogCommand{Operation: "reset-task", JobID: job.ID, TaskID: i}
 							cmdBytes, err := json.Marshal(cmd)
 							if err == nil {
 								m.raft.Apply(cmdBytes, 500*time.Millisecond)
 							}
 						}
 					}
-				} else if m.phase == ReducePhase {
-					for i, info := range m.reduceTasks {
+				} else if job != nil && job.Phase == ReducePhase {
+					for i, info := range job.ReduceTasks {
 						if info.State == InProgress && now.Sub(info.StartTime) > workerTimeout {
-							LogWarn("[Master] Reset ReduceTask %d per worker morto %s", i, workerID)
-							m.reduceTasks[i].State = Idle
+							LogWarn("[Master] Job %s: reset ReduceTask %d per worker morto %s", job.ID, i, workerID)
+							job.ReduceTasks[i].State = Idle
 
 							// Per ReduceTask, preserva il checkpoint se esiste
-							checkpointPath := fmt.Sprintf("data/output/mr-out-%d.checkpoint.json", i)
+							checkpointPath := job.checkpointFileName(i)
 							if _, err := os.Stat(checkpointPath); err == nil {
 								// Checkpoint esiste, lo preserviamo per la riassegnazione
 								if m.reducerCheckpoint == nil {
-									m.reducerCheckpoint = make(map[int]string)
+									m.reducerCheckpoint = make(map[TaskKey]string)
 								}
-								m.reducerCheckpoint[i] = checkpointPath
+								m.reducerCheckpoint[TaskKey{JobID: job.ID, ID: i, Type: ReduceTask}] = checkpointPath
 								LogInfo("[Master] Preservato checkpoint per ReduceTask %d: %s", i, checkpointPath)
 							}
 
 							// Applica il reset tramite Raft per consistency
-							cmd := LogCommand{Operation: "reset-task", TaskID: i}
+							cmd := LogCommand{Operation: "reset-task", JobID: job.ID, TaskID: i}
 							cmdBytes, err := json.Marshal(cmd)
 							if err == nil {
 								m.raft.Apply(cmdBytes, 500*time.Millisecond)
@@ -1218,8 +1732,21 @@ func MakeMaster(files []string, nReduce int, me int, raftAddrs []string, rpcAddr
 
 // SubmitJob gestisce la sottomissione di nuovi job MapReduce
 type SubmitJobArgs struct {
-	InputFiles []string `json:"input_files"`
-	NReduce    int      `json:"n_reduce"`
+	InputFiles []string          `json:"input_files"`
+	NReduce    int               `json:"n_reduce"`
+	App        string            `json:"app,omitempty"`      // vuoto = DefaultAppName
+	Params     map[string]string `json:"params,omitempty"`   // parametri dell'applicazione
+	SplitMB    int               `json:"split_mb,omitempty"` // dimensione split in MB (0 = configurazione)
+	// Formato di input (lines, jsonl, csv); vuoto = dedotto dall'estensione dei file
+	InputFormat string `json:"input_format,omitempty"`
+	// Formato di output (text, tsv, jsonl, csv); vuoto = configurazione
+	OutputFormat string `json:"output_format,omitempty"`
+	// Directory o prefisso s3://bucket/prefisso/ dell'output; vuoto = output locale
+	OutputDir string `json:"output_dir,omitempty"`
+	// Partitioner delle chiavi intermedie (vuoto = PartitionerHash)
+	Partitioner string `json:"partitioner,omitempty"`
+	// File accessori da distribuire ai worker: percorsi sul master o s3://bucket/key
+	CacheFiles []string `json:"cache_files,omitempty"`
 }
 
 type SubmitJobReply struct {
@@ -1247,89 +1774,399 @@ func (m *Master) SubmitJob(args *SubmitJobArgs, reply *SubmitJobReply) error {
 		return fmt.Errorf("non sono il leader, non posso accettare job")
 	}
 
-	LogInfo("[Master] SubmitJob ricevuto: %d file, %d reducer", len(args.InputFiles), args.NReduce)
+	LogInfo("[Master] SubmitJob ricevuto: app=%s, %d file, %d reducer", args.App, len(args.InputFiles), args.NReduce)
+
+	// Genera un JobID univoco, replicato insieme al job
+	jobID := newJobID()
+
+	// Verifica che i file di input esistano ed espande i pattern (anche s3://bucket/in/*)
+	inputFiles, err := resolveInputFiles(args.InputFiles)
+	if err != nil {
+		return err
+	}
+	outputDir := args.OutputDir
+	if outputDir == "" {
+		outputDir = GetConfig().GetJobOutputDir()
+	}
+	if err := validateOutputDir(outputDir); err != nil {
+		return err
+	}
+
+	if args.NReduce <= 0 {
+		return fmt.Errorf("numero di reducer non valido: %d", args.NReduce)
+	}
 
-	// Genera un JobID univoco
-	jobID := fmt.Sprintf("job-%d", time.Now().Unix())
+	// Verifica che l'applicazione esista e accetti i parametri prima di replicare il job
+	appName := args.App
+	if appName == "" {
+		appName = DefaultAppName
+	}
+	app, err := LookupApp(appName)
+	if err != nil {
+		return err
+	}
+	if _, _, err := BuildAppFuncs(appName, args.Params); err != nil {
+		return err
+	}
+	inputFormat := args.InputFormat
+	if inputFormat == "" {
+		inputFormat = detectInputFormat(inputFiles)
+	}
+	format, err := LookupInputFormat(inputFormat)
+	if err != nil {
+		return err
+	}
+	outputFormat := args.OutputFormat
+	if outputFormat == "" {
+		outputFormat = GetConfig().GetOutputFormat()
+	}
+	if _, err := LookupOutputFormat(outputFormat); err != nil {
+		return err
+	}
+	partitioner, err := LookupPartitioner(args.Partitioner)
+	if err != nil {
+		return err
+	}
+	if partitioner.Sampled && app.NoSampling {
+		return fmt.Errorf("il partitioner %s campiona l'input sul master e non è supportato dall'applicazione %s", partitioner.Name, appName)
+	}
+	cacheFiles, err := publishCacheFiles(args.CacheFiles)
+	if err != nil {
+		return err
+	}
+	if err := app.validateCacheParams(args.Params, cacheFiles); err != nil {
+		return err
+	}
 
-	// Verifica che i file di input esistano
-	for _, file := range args.InputFiles {
-		if _, err := os.Stat(file); os.IsNotExist(err) {
-			return fmt.Errorf("file di input non trovato: %s", file)
+	// Calcola gli split di input sul leader: vengono replicati con il job
+	splitSize := GetConfig().GetSplitSize()
+	if args.SplitMB > 0 {
+		splitSize = int64(args.SplitMB) << 20
+	}
+	splits, err := computeInputSplits(inputFiles, splitSize)
+	if err != nil {
+		return fmt.Errorf("errore calcolo split di input: %v", err)
+	}
+
+	// I partitioner campionati ricevono i confini calcolati qui, replicati con il job
+	var bounds []string
+	if partitioner.Sampled {
+		// Le applicazioni con SplitMap ricevono porzioni di testo, le altre i record del formato
+		sampleFormat, mapr := format, RecordMapFunc(nil)
+		if app.SplitMap {
+			mapf, err := app.NewMap(AppContext{Params: args.Params})
+			if err != nil {
+				return err
+			}
+			sampleFormat, mapr = wholeSplitFormat{limit: PartitionSampleChunkSize}, recordMapFunc(mapf)
+		} else if mapr, err = buildAppRecordMap(app, AppContext{Params: args.Params}); err != nil {
+			return err
+		}
+		if bounds, err = samplePartitionBounds(splits, sampleFormat, mapr, args.NReduce); err != nil {
+			return fmt.Errorf("errore campionamento per il partitioner %s: %v", partitioner.Name, err)
 		}
 	}
 
-	// Aggiorna la configurazione del master con i nuovi parametri
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	// Replica il job tramite Raft: sarà applicato da Apply su tutti i nodi
+	cmd := LogCommand{
+		Operation: "submit-job",
+		Job: &JobSpec{
+			JobID:        jobID,
+			InputFiles:   inputFiles,
+			Splits:       splits,
+			NReduce:      args.NReduce,
+			App:          appName,
+			AppParams:    args.Params,
+			MaxAttempts:  GetConfig().GetMaxTaskAttempts(),
+			SubmittedAt:  time.Now(),
+			InputFormat:  format.Name(),
+			OutputFormat: outputFormat,
+			OutputDir:    outputDir,
+
+			Partitioner:     partitioner.Name,
+			PartitionBounds: bounds,
+			CacheFiles:      cacheFiles,
+		},
+	}
+	cmdBytes, err := json.Marshal(cmd)
+	if err != nil {
+		return fmt.Errorf("errore marshaling comando: %v", err)
+	}
+
+	if err := m.raft.Apply(cmdBytes, 5*time.Second).Error(); err != nil {
+		return fmt.Errorf("errore applicando submit-job: %v", err)
+	}
 
-	// Reset dello stato se necessario
-	if m.isDone || m.phase == DonePhase {
-		LogInfo("[Master] Reset dello stato per nuovo job %s", jobID)
-		m.isDone = false
-		m.phase = MapPhase
-		m.mapTasksDone = 0
-		m.reduceTasksDone = 0
+	LogInfo("[Master] Job %s replicato con successo (%d split)", jobID, len(splits))
 
-		// Pulisci i file precedenti prima di iniziare il nuovo job
-		m.cleanupPreviousJobFiles()
+	// Il job parte subito solo se è in testa alla coda, altrimenti resta in attesa
+	status := "queued"
+	m.mu.RLock()
+	if active := m.activeJob(); active != nil && active.ID == jobID {
+		status = "submitted"
 	}
+	m.mu.RUnlock()
 
-	// Aggiorna i parametri del job
-	m.inputFiles = args.InputFiles
-	m.nReduce = args.NReduce
+	*reply = SubmitJobReply{
+		JobID:  jobID,
+		Status: status,
+	}
+
+	return nil
+}
 
-	// Inizializza i task
-	m.mapTasks = make([]TaskInfo, len(args.InputFiles))
-	m.reduceTasks = make([]TaskInfo, args.NReduce)
+// applySubmitJob accoda il job descritto da spec; se la coda era vuota il job
+// diventa subito attivo. Chiamato da Apply con m.mu già acquisito, quindi eseguito su ogni nodo.
+func (m *Master) applySubmitJob(spec *JobSpec) {
+	LogInfo("[Master] Applico submit-job %s: %d file, %d reducer", spec.JobID, len(spec.InputFiles), spec.NReduce)
 
-	for i := range m.mapTasks {
-		m.mapTasks[i].State = Idle
+	wasIdle := m.activeJob() == nil
+	job := newJob(spec)
+	if !m.enqueueJob(job) {
+		LogWarn("[Master] Job %s già presente in coda, ignoro submit-job duplicato", spec.JobID)
+		return
 	}
 
-	for i := range m.reduceTasks {
-		m.reduceTasks[i].State = Idle
+	if wasIdle {
+		m.activateJob(job)
+	} else {
+		LogInfo("[Master] Job %s accodato in posizione %d", job.ID, len(m.jobQueue))
 	}
+}
 
-	LogInfo("[Master] Job %s configurato: %d map tasks, %d reduce tasks",
-		jobID, len(m.mapTasks), len(m.reduceTasks))
+// PauseJob mette in pausa un job: AssignTask smette di distribuirne i task e i worker
+// che li stanno eseguendo li abbandonano al prossimo heartbeat
+func (m *Master) PauseJob(args *JobControlArgs, reply *JobControlReply) error {
+	return m.controlJob("pause-job", args, reply)
+}
 
-	*reply = SubmitJobReply{
-		JobID:  jobID,
-		Status: "submitted",
+// ResumeJob riprende un job in pausa
+func (m *Master) ResumeJob(args *JobControlArgs, reply *JobControlReply) error {
+	return m.controlJob("resume-job", args, reply)
+}
+
+// CancelJob cancella un job in coda o in esecuzione e ne rimuove i file intermedi
+func (m *Master) CancelJob(args *JobControlArgs, reply *JobControlReply) error {
+	return m.controlJob("cancel-job", args, reply)
+}
+
+// controlJob valida e replica tramite Raft un comando di controllo su un job
+func (m *Master) controlJob(operation string, args *JobControlArgs, reply *JobControlReply) error {
+	if m.raft.State() != raft.Leader {
+		return fmt.Errorf("non sono il leader, non posso eseguire %s", operation)
+	}
+
+	jobID := strings.TrimSpace(args.JobID)
+	LogInfo("[Master] %s ricevuto per job %s", operation, jobID)
+
+	m.mu.RLock()
+	job := m.jobs[jobID]
+	var err error
+	switch {
+	case job == nil:
+		err = fmt.Errorf("%w: %s", errJobNotFound, jobID)
+	case job.IsDone():
+		err = fmt.Errorf("job %s già terminato", jobID)
+	case operation == "pause-job" && job.IsPaused():
+		err = fmt.Errorf("job %s già in pausa", jobID)
+	case operation == "resume-job" && !job.IsPaused():
+		err = fmt.Errorf("job %s non è in pausa", jobID)
+	}
+	m.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	cmdBytes, err := json.Marshal(LogCommand{Operation: operation, JobID: jobID})
+	if err != nil {
+		return fmt.Errorf("errore marshaling comando: %v", err)
+	}
+	if err := m.raft.Apply(cmdBytes, 5*time.Second).Error(); err != nil {
+		return fmt.Errorf("errore applicando %s: %v", operation, err)
 	}
 
+	m.mu.RLock()
+	*reply = JobControlReply{JobID: jobID, Status: job.Status.String()}
+	m.mu.RUnlock()
+
+	LogInfo("[Master] %s replicato per job %s, stato: %s", operation, jobID, reply.Status)
 	return nil
 }
 
-// cleanupPreviousJobFiles pulisce i file precedenti prima di iniziare un nuovo job
-func (m *Master) cleanupPreviousJobFiles() {
-	LogInfo("[Master] Pulizia file precedenti...")
+// applyPauseJob mette in pausa un job e rimette Idle i suoi task in corso,
+// così alla ripresa vengono riassegnati. Chiamato da Apply con m.mu già acquisito.
+func (m *Master) applyPauseJob(jobID string) {
+	job := m.jobs[jobID]
+	if job == nil || job.IsDone() {
+		LogDebug("[Master] Ignoro pause-job: job %q non trovato o terminato", jobID)
+		return
+	}
+	wasActive := m.activeJob() == job
+	job.Status = JobPaused
+	for i := range job.MapTasks {
+		if job.MapTasks[i].State == InProgress {
+			job.MapTasks[i].State = Idle
+		}
+	}
+	for i := range job.ReduceTasks {
+		if job.ReduceTasks[i].State == InProgress {
+			job.ReduceTasks[i].State = Idle
+		}
+	}
+	m.forgetJobTasks(job)
+	LogInfo("[Master] Job %s in pausa", job.ID)
+	if wasActive {
+		// I job successivi in coda non restano bloccati dalla pausa
+		m.advanceQueue()
+	}
+}
+
+// applyResumeJob riprende un job in pausa. Chiamato da Apply con m.mu già acquisito.
+func (m *Master) applyResumeJob(jobID string) {
+	job := m.jobs[jobID]
+	if job == nil || !job.IsPaused() {
+		LogDebug("[Master] Ignoro resume-job: job %q non trovato o non in pausa", jobID)
+		return
+	}
+	job.Status = JobActive
+	LogInfo("[Master] Job %s ripreso", job.ID)
+	if m.activeJob() == job {
+		// Il job precede quelli in esecuzione e torna attivo
+		m.activateJob(job)
+	}
+}
+
+// applyCancelJob porta un job nello stato terminale cancellato, ne rimuove i file
+// e, se era il job attivo, passa al successivo. Chiamato da Apply con m.mu già acquisito.
+func (m *Master) applyCancelJob(jobID string) {
+	job := m.jobs[jobID]
+	if job == nil || job.IsDone() {
+		LogDebug("[Master] Ignoro cancel-job: job %q non trovato o terminato", jobID)
+		return
+	}
+
+	wasActive := m.activeJob() == job
+	job.Status = JobCanceled
+	job.FinishedAt = time.Now()
+	LogInfo("[Master] Job %s cancellato (fase %v, progresso %.1f%%)", job.ID, job.Phase, job.Progress())
+	m.stopJob(job, wasActive)
+}
+
+// applyTaskFailure registra un tentativo fallito e rende il task riassegnabile; quando i
+// fallimenti raggiungono il massimo del job, il job fallisce. Chiamato con m.mu acquisito.
+func (m *Master) applyTaskFailure(job *Job, taskType TaskType, task *TaskInfo, taskID int, failure TaskFailure) {
+	if task.State == Completed {
+		// Un altro tentativo è già andato a buon fine
+		LogDebug("[Master] Ignoro fallimento di %v %d del job %s: già completato", taskType, taskID, job.ID)
+		return
+	}
+	task.Failures = append(task.Failures, failure)
+	task.State = Idle
+	LogWarn("[Master] Job %s: %vTask %d fallito (tentativo %d, worker %s, fallimenti %d/%d): %s",
+		job.ID, taskType, taskID, failure.Attempt, failure.WorkerID, len(task.Failures), job.maxAttempts(), failure.Error)
+
+	if len(task.Failures) < job.maxAttempts() {
+		return
+	}
+	wasActive := m.activeJob() == job
+	job.Status = JobFailed
+	job.Error = fmt.Sprintf("%vTask %d fallito %d volte: %s", taskType, taskID, len(task.Failures), failure.Error)
+	job.FinishedAt = failure.Time
+	LogError("[Master] Job %s fallito: %s", job.ID, job.Error)
+	m.stopJob(job, wasActive)
+}
+
+// stopJob rimuove i file di un job terminato senza completamento (cancellato o fallito)
+// e, se era il job attivo, attiva il successivo in coda. Chiamato con m.mu acquisito.
+func (m *Master) stopJob(job *Job, wasActive bool) {
+	if job.Started {
+		// Output parziali e checkpoint di un job avviato, anche se ora in pausa, non servono più
+		m.queueOutputEffect(outputCleanup, job)
+	}
+	m.cleanupJobIntermediateFiles(job)
+	m.forgetJobTasks(job)
+	if wasActive {
+		m.advanceQueue()
+	}
+}
+
+// cleanupJobFiles rimuove output e file intermedi di un job
+func (m *Master) cleanupJobFiles(job *Job) {
+	LogInfo("[Master] Pulizia file del job %s...", job.ID)
 
 	// Pulisci i file di output precedenti usando il numero di reducer corretto
-	for i := 0; i < m.nReduce; i++ {
-		outputFile := getOutputFileName(i)
-		if err := os.Remove(outputFile); err != nil && !os.IsNotExist(err) {
+	for i := 0; i < job.NReduce; i++ {
+		outputFile := job.outputFileName(i)
+		if err := storageFor(outputFile).Remove(outputFile); err != nil && !os.IsNotExist(err) {
 			LogWarn("[Master] Errore rimozione file output %s: %v", outputFile, err)
 		}
 	}
 
-	// Pulisci i file intermedi precedenti usando il numero di reducer corretto
-	for i := 0; i < len(m.inputFiles); i++ {
-		for j := 0; j < m.nReduce; j++ {
-			intermediateFile := getIntermediateFileName(i, j)
+	m.cleanupJobIntermediateFiles(job)
+
+	LogInfo("[Master] Pulizia file del job %s completata", job.ID)
+}
+
+// cleanupJobIntermediateFiles rimuove i file intermedi e gli spill dei reduce di un job
+func (m *Master) cleanupJobIntermediateFiles(job *Job) {
+	for i := 0; i < len(job.MapTasks); i++ {
+		for j := 0; j < job.NReduce; j++ {
+			intermediateFile := getIntermediateFileName(job.ID, i, j)
 			if err := os.Remove(intermediateFile); err != nil && !os.IsNotExist(err) {
 				LogWarn("[Master] Errore rimozione file intermedio %s: %v", intermediateFile, err)
 			}
 		}
 	}
 
-	LogInfo("[Master] Pulizia file precedenti completata")
+	// Spill lasciati da reduce interrotti e intermedi di tentativi mai promossi
+	dir := filepath.Dir(getIntermediateFileName(job.ID, 0, 0))
+	spills, _ := filepath.Glob(filepath.Join(dir, "mr-spill-"+jobFilePrefix(job.ID)+"*"))
+	attempts, _ := filepath.Glob(filepath.Join(dir, "mr-intermediate-"+jobFilePrefix(job.ID)+"*"+attemptMarker+"*"))
+	for _, spill := range append(spills, attempts...) {
+		if err := os.Remove(spill); err != nil && !os.IsNotExist(err) {
+			LogWarn("[Master] Errore rimozione spill %s: %v", spill, err)
+		}
+	}
+}
+
+// cleanupOutputFiles rimuove gli output del job (inclusi partial e checkpoint) lasciati da
+// un'esecuzione precedente nella directory di output locale e in quella del job, se indicata.
+// Gli output degli altri job hanno un prefisso diverso e restano intatti.
+func (m *Master) cleanupOutputFiles(job *Job) {
+	dirs := []string{filepath.Dir(getOutputFileName(job.ID, 0))}
+	if job.OutputDir != "" {
+		dirs = append(dirs, job.OutputDir)
+	}
+	for _, dir := range dirs {
+		pattern := joinStoragePath(dir, "mr-out-"+jobFilePrefix(job.ID)+"*")
+		st := storageFor(pattern)
+		matches, err := st.Glob(pattern)
+		if err != nil {
+			LogWarn("[Master] Errore ricerca file output %s: %v", pattern, err)
+			continue
+		}
+		for _, outputFile := range matches {
+			if err := st.Remove(outputFile); err != nil && !os.IsNotExist(err) {
+				LogWarn("[Master] Errore rimozione file output %s: %v", outputFile, err)
+			}
+		}
+	}
 }
 
 // copyOutputFilesToLocal copia i file di output dal volume Docker alla cartella locale data/output/
-func (m *Master) copyOutputFilesToLocal() {
-	LogInfo("[Master] Avvio copia file di output nella cartella locale...")
+func (m *Master) copyOutputFilesToLocal(job *Job) {
+	if isStorageURI(job.OutputDir) {
+		// Output remoto: il file unificato resta accanto agli output dei reduce
+		unifiedFile := joinStoragePath(job.OutputDir, job.unifiedOutputName())
+		totalRecords, err := writeUnifiedOutput(job, unifiedFile, GetConfig().IsOutputBannerEnabled())
+		if err != nil {
+			LogError("[Master] Errore creazione file finale %s: %v", unifiedFile, err)
+			return
+		}
+		LogInfo("[Master] File finale unificato creato: %s (%d record totali)", unifiedFile, totalRecords)
+		return
+	}
+	LogInfo("[Master] Avvio copia file di output del job %s nella cartella locale...", job.ID)
 
 	// Crea la cartella data/output se non esiste
 	localOutputDir := "data/output"
@@ -1339,12 +2176,12 @@ func (m *Master) copyOutputFilesToLocal() {
 	}
 
 	// Copia ogni file di output
-	for i := 0; i < m.nReduce; i++ {
-		sourceFile := getOutputFileName(i)
-		destFile := filepath.Join(localOutputDir, fmt.Sprintf("mr-out-%d", i))
+	for i := 0; i < job.NReduce; i++ {
+		sourceFile := job.outputFileName(i)
+		destFile := filepath.Join(localOutputDir, outputBaseName(job.ID, i))
 
 		// Verifica che il file sorgente esista
-		if _, err := os.Stat(sourceFile); os.IsNotExist(err) {
+		if _, err := storageFor(sourceFile).Stat(sourceFile); os.IsNotExist(err) {
 			LogWarn("[Master] File di output %s non trovato, salto", sourceFile)
 			continue
 		}
@@ -1360,15 +2197,15 @@ func (m *Master) copyOutputFilesToLocal() {
 	LogInfo("[Master] Copia file di output completata in %s", localOutputDir)
 
 	// Crea anche il file finale unificato
-	m.createUnifiedOutputFile()
+	m.createUnifiedOutputFile(job)
 
 	// Crea anche il file finale nel volume Docker
-	m.createUnifiedOutputFileInDocker()
+	m.createUnifiedOutputFileInDocker(job)
 }
 
 // copyFile copia un file da source a destination
 func (m *Master) copyFile(source, destination string) error {
-	srcFile, err := os.Open(source)
+	srcFile, err := openStorageFile(source)
 	if err != nil {
 		return err
 	}
@@ -1385,7 +2222,7 @@ func (m *Master) copyFile(source, destination string) error {
 }
 
 // createUnifiedOutputFile crea un file finale unificato che combina tutti i file di output
-func (m *Master) createUnifiedOutputFile() {
+func (m *Master) createUnifiedOutputFile(job *Job) {
 	LogInfo("[Master] Creazione file finale unificato...")
 
 	// Crea la cartella data/output se non esiste
@@ -1395,68 +2232,17 @@ func (m *Master) createUnifiedOutputFile() {
 		return
 	}
 
-	// File finale unificato
-	unifiedFile := filepath.Join(localOutputDir, "final-output.txt")
-
-	// Apri il file finale per scrittura
-	finalFile, err := os.Create(unifiedFile)
+	unifiedFile := filepath.Join(localOutputDir, job.unifiedOutputName())
+	totalRecords, err := writeUnifiedOutput(job, unifiedFile, GetConfig().IsOutputBannerEnabled())
 	if err != nil {
 		LogError("[Master] Errore creazione file finale %s: %v", unifiedFile, err)
 		return
 	}
-	defer finalFile.Close()
-
-	// Scrivi header
-	fmt.Fprintf(finalFile, "=== RISULTATO FINALE MAPREDUCE ===\n")
-	fmt.Fprintf(finalFile, "Generato il: %s\n", time.Now().Format("2006-01-02 15:04:05"))
-	fmt.Fprintf(finalFile, "Numero di reducer: %d\n", m.nReduce)
-	fmt.Fprintf(finalFile, "=====================================\n\n")
-
-	// Combina tutti i file di output
-	totalRecords := 0
-	for i := 0; i < m.nReduce; i++ {
-		sourceFile := getOutputFileName(i)
-
-		// Verifica che il file sorgente esista
-		if _, err := os.Stat(sourceFile); os.IsNotExist(err) {
-			LogWarn("[Master] File di output %s non trovato, salto", sourceFile)
-			continue
-		}
-
-		// Leggi il file di output
-		file, err := os.Open(sourceFile)
-		if err != nil {
-			LogError("[Master] Errore apertura file %s: %v", sourceFile, err)
-			continue
-		}
-
-		// Copia il contenuto nel file finale
-		fmt.Fprintf(finalFile, "--- OUTPUT REDUCER %d ---\n", i)
-		scanner := bufio.NewScanner(file)
-		recordCount := 0
-		for scanner.Scan() {
-			line := scanner.Text()
-			if line != "" { // Salta righe vuote
-				fmt.Fprintf(finalFile, "%s\n", line)
-				recordCount++
-			}
-		}
-		file.Close()
-
-		fmt.Fprintf(finalFile, "Record nel reducer %d: %d\n\n", i, recordCount)
-		totalRecords += recordCount
-	}
-
-	// Scrivi footer
-	fmt.Fprintf(finalFile, "=====================================\n")
-	fmt.Fprintf(finalFile, "TOTALE RECORD PROCESSATI: %d\n", totalRecords)
-	fmt.Fprintf(finalFile, "=====================================\n")
-
 	LogInfo("[Master] File finale unificato creato: %s (%d record totali)", unifiedFile, totalRecords)
 }
 
 // createUnifiedOutputFileInDocker crea un file finale unificato nel volume Docker
-func (m *Master) createUnifiedOutputFileInDocker() {
+func (m *Master) createUnifiedOutputFileInDocker(job *Job) {
 	LogInfo("[Master] Creazione file finale unificato nel volume Docker...")
 
 	// File finale nel volume Docker
@@ -1464,63 +2250,94 @@ func (m *Master) createUnifiedOutputFileInDocker() {
 	if basePath == "" {
 		basePath = "."
 	}
-	unifiedFile := filepath.Join(basePath, "final-output.txt")
-
-	// Apri il file finale per scrittura
-	finalFile, err := os.Create(unifiedFile)
+	unifiedFile := filepath.Join(basePath, job.unifiedOutputName())
+	totalRecords, err := writeUnifiedOutput(job, unifiedFile, GetConfig().IsOutputBannerEnabled())
 	if err != nil {
 		LogError("[Master] Errore creazione file finale Docker %s: %v", unifiedFile, err)
 		return
 	}
-	defer finalFile.Close()
-
-	// Scrivi header
-	fmt.Fprintf(finalFile, "=== RISULTATO FINALE MAPREDUCE ===\n")
-	fmt.Fprintf(finalFile, "Generato il: %s\n", time.Now().Format("2006-01-02 15:04:05"))
-	fmt.Fprintf(finalFile, "Numero di reducer: %d\n", m.nReduce)
-	fmt.Fprintf(finalFile, "=====================================\n\n")
-
-	// Combina tutti i file di output
-	totalRecords := 0
-	for i := 0; i < m.nReduce; i++ {
-		sourceFile := getOutputFileName(i)
+	LogInfo("[Master] File finale unificato Docker creato: %s (%d record totali)", unifiedFile, totalRecords)
+}
 
-		// Verifica che il file sorgente esista
-		if _, err := os.Stat(sourceFile); os.IsNotExist(err) {
+// writeUnifiedOutput concatena gli output dei reduce del job in path, nel formato di output
+// del job e con la sua eventuale intestazione. Con banner, per il formato text, aggiunge
+// l'intestazione descrittiva e il numero di record per reducer. Restituisce i record scritti.
+func writeUnifiedOutput(job *Job, path string, banner bool) (int64, error) {
+	format := job.outputFormat()
+	finalFile, err := storageFor(path).Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer finalFile.Close()
+	w := bufio.NewWriter(finalFile)
+
+	banner = banner && format.Name == OutputFormatText
+	if banner {
+		fmt.Fprintf(w, "=== RISULTATO FINALE MAPREDUCE ===\n")
+		fmt.Fprintf(w, "Generato il: %s\n", time.Now().Format("2006-01-02 15:04:05"))
+		fmt.Fprintf(w, "Job: %s\n", job.ID)
+		fmt.Fprintf(w, "Numero di reducer: %d\n", job.NReduce)
+		fmt.Fprintf(w, "=====================================\n\n")
+	}
+	w.WriteString(format.Header)
+
+	var totalRecords int64
+	for i := 0; i < job.NReduce; i++ {
+		sourceFile := job.outputFileName(i)
+		file, err := openStorageFile(sourceFile)
+		if os.IsNotExist(err) {
 			LogWarn("[Master] File di output %s non trovato, salto", sourceFile)
 			continue
 		}
-
-		// Leggi il file di output
-		file, err := os.Open(sourceFile)
 		if err != nil {
-			LogError("[Master] Errore apertura file %s: %v", sourceFile, err)
-			continue
+			return totalRecords, err
 		}
 
-		// Copia il contenuto nel file finale
-		fmt.Fprintf(finalFile, "--- OUTPUT REDUCER %d ---\n", i)
-		scanner := bufio.NewScanner(file)
-		recordCount := 0
-		for scanner.Scan() {
-			line := scanner.Text()
-			if line != "" { // Salta righe vuote
-				fmt.Fprintf(finalFile, "%s\n", line)
-				recordCount++
+		// I record sono quelli registrati dal reduce; in loro assenza si contano le righe
+		records, known := int64(0), false
+		if i < len(job.ReduceTasks) {
+			if checksum, ok := findFileChecksum(job.ReduceTasks[i].Files, i); ok {
+				records, known = checksum.Records, true
 			}
 		}
+		if banner {
+			fmt.Fprintf(w, "--- OUTPUT REDUCER %d ---\n", i)
+		}
+		counter := &lineCounter{w: w}
+		_, err = io.Copy(counter, file)
 		file.Close()
+		if err != nil {
+			return totalRecords, fmt.Errorf("errore copia %s: %v", sourceFile, err)
+		}
+		if !known {
+			records = counter.lines
+		}
+		if banner {
+			fmt.Fprintf(w, "Record nel reducer %d: %d\n\n", i, records)
+		}
+		totalRecords += records
+	}
 
-		fmt.Fprintf(finalFile, "Record nel reducer %d: %d\n\n", i, recordCount)
-		totalRecords += recordCount
+	if banner {
+		fmt.Fprintf(w, "=====================================\n")
+		fmt.Fprintf(w, "TOTALE RECORD PROCESSATI: %d\n", totalRecords)
+		fmt.Fprintf(w, "=====================================\n")
+	}
+	if err := w.Flush(); err != nil {
+		return totalRecords, err
 	}
+	return totalRecords, finalFile.Close()
+}
 
-	// Scrivi footer
-	fmt.Fprintf(finalFile, "=====================================\n")
-	fmt.Fprintf(finalFile, "TOTALE RECORD PROCESSATI: %d\n", totalRecords)
-	fmt.Fprintf(finalFile, "=====================================\n")
+// lineCounter inoltra i dati scritti contando le righe
+type lineCounter struct {
+	w     io.Writer
+	lines int64
+}
 
-	LogInfo("[Master] File finale unificato Docker creato: %s (%d record totali)", unifiedFile, totalRecords)
+func (c *lineCounter) Write(p []byte) (int, error) {
+	c.lines += int64(bytes.Count(p, []byte{'\n'}))
+	return c.w.Write(p)
 }
 
 // backupToS3 esegue un backup su S3 se abilitato
@@ -1725,7 +2542,7 @@ func (m *Master) GetWorkerTasks(args *GetWorkerTasksArgs, reply *GetWorkerTasksR
 	}
 	tasks := make([]WorkerTask, 0, len(set))
 	for tk := range set {
-		tasks = append(tasks, WorkerTask{TaskID: tk.ID, Type: tk.Type})
+		tasks = append(tasks, WorkerTask{JobID: tk.JobID, TaskID: tk.ID, Type: tk.Type})
 	}
 	reply.Tasks = tasks
 	return nil
@@ -1840,23 +2657,32 @@ func (m *Master) WorkerHeartbeat(args *WorkerHeartbeatArgs, reply *WorkerHeartbe
 		return nil
 	}
 
-	// Aggiorna il timestamp del heartbeat
+	// Aggiorna il timestamp del heartbeat e l'avanzamento del task in corso
 	m.workerHeartbeat[workerID] = now
 	m.workerLastSeen[workerID] = now
+	m.recordHeartbeatProgress(workerID, args.Progress, now)
+	reply.CleanupJobs = m.shuffleCleanupJobs(args.ShuffleAddr)
 
 	// Aggiorna o crea le informazioni del worker
 	if worker, exists := m.workers[workerID]; exists {
 		worker.LastSeen = now
+		worker.ShuffleAddr = args.ShuffleAddr
+		m.advertiseWorkerSlots(workerID, args.Slots)
 	} else {
 		m.workers[workerID] = &WorkerInfo{
-			ID:        workerID,
-			Status:    "active",
-			LastSeen:  now,
-			TasksDone: 0,
+			ID:          workerID,
+			Status:      "active",
+			LastSeen:    now,
+			TasksDone:   0,
+			Slots:       args.Slots,
+			ShuffleAddr: args.ShuffleAddr,
 		}
 		LogInfo("[Master] Nuovo worker registrato: %s", workerID)
 	}
 
+	// Segnala al worker i job in pausa o cancellati di cui sta ancora eseguendo task
+	reply.AbandonJobs = m.workerAbandonedJobs(workerID, args.Progress)
+
 	reply.Success = true
 	reply.Message = "Heartbeat ricevuto"
 	return nil
@@ -1864,58 +2690,143 @@ func (m *Master) WorkerHeartbeat(args *WorkerHeartbeatArgs, reply *WorkerHeartbe
 
 // ===== METODI REALI PER DASHBOARD DATA =====
 
-// GetJobInfo restituisce informazioni sui job per il dashboard
+// GetJobInfo restituisce informazioni sui job per il dashboard, nell'ordine della coda
 func (m *Master) GetJobInfo() []JobInfo {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
 	var jobs []JobInfo
+	active := m.activeJob()
+	for _, job := range m.orderedJobs() {
+		jobs = append(jobs, m.jobInfo(job, active))
+	}
+	return jobs
+}
 
-	// Crea un job principale basato sullo stato del master
-	jobID := "main-job"
-	status := "running"
-	phase := fmt.Sprint(m.phase)
-
-	if m.isDone {
-		status = "completed"
+// GetJob restituisce via RPC i dettagli di un job, inclusi i contatori utente aggregati
+func (m *Master) GetJob(args *JobControlArgs, reply *JobDetails) error {
+	jobID := strings.TrimSpace(args.JobID)
+	details, ok := m.GetJobDetails(jobID)
+	if !ok {
+		return fmt.Errorf("%w: %s", errJobNotFound, jobID)
 	}
+	*reply = details
+	return nil
+}
 
-	// Calcola il progresso
-	var progress float64
-	if m.phase == MapPhase {
-		if len(m.mapTasks) > 0 {
-			progress = float64(m.mapTasksDone) / float64(len(m.mapTasks)) * 100
-		}
-	} else if m.phase == ReducePhase {
-		if len(m.reduceTasks) > 0 {
-			progress = float64(m.reduceTasksDone) / float64(len(m.reduceTasks)) * 100
+// GetJobDetails restituisce i dettagli di un job, incluso lo storico dei fallimenti dei task
+func (m *Master) GetJobDetails(jobID string) (JobDetails, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	job := m.jobs[jobID]
+	if job == nil {
+		return JobDetails{}, false
+	}
+	info := m.jobInfo(job, m.activeJob())
+	details := JobDetails{
+		ID:           info.ID,
+		Status:       info.Status,
+		Phase:        info.Phase,
+		StartTime:    info.StartTime,
+		EndTime:      info.EndTime,
+		Progress:     info.Progress,
+		RunningTasks: info.RunningTasks,
+		App:          job.App,
+		AppParams:    job.AppParams,
+		InputFormat:  job.inputFormatName(),
+		OutputFormat: job.outputFormat().Name,
+		OutputDir:    job.OutputDir,
+		Partitioner:  job.partitionerName(),
+		CacheFiles:   job.CacheFiles,
+		InputFiles:   job.InputFiles,
+		MaxAttempts:  job.maxAttempts(),
+		Counters:     job.Counters,
+		Error:        job.Error,
+		ErrorLog:     []string{},
+		Failures:     []JobTaskFailure{},
+	}
+	collect := func(taskType TaskType, tasks []TaskInfo) TaskStateCounts {
+		counts := TaskStateCounts{Total: len(tasks)}
+		for id, task := range tasks {
+			switch task.State {
+			case Completed:
+				counts.Completed++
+			case InProgress:
+				counts.InProgress++
+			}
+			if len(task.Failures) > 0 {
+				counts.Failed++
+			}
+			for _, f := range task.Failures {
+				details.Failures = append(details.Failures, JobTaskFailure{TaskType: taskType.String(), TaskID: id, TaskFailure: f})
+			}
 		}
-	} else if m.isDone {
-		progress = 100.0
+		return counts
 	}
+	details.MapTasks = collect(MapTask, job.MapTasks)
+	details.ReduceTasks = collect(ReduceTask, job.ReduceTasks)
+	sort.SliceStable(details.Failures, func(i, j int) bool {
+		return details.Failures[i].Time.Before(details.Failures[j].Time)
+	})
 
-	// Calcola la durata (usa tempo di creazione come approssimazione)
-	var duration time.Duration = 0
+	if job.Error != "" {
+		details.ErrorLog = append(details.ErrorLog, job.Error)
+	}
+	for _, f := range details.Failures {
+		details.ErrorLog = append(details.ErrorLog, fmt.Sprintf("%s %s %d tentativo %d (worker %s): %s",
+			f.Time.Format(time.RFC3339), f.TaskType, f.TaskID, f.Attempt, f.WorkerID, f.Error))
+	}
+	return details, true
+}
 
-	job := JobInfo{
-		ID:          jobID,
-		Status:      status,
-		Phase:       phase,
-		StartTime:   time.Now().Add(-duration), // Approssimazione
-		Duration:    duration,
-		MapTasks:    len(m.mapTasks),
-		ReduceTasks: len(m.reduceTasks),
-		Progress:    progress,
+// jobInfo costruisce il riepilogo di un job per il dashboard. Chiamato con m.mu acquisito.
+func (m *Master) jobInfo(job *Job, active *Job) JobInfo {
+	// Il job in testa alla coda è in esecuzione, gli altri non completati sono in attesa
+	status := "queued"
+	switch {
+	case job.IsCanceled():
+		status = "canceled"
+	case job.IsFailed():
+		status = "failed"
+	case job.IsDone():
+		status = "completed"
+	case job.IsPaused():
+		status = "paused"
+	case job == active:
+		status = "running"
 	}
 
-	// Aggiungi end time se completato
-	if m.isDone {
-		endTime := time.Now()
-		job.EndTime = &endTime
+	// Calcola la durata dal momento della sottomissione
+	end := time.Now()
+	if job.IsDone() && !job.FinishedAt.IsZero() {
+		end = job.FinishedAt
+	}
+	var duration time.Duration
+	if !job.SubmittedAt.IsZero() {
+		duration = end.Sub(job.SubmittedAt)
 	}
 
-	jobs = append(jobs, job)
-	return jobs
+	info := JobInfo{
+		ID:           job.ID,
+		Status:       status,
+		Phase:        fmt.Sprint(job.Phase),
+		StartTime:    job.SubmittedAt,
+		Duration:     duration,
+		MapTasks:     len(job.MapTasks),
+		ReduceTasks:  len(job.ReduceTasks),
+		Progress:     job.Progress(),
+		Counters:     job.Counters,
+		Error:        job.Error,
+		RunningTasks: m.jobProgress(job.ID),
+	}
+
+	// Aggiungi end time se completato
+	if job.IsDone() {
+		endTime := end
+		info.EndTime = &endTime
+	}
+	return info
 }
 
 // GetWorkers restituisce informazioni sui worker per il dashboard
@@ -1940,33 +2851,30 @@ func (m *Master) GetWorkers() []WorkerInfoDashboard {
 			status = "failed"
 		}
 
-		// Trova il task corrente se esiste
+		// Trova i task in esecuzione negli slot, preferendo quelli con un report di avanzamento
 		currentTask := ""
-		for taskID, taskInfo := range m.mapTasks {
-			if taskInfo.State == InProgress {
-				// Verifica se questo worker sta eseguendo questo task
-				// Questo è una semplificazione - in un'implementazione reale
-				// dovresti tracciare quale worker sta eseguendo quale task
-				if taskID%len(m.workers) == 0 { // Esempio di distribuzione
-					currentTask = fmt.Sprintf("map-task-%d", taskID)
-				}
-			}
+		for taskKey := range m.workerToTasks[workerID] {
+			currentTask = dashboardTaskName(taskKey.JobID, taskKey.Type, taskKey.ID)
+			break
 		}
-
-		for taskID, taskInfo := range m.reduceTasks {
-			if taskInfo.State == InProgress {
-				if taskID%len(m.workers) == 0 { // Esempio di distribuzione
-					currentTask = fmt.Sprintf("reduce-task-%d", taskID)
-				}
-			}
+		progress := m.workerTaskProgress(workerID)
+		if len(progress) > 0 {
+			currentTask = dashboardTaskName(progress[0].JobID, progress[0].Type, progress[0].TaskID)
+		}
+		running := len(m.workerToTasks[workerID])
+		if len(progress) > running {
+			running = len(progress)
 		}
 
 		workerDashboard := WorkerInfoDashboard{
-			ID:          workerID,
-			Status:      status,
-			LastSeen:    worker.LastSeen,
-			TasksDone:   worker.TasksDone,
-			CurrentTask: currentTask,
+			ID:           workerID,
+			Status:       status,
+			LastSeen:     worker.LastSeen,
+			TasksDone:    worker.TasksDone,
+			CurrentTask:  currentTask,
+			Slots:        m.workerSlotLimit(workerID, worker.Slots),
+			RunningTasks: running,
+			Progress:     progress,
 		}
 
 		workers = append(workers, workerDashboard)
@@ -1975,6 +2883,15 @@ func (m *Master) GetWorkers() []WorkerInfoDashboard {
 	return workers
 }
 
+// dashboardTaskName restituisce il nome di un task mostrato dal dashboard
+func dashboardTaskName(jobID string, taskType TaskType, taskID int) string {
+	kind := "map"
+	if taskType == ReduceTask {
+		kind = "reduce"
+	}
+	return fmt.Sprintf("%s/%s-task-%d", jobID, kind, taskID)
+}
+
 // GetMasterInfoForDashboard restituisce informazioni sui master per il dashboard
 func (m *Master) GetMasterInfoForDashboard() []MasterInfo {
 	m.mu.RLock()
@@ -2054,17 +2971,27 @@ func (m *Master) GetTaskMetrics() map[string]interface{} {
 	mapTaskCounts := make(map[TaskState]int)
 	reduceTaskCounts := make(map[TaskState]int)
 
-	for _, task := range m.mapTasks {
-		mapTaskCounts[task.State]++
-	}
-
-	for _, task := range m.reduceTasks {
-		reduceTaskCounts[task.State]++
+	// Aggrega i task di tutti i job in coda
+	totalMapTasks := 0
+	totalReduceTasks := 0
+	for _, job := range m.orderedJobs() {
+		for _, task := range job.MapTasks {
+			mapTaskCounts[task.State]++
+		}
+		for _, task := range job.ReduceTasks {
+			reduceTaskCounts[task.State]++
+		}
+		totalMapTasks += len(job.MapTasks)
+		totalReduceTasks += len(job.ReduceTasks)
 	}
 
 	// Calcola statistiche
-	totalMapTasks := len(m.mapTasks)
-	totalReduceTasks := len(m.reduceTasks)
+	phase := fmt.Sprint(DonePhase)
+	activeJobID := ""
+	if job := m.activeJob(); job != nil {
+		phase = fmt.Sprint(job.Phase)
+		activeJobID = job.ID
+	}
 	completedMapTasks := mapTaskCounts[Completed]
 	completedReduceTasks := reduceTaskCounts[Completed]
 
@@ -2084,7 +3011,9 @@ func (m *Master) GetTaskMetrics() map[string]interface{} {
 			"failed":      reduceTaskCounts[Failed],
 		},
 		"overall": map[string]interface{}{
-			"phase":          fmt.Sprint(m.phase),
+			"phase":          phase,
+			"active_job":     activeJobID,
+			"jobs":           len(m.jobQueue),
 			"is_done":        m.isDone,
 			"total_workers":  len(m.workers),
 			"active_workers": m.getActiveWorkerCount(),
@@ -2140,15 +3069,16 @@ func (m *Master) GetSystemHealth() map[string]interface{} {
 	failedMapTasks := 0
 	failedReduceTasks := 0
 
-	for _, task := range m.mapTasks {
-		if task.State == Failed {
-			failedMapTasks++
+	for _, job := range m.orderedJobs() {
+		for _, task := range job.MapTasks {
+			if task.State == Failed {
+				failedMapTasks++
+			}
 		}
-	}
-
-	for _, task := range m.reduceTasks {
-		if task.State == Failed {
-			failedReduceTasks++
+		for _, task := range job.ReduceTasks {
+			if task.State == Failed {
+				failedReduceTasks++
+			}
 		}
 	}
 
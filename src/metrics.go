@@ -100,6 +100,49 @@ var (
 		[]string{"operation", "status"},
 	)
 
+	// Metriche per il combiner
+	combineRecords = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mapreduce_combine_records_total",
+			Help: "Records emitted by map tasks before and after the combiner",
+		},
+		[]string{"stage"},
+	)
+
+	// Metriche per l'esecuzione speculativa
+	speculativeLaunches = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mapreduce_speculative_launches_total",
+			Help: "Backup attempts launched for straggler tasks",
+		},
+		[]string{"type"},
+	)
+
+	speculativeWins = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mapreduce_speculative_wins_total",
+			Help: "Speculated tasks committed by the backup attempt",
+		},
+		[]string{"type"},
+	)
+
+	// Metriche per la sincronizzazione delle directory su S3
+	s3SyncFiles = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mapreduce_s3_sync_files_total",
+			Help: "Files handled by S3 directory sync (uploaded, skipped, deleted, failed)",
+		},
+		[]string{"result"},
+	)
+
+	s3SyncBytes = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mapreduce_s3_sync_bytes_total",
+			Help: "Bytes uploaded by S3 directory sync and bytes skipped because unchanged",
+		},
+		[]string{"result"},
+	)
+
 	fileSize = promauto.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Name:    "mapreduce_file_size_bytes",
@@ -215,6 +258,36 @@ func (mc *MetricCollector) RecordFileOperation(operation string, success bool, s
 	}
 }
 
+// RecordCombine registra i record di un map task prima e dopo il combiner
+// before e after devono essere non negativi
+func (mc *MetricCollector) RecordCombine(before, after int64) {
+	if before < 0 || after < 0 {
+		return // Ignora valori non validi
+	}
+	combineRecords.WithLabelValues("before").Add(float64(before))
+	combineRecords.WithLabelValues("after").Add(float64(after))
+}
+
+// RecordSpeculativeLaunch registra l'avvio di un tentativo di backup per un task lento
+func (mc *MetricCollector) RecordSpeculativeLaunch(taskType string) {
+	speculativeLaunches.WithLabelValues(taskType).Inc()
+}
+
+// RecordSpeculativeWin registra un task speculato completato per primo dal tentativo di backup
+func (mc *MetricCollector) RecordSpeculativeWin(taskType string) {
+	speculativeWins.WithLabelValues(taskType).Inc()
+}
+
+// RecordS3Sync registra il risultato di una sincronizzazione di directory su S3
+func (mc *MetricCollector) RecordS3Sync(stats S3SyncStats) {
+	s3SyncFiles.WithLabelValues("uploaded").Add(float64(stats.Uploaded))
+	s3SyncFiles.WithLabelValues("skipped").Add(float64(stats.Skipped))
+	s3SyncFiles.WithLabelValues("deleted").Add(float64(stats.Deleted))
+	s3SyncFiles.WithLabelValues("failed").Add(float64(stats.Failed))
+	s3SyncBytes.WithLabelValues("uploaded").Add(float64(stats.BytesUploaded))
+	s3SyncBytes.WithLabelValues("skipped").Add(float64(stats.BytesSkipped))
+}
+
 // SetJobStartTime imposta il tempo di inizio del job per il calcolo della durata
 // Deve essere chiamato prima di RecordJobCompletion
 func (mc *MetricCollector) SetJobStartTime() {
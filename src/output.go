@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	// OutputFormatText scrive righe "chiave valore" separate da uno spazio (formato storico)
+	OutputFormatText = "text"
+	// OutputFormatTSV scrive righe chiave<TAB>valore con tabulazioni e a capo nei campi in escape
+	OutputFormatTSV = "tsv"
+	// OutputFormatJSONL scrive un oggetto {"key":...,"value":...} per riga
+	OutputFormatJSONL = "jsonl"
+	// OutputFormatCSV scrive righe CSV chiave,valore; l'intestazione è solo nell'output unificato
+	OutputFormatCSV = "csv"
+)
+
+// OutputWriter scrive i risultati di un reduce task nel formato di output del job
+type OutputWriter interface {
+	Write(key, value string) error
+	Flush() error
+}
+
+// OutputFormat descrive un formato di output registrato. I file dei singoli reduce non
+// hanno intestazione, così possono essere concatenati: Header viene scritto una sola
+// volta in testa all'output unificato. MultiLine indica che un record può occupare più
+// righe, quindi il numero di righe di un output non corrisponde ai record scritti.
+type OutputFormat struct {
+	Name        string
+	Description string
+	Extension   string // estensione del file finale unificato
+	Header      string
+	MultiLine   bool
+	NewWriter   func(w io.Writer) OutputWriter
+}
+
+// outputFormatRegistry contiene i formati di output disponibili, indicizzati per nome
+var outputFormatRegistry = make(map[string]*OutputFormat)
+
+// RegisterOutputFormat registra un formato di output; un nome già presente viene sostituito
+func RegisterOutputFormat(f *OutputFormat) {
+	outputFormatRegistry[f.Name] = f
+}
+
+// LookupOutputFormat restituisce il formato di output con il nome indicato.
+// Un nome vuoto indica OutputFormatText.
+func LookupOutputFormat(name string) (*OutputFormat, error) {
+	if name == "" {
+		name = OutputFormatText
+	}
+	f, ok := outputFormatRegistry[name]
+	if !ok {
+		return nil, fmt.Errorf("formato di output %q non registrato (disponibili: %s)", name, strings.Join(OutputFormatNames(), ", "))
+	}
+	return f, nil
+}
+
+// OutputFormatNames restituisce i nomi dei formati di output registrati in ordine alfabetico
+func OutputFormatNames() []string {
+	names := make([]string, 0, len(outputFormatRegistry))
+	for name := range outputFormatRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	RegisterOutputFormat(&OutputFormat{
+		Name:        OutputFormatText,
+		Description: "righe \"chiave valore\" separate da spazio (solo la chiave se il valore è vuoto)",
+		Extension:   ".txt",
+		NewWriter:   func(w io.Writer) OutputWriter { return &textWriter{w: bufio.NewWriter(w)} },
+	})
+	RegisterOutputFormat(&OutputFormat{
+		Name:        OutputFormatTSV,
+		Description: "righe chiave<TAB>valore; \\, TAB e a capo nei campi scritti come \\\\, \\t, \\n, \\r",
+		Extension:   ".tsv",
+		NewWriter:   func(w io.Writer) OutputWriter { return &tsvWriter{w: bufio.NewWriter(w)} },
+	})
+	RegisterOutputFormat(&OutputFormat{
+		Name:        OutputFormatJSONL,
+		Description: "un oggetto JSON {\"key\",\"value\"} per riga",
+		Extension:   ".jsonl",
+		NewWriter:   func(w io.Writer) OutputWriter { return &jsonlWriter{w: bufio.NewWriter(w)} },
+	})
+	RegisterOutputFormat(&OutputFormat{
+		Name:        OutputFormatCSV,
+		Description: "righe CSV key,value con intestazione nell'output unificato",
+		Extension:   ".csv",
+		Header:      "key,value\n",
+		MultiLine:   true,
+		NewWriter:   func(w io.Writer) OutputWriter { return csvWriter{csv.NewWriter(w)} },
+	})
+}
+
+type textWriter struct {
+	w *bufio.Writer
+}
+
+func (t *textWriter) Write(key, value string) error {
+	t.w.WriteString(key)
+	if value != "" {
+		t.w.WriteByte(' ')
+		t.w.WriteString(value)
+	}
+	return t.w.WriteByte('\n')
+}
+
+func (t *textWriter) Flush() error { return t.w.Flush() }
+
+// tsvEscaper rende i campi sicuri per una riga TSV
+var tsvEscaper = strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\n", "\\n", "\r", "\\r")
+
+type tsvWriter struct {
+	w *bufio.Writer
+}
+
+func (t *tsvWriter) Write(key, value string) error {
+	tsvEscaper.WriteString(t.w, key)
+	t.w.WriteByte('\t')
+	tsvEscaper.WriteString(t.w, value)
+	return t.w.WriteByte('\n')
+}
+
+func (t *tsvWriter) Flush() error { return t.w.Flush() }
+
+type jsonlWriter struct {
+	w *bufio.Writer
+}
+
+func (j *jsonlWriter) Write(key, value string) error {
+	data, err := json.Marshal(struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	}{key, value})
+	if err != nil {
+		return err
+	}
+	j.w.Write(data)
+	return j.w.WriteByte('\n')
+}
+
+func (j *jsonlWriter) Flush() error { return j.w.Flush() }
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (c csvWriter) Write(key, value string) error {
+	return c.w.Write([]string{key, value})
+}
+
+func (c csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
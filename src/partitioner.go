@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	// PartitionerHash distribuisce le chiavi tra i reduce con ihash (default)
+	PartitionerHash = "hash"
+	// PartitionerRange assegna a ogni reduce un intervallo di chiavi, delimitato da
+	// confini calcolati campionando l'input: concatenando mr-out-0..N l'output è ordinato
+	PartitionerRange = "range"
+)
+
+// Partitioner sceglie il reduce task a cui inviare una chiave emessa dal map
+type Partitioner interface {
+	Partition(key string, nReduce int) int
+}
+
+// PartitionerType descrive un partitioner registrato. New costruisce il partitioner
+// a partire dai confini replicati con il job; Sampled indica che i confini vanno
+// calcolati dal leader con un campionamento dell'input alla sottomissione del job.
+type PartitionerType struct {
+	Name        string
+	Description string
+	Sampled     bool
+	New         func(bounds []string) (Partitioner, error)
+}
+
+// partitionerRegistry contiene i partitioner disponibili, indicizzati per nome
+var partitionerRegistry = make(map[string]*PartitionerType)
+
+// RegisterPartitioner registra un partitioner; un nome già presente viene sostituito
+func RegisterPartitioner(p *PartitionerType) {
+	partitionerRegistry[p.Name] = p
+}
+
+// LookupPartitioner restituisce il partitioner registrato con il nome indicato.
+// Un nome vuoto indica PartitionerHash.
+func LookupPartitioner(name string) (*PartitionerType, error) {
+	if name == "" {
+		name = PartitionerHash
+	}
+	p, ok := partitionerRegistry[name]
+	if !ok {
+		return nil, fmt.Errorf("partitioner %q non registrato (disponibili: %s)", name, strings.Join(PartitionerNames(), ", "))
+	}
+	return p, nil
+}
+
+// PartitionerNames restituisce i nomi dei partitioner registrati in ordine alfabetico
+func PartitionerNames() []string {
+	names := make([]string, 0, len(partitionerRegistry))
+	for name := range partitionerRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	RegisterPartitioner(&PartitionerType{
+		Name:        PartitionerHash,
+		Description: "hash della chiave modulo il numero di reduce",
+		New:         func([]string) (Partitioner, error) { return hashPartitioner{}, nil },
+	})
+	RegisterPartitioner(&PartitionerType{
+		Name:        PartitionerRange,
+		Description: "intervalli di chiavi ordinati, confini campionati dall'input",
+		Sampled:     true,
+		New:         newRangePartitioner,
+	})
+}
+
+// newTaskPartitioner costruisce il partitioner di un map task
+func newTaskPartitioner(task *Task) (Partitioner, error) {
+	p, err := LookupPartitioner(task.Partitioner)
+	if err != nil {
+		return nil, err
+	}
+	return p.New(task.PartitionBounds)
+}
+
+// hashPartitioner è il partitioner storico: ihash(chiave) % nReduce
+type hashPartitioner struct{}
+
+func (hashPartitioner) Partition(key string, nReduce int) int {
+	return ihash(key) % nReduce
+}
+
+// rangePartitioner assegna al reduce i le chiavi in [bounds[i-1], bounds[i]):
+// le chiavi minori del primo confine vanno al reduce 0, quelle non minori dell'ultimo
+// all'ultimo reduce. Con confini ripetuti i reduce intermedi restano vuoti.
+type rangePartitioner struct {
+	bounds []string
+}
+
+func newRangePartitioner(bounds []string) (Partitioner, error) {
+	if !sort.StringsAreSorted(bounds) {
+		return nil, fmt.Errorf("confini del range partitioner non ordinati")
+	}
+	return rangePartitioner{bounds: bounds}, nil
+}
+
+func (p rangePartitioner) Partition(key string, nReduce int) int {
+	id := sort.Search(len(p.bounds), func(i int) bool { return key < p.bounds[i] })
+	if id >= nReduce {
+		id = nReduce - 1
+	}
+	return id
+}
+
+// rangeBounds ordina le chiavi campionate e ne restituisce i nReduce-1 quantili,
+// che dividono il campione in nReduce intervalli di uguale numerosità
+func rangeBounds(keys []string, nReduce int) []string {
+	if nReduce <= 1 || len(keys) == 0 {
+		return nil
+	}
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+	bounds := make([]string, nReduce-1)
+	for i := 1; i < nReduce; i++ {
+		bounds[i-1] = sorted[i*len(sorted)/nReduce]
+	}
+	return bounds
+}
+
+// samplePartitionBounds esegue il pre-passaggio di campionamento del range partitioner:
+// legge fino a PartitionSampleChunks porzioni dell'input distribuite tra gli split con il
+// formato del job, ne passa i record alla funzione di map e calcola i confini dalle chiavi emesse
+func samplePartitionBounds(splits []InputSplit, format InputFormat, mapr RecordMapFunc, nReduce int) ([]string, error) {
+	if nReduce <= 1 || len(splits) == 0 {
+		return nil, nil
+	}
+
+	// Con più split che porzioni si campiona uno split ogni step, con una porzione ciascuno
+	step, perSplit := 1, PartitionSampleChunks/len(splits)
+	if perSplit < 1 {
+		perSplit = 1
+		step = (len(splits) + PartitionSampleChunks - 1) / PartitionSampleChunks
+	}
+
+	var keys []string
+	for i := 0; i < len(splits); i += step {
+		chunks, err := sampleSplitRanges(splits[i], perSplit, PartitionSampleChunkSize)
+		if err != nil {
+			return nil, fmt.Errorf("campionamento di %s: %v", splits[i], err)
+		}
+		for _, chunk := range chunks {
+			chunkKeys, err := sampleChunkKeys(chunk, format, mapr, PartitionSampleChunkSize)
+			if err != nil {
+				return nil, fmt.Errorf("campionamento di %s: %v", chunk, err)
+			}
+			keys = append(keys, chunkKeys...)
+		}
+	}
+
+	bounds := rangeBounds(keys, nReduce)
+	if bounds == nil {
+		return nil, fmt.Errorf("nessuna chiave campionata da %d split", len(splits))
+	}
+	LogInfo("[Master] Campionamento range partitioner: %d chiavi da %d split, %d confini", len(keys), len(splits), len(bounds))
+	return bounds, nil
+}
+
+// sampleChunkKeys legge i record di una porzione, fino a circa limit byte, e restituisce
+// le chiavi emesse dalla map; i record malformati vengono ignorati
+func sampleChunkKeys(chunk InputSplit, format InputFormat, mapr RecordMapFunc, limit int64) ([]string, error) {
+	reader, err := format.Open(chunk)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var keys []string
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			return keys, nil
+		}
+		var malformed *MalformedRecordError
+		if errors.As(err, &malformed) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, kv := range mapr(rec) {
+			keys = append(keys, kv.Key)
+		}
+		// Per i file compressi la porzione è l'intero file: si legge solo l'inizio
+		if rec.Offset-chunk.Offset >= limit {
+			return keys, nil
+		}
+	}
+}
+
+// sampleSplitRanges restituisce n porzioni di al più chunkSize byte distribuite
+// uniformemente nello split. Ogni porzione inizia e finisce a un confine di riga; una
+// porzione che non contiene una riga completa viene scartata. Un file compresso non
+// può essere letto a partire da un offset e viene restituito intero.
+func sampleSplitRanges(split InputSplit, n int, chunkSize int64) ([]InputSplit, error) {
+	if compressionExtension(split.File) != "" {
+		return []InputSplit{split}, nil
+	}
+	st := storageFor(split.File)
+	f, err := st.OpenReaderAt(split.File)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	start, end := split.Offset, split.Offset+split.Length
+	if split.Length == 0 {
+		if end, err = st.Stat(split.File); err != nil {
+			return nil, err
+		}
+	}
+
+	var chunks []InputSplit
+	for i := 0; i < n; i++ {
+		pos := start + (end-start)*int64(i)/int64(n)
+		segEnd := start + (end-start)*int64(i+1)/int64(n)
+		if pos > start {
+			if pos, err = nextLineStart(f, pos); err != nil {
+				return nil, err
+			}
+		}
+		if pos >= segEnd {
+			continue
+		}
+		limit := segEnd - pos
+		if limit > chunkSize {
+			limit = chunkSize
+		}
+		buf := make([]byte, limit)
+		read, err := f.ReadAt(buf, pos)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		buf = buf[:read]
+		// Scarta la riga troncata in coda, salvo a fine split
+		if pos+int64(read) < end {
+			buf = buf[:bytes.LastIndexByte(buf, '\n')+1]
+		}
+		if len(buf) == 0 {
+			continue
+		}
+		chunks = append(chunks, InputSplit{File: split.File, Offset: pos, Length: int64(len(buf))})
+	}
+	return chunks, nil
+}
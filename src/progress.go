@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// Avanzamento dei task: i worker lo inviano con l'heartbeat e con l'RPC ReportProgress.
+// Il leader conserva l'ultimo report di ogni task in esecuzione negli slot di ciascun worker
+// e, quando il task avanza, aggiorna
+// LastProgress del task: il monitor dei timeout resetta solo i task fermi da TaskTimeout.
+
+// lastActivity restituisce l'ultimo istante in cui il task ha mostrato attività
+func (t TaskInfo) lastActivity() time.Time {
+	if t.LastProgress.After(t.StartTime) {
+		return t.LastProgress
+	}
+	return t.StartTime
+}
+
+// progressAdvanced indica se il nuovo report mostra avanzamento rispetto al precedente
+func progressAdvanced(prev *TaskProgress, cur *TaskProgress) bool {
+	if prev == nil || prev.AttemptID != cur.AttemptID || prev.JobID != cur.JobID ||
+		prev.TaskID != cur.TaskID || prev.Type != cur.Type {
+		return true
+	}
+	return cur.Bytes > prev.Bytes || cur.Records > prev.Records || cur.Percent > prev.Percent
+}
+
+// recordProgress registra il report di avanzamento di un task del worker. Chiamato con m.mu acquisito.
+func (m *Master) recordProgress(workerID string, p *TaskProgress, now time.Time) {
+	job := m.jobs[p.JobID]
+	if job == nil {
+		return
+	}
+	tasks := job.MapTasks
+	if p.Type == ReduceTask {
+		tasks = job.ReduceTasks
+	}
+	if p.TaskID < 0 || p.TaskID >= len(tasks) {
+		return
+	}
+
+	report := *p
+	report.WorkerID = workerID
+	report.UpdatedAt = now
+	key := TaskKey{JobID: p.JobID, ID: p.TaskID, Type: p.Type}
+	if tasks[p.TaskID].State == InProgress && progressAdvanced(m.workerProgress[workerID][key], &report) {
+		tasks[p.TaskID].LastProgress = now
+	}
+	if m.workerProgress == nil {
+		m.workerProgress = make(map[string]map[TaskKey]*TaskProgress)
+	}
+	if m.workerProgress[workerID] == nil {
+		m.workerProgress[workerID] = make(map[TaskKey]*TaskProgress)
+	}
+	m.workerProgress[workerID][key] = &report
+}
+
+// recordHeartbeatProgress sostituisce l'avanzamento del worker con i task riportati
+// nell'heartbeat: i task non più riportati sono terminati. Chiamato con m.mu acquisito.
+func (m *Master) recordHeartbeatProgress(workerID string, reports []TaskProgress, now time.Time) {
+	running := make(map[TaskKey]bool, len(reports))
+	for i := range reports {
+		running[TaskKey{JobID: reports[i].JobID, ID: reports[i].TaskID, Type: reports[i].Type}] = true
+		m.recordProgress(workerID, &reports[i], now)
+	}
+	for key := range m.workerProgress[workerID] {
+		if !running[key] {
+			m.clearWorkerProgress(workerID, key)
+		}
+	}
+}
+
+// clearWorkerProgress rimuove l'avanzamento del task indicato dal worker.
+// Chiamato con m.mu acquisito.
+func (m *Master) clearWorkerProgress(workerID string, key TaskKey) {
+	if progress := m.workerProgress[workerID]; progress != nil {
+		delete(progress, key)
+		if len(progress) == 0 {
+			delete(m.workerProgress, workerID)
+		}
+	}
+}
+
+// workerTaskProgress restituisce l'avanzamento dei task in esecuzione sul worker,
+// ordinati per job, tipo e ID. Chiamato con m.mu acquisito.
+func (m *Master) workerTaskProgress(workerID string) []TaskProgress {
+	var running []TaskProgress
+	for _, p := range m.workerProgress[workerID] {
+		running = append(running, *p)
+	}
+	sortTaskProgress(running)
+	return running
+}
+
+// jobProgress restituisce l'avanzamento dei task in esecuzione del job, ordinati per tipo e ID.
+// Chiamato con m.mu acquisito.
+func (m *Master) jobProgress(jobID string) []TaskProgress {
+	var running []TaskProgress
+	for _, progress := range m.workerProgress {
+		for _, p := range progress {
+			if p.JobID == jobID {
+				running = append(running, *p)
+			}
+		}
+	}
+	sortTaskProgress(running)
+	return running
+}
+
+// sortTaskProgress ordina i report di avanzamento per job, tipo, ID del task e worker
+func sortTaskProgress(running []TaskProgress) {
+	sort.Slice(running, func(i, j int) bool {
+		if running[i].JobID != running[j].JobID {
+			return running[i].JobID < running[j].JobID
+		}
+		if running[i].Type != running[j].Type {
+			return running[i].Type < running[j].Type
+		}
+		if running[i].TaskID != running[j].TaskID {
+			return running[i].TaskID < running[j].TaskID
+		}
+		return running[i].WorkerID < running[j].WorkerID
+	})
+}
+
+// ReportProgress è il metodo RPC con cui un worker segnala l'avanzamento del task in corso
+func (m *Master) ReportProgress(args *ReportProgressArgs, reply *Reply) error {
+	if m.raft.State() != raft.Leader {
+		return fmt.Errorf("non sono il leader")
+	}
+	workerID := strings.TrimSpace(args.WorkerID)
+	if workerID == "" {
+		return fmt.Errorf("WorkerID mancante")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	m.workerLastSeen[workerID] = now
+	if worker, exists := m.workers[workerID]; exists {
+		worker.LastSeen = now
+	}
+	m.recordProgress(workerID, &args.Progress, now)
+	LogDebug("[Master] Progresso worker %s: job %s %v %d al %.1f%% (%d record, %d byte)", workerID,
+		args.Progress.JobID, args.Progress.Type, args.Progress.TaskID, args.Progress.Percent, args.Progress.Records, args.Progress.Bytes)
+	return nil
+}
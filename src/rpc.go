@@ -1,7 +1,9 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"net/rpc"
 	"os"
 	"path/filepath"
 	"strings"
@@ -63,20 +65,137 @@ func getMasterRpcAddresses() []string {
 
 type Task struct {
 	Type       TaskType
+	JobID      string `json:"job_id,omitempty"`
 	TaskID     int
 	Input      string
+	Offset     int64 `json:"offset,omitempty"` // inizio dello split nel file di input
+	Length     int64 `json:"length,omitempty"` // lunghezza dello split (0 = intero file)
 	NReduce    int
 	NMap       int
-	Checkpoint string `json:"checkpoint,omitempty"`
+	Attempt    int               `json:"attempt,omitempty"`    // tentativo corrente del task (da 1)
+	AttemptID  string            `json:"attempt_id,omitempty"` // ID univoco dell'assegnazione, suffisso dei file scritti
+	Checkpoint string            `json:"checkpoint,omitempty"`
+	App        string            `json:"app,omitempty"`         // applicazione del job (vuoto = DefaultAppName)
+	AppParams  map[string]string `json:"app_params,omitempty"`  // parametri dell'applicazione
+	MapOutputs []MapOutput       `json:"map_outputs,omitempty"` // per i reduce: worker che servono gli output dei map
+
+	CacheFiles []CacheFile `json:"cache_files,omitempty"` // file accessori del job da scaricare in cache
+
+	// Per i map: formato di input con cui leggere i record dello split (vuoto = InputFormatLines)
+	InputFormat string `json:"input_format,omitempty"`
+	// Per i reduce: formato in cui scrivere l'output (vuoto = OutputFormatText)
+	OutputFormat string `json:"output_format,omitempty"`
+	// Per i reduce: directory o prefisso URI dell'output (vuoto = directory di output locale)
+	OutputDir string `json:"output_dir,omitempty"`
+
+	// Per i map: partitioner delle chiavi intermedie e relativi confini
+	Partitioner     string   `json:"partitioner,omitempty"`
+	PartitionBounds []string `json:"partition_bounds,omitempty"`
+}
+
+// CacheFile è un file accessorio pubblicato con il job e scaricato da ogni worker.
+// Checksum è noto solo per i file locali, validati dal leader alla sottomissione.
+type CacheFile struct {
+	Name     string        `json:"name"`   // nome con cui le funzioni dell'applicazione trovano il file
+	Source   string        `json:"source"` // percorso sul master o s3://bucket/key
+	Checksum *FileChecksum `json:"checksum,omitempty"`
+}
+
+type CacheFileArgs struct {
+	JobID string `json:"job_id"`
+	Name  string `json:"name"`
 }
+
+type CacheFileReply struct {
+	Data []byte `json:"data"`
+}
+
+// MapOutput indica il worker che serve le partizioni intermedie di un map task completato
+type MapOutput struct {
+	TaskID    int           `json:"task_id"`
+	Addr      string        `json:"addr,omitempty"`       // indirizzo shuffle del worker (vuoto = filesystem condiviso)
+	AttemptID string        `json:"attempt_id,omitempty"` // tentativo promosso, suffisso dei file serviti
+	Checksum  *FileChecksum `json:"checksum,omitempty"`   // checksum della partizione del reduce
+}
+
 type RequestTaskArgs struct {
 	WorkerID string `json:"worker_id"`
+	Slots    int    `json:"slots,omitempty"` // slot di esecuzione del worker (0 = 1)
 }
 type TaskCompletedArgs struct {
-	TaskID   int      `json:"task_id"`
-	Type     TaskType `json:"type"`
-	WorkerID string   `json:"worker_id"`
+	JobID       string         `json:"job_id,omitempty"`
+	TaskID      int            `json:"task_id"`
+	Type        TaskType       `json:"type"`
+	WorkerID    string         `json:"worker_id"`
+	AttemptID   string         `json:"attempt_id,omitempty"`   // vuoto = file già scritti con i nomi definitivi
+	ShuffleAddr string         `json:"shuffle_addr,omitempty"` // per i map: worker che serve gli intermedi
+	Counters    TaskCounters   `json:"counters"`
+	Files       []FileChecksum `json:"files,omitempty"` // checksum dei file prodotti dal tentativo
+}
+
+// MapOutputLostArgs segnala al master che un reduce non ha potuto scaricare gli output
+// di alcuni map task: i map vengono rieseguiti e il reduce torna in coda
+type MapOutputLostArgs struct {
+	JobID     string      `json:"job_id"`
+	TaskID    int         `json:"task_id"` // reduce task che ha rilevato la perdita
+	WorkerID  string      `json:"worker_id"`
+	AttemptID string      `json:"attempt_id,omitempty"`
+	Lost      []MapOutput `json:"lost"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// TaskFailedArgs segnala al master che l'esecuzione di un task è fallita
+type TaskFailedArgs struct {
+	JobID     string   `json:"job_id,omitempty"`
+	TaskID    int      `json:"task_id"`
+	Type      TaskType `json:"type"`
+	WorkerID  string   `json:"worker_id"`
+	Attempt   int      `json:"attempt"`
+	AttemptID string   `json:"attempt_id,omitempty"`
+	Error     string   `json:"error"`
+}
+
+// TaskCounters raccoglie i contatori prodotti dall'esecuzione di un task
+type TaskCounters struct {
+	InputRecords         int64 `json:"input_records,omitempty"`          // record letti dallo split e passati alla map
+	MalformedRecords     int64 `json:"malformed_records,omitempty"`      // record scartati perché non interpretabili dal formato
+	RecordsBeforeCombine int64 `json:"records_before_combine,omitempty"` // coppie emesse da map
+	RecordsAfterCombine  int64 `json:"records_after_combine,omitempty"`  // coppie scritte negli intermedi
+
+	User map[string]int64 `json:"user,omitempty"` // contatori incrementati dalle funzioni dell'applicazione
+}
+
+// Add somma i contatori di un task a quelli correnti
+func (c *TaskCounters) Add(other TaskCounters) {
+	c.InputRecords += other.InputRecords
+	c.MalformedRecords += other.MalformedRecords
+	c.RecordsBeforeCombine += other.RecordsBeforeCombine
+	c.RecordsAfterCombine += other.RecordsAfterCombine
+	for name, value := range other.User {
+		if c.User == nil {
+			c.User = make(map[string]int64)
+		}
+		c.User[name] += value
+	}
+}
+
+// Sub sottrae i contatori di un task il cui output è andato perso
+func (c *TaskCounters) Sub(other TaskCounters) {
+	c.InputRecords -= other.InputRecords
+	c.MalformedRecords -= other.MalformedRecords
+	c.RecordsBeforeCombine -= other.RecordsBeforeCombine
+	c.RecordsAfterCombine -= other.RecordsAfterCombine
+	for name, value := range other.User {
+		if c.User == nil {
+			c.User = make(map[string]int64)
+		}
+		c.User[name] -= value
+		if c.User[name] == 0 {
+			delete(c.User, name)
+		}
+	}
 }
+
 type Reply struct{}
 
 // Strutture per ottenere informazioni sui master
@@ -100,10 +219,12 @@ type WorkerInfoReply struct {
 }
 
 type WorkerInfo struct {
-	ID        string    `json:"id"`
-	Status    string    `json:"status"`
-	LastSeen  time.Time `json:"last_seen"`
-	TasksDone int       `json:"tasks_done"`
+	ID          string    `json:"id"`
+	Status      string    `json:"status"`
+	LastSeen    time.Time `json:"last_seen"`
+	TasksDone   int       `json:"tasks_done"`
+	Slots       int       `json:"slots"`
+	ShuffleAddr string    `json:"shuffle_addr,omitempty"`
 }
 
 // Strutture per il trasferimento della leadership
@@ -115,12 +236,47 @@ type LeadershipTransferReply struct {
 
 // Strutture per il heartbeat dei worker
 type WorkerHeartbeatArgs struct {
-	WorkerID string `json:"worker_id"`
+	WorkerID    string         `json:"worker_id"`
+	Slots       int            `json:"slots,omitempty"`        // slot di esecuzione del worker (0 = 1)
+	ShuffleAddr string         `json:"shuffle_addr,omitempty"` // indirizzo del server shuffle del worker
+	Progress    []TaskProgress `json:"progress,omitempty"`     // task in esecuzione negli slot del worker
+}
+
+// TaskProgress descrive l'avanzamento del task in esecuzione su un worker
+type TaskProgress struct {
+	WorkerID  string    `json:"worker_id,omitempty"` // impostato dal master
+	JobID     string    `json:"job_id,omitempty"`
+	TaskID    int       `json:"task_id"`
+	Type      TaskType  `json:"type"`
+	Attempt   int       `json:"attempt,omitempty"`
+	AttemptID string    `json:"attempt_id,omitempty"`
+	Bytes     int64     `json:"bytes"`   // byte di input elaborati
+	Records   int64     `json:"records"` // record (map) o chiavi (reduce) elaborati
+	Percent   float64   `json:"percent"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ReportProgressArgs è l'argomento dell'RPC con cui il worker segnala l'avanzamento del task
+type ReportProgressArgs struct {
+	WorkerID string       `json:"worker_id"`
+	Progress TaskProgress `json:"progress"`
 }
 
 type WorkerHeartbeatReply struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
+	Success     bool     `json:"success"`
+	Message     string   `json:"message"`
+	AbandonJobs []string `json:"abandon_jobs,omitempty"` // job in pausa/cancellati: abbandonare i task in corso
+	CleanupJobs []string `json:"cleanup_jobs,omitempty"` // job terminati: rimuovere gli intermedi serviti
+}
+
+// Strutture per pausa, ripresa e cancellazione di un job
+type JobControlArgs struct {
+	JobID string `json:"job_id"`
+}
+
+type JobControlReply struct {
+	JobID  string `json:"job_id"`
+	Status string `json:"status"`
 }
 
 // Strutture per ottenere il conteggio dei worker attivi
@@ -132,6 +288,7 @@ type WorkerCountReply struct {
 
 // ResetTaskArgs consente di richiedere il reset di un task specifico
 type ResetTaskArgs struct {
+	JobID  string   `json:"job_id,omitempty"` // vuoto = job attivo
 	TaskID int      `json:"task_id"`
 	Type   TaskType `json:"type"` // MapTask o ReduceTask
 	Reason string   `json:"reason,omitempty"`
@@ -147,11 +304,21 @@ type GetWorkerTasksReply struct {
 
 // WorkerTask rappresenta un task con ID e tipo
 type WorkerTask struct {
+	JobID  string   `json:"job_id,omitempty"`
 	TaskID int      `json:"task_id"`
 	Type   TaskType `json:"type"`
 }
 
-func getIntermediateFileName(mapTaskID, reduceTaskID int) string {
+// jobFilePrefix restituisce il prefisso usato nei nomi dei file di un job
+// (vuoto per i task senza JobID, che mantengono i nomi legacy)
+func jobFilePrefix(jobID string) string {
+	if jobID == "" {
+		return ""
+	}
+	return jobID + "-"
+}
+
+func getIntermediateFileName(jobID string, mapTaskID, reduceTaskID int) string {
 	basePath := os.Getenv("TMP_PATH")
 	if basePath == "" {
 		if globalConfig != nil {
@@ -160,10 +327,16 @@ func getIntermediateFileName(mapTaskID, reduceTaskID int) string {
 			basePath = "." // Fallback
 		}
 	}
-	return filepath.Join(basePath, fmt.Sprintf("mr-intermediate-%d-%d", mapTaskID, reduceTaskID))
+	return filepath.Join(basePath, fmt.Sprintf("mr-intermediate-%s%d-%d", jobFilePrefix(jobID), mapTaskID, reduceTaskID))
+}
+
+// outputBaseName restituisce il nome del file di output del reduce, con il prefisso del job
+// così che i job in coda non sovrascrivano gli output dei precedenti
+func outputBaseName(jobID string, reduceTaskID int) string {
+	return fmt.Sprintf("mr-out-%s%d", jobFilePrefix(jobID), reduceTaskID)
 }
 
-func getOutputFileName(reduceTaskID int) string {
+func getOutputFileName(jobID string, reduceTaskID int) string {
 	basePath := os.Getenv("TMP_PATH")
 	if basePath == "" {
 		if globalConfig != nil {
@@ -172,5 +345,37 @@ func getOutputFileName(reduceTaskID int) string {
 			basePath = "." // Fallback
 		}
 	}
-	return filepath.Join(basePath, fmt.Sprintf("mr-out-%d", reduceTaskID))
+	return filepath.Join(basePath, outputBaseName(jobID, reduceTaskID))
+}
+
+// reduceOutputFileName restituisce il file di output del reduce nella directory del job,
+// che può essere un prefisso s3://; senza directory è getOutputFileName
+func reduceOutputFileName(outputDir, jobID string, reduceTaskID int) string {
+	if outputDir == "" {
+		return getOutputFileName(jobID, reduceTaskID)
+	}
+	return joinStoragePath(outputDir, outputBaseName(jobID, reduceTaskID))
+}
+
+// reduceCheckpointFileName restituisce il checkpoint del reduce accanto al suo output;
+// con output remoto resta sul disco locale, dove il reduce lo legge e lo aggiorna
+func reduceCheckpointFileName(outputDir, jobID string, reduceTaskID int) string {
+	out := reduceOutputFileName(outputDir, jobID, reduceTaskID)
+	if isStorageURI(out) {
+		out = getOutputFileName(jobID, reduceTaskID)
+	}
+	return out + ".checkpoint.json"
+}
+
+// rpcError ripristina gli errori sentinella del master, che net/rpc consegna al client
+// come semplice testo, così che i chiamanti possano distinguerli con errors.Is
+func rpcError(err error) error {
+	var serverErr rpc.ServerError
+	if !errors.As(err, &serverErr) {
+		return err
+	}
+	if msg := string(serverErr); strings.HasPrefix(msg, errJobNotFound.Error()) {
+		return fmt.Errorf("%w%s", errJobNotFound, strings.TrimPrefix(msg, errJobNotFound.Error()))
+	}
+	return err
 }
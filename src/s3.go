@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
@@ -20,6 +22,10 @@ type S3Client struct {
 	s3Client   *s3.S3
 	uploader   *s3manager.Uploader
 	downloader *s3manager.Downloader
+
+	syncWorkers int  // upload in parallele di SyncDirectory
+	syncDelete  bool // SyncDirectory rimuove gli oggetti dei file eliminati in locale
+	metrics     *MetricCollector
 }
 
 // S3Config configurazione per S3
@@ -28,6 +34,38 @@ type S3Config struct {
 	Region       string
 	Enabled      bool
 	SyncInterval time.Duration
+
+	// Endpoint di un server compatibile S3 (es. http://localhost:9000); vuoto = AWS
+	Endpoint string
+	// ForcePathStyle usa URL http://endpoint/bucket/key invece di http://bucket.endpoint/key
+	ForcePathStyle bool
+	// Credenziali statiche; vuote = catena standard AWS (variabili AWS_*, profilo, ruolo IAM)
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// DisableSSL usa HTTP verso l'endpoint invece di HTTPS
+	DisableSSL bool
+
+	// SyncWorkers limita gli upload in parallelo di SyncDirectory (0 = DefaultS3SyncWorkers);
+	// con SyncDelete vengono rimossi da S3 i file eliminati dalla directory locale
+	SyncWorkers int
+	SyncDelete  bool
+}
+
+// awsConfig restituisce la configurazione della sessione AWS
+func (c S3Config) awsConfig() *aws.Config {
+	config := &aws.Config{
+		Region:           aws.String(c.Region),
+		S3ForcePathStyle: aws.Bool(c.ForcePathStyle),
+		DisableSSL:       aws.Bool(c.DisableSSL),
+	}
+	if c.Endpoint != "" {
+		config.Endpoint = aws.String(c.Endpoint)
+	}
+	if c.AccessKeyID != "" {
+		config.Credentials = credentials.NewStaticCredentials(c.AccessKeyID, c.SecretAccessKey, c.SessionToken)
+	}
+	return config
 }
 
 // NewS3Client crea un nuovo client S3
@@ -44,10 +82,12 @@ func NewS3Client(config S3Config) (*S3Client, error) {
 		config.Region = "us-east-1"
 	}
 
+	if config.AccessKeyID != "" && config.SecretAccessKey == "" {
+		return nil, fmt.Errorf("secret key S3 mancante per l'access key %s", config.AccessKeyID)
+	}
+
 	// Crea sessione AWS
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(config.Region),
-	})
+	sess, err := session.NewSession(config.awsConfig())
 	if err != nil {
 		return nil, fmt.Errorf("errore creazione sessione AWS: %v", err)
 	}
@@ -56,17 +96,30 @@ func NewS3Client(config S3Config) (*S3Client, error) {
 	uploader := s3manager.NewUploader(sess)
 	downloader := s3manager.NewDownloader(sess)
 
+	if config.SyncWorkers <= 0 {
+		config.SyncWorkers = DefaultS3SyncWorkers
+	}
+
 	return &S3Client{
 		bucket:     config.Bucket,
 		region:     config.Region,
 		s3Client:   s3Client,
 		uploader:   uploader,
 		downloader: downloader,
+
+		syncWorkers: config.SyncWorkers,
+		syncDelete:  config.SyncDelete,
+		metrics:     NewMetricCollector(),
 	}, nil
 }
 
 // UploadFile carica un file su S3
 func (s *S3Client) UploadFile(localPath, s3Key string) error {
+	return s.uploadFile(localPath, s3Key, nil)
+}
+
+// uploadFile carica un file su S3 con i metadati indicati
+func (s *S3Client) uploadFile(localPath, s3Key string, metadata map[string]*string) error {
 	file, err := os.Open(localPath)
 	if err != nil {
 		return fmt.Errorf("errore apertura file %s: %v", localPath, err)
@@ -74,9 +127,10 @@ func (s *S3Client) UploadFile(localPath, s3Key string) error {
 	defer file.Close()
 
 	_, err = s.uploader.Upload(&s3manager.UploadInput{
-		Bucket: aws.String(s.bucket),
-		Key:    aws.String(s3Key),
-		Body:   file,
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(s3Key),
+		Body:     file,
+		Metadata: metadata,
 	})
 
 	if err != nil {
@@ -113,34 +167,11 @@ func (s *S3Client) DownloadFile(s3Key, localPath string) error {
 	return nil
 }
 
-// SyncDirectory sincronizza una directory locale con S3
+// SyncDirectory sincronizza una directory locale con S3, caricando solo i file modificati
+// (vedi SyncDirectoryStats)
 func (s *S3Client) SyncDirectory(localPath, s3Prefix string) error {
-	if _, err := os.Stat(localPath); os.IsNotExist(err) {
-		LogWarn("Directory %s non esiste, salto sincronizzazione", localPath)
-		return nil
-	}
-
-	return filepath.Walk(localPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		if info.IsDir() {
-			return nil
-		}
-
-		// Calcola il percorso relativo
-		relPath, err := filepath.Rel(localPath, path)
-		if err != nil {
-			return err
-		}
-
-		// Crea la chiave S3
-		s3Key := s3Prefix + strings.ReplaceAll(relPath, "\\", "/")
-
-		// Upload del file
-		return s.UploadFile(path, s3Key)
-	})
+	_, err := s.SyncDirectoryStats(localPath, s3Prefix)
+	return err
 }
 
 // BackupToS3 crea un backup completo su S3
@@ -194,6 +225,19 @@ func GetS3ConfigFromEnv() S3Config {
 		Bucket:  os.Getenv("S3_BUCKET_NAME"),
 		Region:  os.Getenv("AWS_REGION"),
 		Enabled: os.Getenv("S3_SYNC_ENABLED") == "true",
+
+		SyncDelete: os.Getenv("S3_SYNC_DELETE") == "true",
+
+		Endpoint:        os.Getenv("S3_ENDPOINT"),
+		ForcePathStyle:  os.Getenv("S3_FORCE_PATH_STYLE") == "true",
+		AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("S3_SESSION_TOKEN"),
+		DisableSSL:      os.Getenv("S3_DISABLE_SSL") == "true",
+	}
+
+	if workers, err := strconv.Atoi(os.Getenv("S3_SYNC_WORKERS")); err == nil {
+		config.SyncWorkers = workers
 	}
 
 	// Parse sync interval
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Sincronizzazione incrementale di una directory locale con un prefisso S3. Un file viene
+// caricato solo se l'oggetto remoto manca o ha dimensione o contenuto diversi. Il contenuto
+// si confronta con l'MD5: per gli upload in una sola parte è l'ETag, per quelli multipart
+// (ETag "<hash>-<parti>") è il metadato s3SyncMD5Metadata scritto al momento dell'upload.
+
+// s3SyncMD5Metadata è il metadato (x-amz-meta-md5) con l'MD5 esadecimale del file caricato
+const s3SyncMD5Metadata = "Md5"
+
+// S3SyncStats riepiloga una sincronizzazione di directory
+type S3SyncStats struct {
+	Uploaded      int
+	Skipped       int // file invariati, non ricaricati
+	Deleted       int // oggetti rimossi perché il file locale non esiste più
+	Failed        int
+	BytesUploaded int64
+	BytesSkipped  int64
+}
+
+// s3RemoteObject è un oggetto elencato sotto il prefisso sincronizzato
+type s3RemoteObject struct {
+	size int64
+	etag string
+}
+
+// SyncDirectoryStats sincronizza localPath con s3Prefix usando al più syncWorkers upload in
+// parallelo e, se abilitato, rimuove gli oggetti dei file eliminati in locale. In caso di
+// errori i restanti file vengono comunque sincronizzati; la rimozione avviene solo se
+// l'intera directory è stata letta.
+func (s *S3Client) SyncDirectoryStats(localPath, s3Prefix string) (S3SyncStats, error) {
+	var stats S3SyncStats
+	if _, err := os.Stat(localPath); os.IsNotExist(err) {
+		LogWarn("Directory %s non esiste, salto sincronizzazione", localPath)
+		return stats, nil
+	}
+
+	remote, err := s.listRemoteObjects(s3Prefix)
+	if err != nil {
+		return stats, err
+	}
+
+	type syncItem struct {
+		path string
+		key  string
+		size int64
+	}
+	items := make(chan syncItem)
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	for i := 0; i < s.syncWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range items {
+				uploaded, err := s.syncFile(item.path, item.key, item.size, remote[item.key])
+				mu.Lock()
+				switch {
+				case err != nil:
+					stats.Failed++
+					if firstErr == nil {
+						firstErr = err
+					}
+					LogError("Errore sincronizzazione %s: %v", item.path, err)
+				case uploaded:
+					stats.Uploaded++
+					stats.BytesUploaded += item.size
+				default:
+					stats.Skipped++
+					stats.BytesSkipped += item.size
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	local := make(map[string]bool)
+	walkErr := filepath.Walk(localPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		relPath, err := filepath.Rel(localPath, path)
+		if err != nil {
+			return err
+		}
+		s3Key := s3Prefix + strings.ReplaceAll(relPath, "\\", "/")
+		local[s3Key] = true
+		items <- syncItem{path: path, key: s3Key, size: info.Size()}
+		return nil
+	})
+	close(items)
+	wg.Wait()
+
+	if walkErr != nil {
+		firstErr = walkErr
+	}
+	if s.syncDelete {
+		switch {
+		case firstErr != nil:
+			// Una sincronizzazione incompleta non deve rimuovere oggetti remoti: il remoto
+			// resta l'ultima copia valida dei file che non è stato possibile caricare
+			LogWarn("Rimozione dei file eliminati ignorata: sincronizzazione di %s incompleta", localPath)
+		case s3Prefix == "":
+			LogWarn("Rimozione dei file eliminati ignorata: prefisso S3 vuoto")
+		default:
+			for key := range remote {
+				if local[key] {
+					continue
+				}
+				if err := s.DeleteFile(key); err != nil {
+					stats.Failed++
+					if firstErr == nil {
+						firstErr = err
+					}
+					continue
+				}
+				stats.Deleted++
+			}
+		}
+	}
+
+	s.metrics.RecordS3Sync(stats)
+	LogInfo("Sincronizzazione %s -> s3://%s/%s: %d caricati (%d byte), %d invariati (%d byte), %d eliminati, %d errori",
+		localPath, s.bucket, s3Prefix, stats.Uploaded, stats.BytesUploaded, stats.Skipped, stats.BytesSkipped, stats.Deleted, stats.Failed)
+	if firstErr != nil {
+		return stats, fmt.Errorf("sincronizzazione di %s incompleta (%d errori): %v", localPath, stats.Failed, firstErr)
+	}
+	return stats, nil
+}
+
+// syncFile carica il file se l'oggetto remoto è assente o diverso; restituisce se ha caricato
+func (s *S3Client) syncFile(path, key string, size int64, remote *s3RemoteObject) (bool, error) {
+	sum, err := fileMD5(path)
+	if err != nil {
+		return false, err
+	}
+	if remote != nil && remote.size == size {
+		same, err := s.remoteMatches(key, remote, sum)
+		if err != nil {
+			return false, err
+		}
+		if same {
+			return false, nil
+		}
+	}
+	return true, s.uploadFile(path, key, map[string]*string{s3SyncMD5Metadata: aws.String(sum)})
+}
+
+// remoteMatches confronta l'MD5 del file locale con l'ETag o, per gli oggetti multipart,
+// con il metadato MD5 letto con una HEAD
+func (s *S3Client) remoteMatches(key string, remote *s3RemoteObject, sum string) (bool, error) {
+	etag := strings.Trim(remote.etag, "\"")
+	if !strings.Contains(etag, "-") {
+		return etag == sum, nil
+	}
+	head, err := s.s3Client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(key)})
+	if err != nil {
+		return false, fmt.Errorf("errore lettura metadati %s: %v", key, err)
+	}
+	for name, value := range head.Metadata {
+		if strings.EqualFold(name, s3SyncMD5Metadata) {
+			return aws.StringValue(value) == sum, nil
+		}
+	}
+	return false, nil
+}
+
+// listRemoteObjects restituisce dimensione ed ETag degli oggetti sotto il prefisso
+func (s *S3Client) listRemoteObjects(prefix string) (map[string]*s3RemoteObject, error) {
+	objects := make(map[string]*s3RemoteObject)
+	err := s.s3Client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			objects[aws.StringValue(obj.Key)] = &s3RemoteObject{size: aws.Int64Value(obj.Size), etag: aws.StringValue(obj.ETag)}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("errore elenco oggetti s3://%s/%s: %v", s.bucket, prefix, err)
+	}
+	return objects, nil
+}
+
+// fileMD5 restituisce l'MD5 esadecimale del contenuto del file
+func fileMD5(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/rpc"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// Shuffle tra worker: i map lasciano le partizioni intermedie sul disco locale del worker
+// e le servono via HTTP; il master registra nel TaskInfo l'indirizzo del worker che ha
+// prodotto l'output promosso e lo passa ai reduce, che scaricano le partizioni. Se il
+// worker non risponde più, il reduce lo segnala e il master riesegue i map persi.
+
+// workerShuffleAddr è l'indirizzo del server shuffle del worker (vuoto = shuffle disabilitato).
+// Impostato una sola volta all'avvio del worker, prima degli slot.
+var workerShuffleAddr string
+
+// startShuffleServer avvia il server HTTP che serve le partizioni intermedie del worker
+// e restituisce l'indirizzo da annunciare ai reduce
+func startShuffleServer(cfg ShuffleConfig) (string, error) {
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.Port))
+	if err != nil {
+		return "", fmt.Errorf("errore avvio server shuffle sulla porta %d: %v", cfg.Port, err)
+	}
+	host := cfg.Host
+	if host == "" {
+		if hn, err := os.Hostname(); err == nil && hn != "" {
+			host = hn
+		} else {
+			host = "localhost"
+		}
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(ln.Addr().(*net.TCPAddr).Port))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(ShufflePath, serveShufflePartition)
+	go func() {
+		if err := http.Serve(ln, mux); err != nil {
+			LogError("Server shuffle terminato: %v", err)
+		}
+	}()
+	return addr, nil
+}
+
+// shuffleURL costruisce l'URL della partizione reduceID dell'output di un map
+func shuffleURL(jobID string, out MapOutput, reduceID int) string {
+	return fmt.Sprintf("http://%s%s?job=%s&map=%d&reduce=%d&attempt=%s", out.Addr, ShufflePath,
+		url.QueryEscape(jobID), out.TaskID, reduceID, url.QueryEscape(out.AttemptID))
+}
+
+// validShuffleName indica se un ID di job o di tentativo può comparire in un nome di file
+func validShuffleName(s string) bool {
+	return !strings.ContainsAny(s, `/\`) && !strings.Contains(s, "..")
+}
+
+// serveShufflePartition serve una partizione intermedia prodotta da un map di questo worker
+func serveShufflePartition(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	jobID, attemptID := q.Get("job"), q.Get("attempt")
+	mapID, errMap := strconv.Atoi(q.Get("map"))
+	reduceID, errReduce := strconv.Atoi(q.Get("reduce"))
+	if errMap != nil || errReduce != nil || mapID < 0 || reduceID < 0 ||
+		!validShuffleName(jobID) || !validShuffleName(attemptID) {
+		http.Error(w, "parametri non validi", http.StatusBadRequest)
+		return
+	}
+
+	fileName := attemptFileName(getIntermediateFileName(jobID, mapID, reduceID), attemptID)
+	file, err := os.Open(fileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "partizione non trovata", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	LogDebug("Shuffle: servo %s (%d byte) a %s", fileName, info.Size(), r.RemoteAddr)
+	http.ServeContent(w, r, filepath.Base(fileName), info.ModTime(), file)
+}
+
+// mapOutputLostError indica che gli output di alcuni map non sono più raggiungibili
+type mapOutputLostError struct {
+	Lost []MapOutput
+	Err  error
+}
+
+func (e *mapOutputLostError) Error() string {
+	return fmt.Sprintf("output di %d map task non raggiungibili: %v", len(e.Lost), e.Err)
+}
+
+// fetchMapOutput scarica una partizione intermedia nel file dest, con qualche tentativo
+func fetchMapOutput(client *http.Client, jobID string, out MapOutput, reduceID int, dest string) error {
+	source := shuffleURL(jobID, out, reduceID)
+	var lastErr error
+	for attempt := 1; attempt <= ShuffleFetchRetries; attempt++ {
+		lastErr = downloadFile(client, source, dest)
+		if lastErr == nil {
+			return nil
+		}
+		if _, missing := lastErr.(errPartitionMissing); missing {
+			break // il worker non ha più la partizione: inutile riprovare
+		}
+		LogWarn("Shuffle: download di %s fallito (tentativo %d/%d): %v", source, attempt, ShuffleFetchRetries, lastErr)
+		time.Sleep(ShuffleRetryDelay)
+	}
+	return lastErr
+}
+
+// errPartitionMissing indica che il worker ha risposto ma non ha la partizione richiesta
+type errPartitionMissing string
+
+func (e errPartitionMissing) Error() string {
+	return fmt.Sprintf("partizione %s non presente sul worker", string(e))
+}
+
+// downloadFile scarica source in dest passando da un file temporaneo
+func downloadFile(client *http.Client, source, dest string) error {
+	resp, err := client.Get(source)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return errPartitionMissing(source)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("risposta %s", resp.Status)
+	}
+
+	tmp := dest + ".download"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, resp.Body); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
+
+// gatherReduceInputs raccoglie le partizioni del reduce task: quelle servite da un worker
+// vengono scaricate in file locali (restituiti in fetched, da rimuovere a fine task), le
+// altre sono lette dal filesystem condiviso. Gli output non raggiungibili o che non
+// corrispondono al checksum registrato vengono restituiti come *mapOutputLostError.
+func gatherReduceInputs(task *Task) (inputs []string, fetched []string, err error) {
+	outputs := make(map[int]MapOutput, len(task.MapOutputs))
+	for _, out := range task.MapOutputs {
+		outputs[out.TaskID] = out
+	}
+
+	type result struct {
+		mapID int
+		path  string
+		err   error
+	}
+	results := make([]result, task.NMap)
+	client := &http.Client{Timeout: ShuffleFetchTimeout}
+	sem := make(chan struct{}, ShuffleFetchParallelism)
+	var wg sync.WaitGroup
+	for mapID := 0; mapID < task.NMap; mapID++ {
+		out, known := outputs[mapID]
+		shared := getIntermediateFileName(task.JobID, mapID, task.TaskID)
+		if !known || out.Addr == "" {
+			// Output promosso sul filesystem condiviso
+			results[mapID] = result{mapID: mapID, path: shared}
+			continue
+		}
+		if out.Addr == workerShuffleAddr {
+			// Output prodotto da questo worker: nessun download
+			results[mapID] = result{mapID: mapID, path: attemptFileName(shared, out.AttemptID)}
+			continue
+		}
+
+		dest := attemptFileName(filepath.Join(filepath.Dir(shared),
+			fmt.Sprintf("mr-shuffle-%s%d-%d", jobFilePrefix(task.JobID), mapID, task.TaskID)), task.AttemptID)
+		wg.Add(1)
+		go func(mapID int, out MapOutput, dest string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[mapID] = result{mapID: mapID, path: dest, err: fetchMapOutput(client, task.JobID, out, task.TaskID, dest)}
+		}(mapID, out, dest)
+	}
+	wg.Wait()
+
+	var lost []MapOutput
+	var lostErr error
+	for _, res := range results {
+		out, known := outputs[res.mapID]
+		if !known {
+			// Map senza posizione né checksum registrati: partizione opzionale sul filesystem condiviso
+			if _, err := os.Stat(res.path); err == nil {
+				inputs = append(inputs, res.path)
+			}
+			continue
+		}
+		if res.err == nil && out.Addr != "" && out.Addr != workerShuffleAddr {
+			fetched = append(fetched, res.path)
+		}
+		if res.err == nil {
+			// La partizione deve esistere, anche se vuota, e corrispondere al checksum del map
+			if out.Checksum != nil {
+				res.err = verifyFileChecksum(res.path, *out.Checksum)
+			} else {
+				_, res.err = os.Stat(res.path)
+			}
+		}
+		if res.err != nil {
+			lost = append(lost, out)
+			lostErr = res.err
+			continue
+		}
+		inputs = append(inputs, res.path)
+	}
+	if len(lost) > 0 {
+		return nil, fetched, &mapOutputLostError{Lost: lost, Err: lostErr}
+	}
+	return inputs, fetched, nil
+}
+
+// removeJobShuffleFiles rimuove le partizioni intermedie di un job servite da questo worker
+func removeJobShuffleFiles(jobID string) {
+	if jobID == "" || !validShuffleName(jobID) {
+		return
+	}
+	pattern := filepath.Join(filepath.Dir(getIntermediateFileName(jobID, 0, 0)),
+		fmt.Sprintf("mr-intermediate-%s*", jobFilePrefix(jobID)))
+	files, _ := filepath.Glob(pattern)
+	for _, file := range files {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			LogWarn("Errore rimozione intermedio %s: %v", file, err)
+		}
+	}
+	if len(files) > 0 {
+		LogInfo("Shuffle: rimossi %d file intermedi del job terminato %s", len(files), jobID)
+	}
+}
+
+// reportMapOutputLost segnala al master gli output dei map che il reduce non ha potuto scaricare
+func reportMapOutputLost(masterAddr string, task *Task, workerID string, lostErr *mapOutputLostError) {
+	client, err := rpc.DialHTTP("tcp", masterAddr)
+	if err != nil {
+		LogError("Errore connessione master %s per report output persi: %v", masterAddr, err)
+		return
+	}
+	defer client.Close()
+
+	args := MapOutputLostArgs{
+		JobID:     task.JobID,
+		TaskID:    task.TaskID,
+		WorkerID:  workerID,
+		AttemptID: task.AttemptID,
+		Lost:      lostErr.Lost,
+		Error:     lostErr.Err.Error(),
+	}
+	var reply Reply
+	if err := client.Call("Master.ReportMapOutputLost", args, &reply); err != nil {
+		LogError("Errore report output persi per il ReduceTask %d: %v", task.TaskID, err)
+	} else {
+		LogWarn("ReduceTask %d: segnalati %d output di map non raggiungibili", task.TaskID, len(lostErr.Lost))
+	}
+}
+
+// mapOutputs restituisce posizione e checksum della partizione reduceID degli output
+// dei map completati del job
+func (j *Job) mapOutputs(reduceID int) []MapOutput {
+	var outputs []MapOutput
+	for id, info := range j.MapTasks {
+		if info.State != Completed {
+			continue
+		}
+		out := MapOutput{TaskID: id, Addr: info.Location, AttemptID: info.Committed}
+		if checksum, ok := findFileChecksum(info.Files, reduceID); ok {
+			out.Checksum = &checksum
+		}
+		if out.Addr != "" || out.Checksum != nil {
+			outputs = append(outputs, out)
+		}
+	}
+	return outputs
+}
+
+// applyLostMapOutputs riporta Idle i map i cui output non sono più raggiungibili, tornando
+// alla fase map, e rimette in coda il reduce che li ha segnalati senza contarlo come
+// fallimento. Chiamato da Apply con m.mu acquisito.
+func (m *Master) applyLostMapOutputs(job *Job, cmd LogCommand) {
+	reset := 0
+	for _, out := range cmd.Lost {
+		if out.TaskID < 0 || out.TaskID >= len(job.MapTasks) {
+			continue
+		}
+		info := &job.MapTasks[out.TaskID]
+		if info.State != Completed || info.Location != out.Addr || info.Committed != out.AttemptID {
+			continue // già rieseguito dopo un'altra segnalazione
+		}
+		job.resetCompletedTask(info)
+		job.MapTasksDone--
+		reset++
+		LogWarn("[Master] Job %s: output di MapTask %d su %s non raggiungibile, riesecuzione", job.ID, out.TaskID, out.Addr)
+	}
+	if reset > 0 && job.Phase == ReducePhase {
+		job.Phase = MapPhase
+		LogWarn("[Master] Job %s: ritorno a MapPhase per rieseguire %d map task", job.ID, reset)
+	}
+	if cmd.TaskID >= 0 && cmd.TaskID < len(job.ReduceTasks) && job.ReduceTasks[cmd.TaskID].State == InProgress {
+		job.ReduceTasks[cmd.TaskID].State = Idle
+	}
+}
+
+// shuffleCleanupJobs restituisce i job terminati di cui il worker serve ancora intermedi.
+// Ogni job viene segnalato una sola volta per indirizzo. Chiamato con m.mu acquisito.
+func (m *Master) shuffleCleanupJobs(shuffleAddr string) []string {
+	if shuffleAddr == "" {
+		return nil
+	}
+	var cleanup []string
+	for jobID, job := range m.jobs {
+		if !job.IsDone() || m.shuffleCleaned[shuffleAddr][jobID] {
+			continue
+		}
+		for _, info := range job.MapTasks {
+			if info.Location == shuffleAddr {
+				cleanup = append(cleanup, jobID)
+				break
+			}
+		}
+	}
+	if len(cleanup) > 0 {
+		if m.shuffleCleaned == nil {
+			m.shuffleCleaned = make(map[string]map[string]bool)
+		}
+		if m.shuffleCleaned[shuffleAddr] == nil {
+			m.shuffleCleaned[shuffleAddr] = make(map[string]bool)
+		}
+		for _, jobID := range cleanup {
+			m.shuffleCleaned[shuffleAddr][jobID] = true
+		}
+	}
+	return cleanup
+}
+
+// ReportMapOutputLost è il metodo RPC con cui un reduce segnala gli output dei map che
+// non è riuscito a scaricare
+func (m *Master) ReportMapOutputLost(args *MapOutputLostArgs, reply *Reply) error {
+	if m.raft.State() != raft.Leader {
+		return fmt.Errorf("non sono il leader")
+	}
+	LogWarn("[Master] ReportMapOutputLost ricevuto: Job=%s, ReduceTask=%d, Worker=%s, output persi=%d: %s",
+		args.JobID, args.TaskID, args.WorkerID, len(args.Lost), args.Error)
+
+	m.mu.RLock()
+	job := m.getJob(args.JobID)
+	if job == nil {
+		m.mu.RUnlock()
+		return fmt.Errorf("%w: %s", errJobNotFound, args.JobID)
+	}
+	jobID, nReduce := job.ID, len(job.ReduceTasks)
+	m.mu.RUnlock()
+	if args.TaskID < 0 || args.TaskID >= nReduce {
+		return fmt.Errorf("TaskID %d fuori range", args.TaskID)
+	}
+
+	cmd := LogCommand{Operation: "lost-map", JobID: jobID, TaskID: args.TaskID, AttemptID: args.AttemptID, Lost: args.Lost}
+	cmdBytes, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+	if err := m.raft.Apply(cmdBytes, 2*time.Second).Error(); err != nil {
+		return fmt.Errorf("errore applicando lost-map: %v", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.untrackWorkerTask(args.WorkerID, TaskKey{JobID: jobID, ID: args.TaskID, Type: ReduceTask})
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+// Slot dei worker: ogni processo worker esegue fino a Slots task in parallelo e lo
+// dichiara al master con RequestTask e con l'heartbeat. Il master conta i task in carico
+// al worker in workerToTasks e non ne assegna altri quando tutti gli slot sono occupati.
+
+// advertiseWorkerSlots registra il numero di slot dichiarato dal worker. Chiamato con m.mu acquisito.
+func (m *Master) advertiseWorkerSlots(workerID string, slots int) {
+	if worker, exists := m.workers[workerID]; exists && slots > 0 {
+		worker.Slots = slots
+	}
+}
+
+// workerSlotLimit restituisce il numero di slot del worker (almeno uno). Chiamato con m.mu acquisito.
+func (m *Master) workerSlotLimit(workerID string, slots int) int {
+	if slots <= 0 {
+		if worker, exists := m.workers[workerID]; exists {
+			slots = worker.Slots
+		}
+	}
+	if slots <= 0 {
+		return 1
+	}
+	return slots
+}
+
+// pruneWorkerTasks rimuove dai task in carico al worker quelli che non sono più in
+// esecuzione (completati, resettati dal timeout o di job terminati). Chiamato con m.mu acquisito.
+func (m *Master) pruneWorkerTasks(workerID string) {
+	for key := range m.workerToTasks[workerID] {
+		job := m.jobs[key.JobID]
+		if job == nil || job.IsDone() {
+			m.untrackWorkerTask(workerID, key)
+			continue
+		}
+		tasks := job.MapTasks
+		if key.Type == ReduceTask {
+			tasks = job.ReduceTasks
+		}
+		if key.ID < 0 || key.ID >= len(tasks) || tasks[key.ID].State != InProgress {
+			m.untrackWorkerTask(workerID, key)
+		}
+	}
+}
+
+// workerAbandonedJobs restituisce i job in pausa, cancellati o falliti di cui il worker
+// sta ancora eseguendo task e ne rilascia gli slot. I task in esecuzione sono quelli
+// riportati dal worker nell'heartbeat, oltre a quelli ancora in workerToTasks: pruneWorkerTasks
+// rimuove i task dei job terminati prima che l'heartbeat possa segnalarli.
+// Chiamato con m.mu acquisito.
+func (m *Master) workerAbandonedJobs(workerID string, running []TaskProgress) []string {
+	keys := make([]TaskKey, 0, len(running)+len(m.workerToTasks[workerID]))
+	for _, progress := range running {
+		keys = append(keys, TaskKey{JobID: progress.JobID, ID: progress.TaskID, Type: progress.Type})
+	}
+	for key := range m.workerToTasks[workerID] {
+		keys = append(keys, key)
+	}
+
+	var jobIDs []string
+	abandoned := make(map[string]bool)
+	for _, key := range keys {
+		job := m.jobs[key.JobID]
+		if job == nil || (!job.IsPaused() && !job.IsCanceled() && !job.IsFailed()) {
+			continue
+		}
+		if !abandoned[job.ID] {
+			abandoned[job.ID] = true
+			jobIDs = append(jobIDs, job.ID)
+		}
+		if m.workerToTasks[workerID][key] {
+			m.untrackWorkerTask(workerID, key)
+			LogInfo("[Master] Worker %s deve abbandonare il task %v %d del job %s (%v)",
+				workerID, key.Type, key.ID, job.ID, job.Status)
+		}
+	}
+	return jobIDs
+}
+
+// workerHasFreeSlot indica se il worker ha uno slot libero per un nuovo task. Chiamato con m.mu acquisito.
+func (m *Master) workerHasFreeSlot(workerID string, slots int) bool {
+	m.pruneWorkerTasks(workerID)
+	return len(m.workerToTasks[workerID]) < m.workerSlotLimit(workerID, slots)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Esecuzione speculativa: verso la fine di una fase il monitor dei task individua i task
+// in corso da molto più tempo della mediana del job e li segna come candidati. Alla prossima
+// richiesta di un altro worker AssignTask lancia un tentativo di backup; il primo tentativo
+// che completa viene promosso (vedi attempt.go) e l'altro scartato.
+
+// phaseTasks restituisce i task della fase corrente del job e il loro tipo
+func (j *Job) phaseTasks() ([]TaskInfo, TaskType) {
+	if j.Phase == ReducePhase {
+		return j.ReduceTasks, ReduceTask
+	}
+	return j.MapTasks, MapTask
+}
+
+// medianTaskDuration restituisce la mediana delle durate dei task completati (0 se non note)
+func medianTaskDuration(tasks []TaskInfo) time.Duration {
+	var durations []time.Duration
+	for _, task := range tasks {
+		if task.State == Completed && task.Duration > 0 {
+			durations = append(durations, task.Duration)
+		}
+	}
+	if len(durations) == 0 {
+		return 0
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	mid := len(durations) / 2
+	if len(durations)%2 == 0 {
+		return (durations[mid-1] + durations[mid]) / 2
+	}
+	return durations[mid]
+}
+
+// markSpeculativeTasks segna come candidati al backup i task lenti della fase corrente.
+// Ogni task riceve al più un backup. Chiamato dal leader con m.mu acquisito.
+func (m *Master) markSpeculativeTasks(job *Job, now time.Time) {
+	if job == nil || job.IsDone() || job.IsPaused() {
+		return
+	}
+	tasks, taskType := job.phaseTasks()
+	done := 0
+	for _, task := range tasks {
+		if task.State == Completed {
+			done++
+		}
+	}
+	if len(tasks) == 0 || float64(done) < SpeculativePhaseThreshold*float64(len(tasks)) {
+		return
+	}
+	median := medianTaskDuration(tasks)
+	if median == 0 {
+		return
+	}
+
+	threshold := time.Duration(float64(median) * SpeculativeSlowdownFactor)
+	if threshold < SpeculativeMinRuntime {
+		threshold = SpeculativeMinRuntime
+	}
+	for id, task := range tasks {
+		if task.State != InProgress || task.StartTime.IsZero() || now.Sub(task.StartTime) <= threshold {
+			continue
+		}
+		key := TaskKey{JobID: job.ID, ID: id, Type: taskType}
+		if _, marked := m.speculative[key]; marked {
+			continue
+		}
+		if m.speculative == nil {
+			m.speculative = make(map[TaskKey]string)
+		}
+		m.speculative[key] = ""
+		LogInfo("[Master] Job %s: %vTask %d in corso da %v (mediana %v), candidato a backup speculativo",
+			job.ID, taskType, id, now.Sub(task.StartTime).Round(time.Millisecond), median.Round(time.Millisecond))
+	}
+}
+
+// takeBackupSlot indica se il worker può eseguire il backup del task: il task deve essere
+// candidato, senza backup già lanciato, e non deve essere già in carico al worker.
+// Chiamato con m.mu acquisito.
+func (m *Master) takeBackupSlot(key TaskKey, workerID string) bool {
+	backupID, marked := m.speculative[key]
+	if !marked || backupID != "" {
+		return false
+	}
+	return !m.workerToTasks[strings.TrimSpace(workerID)][key]
+}
+
+// resolveSpeculation chiude la speculazione di un task completato, registrando se il
+// commit è arrivato dal tentativo di backup. Chiamato con m.mu acquisito.
+func (m *Master) resolveSpeculation(key TaskKey, attemptID string) {
+	backupID, marked := m.speculative[key]
+	if !marked {
+		return
+	}
+	delete(m.speculative, key)
+	if backupID != "" && backupID == attemptID {
+		LogInfo("[Master] Job %s: %vTask %d completato dal backup speculativo %s", key.JobID, key.Type, key.ID, attemptID)
+		if m.metrics != nil {
+			m.metrics.RecordSpeculativeWin(strings.ToLower(key.Type.String()))
+		}
+	}
+}
+
+// absorbTaskFailure gestisce sul leader i fallimenti che non riguardano il tentativo
+// primario del task e che quindi non vanno replicati: il fallimento del backup chiude solo
+// la speculazione, lasciando in corso il primario, mentre quello di un tentativo non più
+// assegnato viene ignorato. Restituisce false se il fallimento va registrato con Raft.
+// Chiamato con m.mu acquisito.
+func (m *Master) absorbTaskFailure(key TaskKey, task *TaskInfo, attemptID, workerID string) bool {
+	switch {
+	case attemptID == "":
+		// Worker che non riporta il tentativo: il fallimento è attribuito al primario
+		return false
+	case attemptID == task.BackupID:
+		LogWarn("[Master] Job %s: fallito il backup speculativo %s di %vTask %d, il tentativo %s continua",
+			key.JobID, attemptID, key.Type, key.ID, task.AttemptID)
+		task.BackupID = ""
+		delete(m.speculative, key)
+	case task.AttemptID != "" && attemptID != task.AttemptID:
+		LogInfo("[Master] Job %s: ignoro il fallimento del tentativo obsoleto %s di %vTask %d (in corso %s)",
+			key.JobID, attemptID, key.Type, key.ID, task.AttemptID)
+	default:
+		return false
+	}
+	m.untrackWorkerTask(workerID, key)
+	return true
+}
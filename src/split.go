@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+)
+
+// InputSplit è un intervallo di byte di un file di input assegnato a un map task.
+// Gli estremi sono allineati a inizio riga, quindi nessuna riga viene spezzata tra due split.
+type InputSplit struct {
+	File   string `json:"file"`
+	Offset int64  `json:"offset"`
+	Length int64  `json:"length"` // 0 = fino a fine file
+}
+
+func (s InputSplit) String() string {
+	if s.Offset == 0 && s.Length == 0 {
+		return s.File
+	}
+	return fmt.Sprintf("%s[%d:+%d]", s.File, s.Offset, s.Length)
+}
+
+// wholeFileSplits crea uno split per file, senza leggere i file
+func wholeFileSplits(files []string) []InputSplit {
+	splits := make([]InputSplit, len(files))
+	for i, file := range files {
+		splits[i] = InputSplit{File: file}
+	}
+	return splits
+}
+
+// computeInputSplits divide i file in split di circa splitSize byte, spostando ogni
+// confine all'inizio della riga successiva. Un file più piccolo di splitSize resta intero,
+// come i file compressi (.gz, .bz2), che non possono essere letti a partire da un offset.
+func computeInputSplits(files []string, splitSize int64) ([]InputSplit, error) {
+	if splitSize <= 0 {
+		return wholeFileSplits(files), nil
+	}
+
+	var splits []InputSplit
+	for _, file := range files {
+		st := storageFor(file)
+		size, err := st.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		if size <= splitSize || compressionExtension(file) != "" {
+			splits = append(splits, InputSplit{File: file})
+			continue
+		}
+
+		f, err := st.OpenReaderAt(file)
+		if err != nil {
+			return nil, err
+		}
+		start := int64(0)
+		for start < size {
+			end := start + splitSize
+			if end < size {
+				end, err = nextLineStart(f, end)
+				if err != nil {
+					f.Close()
+					return nil, fmt.Errorf("calcolo split di %s: %v", file, err)
+				}
+			}
+			if end > size {
+				end = size
+			}
+			splits = append(splits, InputSplit{File: file, Offset: start, Length: end - start})
+			start = end
+		}
+		f.Close()
+	}
+	return splits, nil
+}
+
+// nextLineStart restituisce la posizione del primo byte dopo il primo '\n' in posizione >= pos-1,
+// cioè pos stesso se pos è già a inizio riga. Restituisce la dimensione del file se non ci sono altri '\n'.
+func nextLineStart(f io.ReaderAt, pos int64) (int64, error) {
+	r := bufio.NewReader(io.NewSectionReader(f, pos-1, math.MaxInt64-pos))
+	offset := pos - 1
+	for {
+		b, err := r.ReadByte()
+		if err == io.EOF {
+			return offset, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		offset++
+		if b == '\n' {
+			return offset, nil
+		}
+	}
+}
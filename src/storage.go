@@ -0,0 +1,548 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// Storage dei file di input e di output dei job. Lo storage è scelto dal percorso: gli URI
+// s3://bucket/key vengono letti e scritti direttamente su S3, mem://... è uno storage in
+// memoria del processo (usato nei test), tutto il resto è il filesystem locale. I file
+// intermedi, i checkpoint e le cache dei worker restano sempre sul filesystem locale.
+
+// MemURIPrefix identifica i percorsi dello storage in memoria
+const MemURIPrefix = "mem://"
+
+// Storage è l'accesso ai file di un sistema di storage, indirizzati con percorsi completi
+type Storage interface {
+	// Stat restituisce la dimensione del file; un file assente dà un errore per cui os.IsNotExist è vero
+	Stat(name string) (int64, error)
+	// OpenRange legge length byte a partire da offset (length 0 = fino a fine file)
+	OpenRange(name string, offset, length int64) (io.ReadCloser, error)
+	// OpenReaderAt apre il file per letture ad accesso casuale
+	OpenReaderAt(name string) (StorageReaderAt, error)
+	// Create crea o sostituisce il file; il contenuto è visibile dopo Close
+	Create(name string) (io.WriteCloser, error)
+	Rename(from, to string) error
+	Remove(name string) error
+	// Glob restituisce i file che corrispondono al pattern (sintassi di path.Match) in ordine
+	Glob(pattern string) ([]string, error)
+}
+
+// StorageReaderAt legge un file ad accesso casuale
+type StorageReaderAt interface {
+	io.ReaderAt
+	io.Closer
+}
+
+// storageFor restituisce lo storage del percorso indicato
+func storageFor(name string) Storage {
+	switch {
+	case strings.HasPrefix(name, S3URIPrefix):
+		return s3Storages.get(name)
+	case strings.HasPrefix(name, MemURIPrefix):
+		return memStorage
+	default:
+		return localStorage{}
+	}
+}
+
+// openStorageFile apre l'intero file in lettura sequenziale
+func openStorageFile(name string) (io.ReadCloser, error) {
+	return storageFor(name).OpenRange(name, 0, 0)
+}
+
+// isStorageURI indica se il percorso è un URI (s3://, mem://) e non un file locale
+func isStorageURI(name string) bool {
+	return strings.HasPrefix(name, S3URIPrefix) || strings.HasPrefix(name, MemURIPrefix)
+}
+
+// joinStoragePath aggiunge un nome di file a una directory locale o a un prefisso URI
+func joinStoragePath(dir, name string) string {
+	if isStorageURI(dir) {
+		return strings.TrimSuffix(dir, "/") + "/" + name
+	}
+	return filepath.Join(dir, name)
+}
+
+// hasGlobMeta indica se il percorso contiene caratteri speciali di un pattern
+func hasGlobMeta(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+// resolveInputFiles espande i pattern dei file di input e verifica che gli altri esistano
+func resolveInputFiles(inputs []string) ([]string, error) {
+	var files []string
+	for _, input := range inputs {
+		st := storageFor(input)
+		if hasGlobMeta(input) {
+			matches, err := st.Glob(input)
+			if err != nil {
+				return nil, fmt.Errorf("errore espansione %s: %v", input, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("nessun file di input corrisponde a %s", input)
+			}
+			files = append(files, matches...)
+			continue
+		}
+		if _, err := st.Stat(input); err != nil {
+			if os.IsNotExist(err) {
+				return nil, fmt.Errorf("file di input non trovato: %s", input)
+			}
+			return nil, fmt.Errorf("file di input %s non accessibile: %v", input, err)
+		}
+		files = append(files, input)
+	}
+	return files, nil
+}
+
+// validateOutputDir verifica la directory di output indicata alla sottomissione di un job
+func validateOutputDir(dir string) error {
+	if !strings.HasPrefix(dir, S3URIPrefix) {
+		return nil
+	}
+	if bucket, _, _ := strings.Cut(strings.TrimPrefix(dir, S3URIPrefix), "/"); bucket == "" {
+		return fmt.Errorf("directory di output S3 non valida: %s (atteso s3://bucket/prefisso/)", dir)
+	}
+	return nil
+}
+
+// notExist restituisce l'errore di file assente riconosciuto da os.IsNotExist
+func notExist(op, name string) error {
+	return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
+
+// readCloser unisce un reader e la chiusura della sorgente sottostante
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// localStorage è il filesystem locale
+type localStorage struct{}
+
+func (localStorage) Stat(name string) (int64, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return 0, err
+	}
+	if info.IsDir() {
+		return 0, fmt.Errorf("%s è una directory", name)
+	}
+	return info.Size(), nil
+}
+
+func (localStorage) OpenRange(name string, offset, length int64) (io.ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if offset == 0 && length == 0 {
+		return f, nil
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if length == 0 {
+		return f, nil
+	}
+	return readCloser{io.LimitReader(f, length), f}, nil
+}
+
+func (localStorage) OpenReaderAt(name string) (StorageReaderAt, error) {
+	return os.Open(name)
+}
+
+func (localStorage) Create(name string) (io.WriteCloser, error) {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return nil, err
+	}
+	return os.Create(name)
+}
+
+func (localStorage) Rename(from, to string) error { return os.Rename(from, to) }
+
+func (localStorage) Remove(name string) error { return os.Remove(name) }
+
+func (localStorage) Glob(pattern string) ([]string, error) { return filepath.Glob(pattern) }
+
+// memStorage è lo storage in memoria condiviso dal processo
+var memStorage = &memoryStorage{files: make(map[string][]byte)}
+
+type memoryStorage struct {
+	mu    sync.RWMutex
+	files map[string][]byte
+}
+
+func (m *memoryStorage) get(op, name string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	data, ok := m.files[name]
+	if !ok {
+		return nil, notExist(op, name)
+	}
+	return data, nil
+}
+
+func (m *memoryStorage) Stat(name string) (int64, error) {
+	data, err := m.get("stat", name)
+	return int64(len(data)), err
+}
+
+func (m *memoryStorage) OpenRange(name string, offset, length int64) (io.ReadCloser, error) {
+	data, err := m.get("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	data = data[offset:]
+	if length > 0 && length < int64(len(data)) {
+		data = data[:length]
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *memoryStorage) OpenReaderAt(name string) (StorageReaderAt, error) {
+	data, err := m.get("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return readerAtCloser{bytes.NewReader(data)}, nil
+}
+
+type readerAtCloser struct{ io.ReaderAt }
+
+func (readerAtCloser) Close() error { return nil }
+
+func (m *memoryStorage) Create(name string) (io.WriteCloser, error) {
+	return &memoryFile{storage: m, name: name}, nil
+}
+
+// memoryFile accumula il contenuto e lo pubblica alla chiusura
+type memoryFile struct {
+	bytes.Buffer
+	storage *memoryStorage
+	name    string
+}
+
+func (f *memoryFile) Close() error {
+	f.storage.mu.Lock()
+	defer f.storage.mu.Unlock()
+	f.storage.files[f.name] = append([]byte(nil), f.Bytes()...)
+	return nil
+}
+
+func (m *memoryStorage) Rename(from, to string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.files[from]
+	if !ok {
+		return notExist("rename", from)
+	}
+	delete(m.files, from)
+	m.files[to] = data
+	return nil
+}
+
+func (m *memoryStorage) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.files[name]; !ok {
+		return notExist("remove", name)
+	}
+	delete(m.files, name)
+	return nil
+}
+
+func (m *memoryStorage) Glob(pattern string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var matches []string
+	for name := range m.files {
+		ok, err := path.Match(pattern, name)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matches = append(matches, name)
+		}
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// s3Storages contiene uno storage S3 per bucket, con il client creato al primo uso
+var s3Storages = &s3StorageSet{buckets: make(map[string]*s3Storage)}
+
+type s3StorageSet struct {
+	mu      sync.Mutex
+	buckets map[string]*s3Storage
+}
+
+func (set *s3StorageSet) get(uri string) *s3Storage {
+	bucket, _, _ := strings.Cut(strings.TrimPrefix(uri, S3URIPrefix), "/")
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	st, ok := set.buckets[bucket]
+	if !ok {
+		st = &s3Storage{bucket: bucket}
+		set.buckets[bucket] = st
+	}
+	return st
+}
+
+// s3Storage legge e scrive gli oggetti di un bucket; la configurazione (regione e
+// credenziali) è quella di GetS3ConfigFromEnv, con il bucket preso dall'URI
+type s3Storage struct {
+	bucket string
+	once   sync.Once
+	client *S3Client
+	err    error
+}
+
+func (st *s3Storage) s3() (*S3Client, error) {
+	st.once.Do(func() {
+		config := GetS3ConfigFromEnv()
+		config.Bucket = st.bucket
+		config.Enabled = true
+		st.client, st.err = NewS3Client(config)
+	})
+	return st.client, st.err
+}
+
+// key restituisce la chiave dell'oggetto indicato dall'URI
+func (st *s3Storage) key(uri string) (string, error) {
+	bucket, key, err := parseS3URI(uri)
+	if err != nil {
+		return "", err
+	}
+	if bucket != st.bucket {
+		return "", fmt.Errorf("URI %s fuori dal bucket %s", uri, st.bucket)
+	}
+	return key, nil
+}
+
+// isS3NotFound indica se l'errore S3 corrisponde a un oggetto assente
+func isS3NotFound(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case s3.ErrCodeNoSuchKey, "NotFound":
+			return true
+		}
+	}
+	return false
+}
+
+func (st *s3Storage) Stat(name string) (int64, error) {
+	key, err := st.key(name)
+	if err != nil {
+		return 0, err
+	}
+	c, err := st.s3()
+	if err != nil {
+		return 0, err
+	}
+	head, err := c.s3Client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(st.bucket), Key: aws.String(key)})
+	if err != nil {
+		if isS3NotFound(err) {
+			return 0, notExist("stat", name)
+		}
+		return 0, fmt.Errorf("errore stat %s: %v", name, err)
+	}
+	return aws.Int64Value(head.ContentLength), nil
+}
+
+// getRange scarica l'intervallo di byte [offset, offset+length) dell'oggetto (length 0 = fino alla fine)
+func (st *s3Storage) getRange(name string, offset, length int64) (io.ReadCloser, error) {
+	key, err := st.key(name)
+	if err != nil {
+		return nil, err
+	}
+	c, err := st.s3()
+	if err != nil {
+		return nil, err
+	}
+	input := &s3.GetObjectInput{Bucket: aws.String(st.bucket), Key: aws.String(key)}
+	if length > 0 {
+		input.Range = aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	} else if offset > 0 {
+		input.Range = aws.String(fmt.Sprintf("bytes=%d-", offset))
+	}
+	out, err := c.s3Client.GetObject(input)
+	if err != nil {
+		if isS3NotFound(err) {
+			return nil, notExist("open", name)
+		}
+		return nil, fmt.Errorf("errore lettura %s: %v", name, err)
+	}
+	return out.Body, nil
+}
+
+func (st *s3Storage) OpenRange(name string, offset, length int64) (io.ReadCloser, error) {
+	return st.getRange(name, offset, length)
+}
+
+func (st *s3Storage) OpenReaderAt(name string) (StorageReaderAt, error) {
+	size, err := st.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return &s3ReaderAt{st: st, name: name, size: size}, nil
+}
+
+// s3ReaderAt esegue una richiesta con Range per ogni lettura
+type s3ReaderAt struct {
+	st   *s3Storage
+	name string
+	size int64
+}
+
+func (r *s3ReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	want := int64(len(p))
+	if off+want > r.size {
+		want = r.size - off
+	}
+	body, err := r.st.getRange(r.name, off, want)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+	n, err := io.ReadFull(body, p[:want])
+	if err == nil && want < int64(len(p)) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (r *s3ReaderAt) Close() error { return nil }
+
+func (st *s3Storage) Create(name string) (io.WriteCloser, error) {
+	key, err := st.key(name)
+	if err != nil {
+		return nil, err
+	}
+	c, err := st.s3()
+	if err != nil {
+		return nil, err
+	}
+	// Upload multipart in streaming: i dati scritti passano direttamente all'uploader
+	pr, pw := io.Pipe()
+	w := &s3Writer{pw: pw, done: make(chan error, 1)}
+	go func() {
+		_, err := c.uploader.Upload(&s3manager.UploadInput{Bucket: aws.String(st.bucket), Key: aws.String(key), Body: pr})
+		pr.CloseWithError(err)
+		w.done <- err
+	}()
+	return w, nil
+}
+
+// s3Writer scrive un oggetto S3; Close attende la fine dell'upload e può essere ripetuto
+type s3Writer struct {
+	pw   *io.PipeWriter
+	done chan error
+	once sync.Once
+	err  error
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) { return w.pw.Write(p) }
+
+func (w *s3Writer) Close() error {
+	w.once.Do(func() {
+		w.pw.Close()
+		if err := <-w.done; err != nil {
+			w.err = fmt.Errorf("errore upload: %v", err)
+		}
+	})
+	return w.err
+}
+
+// Rename copia l'oggetto nella nuova chiave e rimuove l'originale (S3 non ha un rename)
+func (st *s3Storage) Rename(from, to string) error {
+	fromKey, err := st.key(from)
+	if err != nil {
+		return err
+	}
+	toKey, err := st.key(to)
+	if err != nil {
+		return err
+	}
+	c, err := st.s3()
+	if err != nil {
+		return err
+	}
+	source := (&url.URL{Path: st.bucket + "/" + fromKey}).EscapedPath()
+	if _, err := c.s3Client.CopyObject(&s3.CopyObjectInput{Bucket: aws.String(st.bucket), Key: aws.String(toKey),
+		CopySource: aws.String(source)}); err != nil {
+		if isS3NotFound(err) {
+			return notExist("rename", from)
+		}
+		return fmt.Errorf("errore copia %s -> %s: %v", from, to, err)
+	}
+	return st.Remove(from)
+}
+
+func (st *s3Storage) Remove(name string) error {
+	key, err := st.key(name)
+	if err != nil {
+		return err
+	}
+	c, err := st.s3()
+	if err != nil {
+		return err
+	}
+	if _, err := c.s3Client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String(st.bucket), Key: aws.String(key)}); err != nil {
+		return fmt.Errorf("errore rimozione %s: %v", name, err)
+	}
+	return nil
+}
+
+// Glob elenca gli oggetti con il prefisso che precede il primo carattere speciale e li
+// confronta con il pattern
+func (st *s3Storage) Glob(pattern string) ([]string, error) {
+	_, keyPattern, _ := strings.Cut(strings.TrimPrefix(pattern, S3URIPrefix), "/")
+	prefix := keyPattern
+	if i := strings.IndexAny(keyPattern, "*?[\\"); i >= 0 {
+		prefix = keyPattern[:i]
+	}
+	c, err := st.s3()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := c.ListFiles(prefix)
+	if err != nil {
+		return nil, err
+	}
+	var matches []string
+	for _, key := range keys {
+		ok, err := path.Match(keyPattern, key)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			matches = append(matches, S3URIPrefix+st.bucket+"/"+key)
+		}
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
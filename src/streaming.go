@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Applicazione "streaming": map e reduce sono comandi esterni (script Python, awk, ...)
+// eseguiti con sh -c, come in Hadoop Streaming. Il mapper riceve su stdin il contenuto
+// dello split (decompresso se .gz/.bz2, senza interpretarne il formato di input) e scrive
+// su stdout coppie chiave<TAB>valore, una per riga; il reducer riceve le coppie ordinate
+// per chiave nello stesso formato, con un processo per reduce task, e scrive le righe di
+// output. Lo stderr dei processi finisce nel log del worker; uscita
+// non zero o timeout fanno fallire il task. Se il job ha file accessori i comandi vengono
+// eseguiti nella directory della cache, così gli script possono essere distribuiti con il job.
+
+func init() {
+	RegisterApp(&App{
+		Name:            "streaming",
+		Description:     "Esegue i comandi esterni dei parametri mapper e reducer (righe chiave<TAB>valore su stdin/stdout); timeout per processo opzionale",
+		NewMap:          newStreamingMap,
+		SplitMap:        true,
+		NewStreamReduce: newStreamingReduce,
+		// Il mapper è un comando esterno: eseguirlo sul master per campionare l'input
+		// richiederebbe gli script del job e un processo per ogni porzione
+		NoSampling: true,
+	})
+}
+
+// streamingCommand è un comando esterno di un job streaming
+type streamingCommand struct {
+	role    string // "mapper" o "reducer", anche nome del parametro del job
+	command string
+	timeout time.Duration
+	dir     string
+}
+
+// newStreamingCommand legge dai parametri del job il comando del ruolo indicato
+func newStreamingCommand(ctx AppContext, role string) (streamingCommand, error) {
+	c := streamingCommand{role: role, command: strings.TrimSpace(ctx.Params[role]), timeout: StreamingTimeout}
+	if c.command == "" {
+		return c, fmt.Errorf("parametro %s mancante", role)
+	}
+	if value := ctx.Params["timeout"]; value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return c, fmt.Errorf("timeout non valido: %q", value)
+		}
+		c.timeout = timeout
+	}
+	for _, path := range ctx.CacheFiles {
+		c.dir = filepath.Dir(path)
+		break
+	}
+	return c, nil
+}
+
+// cmd prepara il processo del comando, terminato alla scadenza di ctx
+func (c streamingCommand) cmd(ctx context.Context, env ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "sh", "-c", c.command)
+	cmd.Dir = c.dir
+	cmd.Env = append(os.Environ(), env...)
+	return cmd
+}
+
+// exitError descrive la terminazione anomala del processo, con l'ultima riga di stderr
+func (c streamingCommand) exitError(ctx context.Context, err error, stderr *stderrLog) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%s %q: timeout dopo %v", c.role, c.command, c.timeout)
+	}
+	if last := stderr.Last(); last != "" {
+		return fmt.Errorf("%s %q terminato con errore: %v (stderr: %s)", c.role, c.command, err, last)
+	}
+	return fmt.Errorf("%s %q terminato con errore: %v", c.role, c.command, err)
+}
+
+// newStreamingMap esegue il mapper una volta per split
+func newStreamingMap(ctx AppContext) (MapFunc, error) {
+	c, err := newStreamingCommand(ctx, "mapper")
+	if err != nil {
+		return nil, err
+	}
+	return func(filename string, contents string) []KeyValue {
+		procCtx, cancel := context.WithTimeout(context.Background(), c.timeout)
+		defer cancel()
+
+		cmd := c.cmd(procCtx, "MR_INPUT_FILE="+filename)
+		var stdout bytes.Buffer
+		stderr := newStderrLog(c.role)
+		cmd.Stdin = strings.NewReader(contents)
+		cmd.Stdout = &stdout
+		cmd.Stderr = stderr
+		err := cmd.Run()
+		stderr.Flush()
+		if err != nil {
+			ctx.Fail(c.exitError(procCtx, err, stderr))
+			return nil
+		}
+
+		kva := []KeyValue{}
+		for _, line := range strings.Split(stdout.String(), "\n") {
+			if line = strings.TrimRight(line, "\r"); line == "" {
+				continue
+			}
+			key, value, _ := strings.Cut(line, "\t")
+			kva = append(kva, KeyValue{Key: key, Value: value})
+		}
+		return kva
+	}, nil
+}
+
+// newStreamingReduce valida il reducer; il processo viene avviato una volta per reduce task
+func newStreamingReduce(ctx AppContext) (StreamReduceFunc, error) {
+	c, err := newStreamingCommand(ctx, "reducer")
+	if err != nil {
+		return nil, err
+	}
+	return func(out OutputWriter) (StreamReducer, error) {
+		return startStreamingReducer(c, out)
+	}, nil
+}
+
+// streamingReducer passa le coppie del reduce allo stdin del processo e scrive il suo
+// stdout nell'output del task: ogni riga è una coppia chiave<TAB>valore (una riga senza
+// tabulazione è una chiave con valore vuoto) scritta nel formato di output del job
+type streamingReducer struct {
+	c      streamingCommand
+	ctx    context.Context
+	cancel context.CancelFunc
+	cmd    *exec.Cmd
+	pipe   io.WriteCloser
+	stdin  *bufio.Writer
+	stderr *stderrLog
+	copied chan streamCopyResult
+	done   bool
+}
+
+type streamCopyResult struct {
+	records int64
+	err     error
+}
+
+func startStreamingReducer(c streamingCommand, out OutputWriter) (*streamingReducer, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	r := &streamingReducer{c: c, ctx: ctx, cancel: cancel, cmd: c.cmd(ctx), stderr: newStderrLog(c.role),
+		copied: make(chan streamCopyResult, 1)}
+	r.cmd.Stderr = r.stderr
+	pipe, err := r.cmd.StdinPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	stdout, err := r.cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if err := r.cmd.Start(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("avvio %s %q: %v", c.role, c.command, err)
+	}
+	r.pipe = pipe
+	r.stdin = bufio.NewWriter(pipe)
+	go r.copyOutput(stdout, out)
+	return r, nil
+}
+
+// copyOutput copia lo stdout del processo nell'output del task contando le righe
+func (r *streamingReducer) copyOutput(stdout io.Reader, out OutputWriter) {
+	var result streamCopyResult
+	reader := bufio.NewReader(stdout)
+	for {
+		line, err := reader.ReadString('\n')
+		if line = strings.TrimRight(line, "\r\n"); line != "" && result.err == nil {
+			key, value, _ := strings.Cut(line, "\t")
+			if werr := out.Write(key, value); werr != nil {
+				// Continua a leggere per non bloccare il processo
+				result.err = werr
+			}
+			result.records++
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			result.err = err
+			break
+		}
+	}
+	r.copied <- result
+}
+
+// Reduce scrive una riga chiave<TAB>valore per ogni valore della chiave
+func (r *streamingReducer) Reduce(key string, values []string) error {
+	for _, value := range values {
+		r.stdin.WriteString(key)
+		r.stdin.WriteByte('\t')
+		r.stdin.WriteString(value)
+		if err := r.stdin.WriteByte('\n'); err != nil {
+			// Il processo ha chiuso lo stdin: l'errore utile è quello della sua uscita
+			if _, exitErr := r.wait(); exitErr != nil {
+				return exitErr
+			}
+			return fmt.Errorf("scrittura verso %s: %v", r.c.role, err)
+		}
+	}
+	return nil
+}
+
+// Close chiude lo stdin del processo e ne attende la fine
+func (r *streamingReducer) Close() (int64, error) {
+	if err := r.stdin.Flush(); err != nil {
+		if _, exitErr := r.wait(); exitErr != nil {
+			return 0, exitErr
+		}
+		return 0, fmt.Errorf("scrittura verso %s: %v", r.c.role, err)
+	}
+	return r.wait()
+}
+
+// Abort termina il processo senza attenderne l'output
+func (r *streamingReducer) Abort() {
+	r.cancel()
+	r.wait()
+}
+
+// wait chiude lo stdin, attende la copia dell'output e la fine del processo
+func (r *streamingReducer) wait() (int64, error) {
+	if r.done {
+		return 0, fmt.Errorf("%s già terminato", r.c.role)
+	}
+	r.done = true
+	defer r.cancel()
+	r.pipe.Close()
+	result := <-r.copied
+	err := r.cmd.Wait()
+	r.stderr.Flush()
+	if err != nil {
+		return 0, r.c.exitError(r.ctx, err, r.stderr)
+	}
+	if result.err != nil {
+		return 0, fmt.Errorf("errore output %s: %v", r.c.role, result.err)
+	}
+	return result.records, nil
+}
+
+// stderrLog scrive nel log del worker lo stderr di un processo, una riga alla volta,
+// e ricorda l'ultima riga per il messaggio di errore del task
+type stderrLog struct {
+	mu      sync.Mutex
+	role    string
+	partial []byte
+	last    string
+}
+
+func newStderrLog(role string) *stderrLog {
+	return &stderrLog{role: role}
+}
+
+func (l *stderrLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.partial = append(l.partial, p...)
+	for {
+		i := bytes.IndexByte(l.partial, '\n')
+		if i < 0 {
+			break
+		}
+		l.logLine(string(l.partial[:i]))
+		l.partial = l.partial[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush registra l'eventuale ultima riga senza a capo
+func (l *stderrLog) Flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.partial) > 0 {
+		l.logLine(string(l.partial))
+		l.partial = nil
+	}
+}
+
+func (l *stderrLog) logLine(line string) {
+	if line = strings.TrimRight(line, "\r"); line == "" {
+		return
+	}
+	l.last = line
+	LogWarn("[streaming %s] %s", l.role, line)
+}
+
+// Last restituisce l'ultima riga scritta su stderr
+func (l *stderrLog) Last() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.last
+}
@@ -0,0 +1,58 @@
+package main
+
+import "testing"
+
+// TestAppRegistry verifica la risoluzione delle applicazioni e la validazione dei parametri
+func TestAppRegistry(t *testing.T) {
+	if _, _, err := BuildAppFuncs("", nil); err != nil {
+		t.Fatalf("l'applicazione di default deve essere risolta: %v", err)
+	}
+	if _, _, err := BuildAppFuncs("sconosciuta", nil); err == nil {
+		t.Fatalf("un'applicazione non registrata deve restituire errore")
+	}
+	if _, _, err := BuildAppFuncs("grep", nil); err == nil {
+		t.Fatalf("grep senza pattern deve restituire errore")
+	}
+
+	mapf, reducef, err := BuildAppFuncs("grep", map[string]string{"pattern": "^err", "ignore_case": "true"})
+	if err != nil {
+		t.Fatalf("grep: %v", err)
+	}
+	kva := mapf("log.txt", "ERR disco\nok\nerr rete")
+	if len(kva) != 2 || kva[0].Key != "ERR disco" {
+		t.Fatalf("grep map inatteso: %v", kva)
+	}
+	if got := reducef("ERR disco", []string{"1", "1"}); got != "2" {
+		t.Fatalf("grep reduce inatteso: %s", got)
+	}
+
+	_, reducef, err = BuildAppFuncs("invertedindex", nil)
+	if err != nil {
+		t.Fatalf("invertedindex: %v", err)
+	}
+	if got := reducef("ciao", []string{"b.txt", "a.txt", "b.txt"}); got != "2 a.txt,b.txt" {
+		t.Fatalf("invertedindex reduce inatteso: %s", got)
+	}
+}
+
+// TestCombinerPreservesCounts verifica che il combiner riduca le coppie
+// senza cambiare il risultato del reduce
+func TestCombinerPreservesCounts(t *testing.T) {
+	combinef, err := BuildAppCombiner("wordcount", nil)
+	if err != nil || combinef == nil {
+		t.Fatalf("wordcount deve avere un combiner: %v", err)
+	}
+
+	kva := Map("a.txt", "ciao mondo ciao ciao")
+	combined := combineKeyValues(kva, combinef)
+	if len(kva) != 4 || len(combined) != 2 {
+		t.Fatalf("combiner inatteso: %d -> %d coppie (%v)", len(kva), len(combined), combined)
+	}
+	if combined[0].Key != "ciao" || Reduce("ciao", []string{combined[0].Value, "1"}) != "4" {
+		t.Fatalf("conteggio dopo il combiner errato: %v", combined)
+	}
+
+	if combinef, _ := BuildAppCombiner("invertedindex", nil); combinef != nil {
+		t.Fatalf("invertedindex non deve avere un combiner")
+	}
+}
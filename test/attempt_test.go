@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestMapAttemptFilesPromotion verifica che un map task scriva solo file del tentativo,
+// che la promozione produca i nomi definitivi e che i file di uno straggler vengano rimossi
+func TestMapAttemptFilesPromotion(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMP_PATH", dir)
+	input := filepath.Join(dir, "input.txt")
+	if err := os.WriteFile(input, []byte("alfa beta gamma delta alfa\n"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	run := func(attempt int) *Task {
+		task := &Task{Type: MapTask, JobID: "job-a", TaskID: 0, Input: input, NReduce: 2, Attempt: attempt}
+		task.AttemptID = newAttemptID(task.Type, task.TaskID, attempt)
+		if _, err := executeMapTask(task, Map, nil); err != nil {
+			t.Fatalf("executeMapTask: %v", err)
+		}
+		return task
+	}
+	first, second := run(1), run(2)
+	if first.AttemptID == second.AttemptID {
+		t.Fatalf("ID dei tentativi non univoci: %s", first.AttemptID)
+	}
+
+	files := taskOutputFiles("job-a", MapTask, 0, 2, "")
+	for _, name := range files {
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Fatalf("il file definitivo %s non deve esistere prima del commit", name)
+		}
+	}
+
+	// Il primo tentativo vince, il secondo viene scartato
+	if err := promoteAttemptFiles(files, first.AttemptID); err != nil {
+		t.Fatalf("promoteAttemptFiles: %v", err)
+	}
+	removeAttemptFiles(files, second.AttemptID)
+
+	for _, name := range files {
+		if _, err := os.Stat(name); err != nil {
+			t.Fatalf("file definitivo %s mancante dopo la promozione: %v", name, err)
+		}
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(dir, "*"+attemptMarker+"*"))
+	if len(leftovers) != 0 {
+		t.Fatalf("file dei tentativi non rimossi: %v", leftovers)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// startMasterRPC espone il master via RPC su una porta locale e ne restituisce l'indirizzo
+func startMasterRPC(t *testing.T, m *Master) string {
+	t.Helper()
+	server := rpc.NewServer()
+	if err := server.RegisterName("Master", m); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go http.Serve(l, server)
+	return l.Addr().String()
+}
+
+// TestJobCacheFiles verifica pubblicazione, download verificato e uso dei file accessori
+// da parte della map di wordcount, oltre al rifiuto di un file modificato dopo la pubblicazione
+func TestJobCacheFiles(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMP_PATH", filepath.Join(dir, "tmp"))
+	source := filepath.Join(dir, "stop.txt")
+	if err := os.WriteFile(source, []byte("the\nand\n"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	files, err := publishCacheFiles([]string{source, "s3://bucket/liste/paesi.csv"})
+	if err != nil {
+		t.Fatalf("publishCacheFiles: %v", err)
+	}
+	if len(files) != 2 || files[0].Name != "stop.txt" || files[0].Checksum == nil || files[1].Name != "paesi.csv" {
+		t.Fatalf("file pubblicati inattesi: %+v", files)
+	}
+	if _, err := publishCacheFiles([]string{source, source}); err == nil {
+		t.Fatalf("atteso errore per nomi duplicati")
+	}
+	if _, err := publishCacheFiles([]string{"s3://bucket"}); err == nil {
+		t.Fatalf("atteso errore per URI S3 senza chiave")
+	}
+
+	m := &Master{}
+	applySubmit(t, m, &JobSpec{JobID: "job-s", InputFiles: []string{"a.txt"}, NReduce: 1, CacheFiles: files[:1]})
+	addr := startMasterRPC(t, m)
+
+	task := m.jobs["job-s"].newMapTask(0)
+	task.App = "wordcount"
+	task.AppParams = map[string]string{"stopwords": "stop.txt"}
+	cached, release, err := prepareJobCache(addr, task)
+	if err != nil {
+		t.Fatalf("prepareJobCache: %v", err)
+	}
+
+	counters := newUserCounters()
+	funcs, err := resolveTaskFuncs(task, AppContext{Counters: counters, CacheFiles: cached}, nil, nil)
+	if err != nil {
+		t.Fatalf("resolveTaskFuncs: %v", err)
+	}
+	var keys []string
+	for _, kv := range funcs.RecordMap(Record{File: "testo.txt", Value: "the cat and the dog"}) {
+		keys = append(keys, kv.Key)
+	}
+	if strings.Join(keys, " ") != "cat dog" {
+		t.Fatalf("stop-word non filtrate: %v", keys)
+	}
+	if skipped := counters.Snapshot()["wordcount_stopwords_skipped"]; skipped != 3 {
+		t.Fatalf("stop-word scartate: %d, attese 3", skipped)
+	}
+
+	// Un parametro stopwords che non nomina un file del job viene rifiutato alla sottomissione
+	// e, in un task, fa fallire la costruzione della map invece di non filtrare nulla
+	app, _ := LookupApp("wordcount")
+	if err := app.validateCacheParams(map[string]string{"stopwords": "altro.txt"}, files[:1]); err == nil {
+		t.Fatalf("atteso errore per stopwords non pubblicato con il job")
+	}
+	if err := app.validateCacheParams(map[string]string{"stopwords": "stop.txt"}, files[:1]); err != nil {
+		t.Fatalf("stopwords pubblicato rifiutato: %v", err)
+	}
+	if _, err := resolveTaskFuncs(task, AppContext{Counters: newUserCounters()}, nil, nil); err == nil {
+		t.Fatalf("atteso errore per stopwords assente dalla cache del task")
+	}
+
+	// Un file modificato dopo la pubblicazione non supera la verifica del checksum
+	if err := os.WriteFile(source, []byte("the\nor\n"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	applySubmit(t, m, &JobSpec{JobID: "job-t", InputFiles: []string{"a.txt"}, NReduce: 1, CacheFiles: files[:1]})
+	if _, _, err := prepareJobCache(addr, m.jobs["job-t"].newMapTask(0)); err == nil {
+		t.Fatalf("atteso errore per un file di cache corrotto")
+	}
+
+	release()
+	removeJobCache("job-s")
+	if _, err := os.Stat(jobCacheDir("job-s")); !os.IsNotExist(err) {
+		t.Fatalf("cache del job non rimossa: %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestMapOutputChecksums verifica che i checksum registrati dal map rilevino un intermedio
+// troncato ma ancora decodificabile, sia al commit sia nel reduce che lo legge
+func TestMapOutputChecksums(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMP_PATH", dir)
+	input := filepath.Join(dir, "input.txt")
+	if err := os.WriteFile(input, []byte("alfa beta gamma delta alfa beta\n"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	m := &Master{}
+	applySubmit(t, m, &JobSpec{JobID: "job-a", InputFiles: []string{input}, NReduce: 2})
+	job := m.jobs["job-a"]
+
+	task := &Task{Type: MapTask, JobID: "job-a", TaskID: 0, Input: input, NReduce: 2, AttemptID: "m0-1-x"}
+	result, err := executeMapTask(task, Map, nil)
+	if err != nil {
+		t.Fatalf("executeMapTask: %v", err)
+	}
+	if len(result.Files) != 2 {
+		t.Fatalf("attesi checksum per 2 partizioni, trovati %+v", result.Files)
+	}
+	if !m.validateMapAttemptOutput(job, 0, task.AttemptID, result.Files) {
+		t.Fatalf("output integro rifiutato")
+	}
+
+	// Riscrive una partizione con un record in meno: il file è valido ma non corrisponde
+	var partition int
+	for _, f := range result.Files {
+		if f.Records > 1 {
+			partition = f.Partition
+		}
+	}
+	name := attemptFileName(getIntermediateFileName("job-a", 0, partition), task.AttemptID)
+	if err := writeKeyValuesToFile(name, []KeyValue{{"alfa", "1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if m.validateMapAttemptOutput(job, 0, task.AttemptID, result.Files) {
+		t.Fatalf("intermedio troncato accettato al commit")
+	}
+
+	checksum, _ := findFileChecksum(result.Files, partition)
+	reduce := &Task{Type: ReduceTask, JobID: "job-a", TaskID: partition, NMap: 1, AttemptID: "r-1-y",
+		MapOutputs: []MapOutput{{TaskID: 0, AttemptID: task.AttemptID, Checksum: &checksum}}}
+	if err := promoteAttemptFiles(taskOutputFiles("job-a", MapTask, 0, 2, ""), task.AttemptID); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = gatherReduceInputs(reduce)
+	var lost *mapOutputLostError
+	if !errors.As(err, &lost) || len(lost.Lost) != 1 {
+		t.Fatalf("il reduce deve segnalare l'intermedio non corrispondente, ottenuto %v", err)
+	}
+}
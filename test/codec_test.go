@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestIntermediateCodecRoundTrip verifica scrittura e lettura dei file intermedi con ogni
+// codec e che la validazione rilevi un payload corrotto tramite checksum
+func TestIntermediateCodecRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	kvs := []KeyValue{{"a", "1"}, {"b", ""}, {"città", "multi\nriga"}}
+
+	for _, codec := range []string{CodecJSON, CodecBinary, CodecGzip} {
+		path := filepath.Join(dir, "kv-"+codec)
+		w, err := createKVFile(path, codec)
+		if err != nil {
+			t.Fatalf("%s: create: %v", codec, err)
+		}
+		for _, kv := range kvs {
+			if err := w.Write(kv); err != nil {
+				t.Fatalf("%s: write: %v", codec, err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("%s: close: %v", codec, err)
+		}
+
+		if n, err := validateKVFile(path); err != nil || n != int64(len(kvs)) {
+			t.Fatalf("%s: validazione: %d record, %v", codec, n, err)
+		}
+		r, err := openKVFile(path)
+		if err != nil {
+			t.Fatalf("%s: open: %v", codec, err)
+		}
+		var got []KeyValue
+		for {
+			kv, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: read: %v", codec, err)
+			}
+			got = append(got, kv)
+		}
+		r.Close()
+		if len(got) != len(kvs) || got[2] != kvs[2] {
+			t.Fatalf("%s: letti %v, attesi %v", codec, got, kvs)
+		}
+	}
+
+	// Un byte alterato nel payload invalida il checksum
+	path := filepath.Join(dir, "kv-"+CodecBinary)
+	data, _ := os.ReadFile(path)
+	data[len(data)-1] ^= 0xff
+	_ = os.WriteFile(path, data, 0644)
+	if _, err := validateKVFile(path); err == nil {
+		t.Fatalf("payload corrotto non rilevato")
+	}
+
+	// Una partizione vuota ha comunque header e checksum validi
+	empty := filepath.Join(dir, "empty")
+	if err := writeKeyValuesToFile(empty, nil); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := validateKVFile(empty); err != nil || n != 0 {
+		t.Fatalf("partizione vuota: %d record, %v", n, err)
+	}
+}
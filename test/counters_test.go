@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hashicorp/raft"
+)
+
+// TestUserCountersAggregatedFromWinningAttempt verifica che i contatori incrementati
+// dalle funzioni dell'applicazione vengano sommati nel job solo per il tentativo promosso
+func TestUserCountersAggregatedFromWinningAttempt(t *testing.T) {
+	t.Setenv("TMP_PATH", t.TempDir())
+
+	// La map di grep conta le righe esaminate e quelle scartate
+	task := &Task{Type: MapTask, App: "grep", AppParams: map[string]string{"pattern": "^err"}}
+	counters := newUserCounters()
+	funcs, err := resolveTaskFuncs(task, AppContext{Counters: counters}, nil, nil)
+	if err != nil {
+		t.Fatalf("resolveTaskFuncs: %v", err)
+	}
+	funcs.RecordMap(Record{File: "log.txt", Value: "err disco\nok\nerr rete\nok\n"})
+	user := counters.Snapshot()
+	if user["grep_lines_scanned"] != 4 || user["grep_lines_skipped"] != 2 {
+		t.Fatalf("contatori della map inattesi: %v", user)
+	}
+
+	m := &Master{}
+	applySubmit(t, m, &JobSpec{JobID: "job-c", InputFiles: []string{"a.txt"}, NReduce: 1})
+	complete := func(op, attemptID string, user map[string]int64) {
+		t.Helper()
+		data, err := json.Marshal(LogCommand{Operation: op, JobID: "job-c", TaskID: 0, AttemptID: attemptID,
+			Counters: &TaskCounters{User: user}})
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		m.Apply(&raft.Log{Data: data})
+	}
+
+	// Il completamento di un backup superato viene ignorato
+	complete("complete-map", "m0-a1", user)
+	complete("complete-map", "m0-a2", map[string]int64{"grep_lines_scanned": 100})
+	complete("complete-reduce", "r0-a1", map[string]int64{"reduce_keys": 2})
+
+	details, ok := m.GetJobDetails("job-c")
+	if !ok {
+		t.Fatalf("job-c non trovato")
+	}
+	want := map[string]int64{"grep_lines_scanned": 4, "grep_lines_skipped": 2, "reduce_keys": 2}
+	if len(details.Counters.User) != len(want) {
+		t.Fatalf("contatori del job inattesi: %v", details.Counters.User)
+	}
+	for name, value := range want {
+		if details.Counters.User[name] != value {
+			t.Errorf("contatore %s = %d, atteso %d", name, details.Counters.User[name], value)
+		}
+	}
+
+	// Un nil UserCounters (funzioni costruite sul master) ignora gli incrementi
+	var none *UserCounters
+	none.Inc("ignorato", 1)
+	if none.Snapshot() != nil {
+		t.Fatalf("un UserCounters nil non deve avere contatori")
+	}
+}
+
+// TestResetCompletedTaskKeepsCounterTotals verifica che un task Completed riportato Idle
+// dai comandi replicati lost-map e lost-reduce sottragga i propri contatori, così che il
+// nuovo commit non li conti due volte
+func TestResetCompletedTaskKeepsCounterTotals(t *testing.T) {
+	t.Setenv("TMP_PATH", t.TempDir())
+
+	m := &Master{}
+	applySubmit(t, m, &JobSpec{JobID: "job-r", InputFiles: []string{"a.txt"}, NReduce: 2})
+	apply := func(cmd LogCommand) {
+		t.Helper()
+		cmd.JobID = "job-r"
+		data, err := json.Marshal(cmd)
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		m.Apply(&raft.Log{Data: data})
+	}
+	mapCounters := TaskCounters{InputRecords: 5, User: map[string]int64{"righe": 5}}
+	reduceCounters := TaskCounters{User: map[string]int64{"chiavi": 2}}
+	lostMap := func(attemptID string) LogCommand {
+		return LogCommand{Operation: "lost-map", TaskID: -1, Lost: []MapOutput{{TaskID: 0, AttemptID: attemptID}}}
+	}
+
+	apply(LogCommand{Operation: "complete-map", TaskID: 0, AttemptID: "m0-a1", Counters: &mapCounters})
+	apply(lostMap("m0-a1"))
+	job := m.jobs["job-r"]
+	if job.MapTasks[0].State != Idle || job.MapTasksDone != 0 || job.Phase != MapPhase {
+		t.Fatalf("map non resettato: stato %v, completati %d, fase %v", job.MapTasks[0].State, job.MapTasksDone, job.Phase)
+	}
+	apply(LogCommand{Operation: "complete-map", TaskID: 0, AttemptID: "m0-a2", Counters: &mapCounters})
+
+	apply(LogCommand{Operation: "complete-reduce", TaskID: 0, AttemptID: "r0-a1", Counters: &reduceCounters})
+	apply(LogCommand{Operation: "lost-reduce", TaskID: 0, AttemptID: "r0-a1"})
+	if job.ReduceTasks[0].State != Idle || job.ReduceTasksDone != 0 {
+		t.Fatalf("reduce non resettato: stato %v, completati %d", job.ReduceTasks[0].State, job.ReduceTasksDone)
+	}
+	apply(LogCommand{Operation: "complete-reduce", TaskID: 0, AttemptID: "r0-a2", Counters: &reduceCounters})
+	// Un reset riferito a un tentativo superato viene ignorato
+	apply(LogCommand{Operation: "lost-reduce", TaskID: 0, AttemptID: "r0-a1"})
+	apply(lostMap("m0-a1"))
+
+	if job.MapTasksDone != 1 || job.ReduceTasksDone != 1 || job.ReduceTasks[0].Committed != "r0-a2" {
+		t.Fatalf("task completati inattesi: map %d, reduce %d (%q)", job.MapTasksDone, job.ReduceTasksDone, job.ReduceTasks[0].Committed)
+	}
+	if job.Counters.InputRecords != 5 || job.Counters.User["righe"] != 5 || job.Counters.User["chiavi"] != 2 {
+		t.Fatalf("contatori del job inattesi dopo il reset: %+v", job.Counters)
+	}
+}
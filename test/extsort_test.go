@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestPrepareSortedRunsSpillsUnsortedInput verifica che un intermedio non ordinato venga
+// ordinato su spill entro il budget e che il merge restituisca le chiavi in ordine
+func TestPrepareSortedRunsSpillsUnsortedInput(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, kvs []KeyValue) string {
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatalf("create %s: %v", path, err)
+		}
+		enc := json.NewEncoder(f)
+		for _, kv := range kvs {
+			_ = enc.Encode(kv)
+		}
+		_ = f.Close()
+		return path
+	}
+
+	sorted := write("sorted", []KeyValue{{"a", "1"}, {"c", "1"}, {"e", "1"}})
+	unsorted := write("unsorted", []KeyValue{{"d", "1"}, {"a", "1"}, {"f", "1"}, {"b", "1"}, {"c", "1"}})
+
+	// Budget minimo: ogni coppia finisce in uno spill separato
+	runs, spills, err := prepareSortedRuns([]string{sorted, unsorted}, 1, filepath.Join(dir, "spill-"))
+	if err != nil {
+		t.Fatalf("prepareSortedRuns: %v", err)
+	}
+	if len(spills) == 0 || runs[0] != sorted {
+		t.Fatalf("atteso run ordinato riusato e spill per il non ordinato: runs=%v spills=%v", runs, spills)
+	}
+
+	merger, err := newKVMerger(runs)
+	if err != nil {
+		t.Fatalf("newKVMerger: %v", err)
+	}
+	defer merger.Close()
+
+	var keys []string
+	counts := map[string]int{}
+	for {
+		key, values, ok, err := merger.Next()
+		if err != nil {
+			t.Fatalf("merge: %v", err)
+		}
+		if !ok {
+			break
+		}
+		keys = append(keys, key)
+		counts[key] = len(values)
+	}
+	want := []string{"a", "b", "c", "d", "e", "f"}
+	if len(keys) != len(want) {
+		t.Fatalf("chiavi attese %v, trovate %v", want, keys)
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Fatalf("chiavi attese %v, trovate %v", want, keys)
+		}
+	}
+	if counts["a"] != 2 || counts["c"] != 2 || counts["b"] != 1 {
+		t.Fatalf("valori raggruppati errati: %v", counts)
+	}
+}
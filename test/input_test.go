@@ -0,0 +1,139 @@
+package main
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readAllRecords legge i record di tutti gli split con il formato indicato, contando i malformati
+func readAllRecords(t *testing.T, format InputFormat, splits []InputSplit) ([]Record, int) {
+	t.Helper()
+	var records []Record
+	malformed := 0
+	for _, split := range splits {
+		reader, err := format.Open(split)
+		if err != nil {
+			t.Fatalf("Open %s: %v", split, err)
+		}
+		for {
+			rec, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			var bad *MalformedRecordError
+			if errors.As(err, &bad) {
+				malformed++
+				continue
+			}
+			if err != nil {
+				t.Fatalf("Next %s: %v", split, err)
+			}
+			records = append(records, rec)
+		}
+		reader.Close()
+	}
+	return records, malformed
+}
+
+// TestCSVInputAcrossSplits verifica che ogni split di un CSV usi l'intestazione del file,
+// che gli offset dei record puntino all'inizio della riga e che le righe con un numero di
+// campi diverso dall'intestazione vengano scartate e contate dal map task
+func TestCSVInputAcrossSplits(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMP_PATH", dir)
+	cities := []string{"Roma", "Milano", "Torino"}
+	var b strings.Builder
+	b.WriteString("città,importo\n")
+	for i := 0; i < 90; i++ {
+		fmt.Fprintf(&b, "%s,%d\n", cities[i%3], i)
+	}
+	b.WriteString("riga,con,troppi,campi\n")
+	path := filepath.Join(dir, "vendite.csv")
+	data := []byte(b.String())
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	splits, err := computeInputSplits([]string{path}, 256)
+	if err != nil || len(splits) < 3 {
+		t.Fatalf("attesi più split: %v %v", splits, err)
+	}
+	format, err := LookupInputFormat(detectInputFormat([]string{path}))
+	if err != nil || format.Name() != InputFormatCSV {
+		t.Fatalf("formato dedotto inatteso: %v %v", format, err)
+	}
+	records, malformed := readAllRecords(t, format, splits)
+	if len(records) != 90 || malformed != 1 {
+		t.Fatalf("attesi 90 record e 1 malformato, ottenuti %d e %d", len(records), malformed)
+	}
+	for i, rec := range records {
+		if rec.Fields["città"] != cities[i%3] || rec.Fields["importo"] != fmt.Sprint(i) {
+			t.Fatalf("record %d con campi inattesi: %v", i, rec.Fields)
+		}
+		line := rec.Fields["città"] + "," + rec.Fields["importo"] + "\n"
+		if !strings.HasPrefix(string(data[rec.Offset:]), line) {
+			t.Fatalf("offset %d del record %d non punta alla riga %q", rec.Offset, i, line)
+		}
+	}
+
+	// Il map task dell'ultimo split conta i record letti e quello scartato
+	last := splits[len(splits)-1]
+	task := &Task{Type: MapTask, JobID: "job-csv", TaskID: len(splits) - 1, Input: last.File, Offset: last.Offset,
+		Length: last.Length, NReduce: 1, App: "fieldcount", AppParams: map[string]string{"field": "città"}, InputFormat: InputFormatCSV}
+	funcs, err := resolveTaskFuncs(task, AppContext{}, nil, nil)
+	if err != nil {
+		t.Fatalf("resolveTaskFuncs: %v", err)
+	}
+	result, err := executeTask(task, funcs)
+	if err != nil {
+		t.Fatalf("executeTask: %v", err)
+	}
+	if result.Counters.MalformedRecords != 1 || result.Counters.InputRecords == 0 ||
+		result.Counters.RecordsBeforeCombine != result.Counters.InputRecords {
+		t.Fatalf("contatori inattesi: %+v", result.Counters)
+	}
+}
+
+// TestCompressedJSONLInput verifica che un file .jsonl.gz resti un unico split, venga
+// decompresso in lettura e che gli offset si riferiscano al contenuto decompresso
+func TestCompressedJSONLInput(t *testing.T) {
+	dir := t.TempDir()
+	content := "{\"utente\":\"anna\",\"eta\":31}\n\n{non json}\n{\"utente\":\"bruno\",\"tag\":[\"a\"]}\n"
+	path := filepath.Join(dir, "eventi.jsonl.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	gz := gzip.NewWriter(f)
+	gz.Write([]byte(content))
+	gz.Close()
+	f.Close()
+
+	if !isInputFileName("eventi.jsonl.gz") || isInputFileName("eventi.gz") {
+		t.Fatalf("riconoscimento delle estensioni di input errato")
+	}
+	splits, err := computeInputSplits([]string{path}, 8)
+	if err != nil || len(splits) != 1 || splits[0].Length != 0 {
+		t.Fatalf("un file compresso deve restare un unico split: %v %v", splits, err)
+	}
+	if detectInputFormat([]string{path}) != InputFormatJSONL || detectInputFormat([]string{path, "a.csv"}) != InputFormatLines {
+		t.Fatalf("formato dedotto inatteso")
+	}
+
+	records, malformed := readAllRecords(t, jsonlFormat{}, splits)
+	if len(records) != 2 || malformed != 1 {
+		t.Fatalf("attesi 2 record e 1 malformato, ottenuti %d e %d", len(records), malformed)
+	}
+	if records[0].Fields["utente"] != "anna" || records[0].Fields["eta"] != "31" || records[1].Fields["tag"] != `["a"]` {
+		t.Fatalf("campi inattesi: %v %v", records[0].Fields, records[1].Fields)
+	}
+	if want := int64(strings.Index(content, "{\"utente\":\"bruno\"")); records[1].Offset != want {
+		t.Fatalf("offset del secondo record: %d, atteso %d", records[1].Offset, want)
+	}
+}
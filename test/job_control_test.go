@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/rpc"
+	"testing"
+
+	"github.com/hashicorp/raft"
+)
+
+// applyJobCommand applica un comando di controllo del job all'FSM del master
+func applyJobCommand(t *testing.T, m *Master, operation, jobID string) {
+	t.Helper()
+	data, err := json.Marshal(LogCommand{Operation: operation, JobID: jobID})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	m.Apply(&raft.Log{Data: data})
+}
+
+// TestPauseResumeCancelJob verifica pausa, ripresa e cancellazione di un job, il
+// passaggio al job successivo in coda durante la pausa e dopo la cancellazione
+func TestPauseResumeCancelJob(t *testing.T) {
+	t.Setenv("TMP_PATH", t.TempDir())
+
+	m := &Master{}
+	applySubmit(t, m, &JobSpec{JobID: "job-a", InputFiles: []string{"a.txt", "b.txt"}, NReduce: 1})
+	applySubmit(t, m, &JobSpec{JobID: "job-b", InputFiles: []string{"c.txt"}, NReduce: 1})
+
+	jobA, jobB := m.jobs["job-a"], m.jobs["job-b"]
+	jobA.MapTasks[0].State = InProgress
+
+	applyJobCommand(t, m, "pause-job", "job-a")
+	if !jobA.IsPaused() || jobA.MapTasks[0].State != Idle {
+		t.Fatalf("pausa non applicata: status=%v task=%v", jobA.Status, jobA.MapTasks[0].State)
+	}
+	if m.activeJob() != jobB || !jobB.Started {
+		t.Fatalf("un job in pausa non deve bloccare i job successivi: attivo %+v", m.activeJob())
+	}
+
+	// Il commit di un tentativo avviato prima della pausa viene scartato
+	data, err := json.Marshal(LogCommand{Operation: "complete-map", JobID: "job-a", TaskID: 0, AttemptID: "m0-1"})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	m.Apply(&raft.Log{Data: data})
+	if jobA.MapTasks[0].State != Idle || jobA.MapTasksDone != 0 {
+		t.Fatalf("commit accettato per un job in pausa: %+v", jobA.MapTasks[0])
+	}
+
+	applyJobCommand(t, m, "resume-job", "job-a")
+	if jobA.Status != JobActive {
+		t.Fatalf("ripresa non applicata: status=%v", jobA.Status)
+	}
+	if m.activeJob() != jobA {
+		t.Fatalf("il job ripreso deve tornare attivo prima dei successivi")
+	}
+
+	applyJobCommand(t, m, "cancel-job", "job-a")
+	if !jobA.IsCanceled() || !jobA.IsDone() || jobA.FinishedAt.IsZero() {
+		t.Fatalf("cancellazione non applicata: %+v", jobA)
+	}
+	if active := m.activeJob(); active == nil || active.ID != "job-b" {
+		t.Fatalf("job attivo atteso job-b, trovato %+v", active)
+	}
+
+	// I comandi su un job terminato vengono ignorati
+	applyJobCommand(t, m, "resume-job", "job-a")
+	if !jobA.IsCanceled() {
+		t.Fatalf("un job cancellato non deve essere ripreso")
+	}
+}
+
+// TestCanceledJobAbandonedAfterPrune verifica che il worker venga invitato ad abbandonare
+// i task di un job cancellato anche quando, occupando il secondo slot con il job successivo,
+// il master ha già rimosso il task cancellato da workerToTasks
+func TestCanceledJobAbandonedAfterPrune(t *testing.T) {
+	t.Setenv("TMP_PATH", t.TempDir())
+
+	m := &Master{
+		workers:       map[string]*WorkerInfo{"w1": {ID: "w1", Slots: 2}},
+		workerToTasks: make(map[string]map[TaskKey]bool),
+	}
+	applySubmit(t, m, &JobSpec{JobID: "job-a", InputFiles: []string{"a.txt"}, NReduce: 1})
+	applySubmit(t, m, &JobSpec{JobID: "job-b", InputFiles: []string{"b.txt"}, NReduce: 1})
+
+	keyA := TaskKey{JobID: "job-a", ID: 0, Type: MapTask}
+	m.jobs["job-a"].MapTasks[0].State = InProgress
+	m.workerToTasks["w1"] = map[TaskKey]bool{keyA: true}
+	applyJobCommand(t, m, "cancel-job", "job-a")
+
+	// Il worker chiede un task per il secondo slot: il task del job cancellato viene rilasciato
+	if !m.workerHasFreeSlot("w1", 2) || m.workerToTasks["w1"][keyA] {
+		t.Fatalf("atteso lo slot del job cancellato rilasciato: %v", m.workerToTasks["w1"])
+	}
+	keyB := TaskKey{JobID: "job-b", ID: 0, Type: MapTask}
+	m.jobs["job-b"].MapTasks[0].State = InProgress
+	m.workerToTasks["w1"] = map[TaskKey]bool{keyB: true}
+
+	// L'heartbeat riporta ancora in esecuzione il task del job cancellato
+	running := []TaskProgress{
+		{JobID: "job-a", TaskID: 0, Type: MapTask},
+		{JobID: "job-b", TaskID: 0, Type: MapTask},
+	}
+	if abandon := m.workerAbandonedJobs("w1", running); len(abandon) != 1 || abandon[0] != "job-a" {
+		t.Fatalf("atteso l'abbandono del solo job-a, ottenuto %v", abandon)
+	}
+	if !m.workerToTasks["w1"][keyB] {
+		t.Fatalf("il task del job attivo deve restare in carico al worker")
+	}
+}
+
+// TestTaskFailureMaxAttempts verifica lo storico dei fallimenti di un task e il
+// fallimento del job al raggiungimento del numero massimo di tentativi
+func TestTaskFailureMaxAttempts(t *testing.T) {
+	t.Setenv("TMP_PATH", t.TempDir())
+
+	m := &Master{}
+	applySubmit(t, m, &JobSpec{JobID: "job-a", InputFiles: []string{"a.txt"}, NReduce: 1, MaxAttempts: 2})
+	applySubmit(t, m, &JobSpec{JobID: "job-b", InputFiles: []string{"b.txt"}, NReduce: 1})
+
+	fail := func(attempt int) {
+		t.Helper()
+		data, err := json.Marshal(LogCommand{Operation: "fail-map", JobID: "job-a", TaskID: 0,
+			Failure: &TaskFailure{Attempt: attempt, WorkerID: "w1", Error: "input mancante"}})
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		m.Apply(&raft.Log{Data: data})
+	}
+
+	jobA := m.jobs["job-a"]
+	jobA.MapTasks[0].State = InProgress
+	fail(1)
+	if jobA.MapTasks[0].State != Idle || len(jobA.MapTasks[0].Failures) != 1 || jobA.IsDone() {
+		t.Fatalf("primo fallimento: atteso task Idle e job attivo, trovato %+v", jobA.MapTasks[0])
+	}
+
+	fail(2)
+	if !jobA.IsFailed() || !jobA.IsDone() || jobA.Error == "" {
+		t.Fatalf("atteso job fallito dopo 2 tentativi: status=%v error=%q", jobA.Status, jobA.Error)
+	}
+	if active := m.activeJob(); active == nil || active.ID != "job-b" {
+		t.Fatalf("job attivo atteso job-b, trovato %+v", active)
+	}
+
+	details, ok := m.GetJobDetails("job-a")
+	if !ok || details.Status != "failed" || len(details.Failures) != 2 || details.Failures[1].Attempt != 2 {
+		t.Fatalf("dettagli del job inattesi: %+v", details)
+	}
+}
+
+// TestRPCErrorJobNotFound verifica che l'errore di job inesistente resti riconoscibile
+// dopo il trasporto net/rpc
+func TestRPCErrorJobNotFound(t *testing.T) {
+	m := &Master{jobs: make(map[string]*Job)}
+	err := m.GetJob(&JobControlArgs{JobID: "assente"}, &JobDetails{})
+	if !errors.Is(err, errJobNotFound) {
+		t.Fatalf("errore inatteso dal master: %v", err)
+	}
+	if err := rpcError(rpc.ServerError(err.Error())); !errors.Is(err, errJobNotFound) || err.Error() != "job non trovato: assente" {
+		t.Fatalf("sentinella persa dopo il trasporto: %v", err)
+	}
+	if err := rpcError(rpc.ServerError("job main-job già terminato")); errors.Is(err, errJobNotFound) {
+		t.Fatalf("errore classificato come job non trovato: %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestOutputFormatWriters verifica l'escape dei campi nei formati a una riga per record
+func TestOutputFormatWriters(t *testing.T) {
+	cases := map[string]string{
+		OutputFormatText:  "a\tb 1\nvuoto\n",
+		OutputFormatTSV:   "a\\tb\t1\nvuoto\t\n",
+		OutputFormatJSONL: "{\"key\":\"a\\tb\",\"value\":\"1\"}\n{\"key\":\"vuoto\",\"value\":\"\"}\n",
+		OutputFormatCSV:   "a\tb,1\nvuoto,\n",
+	}
+	for name, want := range cases {
+		format, err := LookupOutputFormat(name)
+		if err != nil {
+			t.Fatalf("LookupOutputFormat(%s): %v", name, err)
+		}
+		var buf bytes.Buffer
+		w := format.NewWriter(&buf)
+		w.Write("a\tb", "1")
+		w.Write("vuoto", "")
+		if err := w.Flush(); err != nil || buf.String() != want {
+			t.Fatalf("%s: scritto %q, atteso %q (%v)", name, buf.String(), want, err)
+		}
+	}
+	if _, err := LookupOutputFormat("xml"); err == nil {
+		t.Fatalf("atteso errore per un formato sconosciuto")
+	}
+}
+
+// TestCSVReduceOutputAndUnifiedFile esegue un job con output CSV e valori su più righe:
+// la validazione del master accetta l'output e il file unificato ha una sola intestazione
+func TestCSVReduceOutputAndUnifiedFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMP_PATH", dir)
+	input := filepath.Join(dir, "input.txt")
+	if err := os.WriteFile(input, []byte("alfa beta gamma alfa\ndelta beta alfa\n"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	m := &Master{}
+	applySubmit(t, m, &JobSpec{JobID: "job-o", InputFiles: []string{input}, NReduce: 2, OutputFormat: OutputFormatCSV})
+	job := m.jobs["job-o"]
+	if _, err := executeMapTask(&Task{Type: MapTask, JobID: "job-o", Input: input, NReduce: 2}, Map, nil); err != nil {
+		t.Fatalf("executeMapTask: %v", err)
+	}
+
+	// Il valore contiene virgole, virgolette e un a capo
+	reducef := func(key string, values []string) string {
+		return fmt.Sprintf("%d,\"volte\"\n%s", len(values), strings.ToUpper(key))
+	}
+	var total int64
+	for i := 0; i < 2; i++ {
+		task := job.newReduceTask(i, "")
+		if task.OutputFormat != OutputFormatCSV {
+			t.Fatalf("formato di output non propagato al reduce: %q", task.OutputFormat)
+		}
+		result, err := executeReduceTask(task, reducef)
+		if err != nil {
+			t.Fatalf("executeReduceTask %d: %v", i, err)
+		}
+		if !m.validateReduceAttemptOutput(job, i, "", result.Files) {
+			t.Fatalf("output CSV del reduce %d rifiutato", i)
+		}
+		job.ReduceTasks[i].Files = result.Files
+		total += result.Files[0].Records
+	}
+
+	unified := filepath.Join(dir, "final-output.csv")
+	written, err := writeUnifiedOutput(job, unified, true)
+	if err != nil || written != total || total != 4 {
+		t.Fatalf("output unificato: %d record di %d (%v)", written, total, err)
+	}
+	f, err := os.Open(unified)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatalf("CSV unificato non valido: %v", err)
+	}
+	counts := make(map[string]string)
+	for _, row := range rows[1:] {
+		counts[row[0]] = row[1]
+	}
+	if strings.Join(rows[0], ",") != "key,value" || len(rows) != 5 || counts["alfa"] != "3,\"volte\"\nALFA" {
+		t.Fatalf("righe inattese: %q", rows)
+	}
+
+	// Il banner si applica solo al formato text
+	job.OutputFormat = OutputFormatText
+	if _, err := writeUnifiedOutput(job, unified, true); err != nil {
+		t.Fatalf("writeUnifiedOutput: %v", err)
+	}
+	if data, _ := os.ReadFile(unified); !strings.HasPrefix(string(data), "=== RISULTATO FINALE MAPREDUCE ===") {
+		t.Fatalf("banner mancante nell'output text: %q", data)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// TestRangePartitionerTotalOrder verifica che i confini campionati dall'input
+// producano partizioni ordinate tra loro e ragionevolmente bilanciate
+func TestRangePartitionerTotalOrder(t *testing.T) {
+	const nReduce = 4
+	rng := rand.New(rand.NewSource(1))
+	var lines []string
+	for i := 0; i < 5000; i++ {
+		lines = append(lines, fmt.Sprintf("chiave-%06d", rng.Intn(1000000)))
+	}
+	path := filepath.Join(t.TempDir(), "input.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	splits, err := computeInputSplits([]string{path}, 8<<10)
+	if err != nil {
+		t.Fatalf("computeInputSplits: %v", err)
+	}
+
+	bounds, err := samplePartitionBounds(splits, linesFormat{}, recordMapFunc(sortMap), nReduce)
+	if err != nil {
+		t.Fatalf("samplePartitionBounds: %v", err)
+	}
+	if len(bounds) != nReduce-1 || !sort.StringsAreSorted(bounds) {
+		t.Fatalf("attesi %d confini ordinati, ottenuti %v", nReduce-1, bounds)
+	}
+
+	p, err := newTaskPartitioner(&Task{Partitioner: PartitionerRange, PartitionBounds: bounds})
+	if err != nil {
+		t.Fatalf("newTaskPartitioner: %v", err)
+	}
+	partitions := make([][]string, nReduce)
+	for _, key := range lines {
+		id := p.Partition(key, nReduce)
+		partitions[id] = append(partitions[id], key)
+	}
+
+	// La concatenazione delle partizioni ordinate deve essere ordinata
+	var concat []string
+	for id, keys := range partitions {
+		if len(keys) < len(lines)/nReduce/2 {
+			t.Errorf("partizione %d sbilanciata: %d chiavi su %d", id, len(keys), len(lines))
+		}
+		sort.Strings(keys)
+		concat = append(concat, keys...)
+	}
+	if !sort.StringsAreSorted(concat) {
+		t.Fatalf("la concatenazione delle partizioni non è ordinata")
+	}
+}
+
+// TestRangePartitionerEmptySample verifica che un campione senza chiavi sia un errore e
+// non un job con tutti i record nell'ultimo reduce
+func TestRangePartitionerEmptySample(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vuoto.txt")
+	if err := os.WriteFile(path, []byte("\n\n"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	splits, err := computeInputSplits([]string{path}, 0)
+	if err != nil {
+		t.Fatalf("computeInputSplits: %v", err)
+	}
+	if bounds, err := samplePartitionBounds(splits, linesFormat{}, recordMapFunc(sortMap), 3); err == nil {
+		t.Fatalf("atteso errore per un campione vuoto, ottenuti i confini %v", bounds)
+	}
+}
+
+// TestPartitionerSelection verifica il default hash e il rifiuto dei nomi sconosciuti
+func TestPartitionerSelection(t *testing.T) {
+	p, err := newTaskPartitioner(&Task{})
+	if err != nil {
+		t.Fatalf("newTaskPartitioner: %v", err)
+	}
+	for _, key := range []string{"a", "parola", "chiave-42"} {
+		if got, want := p.Partition(key, 7), ihash(key)%7; got != want {
+			t.Errorf("hash partitioner: chiave %q -> %d, atteso %d", key, got, want)
+		}
+	}
+
+	if _, err := LookupPartitioner("inesistente"); err == nil {
+		t.Fatalf("atteso errore per un partitioner sconosciuto")
+	}
+	if _, err := newRangePartitioner([]string{"m", "c"}); err == nil {
+		t.Fatalf("atteso errore per confini non ordinati")
+	}
+
+	// Le chiavi oltre l'ultimo confine vanno all'ultimo reduce
+	r, _ := newRangePartitioner([]string{"c", "m"})
+	for key, want := range map[string]int{"a": 0, "c": 1, "k": 1, "m": 2, "z": 2} {
+		if got := r.Partition(key, 3); got != want {
+			t.Errorf("range partitioner: chiave %q -> %d, atteso %d", key, got, want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestRecordProgressUpdatesLastActivity verifica che solo i report con avanzamento
+// rinnovino l'attività del task e che il progresso sia esposto da GetJobInfo/GetWorkers
+func TestRecordProgressUpdatesLastActivity(t *testing.T) {
+	t.Setenv("TMP_PATH", t.TempDir())
+
+	m := &Master{workers: map[string]*WorkerInfo{"w1": {ID: "w1", LastSeen: time.Now()}}}
+	applySubmit(t, m, &JobSpec{JobID: "job-a", InputFiles: []string{"a"}, NReduce: 1})
+	job := m.jobs["job-a"]
+	start := time.Now().Add(-time.Minute)
+	job.MapTasks[0] = TaskInfo{State: InProgress, StartTime: start}
+
+	report := &TaskProgress{JobID: "job-a", TaskID: 0, Type: MapTask, AttemptID: "m0-1-x", Records: 10, Percent: 20}
+	t1 := start.Add(20 * time.Second)
+	m.recordProgress("w1", report, t1)
+	if got := job.MapTasks[0].lastActivity(); !got.Equal(t1) {
+		t.Fatalf("attività attesa %v, trovata %v", t1, got)
+	}
+
+	// Un report identico non rinnova l'attività: il task è fermo
+	m.recordProgress("w1", report, t1.Add(30*time.Second))
+	if got := job.MapTasks[0].lastActivity(); !got.Equal(t1) {
+		t.Fatalf("un report senza avanzamento non deve aggiornare l'attività: %v", got)
+	}
+
+	infos := m.GetJobInfo()
+	if len(infos) != 1 || len(infos[0].RunningTasks) != 1 || infos[0].RunningTasks[0].WorkerID != "w1" {
+		t.Fatalf("avanzamento non esposto da GetJobInfo: %+v", infos)
+	}
+	workers := m.GetWorkers()
+	if len(workers) != 1 || len(workers[0].Progress) != 1 || workers[0].Progress[0].Percent != 20 {
+		t.Fatalf("avanzamento non esposto da GetWorkers: %+v", workers)
+	}
+
+	// Il completamento del task rimuove l'avanzamento del worker
+	m.untrackWorkerTask("w1", TaskKey{JobID: "job-a", ID: 0, Type: MapTask})
+	if _, ok := m.workerProgress["w1"]; ok {
+		t.Fatalf("avanzamento non rimosso al completamento")
+	}
+}
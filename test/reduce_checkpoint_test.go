@@ -79,3 +79,25 @@ func TestReduceResumeFromCheckpoint(t *testing.T) {
 		t.Fatalf("expected to find keys 'b' and 'c' in output, foundB=%v foundC=%v", foundB, foundC)
 	}
 }
+
+// TestReduceCheckpointFollowsJobOutput verifica che il checkpoint del reduce stia accanto
+// all'output del job e resti sul disco locale quando l'output è remoto
+func TestReduceCheckpointFollowsJobOutput(t *testing.T) {
+	baseDir := t.TempDir()
+	t.Setenv("TMP_PATH", baseDir)
+
+	outDir := filepath.Join(baseDir, "custom")
+	job := newJob(&JobSpec{JobID: "job-ck", InputFiles: []string{"a.txt"}, NReduce: 2, OutputDir: outDir})
+	if got, want := job.checkpointFileName(1), job.outputFileName(1)+".checkpoint.json"; got != want {
+		t.Fatalf("checkpoint %s, atteso %s", got, want)
+	}
+	task := job.newReduceTask(1, "")
+	if got := reduceCheckpointFileName(task.OutputDir, task.JobID, task.TaskID); got != job.checkpointFileName(1) {
+		t.Fatalf("checkpoint del worker %s diverso da quello del master %s", got, job.checkpointFileName(1))
+	}
+
+	remote := newJob(&JobSpec{JobID: "job-ck", InputFiles: []string{"a.txt"}, NReduce: 2, OutputDir: "s3://bucket/out"})
+	if got, want := remote.checkpointFileName(0), getOutputFileName("job-ck", 0)+".checkpoint.json"; got != want {
+		t.Fatalf("checkpoint con output remoto %s, atteso %s", got, want)
+	}
+}
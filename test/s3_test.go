@@ -0,0 +1,334 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeS3 è un server compatibile S3 minimale con indirizzamento path-style
+// (/bucket/key): PUT (anche copia), GET con Range, HEAD, DELETE e ListObjectsV2
+type fakeS3 struct {
+	mu       sync.Mutex
+	objects  map[string]*fakeObject // bucket/key
+	requests []*http.Request
+	failPut  string // chiave (bucket/key) il cui caricamento fallisce
+}
+
+// fakeObject è un oggetto con i metadati x-amz-meta-*; etag sostituisce l'MD5
+// del contenuto, per simulare gli oggetti caricati in più parti
+type fakeObject struct {
+	data []byte
+	meta map[string]string
+	etag string
+}
+
+func (o *fakeObject) ETag() string {
+	if o.etag != "" {
+		return o.etag
+	}
+	sum := md5.Sum(o.data)
+	return "\"" + hex.EncodeToString(sum[:]) + "\""
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *httptest.Server) {
+	f := &fakeS3{objects: make(map[string]*fakeObject)}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+// put memorizza un oggetto senza passare dal server
+func (f *fakeS3) put(name, content string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.objects[name] = &fakeObject{data: []byte(content)}
+}
+
+// get restituisce l'oggetto, nil se assente
+func (f *fakeS3) get(name string) *fakeObject {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.objects[name]
+}
+
+// countRequests conta le richieste ricevute con il metodo indicato
+func (f *fakeS3) countRequests(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, r := range f.requests {
+		if r.Method == method {
+			n++
+		}
+	}
+	return n
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r)
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	name := bucket + "/" + key
+
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		f.list(w, bucket, r.URL.Query().Get("prefix"))
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		source, _ := url.PathUnescape(strings.TrimPrefix(r.Header.Get("X-Amz-Copy-Source"), "/"))
+		obj, ok := f.objects[source]
+		if !ok {
+			notFound(w, r)
+			return
+		}
+		f.objects[name] = &fakeObject{data: obj.data, meta: obj.meta}
+		fmt.Fprintf(w, "<CopyObjectResult><ETag>%s</ETag></CopyObjectResult>", obj.ETag())
+	case r.Method == http.MethodPut && name == f.failPut:
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, "<Error><Code>AccessDenied</Code><Message>denied</Message></Error>")
+	case r.Method == http.MethodPut:
+		obj := &fakeObject{meta: make(map[string]string)}
+		obj.data, _ = io.ReadAll(r.Body)
+		for name := range r.Header {
+			if meta := strings.TrimPrefix(name, "X-Amz-Meta-"); meta != name {
+				obj.meta[meta] = r.Header.Get(name)
+			}
+		}
+		f.objects[name] = obj
+		w.Header().Set("ETag", obj.ETag())
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		obj, ok := f.objects[name]
+		if !ok {
+			notFound(w, r)
+			return
+		}
+		data := obj.data
+		w.Header().Set("ETag", obj.ETag())
+		for meta, value := range obj.meta {
+			w.Header().Set("X-Amz-Meta-"+meta, value)
+		}
+		status := http.StatusOK
+		if rng := r.Header.Get("Range"); rng != "" {
+			var start, end int
+			if n, _ := fmt.Sscanf(rng, "bytes=%d-%d", &start, &end); n < 2 || end >= len(data) {
+				end = len(data) - 1
+			}
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+			data, status = data[start:end+1], http.StatusPartialContent
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		w.WriteHeader(status)
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	case r.Method == http.MethodDelete:
+		delete(f.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func notFound(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotFound)
+	if r.Method != http.MethodHead {
+		io.WriteString(w, "<Error><Code>NoSuchKey</Code><Message>not found</Message></Error>")
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, bucket, prefix string) {
+	type content struct {
+		Key  string
+		Size int
+		ETag string
+	}
+	result := struct {
+		XMLName     xml.Name `xml:"ListBucketResult"`
+		Name        string
+		Prefix      string
+		KeyCount    int
+		IsTruncated bool
+		Contents    []content
+	}{Name: bucket, Prefix: prefix}
+	for name, obj := range f.objects {
+		if b, key, _ := strings.Cut(name, "/"); b == bucket && strings.HasPrefix(key, prefix) {
+			result.Contents = append(result.Contents, content{Key: key, Size: len(obj.data), ETag: obj.ETag()})
+		}
+	}
+	sort.Slice(result.Contents, func(i, j int) bool { return result.Contents[i].Key < result.Contents[j].Key })
+	result.KeyCount = len(result.Contents)
+	xml.NewEncoder(w).Encode(result)
+}
+
+// fakeS3Config restituisce la configurazione di un client verso il server di test
+func fakeS3Config(endpoint, bucket string) S3Config {
+	return S3Config{Bucket: bucket, Region: "eu-south-1", Enabled: true, Endpoint: endpoint, ForcePathStyle: true,
+		AccessKeyID: "AKIATEST", SecretAccessKey: "segreto", DisableSSL: true}
+}
+
+// TestS3ClientCustomEndpoint verifica che il client usi l'endpoint indicato, gli URL
+// path-style e le credenziali statiche
+func TestS3ClientCustomEndpoint(t *testing.T) {
+	fake, srv := newFakeS3(t)
+	client, err := NewS3Client(fakeS3Config(srv.URL, "locale"))
+	if err != nil {
+		t.Fatalf("NewS3Client: %v", err)
+	}
+	dir := t.TempDir()
+	src := filepath.Join(dir, "a.txt")
+	os.WriteFile(src, []byte("contenuto\n"), 0644)
+	if err := client.UploadFile(src, "dati/a.txt"); err != nil {
+		t.Fatalf("UploadFile: %v", err)
+	}
+	keys, err := client.ListFiles("dati/")
+	if err != nil || len(keys) != 1 || keys[0] != "dati/a.txt" {
+		t.Fatalf("ListFiles: %v %v", keys, err)
+	}
+	dst := filepath.Join(dir, "copia.txt")
+	if err := client.DownloadFile("dati/a.txt", dst); err != nil {
+		t.Fatalf("DownloadFile: %v", err)
+	}
+	if data, _ := os.ReadFile(dst); string(data) != "contenuto\n" {
+		t.Fatalf("contenuto scaricato inatteso: %q", data)
+	}
+	for _, r := range fake.requests {
+		if !strings.HasPrefix(r.URL.Path, "/locale") || !strings.Contains(r.Header.Get("Authorization"), "Credential=AKIATEST/") {
+			t.Fatalf("richiesta non path-style o senza credenziali statiche: %s %s", r.URL.Path, r.Header.Get("Authorization"))
+		}
+	}
+
+	config := fakeS3Config(srv.URL, "locale")
+	config.SecretAccessKey = ""
+	if _, err := NewS3Client(config); err == nil {
+		t.Fatalf("atteso errore per un'access key senza secret key")
+	}
+}
+
+// TestS3StorageFromEnv usa lo storage s3:// configurato dalle variabili d'ambiente
+// per espandere l'input, calcolare gli split con letture per intervalli e rinominare
+func TestS3StorageFromEnv(t *testing.T) {
+	fake, srv := newFakeS3(t)
+	t.Setenv("S3_ENDPOINT", srv.URL)
+	t.Setenv("S3_FORCE_PATH_STYLE", "true")
+	t.Setenv("S3_ACCESS_KEY_ID", "AKIATEST")
+	t.Setenv("S3_SECRET_ACCESS_KEY", "segreto")
+	t.Setenv("S3_DISABLE_SSL", "true")
+	content := strings.Repeat("riga di input\n", 30)
+	fake.put("ambiente/in/a.txt", content)
+	fake.put("ambiente/in/b.csv", "x,y\n")
+
+	files, err := resolveInputFiles([]string{"s3://ambiente/in/*.txt"})
+	if err != nil || len(files) != 1 || files[0] != "s3://ambiente/in/a.txt" {
+		t.Fatalf("espansione dell'input inattesa: %v %v", files, err)
+	}
+	splits, err := computeInputSplits(files, 100)
+	if err != nil || len(splits) < 3 {
+		t.Fatalf("attesi più split: %v %v", splits, err)
+	}
+	var all strings.Builder
+	for _, s := range splits {
+		part := readSplitLines(t, s)
+		if len(part) == 0 {
+			t.Fatalf("split %s vuoto", s)
+		}
+		all.Write(part)
+	}
+	if all.String() != content {
+		t.Fatalf("gli split non ricompongono il file")
+	}
+
+	st := storageFor("s3://ambiente/out/x")
+	if err := st.Rename("s3://ambiente/in/a.txt", "s3://ambiente/out/a.txt"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if _, err := st.Stat("s3://ambiente/in/a.txt"); !os.IsNotExist(err) {
+		t.Fatalf("originale ancora presente dopo il rename: %v", err)
+	}
+	if size, err := st.Stat("s3://ambiente/out/a.txt"); err != nil || size != int64(len(content)) {
+		t.Fatalf("Stat dopo il rename: %d %v", size, err)
+	}
+}
+
+// TestS3SyncDirectoryIncremental verifica che la sincronizzazione carichi solo i file
+// nuovi o modificati, anche a parità di dimensione, confronti i multipart tramite il
+// metadato MD5 e rimuova gli oggetti dei file eliminati in locale
+func TestS3SyncDirectoryIncremental(t *testing.T) {
+	fake, srv := newFakeS3(t)
+	config := fakeS3Config(srv.URL, "sync")
+	config.SyncWorkers = 2
+	config.SyncDelete = true
+	client, err := NewS3Client(config)
+	if err != nil {
+		t.Fatalf("NewS3Client: %v", err)
+	}
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "sub"), 0755)
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("alfa"), 0644)
+	os.WriteFile(filepath.Join(dir, "sub", "b.txt"), []byte("beta beta"), 0644)
+	os.WriteFile(filepath.Join(dir, "c.txt"), []byte("gamma"), 0644)
+	fake.put("sync/altro/x.txt", "fuori dal prefisso")
+
+	stats, err := client.SyncDirectoryStats(dir, "out/")
+	if err != nil || stats.Uploaded != 3 || stats.BytesUploaded != 18 || stats.Skipped != 0 {
+		t.Fatalf("prima sincronizzazione: %+v %v", stats, err)
+	}
+	if obj := fake.get("sync/out/sub/b.txt"); obj == nil || obj.meta["Md5"] != strings.Trim(obj.ETag(), "\"") {
+		t.Fatalf("metadato MD5 mancante sull'oggetto caricato: %+v", obj)
+	}
+
+	puts := fake.countRequests(http.MethodPut)
+	stats, err = client.SyncDirectoryStats(dir, "out/")
+	if err != nil || stats.Uploaded != 0 || stats.Skipped != 3 || stats.BytesSkipped != 18 || fake.countRequests(http.MethodPut) != puts {
+		t.Fatalf("i file invariati non devono essere ricaricati: %+v %v", stats, err)
+	}
+
+	// Stessa dimensione ma contenuto diverso; c.txt eliminato in locale
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("ALFA"), 0644)
+	os.Remove(filepath.Join(dir, "c.txt"))
+	stats, err = client.SyncDirectoryStats(dir, "out/")
+	if err != nil || stats.Uploaded != 1 || stats.Skipped != 1 || stats.Deleted != 1 {
+		t.Fatalf("sincronizzazione delle modifiche: %+v %v", stats, err)
+	}
+	if string(fake.get("sync/out/a.txt").data) != "ALFA" || fake.get("sync/out/c.txt") != nil || fake.get("sync/altro/x.txt") == nil {
+		t.Fatalf("stato remoto inatteso dopo la sincronizzazione")
+	}
+
+	// Un caricamento fallito annulla la rimozione degli oggetti eliminati in locale
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("alfa!"), 0644)
+	os.Remove(filepath.Join(dir, "sub", "b.txt"))
+	fake.mu.Lock()
+	fake.failPut = "sync/out/a.txt"
+	fake.mu.Unlock()
+	stats, err = client.SyncDirectoryStats(dir, "out/")
+	if err == nil || stats.Failed != 1 || stats.Deleted != 0 || fake.get("sync/out/sub/b.txt") == nil {
+		t.Fatalf("rimozione eseguita dopo un caricamento fallito: %+v %v", stats, err)
+	}
+	fake.mu.Lock()
+	fake.failPut = ""
+	fake.mu.Unlock()
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("ALFA"), 0644)
+	os.WriteFile(filepath.Join(dir, "sub", "b.txt"), []byte("beta beta"), 0644)
+
+	// Oggetto multipart: l'ETag non è l'MD5, fa fede il metadato
+	b := fake.get("sync/out/sub/b.txt")
+	b.etag = "\"0123456789abcdef-2\""
+	if stats, err = client.SyncDirectoryStats(dir, "out/"); err != nil || stats.Skipped != 2 {
+		t.Fatalf("multipart con metadato corretto non riconosciuto: %+v %v", stats, err)
+	}
+	b.meta["Md5"] = "diverso"
+	if stats, err = client.SyncDirectoryStats(dir, "out/"); err != nil || stats.Uploaded != 1 {
+		t.Fatalf("multipart con metadato diverso non ricaricato: %+v %v", stats, err)
+	}
+}
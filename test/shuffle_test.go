@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+// TestShuffleFetchAndLostOutput verifica che un reduce scarichi le partizioni servite da un
+// worker e che una partizione mancante venga segnalata come output perso
+func TestShuffleFetchAndLostOutput(t *testing.T) {
+	t.Setenv("TMP_PATH", t.TempDir())
+
+	addr, err := startShuffleServer(ShuffleConfig{Host: "localhost"})
+	if err != nil {
+		t.Fatalf("avvio server shuffle: %v", err)
+	}
+	partition := attemptFileName(getIntermediateFileName("job-a", 0, 1), "m0-1-x")
+	if err := os.WriteFile(partition, []byte(`{"Key":"a","Value":"1"}`+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	task := &Task{Type: ReduceTask, JobID: "job-a", TaskID: 1, NMap: 1, AttemptID: "r1-1-y",
+		MapOutputs: []MapOutput{{TaskID: 0, Addr: addr, AttemptID: "m0-1-x"}}}
+	inputs, fetched, err := gatherReduceInputs(task)
+	if err != nil {
+		t.Fatalf("download partizione: %v", err)
+	}
+	if len(inputs) != 1 || len(fetched) != 1 || inputs[0] != fetched[0] {
+		t.Fatalf("input inattesi: %v (scaricati %v)", inputs, fetched)
+	}
+	data, err := os.ReadFile(inputs[0])
+	if err != nil || string(data) != `{"Key":"a","Value":"1"}`+"\n" {
+		t.Fatalf("contenuto scaricato errato: %q, %v", data, err)
+	}
+
+	// Un tentativo di cui il worker non ha i file è un output perso
+	task.MapOutputs[0].AttemptID = "m0-2-z"
+	_, _, err = gatherReduceInputs(task)
+	var lost *mapOutputLostError
+	if !errors.As(err, &lost) || len(lost.Lost) != 1 || lost.Lost[0].TaskID != 0 {
+		t.Fatalf("atteso output perso per il map 0, ottenuto %v", err)
+	}
+}
+
+// TestApplyLostMapOutputs verifica che la perdita di un output riporti il map in coda, torni
+// alla fase map e sottragga i contatori del tentativo perso
+func TestApplyLostMapOutputs(t *testing.T) {
+	t.Setenv("TMP_PATH", t.TempDir())
+
+	m := &Master{}
+	applySubmit(t, m, &JobSpec{JobID: "job-a", InputFiles: []string{"a", "b"}, NReduce: 1})
+	job := m.jobs["job-a"]
+	for i := range job.MapTasks {
+		counters := TaskCounters{RecordsBeforeCombine: 10, RecordsAfterCombine: 5}
+		job.MapTasks[i] = TaskInfo{State: Completed, Committed: "m-x", Location: "w1:9000", Counters: &counters}
+		job.Counters.Add(counters)
+	}
+	job.MapTasksDone = 2
+	job.Phase = ReducePhase
+	job.ReduceTasks[0].State = InProgress
+	if outputs := job.newReduceTask(0, "").MapOutputs; len(outputs) != 2 || outputs[1].Addr != "w1:9000" {
+		t.Fatalf("posizioni degli output non passate al reduce: %+v", outputs)
+	}
+
+	lost := []MapOutput{{TaskID: 1, Addr: "w1:9000", AttemptID: "m-x"}, {TaskID: 0, Addr: "w2:9000", AttemptID: "m-x"}}
+	m.applyLostMapOutputs(job, LogCommand{JobID: "job-a", TaskID: 0, Lost: lost})
+
+	if job.MapTasks[1].State != Idle || job.MapTasks[1].Location != "" || job.MapTasks[0].State != Completed {
+		t.Fatalf("solo il map 1 doveva tornare Idle: %+v", job.MapTasks)
+	}
+	if job.Phase != MapPhase || job.MapTasksDone != 1 || job.ReduceTasks[0].State != Idle {
+		t.Fatalf("stato del job inatteso: fase %v, map completati %d, reduce %v", job.Phase, job.MapTasksDone, job.ReduceTasks[0].State)
+	}
+	if job.Counters.RecordsBeforeCombine != 10 || len(job.ReduceTasks[0].Failures) != 0 {
+		t.Fatalf("contatori %+v o fallimenti %v inattesi", job.Counters, job.ReduceTasks[0].Failures)
+	}
+}
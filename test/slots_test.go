@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestWorkerSlotLimit verifica che il master non assegni a un worker più task dei suoi slot
+// e che i task non più in esecuzione liberino lo slot
+func TestWorkerSlotLimit(t *testing.T) {
+	t.Setenv("TMP_PATH", t.TempDir())
+
+	m := &Master{
+		workers:       map[string]*WorkerInfo{"w1": {ID: "w1", LastSeen: time.Now()}},
+		workerToTasks: make(map[string]map[TaskKey]bool),
+	}
+	applySubmit(t, m, &JobSpec{JobID: "job-a", InputFiles: []string{"a", "b", "c"}, NReduce: 1})
+	job := m.jobs["job-a"]
+
+	m.advertiseWorkerSlots("w1", 2)
+	if !m.workerHasFreeSlot("w1", 0) {
+		t.Fatalf("un worker senza task deve avere slot liberi")
+	}
+	m.workerToTasks["w1"] = make(map[TaskKey]bool)
+	for i := 0; i < 2; i++ {
+		job.MapTasks[i] = TaskInfo{State: InProgress, StartTime: time.Now()}
+		m.workerToTasks["w1"][TaskKey{JobID: "job-a", ID: i, Type: MapTask}] = true
+	}
+	if m.workerHasFreeSlot("w1", 2) {
+		t.Fatalf("worker con 2 slot occupati non deve ricevere altri task")
+	}
+	if !m.workerHasFreeSlot("w1", 3) {
+		t.Fatalf("il numero di slot dichiarato nella richiesta deve avere precedenza")
+	}
+
+	// Un task resettato dal timeout non occupa più lo slot
+	job.MapTasks[1].State = Idle
+	if !m.workerHasFreeSlot("w1", 2) {
+		t.Fatalf("lo slot del task resettato deve tornare libero")
+	}
+	if n := len(m.workerToTasks["w1"]); n != 1 {
+		t.Fatalf("attesi 1 task in carico al worker, trovati %d", n)
+	}
+
+	// Senza slot dichiarati il worker ne ha uno solo
+	if got := m.workerSlotLimit("w2", 0); got != 1 {
+		t.Fatalf("slot di default attesi 1, trovati %d", got)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// TestMarkSpeculativeTasks verifica che solo i task molto più lenti della mediana, verso la
+// fine della fase, diventino candidati a un unico backup su un worker diverso
+func TestMarkSpeculativeTasks(t *testing.T) {
+	t.Setenv("TMP_PATH", t.TempDir())
+
+	m := &Master{workerToTasks: make(map[string]map[TaskKey]bool)}
+	applySubmit(t, m, &JobSpec{JobID: "job-a", InputFiles: []string{"a", "b", "c", "d", "e"}, NReduce: 1})
+	job := m.jobs["job-a"]
+
+	now := time.Now()
+	for i := 0; i < 4; i++ {
+		job.MapTasks[i] = TaskInfo{State: Completed, Duration: time.Duration(i+1) * time.Second}
+	}
+	job.MapTasks[4] = TaskInfo{State: InProgress, StartTime: now.Add(-4 * time.Second)}
+	if median := medianTaskDuration(job.MapTasks); median != 2500*time.Millisecond {
+		t.Fatalf("mediana attesa 2.5s, ottenuta %v", median)
+	}
+
+	// 4s non supera 2 volte la mediana: nessun backup
+	m.markSpeculativeTasks(job, now)
+	key := TaskKey{JobID: "job-a", ID: 4, Type: MapTask}
+	if m.takeBackupSlot(key, "w2") {
+		t.Fatalf("backup non atteso per un task entro la soglia")
+	}
+
+	job.MapTasks[4].StartTime = now.Add(-10 * time.Second)
+	m.workerToTasks["w1"] = map[TaskKey]bool{key: true}
+	m.markSpeculativeTasks(job, now)
+	if m.takeBackupSlot(key, "w1") {
+		t.Fatalf("il backup non deve andare al worker che esegue già il task")
+	}
+	if !m.takeBackupSlot(key, "w2") {
+		t.Fatalf("backup atteso per il task lento")
+	}
+
+	// Un solo backup per task
+	m.speculative[key] = "m4-2-backup"
+	if m.takeBackupSlot(key, "w3") {
+		t.Fatalf("il task ha già un backup in corso")
+	}
+	m.resolveSpeculation(key, "m4-2-backup")
+	if _, ok := m.speculative[key]; ok {
+		t.Fatalf("la speculazione deve essere chiusa al commit")
+	}
+}
+
+// TestBackupFailureKeepsPrimary verifica che il fallimento del backup chiuda solo la
+// speculazione e che i fallimenti dei tentativi obsoleti non vengano registrati
+func TestBackupFailureKeepsPrimary(t *testing.T) {
+	t.Setenv("TMP_PATH", t.TempDir())
+
+	m := &Master{workerToTasks: make(map[string]map[TaskKey]bool)}
+	applySubmit(t, m, &JobSpec{JobID: "job-b", InputFiles: []string{"a", "b"}, NReduce: 1})
+	job := m.jobs["job-b"]
+	key := TaskKey{JobID: "job-b", ID: 1, Type: MapTask}
+	job.MapTasks[1] = TaskInfo{State: InProgress, StartTime: time.Now(), Attempts: 3, AttemptID: "m1-2", BackupID: "m1-3"}
+	m.speculative = map[TaskKey]string{key: "m1-3"}
+	m.workerToTasks["w1"] = map[TaskKey]bool{key: true}
+	m.workerToTasks["w2"] = map[TaskKey]bool{key: true}
+
+	// Fallisce il backup mentre il primario è in corso
+	if !m.absorbTaskFailure(key, &job.MapTasks[1], "m1-3", "w2") {
+		t.Fatalf("il fallimento del backup non deve essere replicato")
+	}
+	task := job.MapTasks[1]
+	if task.State != InProgress || task.AttemptID != "m1-2" || task.BackupID != "" || len(task.Failures) != 0 {
+		t.Fatalf("il primario deve restare in corso senza fallimenti: %+v", task)
+	}
+	if _, ok := m.speculative[key]; ok || m.workerToTasks["w2"][key] || !m.workerToTasks["w1"][key] {
+		t.Fatalf("atteso solo il backup rilasciato: speculative=%v workerToTasks=%v", m.speculative, m.workerToTasks)
+	}
+
+	// Un tentativo precedente non è più in carico: il fallimento è ignorato
+	if !m.absorbTaskFailure(key, &job.MapTasks[1], "m1-1", "w3") {
+		t.Fatalf("il fallimento di un tentativo obsoleto non deve essere replicato")
+	}
+
+	// Il fallimento del primario va registrato con Raft
+	if m.absorbTaskFailure(key, &job.MapTasks[1], "m1-2", "w1") {
+		t.Fatalf("il fallimento del primario deve essere replicato")
+	}
+	data, err := json.Marshal(LogCommand{Operation: "fail-map", JobID: "job-b", TaskID: 1,
+		Failure: &TaskFailure{Attempt: 2, AttemptID: "m1-2", WorkerID: "w1", Error: "errore di lettura"}})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	m.Apply(&raft.Log{Data: data})
+	if task := job.MapTasks[1]; task.State != Idle || len(task.Failures) != 1 {
+		t.Fatalf("fallimento del primario non registrato: %+v", task)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestComputeInputSplitsLineAligned verifica che gli split coprano tutto il file
+// senza sovrapposizioni e che ogni split inizi a inizio riga
+func TestComputeInputSplitsLineAligned(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input.txt")
+	var sb strings.Builder
+	for i := 0; i < 200; i++ {
+		sb.WriteString(strings.Repeat("parola ", i%7+1))
+		sb.WriteString("\n")
+	}
+	data := []byte(sb.String())
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	splits, err := computeInputSplits([]string{path}, 100)
+	if err != nil {
+		t.Fatalf("computeInputSplits: %v", err)
+	}
+	if len(splits) < 2 {
+		t.Fatalf("attesi più split, ottenuti %d", len(splits))
+	}
+
+	var joined []byte
+	for _, s := range splits {
+		if s.Offset > 0 && data[s.Offset-1] != '\n' {
+			t.Errorf("split %s non inizia a inizio riga", s)
+		}
+		joined = append(joined, readSplitLines(t, s)...)
+	}
+	if !bytes.Equal(joined, data) {
+		t.Fatalf("la concatenazione degli split non corrisponde al file (%d vs %d byte)", len(joined), len(data))
+	}
+
+	// Un file più piccolo dello split resta intero
+	whole, err := computeInputSplits([]string{path}, int64(len(data)))
+	if err != nil || len(whole) != 1 || whole[0].Length != 0 {
+		t.Fatalf("atteso un unico split intero, ottenuto %v (err %v)", whole, err)
+	}
+}
+
+// readSplitLines legge lo split con il formato lines, come il map task, e ricompone le
+// righe lette; il primo record deve iniziare all'offset dello split
+func readSplitLines(t *testing.T, split InputSplit) []byte {
+	t.Helper()
+	format, err := LookupInputFormat(InputFormatLines)
+	if err != nil {
+		t.Fatalf("LookupInputFormat: %v", err)
+	}
+	reader, err := format.Open(split)
+	if err != nil {
+		t.Fatalf("Open %s: %v", split, err)
+	}
+	defer reader.Close()
+	var buf bytes.Buffer
+	for {
+		rec, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next %s: %v", split, err)
+		}
+		if buf.Len() == 0 && rec.Offset != split.Offset {
+			t.Fatalf("split %s: primo record all'offset %d", split, rec.Offset)
+		}
+		buf.WriteString(rec.Value)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
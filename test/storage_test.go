@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/raft"
+)
+
+// writeStorageFile scrive un file attraverso lo storage del percorso
+func writeStorageFile(t *testing.T, name, content string) {
+	t.Helper()
+	w, err := storageFor(name).Create(name)
+	if err != nil {
+		t.Fatalf("Create %s: %v", name, err)
+	}
+	io.WriteString(w, content)
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close %s: %v", name, err)
+	}
+}
+
+// TestJobOnRemoteStorage esegue un job con input e output sullo storage in memoria:
+// i pattern di input vengono espansi, gli split calcolati leggendo per intervalli, gli
+// output dei reduce promossi e validati dal master senza passare dal disco locale
+func TestJobOnRemoteStorage(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMP_PATH", dir)
+	writeStorageFile(t, "mem://dati/in/a.txt", strings.Repeat("alfa beta\n", 40))
+	writeStorageFile(t, "mem://dati/in/b.txt", "gamma alfa\n")
+	writeStorageFile(t, "mem://dati/in/note.md", "ignorato\n")
+
+	files, err := resolveInputFiles([]string{"mem://dati/in/*.txt"})
+	if err != nil || len(files) != 2 || files[0] != "mem://dati/in/a.txt" {
+		t.Fatalf("espansione dell'input inattesa: %v %v", files, err)
+	}
+	if _, err := resolveInputFiles([]string{"mem://dati/in/manca.txt"}); err == nil {
+		t.Fatalf("atteso errore per un input inesistente")
+	}
+	splits, err := computeInputSplits(files, 128)
+	if err != nil || len(splits) < 4 {
+		t.Fatalf("attesi più split: %v %v", splits, err)
+	}
+
+	m := &Master{}
+	applySubmit(t, m, &JobSpec{JobID: "job-s", InputFiles: files, Splits: splits, NReduce: 2, OutputDir: "mem://dati/out/"})
+	job := m.jobs["job-s"]
+	for i := range splits {
+		if _, err := executeMapTask(job.newMapTask(i), Map, nil); err != nil {
+			t.Fatalf("executeMapTask %d: %v", i, err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		task := job.newReduceTask(i, "")
+		task.AttemptID = "r1"
+		result, err := executeReduceTask(task, Reduce)
+		if err != nil {
+			t.Fatalf("executeReduceTask %d: %v", i, err)
+		}
+		if !m.validateReduceAttemptOutput(job, i, "r1", result.Files) {
+			t.Fatalf("output del reduce %d rifiutato", i)
+		}
+		files := taskOutputFiles(job.ID, ReduceTask, i, job.NReduce, job.OutputDir)
+		if err := promoteAttemptFiles(files, "r1"); err != nil {
+			t.Fatalf("promoteAttemptFiles: %v", err)
+		}
+		job.ReduceTasks[i].Files = result.Files
+		if !m.isReduceTaskCompleted(job, i) || !m.validateReduceTaskOutput(job, i) {
+			t.Fatalf("output promosso del reduce %d non valido", i)
+		}
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "mr-out-*")); len(matches) != 0 {
+		t.Fatalf("output scritti sul disco locale: %v", matches)
+	}
+
+	// Con output remoto il file unificato viene scritto nella directory del job
+	m.copyOutputFilesToLocal(job)
+	r, err := openStorageFile("mem://dati/out/" + job.unifiedOutputName())
+	if err != nil {
+		t.Fatalf("output unificato mancante: %v", err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	counts := make(map[string]string)
+	for _, line := range lines {
+		if k, v, ok := strings.Cut(line, " "); ok {
+			counts[k] = v
+		}
+	}
+	if len(lines) != 3 || counts["alfa"] != "41" || counts["beta"] != "40" || counts["gamma"] != "1" {
+		t.Fatalf("output unificato inatteso: %q", data)
+	}
+
+	m.cleanupJobFiles(job)
+	if _, err := storageFor(job.outputFileName(0)).Stat(job.outputFileName(0)); !os.IsNotExist(err) {
+		t.Fatalf("output del job non rimosso: %v", err)
+	}
+}
+
+// TestApplyQueuesOutputEffects verifica che il completamento di un job applicato dall'FSM
+// non tocchi lo storage degli output: le operazioni vengono accodate ed eseguite dopo
+func TestApplyQueuesOutputEffects(t *testing.T) {
+	t.Setenv("TMP_PATH", t.TempDir())
+
+	m := &Master{}
+	applySubmit(t, m, &JobSpec{JobID: "job-e", InputFiles: []string{"a.txt"}, NReduce: 1, OutputDir: "mem://effetti/out/"})
+	applySubmit(t, m, &JobSpec{JobID: "job-f", InputFiles: []string{"b.txt"}, NReduce: 1, OutputDir: "mem://effetti/out/"})
+	job := m.jobs["job-e"]
+	writeStorageFile(t, job.outputFileName(0), "alfa 1\n")
+	for _, op := range []string{"complete-map", "complete-reduce"} {
+		data, _ := json.Marshal(LogCommand{Operation: op, JobID: "job-e", TaskID: 0})
+		m.Apply(&raft.Log{Data: data})
+	}
+	if !job.IsDone() {
+		t.Fatalf("job-e dovrebbe essere completato")
+	}
+
+	unified := joinStoragePath(job.OutputDir, job.unifiedOutputName())
+	if _, err := storageFor(unified).Stat(unified); !os.IsNotExist(err) {
+		t.Fatalf("file unificato scritto da Apply: %v", err)
+	}
+	// Attivazione di job-e alla sottomissione, completamento di job-e, attivazione di job-f
+	var queued []string
+	for _, effect := range m.outputEffects {
+		queued = append(queued, fmt.Sprintf("%d:%s", effect.kind, effect.job.ID))
+	}
+	want := fmt.Sprintf("%d:job-e %d:job-e %d:job-f", outputCleanup, outputPublish, outputCleanup)
+	if strings.Join(queued, " ") != want {
+		t.Fatalf("operazioni accodate %v, attese %s", queued, want)
+	}
+
+	// La pulizia accodata all'attivazione di job-e, eseguita dopo il suo completamento,
+	// non rimuove gli output ormai definitivi
+	for i := range m.outputEffects {
+		m.runOutputEffect(&m.outputEffects[i])
+	}
+	if _, err := storageFor(unified).Stat(unified); err != nil {
+		t.Fatalf("file unificato non creato: %v", err)
+	}
+	if _, err := storageFor(job.outputFileName(0)).Stat(job.outputFileName(0)); err != nil {
+		t.Fatalf("output di job-e rimosso: %v", err)
+	}
+}
+
+// TestPublishedJobsNotRepublished verifica che il marcatore publish-job replicato eviti
+// di ripubblicare un job e che un nuovo leader accodi solo i job completati non pubblicati
+func TestPublishedJobsNotRepublished(t *testing.T) {
+	t.Setenv("TMP_PATH", t.TempDir())
+
+	m := &Master{}
+	for _, id := range []string{"job-g", "job-h"} {
+		applySubmit(t, m, &JobSpec{JobID: id, InputFiles: []string{"a.txt"}, NReduce: 1, OutputDir: "mem://pubblicati/" + id + "/"})
+		writeStorageFile(t, m.jobs[id].outputFileName(0), "alfa 1\n")
+		for _, op := range []string{"complete-map", "complete-reduce"} {
+			data, _ := json.Marshal(LogCommand{Operation: op, JobID: id, TaskID: 0})
+			m.Apply(&raft.Log{Data: data})
+		}
+	}
+	data, _ := json.Marshal(LogCommand{Operation: "publish-job", JobID: "job-g"})
+	m.Apply(&raft.Log{Data: data})
+	if !m.jobs["job-g"].Published || m.jobs["job-h"].Published {
+		t.Fatalf("marcatore di pubblicazione applicato al job sbagliato")
+	}
+
+	// Nuovo leader: solo job-h resta da pubblicare
+	m.outputEffects = nil
+	m.publishPendingJobs()
+	if len(m.outputEffects) != 1 || m.outputEffects[0].kind != outputPublish || m.outputEffects[0].job.ID != "job-h" {
+		t.Fatalf("operazioni accodate inattese: %+v", m.outputEffects)
+	}
+
+	// La pubblicazione rieseguita dal log per job-g viene saltata
+	jobG := m.jobs["job-g"]
+	m.runOutputEffect(&outputEffect{kind: outputPublish, job: *jobG})
+	unified := joinStoragePath(jobG.OutputDir, jobG.unifiedOutputName())
+	if _, err := storageFor(unified).Stat(unified); !os.IsNotExist(err) {
+		t.Fatalf("job già pubblicato ripubblicato: %v", err)
+	}
+	jobH := m.jobs["job-h"]
+	m.runOutputEffect(&m.outputEffects[0])
+	unified = joinStoragePath(jobH.OutputDir, jobH.unifiedOutputName())
+	if _, err := storageFor(unified).Stat(unified); err != nil {
+		t.Fatalf("file unificato di job-h non creato: %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestStreamingWordCount esegue un wordcount con mapper e reducer esterni (sh e awk)
+// e verifica che uscita non zero e timeout vengano riportati come errori del task
+func TestStreamingWordCount(t *testing.T) {
+	if _, err := exec.LookPath("awk"); err != nil {
+		t.Skip("awk non disponibile")
+	}
+	dir := t.TempDir()
+	t.Setenv("TMP_PATH", dir)
+	input := filepath.Join(dir, "input.txt")
+	if err := os.WriteFile(input, []byte("alfa beta\nbeta gamma beta\n"), 0644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	params := map[string]string{
+		"mapper":  `tr -s ' ' '\n' | awk 'NF { print $1 "\t1" }'`,
+		"reducer": `awk -F'\t' '{ s[$1] += $2 } END { for (k in s) print k "\t" s[k] }'`,
+	}
+	if _, _, err := BuildAppFuncs("streaming", map[string]string{"mapper": "cat"}); err == nil {
+		t.Fatalf("atteso errore per reducer mancante")
+	}
+
+	failure := &appFailure{}
+	ctx := AppContext{failure: failure}
+	mapTask := &Task{Type: MapTask, TaskID: 0, Input: input, NReduce: 1, App: "streaming", AppParams: params}
+	funcs, err := resolveTaskFuncs(mapTask, ctx, nil, nil)
+	if err != nil {
+		t.Fatalf("resolveTaskFuncs: %v", err)
+	}
+	if _, err := executeMapTask(mapTask, funcs.Map, nil); err != nil || failure.Err() != nil {
+		t.Fatalf("map streaming: %v %v", err, failure.Err())
+	}
+
+	reduceTask := &Task{Type: ReduceTask, TaskID: 0, NMap: 1, App: "streaming", AppParams: params}
+	funcs, err = resolveTaskFuncs(reduceTask, ctx, nil, nil)
+	if err != nil || funcs.StreamReduce == nil {
+		t.Fatalf("reduce streaming non risolto: %v", err)
+	}
+	result, err := executeTask(reduceTask, funcs)
+	if err != nil {
+		t.Fatalf("reduce streaming: %v", err)
+	}
+	data, err := os.ReadFile(getOutputFileName("", 0))
+	if err != nil {
+		t.Fatalf("output: %v", err)
+	}
+	counts := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		counts[key] = value
+	}
+	if counts["alfa"] != "1" || counts["beta"] != "3" || counts["gamma"] != "1" || len(counts) != 3 {
+		t.Fatalf("output inatteso: %q", data)
+	}
+	if len(result.Files) != 1 || result.Files[0].Records != 3 {
+		t.Fatalf("checksum dell'output inatteso: %+v", result.Files)
+	}
+
+	// Uscita non zero: l'errore riporta l'ultima riga di stderr
+	failing := AppContext{Params: map[string]string{"mapper": "echo guasto >&2; exit 3"}, failure: &appFailure{}}
+	mapf, err := newStreamingMap(failing)
+	if err != nil {
+		t.Fatalf("newStreamingMap: %v", err)
+	}
+	mapf(input, "riga\n")
+	if err := failing.failure.Err(); err == nil || !strings.Contains(err.Error(), "guasto") {
+		t.Fatalf("atteso errore con lo stderr del mapper, ottenuto %v", err)
+	}
+
+	// Timeout del processo
+	slow := AppContext{Params: map[string]string{"mapper": "exec sleep 5", "timeout": "100ms"}, failure: &appFailure{}}
+	mapf, _ = newStreamingMap(slow)
+	mapf(input, "")
+	if err := slow.failure.Err(); err == nil || !strings.Contains(err.Error(), "timeout") {
+		t.Fatalf("atteso errore di timeout, ottenuto %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/hashicorp/raft"
+)
+
+// applySubmit applica un comando submit-job all'FSM del master
+func applySubmit(t *testing.T, m *Master, spec *JobSpec) {
+	t.Helper()
+	data, err := json.Marshal(LogCommand{Operation: "submit-job", Job: spec})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	m.Apply(&raft.Log{Data: data})
+}
+
+// TestSubmitJobAppliedAndSnapshotted verifica che il comando submit-job venga
+// applicato dall'FSM e sopravviva a un ciclo Snapshot/Restore
+func TestSubmitJobAppliedAndSnapshotted(t *testing.T) {
+	t.Setenv("TMP_PATH", t.TempDir())
+
+	m := &Master{}
+	applySubmit(t, m, &JobSpec{JobID: "job-42", InputFiles: []string{"a.txt", "b.txt"}, NReduce: 3})
+
+	job := m.jobs["job-42"]
+	if job == nil || len(job.MapTasks) != 2 || len(job.ReduceTasks) != 3 || job.Phase != MapPhase {
+		t.Fatalf("submit-job non applicato: job=%+v", job)
+	}
+	if m.activeJob() != job {
+		t.Fatalf("job-42 dovrebbe essere il job attivo")
+	}
+
+	snap, err := m.Snapshot()
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	restored := &Master{}
+	if err := restored.Restore(io.NopCloser(bytes.NewReader(snap.(*memorySnapshot).data))); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	rj := restored.jobs["job-42"]
+	if rj == nil || len(rj.InputFiles) != 2 || rj.NReduce != 3 || len(restored.jobQueue) != 1 {
+		t.Fatalf("stato ripristinato errato: job=%+v queue=%v", rj, restored.jobQueue)
+	}
+}
+
+// TestSubmitJobQueueFIFO verifica che i job vengano accodati in ordine,
+// che i duplicati siano ignorati e che il job successivo parta al termine del precedente
+func TestSubmitJobQueueFIFO(t *testing.T) {
+	t.Setenv("TMP_PATH", t.TempDir())
+
+	m := &Master{}
+	applySubmit(t, m, &JobSpec{JobID: "job-a", InputFiles: []string{"a.txt"}, NReduce: 1})
+	applySubmit(t, m, &JobSpec{JobID: "job-b", InputFiles: []string{"b.txt", "c.txt"}, NReduce: 2})
+	applySubmit(t, m, &JobSpec{JobID: "job-a", InputFiles: []string{"x.txt"}, NReduce: 5})
+
+	if len(m.jobQueue) != 2 || m.jobQueue[0] != "job-a" || m.jobQueue[1] != "job-b" {
+		t.Fatalf("coda errata: %v", m.jobQueue)
+	}
+	if m.jobs["job-a"].NReduce != 1 {
+		t.Fatalf("il duplicato non deve sovrascrivere job-a")
+	}
+	if active := m.activeJob(); active == nil || active.ID != "job-a" {
+		t.Fatalf("job attivo atteso job-a, trovato %+v", active)
+	}
+
+	// Completa job-a: map e reduce
+	for _, op := range []string{"complete-map", "complete-reduce"} {
+		data, _ := json.Marshal(LogCommand{Operation: op, JobID: "job-a", TaskID: 0})
+		m.Apply(&raft.Log{Data: data})
+	}
+
+	if !m.jobs["job-a"].IsDone() {
+		t.Fatalf("job-a dovrebbe essere completato, fase %v", m.jobs["job-a"].Phase)
+	}
+	if active := m.activeJob(); active == nil || active.ID != "job-b" {
+		t.Fatalf("job attivo atteso job-b, trovato %+v", active)
+	}
+	if m.Done() {
+		t.Fatalf("il master non deve risultare completato con job-b in coda")
+	}
+}
+
+// TestFinishedJobsPruned verifica che lo stato conservi solo gli ultimi MaxRetainedJobs
+// job terminati, così che gli snapshot si riducano, senza toccare i job ancora in coda
+func TestFinishedJobsPruned(t *testing.T) {
+	t.Setenv("TMP_PATH", t.TempDir())
+
+	m := &Master{}
+	total := MaxRetainedJobs + 10
+	for i := 0; i < total; i++ {
+		applySubmit(t, m, &JobSpec{JobID: fmt.Sprintf("job-%03d", i), InputFiles: []string{"a.txt"}, NReduce: 1})
+	}
+	full, err := m.Snapshot()
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+
+	for i := 0; i < total-1; i++ {
+		applyJobCommand(t, m, "cancel-job", fmt.Sprintf("job-%03d", i))
+	}
+	if len(m.jobs) != MaxRetainedJobs+1 || len(m.jobQueue) != MaxRetainedJobs+1 {
+		t.Fatalf("attesi %d job in stato, trovati %d (coda %d)", MaxRetainedJobs+1, len(m.jobs), len(m.jobQueue))
+	}
+	if m.jobs["job-000"] != nil || m.jobs["job-008"] != nil || m.jobs["job-009"] == nil {
+		t.Fatalf("devono essere rimossi i job terminati più vecchi: coda %v", m.jobQueue)
+	}
+	last := fmt.Sprintf("job-%03d", total-1)
+	if active := m.activeJob(); active == nil || active.ID != last {
+		t.Fatalf("il job in coda non deve essere rimosso, attivo %+v", active)
+	}
+
+	pruned, err := m.Snapshot()
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	if len(pruned.(*memorySnapshot).data) >= len(full.(*memorySnapshot).data) {
+		t.Fatalf("lo snapshot non si è ridotto: %d byte, prima %d", len(pruned.(*memorySnapshot).data), len(full.(*memorySnapshot).data))
+	}
+	restored := &Master{}
+	if err := restored.Restore(io.NopCloser(bytes.NewReader(pruned.(*memorySnapshot).data))); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if len(restored.jobQueue) != MaxRetainedJobs+1 {
+		t.Fatalf("attesi %d job dopo il restore, trovati %d", MaxRetainedJobs+1, len(restored.jobQueue))
+	}
+}
+
+// TestQueuedJobsKeepSeparateOutputs verifica che gli output dei reduce e il file unificato
+// siano distinti per job e che la pulizia all'attivazione di un job non tocchi gli altri
+func TestQueuedJobsKeepSeparateOutputs(t *testing.T) {
+	t.Setenv("TMP_PATH", t.TempDir())
+
+	m := &Master{}
+	applySubmit(t, m, &JobSpec{JobID: "job-a", InputFiles: []string{"a.txt"}, NReduce: 1})
+	applySubmit(t, m, &JobSpec{JobID: "job-b", InputFiles: []string{"b.txt"}, NReduce: 1})
+	jobA, jobB := m.jobs["job-a"], m.jobs["job-b"]
+	if jobA.outputFileName(0) == jobB.outputFileName(0) || jobA.unifiedOutputName() == jobB.unifiedOutputName() {
+		t.Fatalf("output non distinti per job: %s, %s", jobA.outputFileName(0), jobA.unifiedOutputName())
+	}
+
+	for _, name := range []string{jobA.outputFileName(0), jobB.outputFileName(0), jobB.outputFileName(0) + ".partial"} {
+		if err := os.WriteFile(name, []byte("k 1\n"), 0644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	m.cleanupOutputFiles(jobB)
+	if _, err := os.Stat(jobA.outputFileName(0)); err != nil {
+		t.Fatalf("output di job-a rimosso attivando job-b: %v", err)
+	}
+	for _, name := range []string{jobB.outputFileName(0), jobB.outputFileName(0) + ".partial"} {
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Fatalf("output residuo di job-b non rimosso: %s", name)
+		}
+	}
+}
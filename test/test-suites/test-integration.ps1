@@ -107,7 +107,7 @@ function Test-CompletePipeline {
             Add-TestResult -TestName "Integration-OutputFiles" -Success $true -Message "Found $($outputFiles.Count) output files"
             
             # Check final output
-            $finalOutput = Join-Path $outputDir "final-output.txt"
+            $finalOutput = Join-Path $outputDir "final-output-main-job.txt"
             if (Test-Path $finalOutput) {
                 $content = Get-Content $finalOutput -Raw
                 if ($content -and $content.Length -gt 0) {